@@ -1,46 +1,374 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/vincentvignali/yamsAttackSocket/internal/api"
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
+	"github.com/vincentvignali/yamsAttackSocket/internal/config"
 	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/leaderboard"
+	"github.com/vincentvignali/yamsAttackSocket/internal/lobby"
 	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+	"github.com/vincentvignali/yamsAttackSocket/internal/profile"
+	"github.com/vincentvignali/yamsAttackSocket/internal/tournament"
+	"github.com/vincentvignali/yamsAttackSocket/internal/tracing"
+	"github.com/vincentvignali/yamsAttackSocket/internal/webhook"
 	"github.com/vincentvignali/yamsAttackSocket/internal/websocket"
 )
 
+// getenv reads the environment, defaulting the instance ID to the Fly.io machine ID.
+func getenv(key string) string {
+	value := os.Getenv(key)
+	if key == "INSTANCE_ID" && value == "" {
+		return os.Getenv("FLY_MACHINE_ID")
+	}
+	return value
+}
+
 func main() {
-	gameManager := game.NewGameManager()
+	cfg, opts, err := config.Load(os.Args[1:], getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logger.Error.Printf("Cannot load configuration: %v", err)
+		os.Exit(2)
+	}
+	if opts.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			logger.Error.Printf("Cannot print configuration: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if opts.ConfigFile != "" {
+		logger.System.Printf("Configuration loaded from %s", opts.ConfigFile)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		FilePath:    cfg.Tracing.File,
+		ServiceName: "yamsAttackSocket",
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		logger.Error.Printf("Cannot initialize tracing: %v", err)
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error.Printf("Cannot flush traces: %v", err)
+		}
+	}()
+
+	var broadcaster broadcast.Broadcaster = broadcast.NewLocal()
+	var redisBroadcaster *broadcast.Redis
+	if cfg.Broadcast.Backend == "redis" {
+		redisConfig, err := broadcast.ParseRedisURL(cfg.Broadcast.RedisURL)
+		if err != nil {
+			logger.Error.Printf("Invalid Redis URL: %v", err)
+			os.Exit(2)
+		}
+		// Retained states live as long as an idle game
+		redisConfig.SnapshotTTL = cfg.Game.InactivityTimeout
+		redisBroadcaster, err = broadcast.NewRedis(context.Background(), redisConfig)
+		if err != nil {
+			logger.Error.Printf("Cannot connect to the Redis broadcast backend: %v", err)
+			os.Exit(1)
+		}
+		broadcaster = redisBroadcaster
+	}
+	defer broadcaster.Close()
+
+	gameManager := game.NewGameManagerWithConfig(game.Config{
+		InactivityTimeout:       cfg.Game.InactivityTimeout,
+		CleanupInterval:         cfg.Game.CleanupInterval,
+		MaxLifetime:             cfg.Game.MaxLifetime,
+		ExpiryWarning:           cfg.Game.ExpiryWarning,
+		ShardCount:              cfg.Game.Shards,
+		ResultRetention:         cfg.Game.ResultRetention,
+		PausedInactivityTimeout: cfg.Game.PausedInactivityTimeout,
+		HostGracePeriod:         cfg.Game.HostGracePeriod,
+		DuplicateHostPolicy:     game.DuplicateHostPolicy(cfg.Game.DuplicateHostPolicy),
+		Broadcaster:             broadcaster,
+		InstanceID:              cfg.Routing.InstanceID,
+	})
 	
-	gameHandler := api.NewGameHTTPHandler(gameManager)
-	wsHandler := websocket.NewGameWSHandler(gameManager)
+	// Every instance records the results of the games ended on any instance
+	board := leaderboard.New()
+	defer board.Close()
+	profiles := profile.New()
+	resultsCtx, stopResults := context.WithCancel(context.Background())
+	defer stopResults()
+	if err := board.Listen(resultsCtx, broadcaster); err != nil {
+		logger.Error.Printf("Cannot subscribe to the game results: %v", err)
+		os.Exit(1)
+	}
+	if err := profiles.Listen(resultsCtx, broadcaster); err != nil {
+		logger.Error.Printf("Cannot subscribe to the game results: %v", err)
+		os.Exit(1)
+	}
 	
-	mux := http.NewServeMux()
+	tournaments := tournament.NewManager(gameManager)
+	defer tournaments.Close()
+	lobbyConfig := lobby.DefaultConfig()
+	lobbyConfig.QueueTimeout = cfg.Lobby.QueueTimeout
+	lobbyConfig.RatingRange = cfg.Lobby.RatingRange
+	lobbyConfig.RatingRangeGrowth = cfg.Lobby.RatingRangeGrowth
+	matchmaking := lobby.NewWithConfig(gameManager, lobbyConfig)
+	defer matchmaking.Close()
+	
+	var dispatcher *webhook.Dispatcher
+	if len(cfg.Webhook.URLs) > 0 {
+		webhookConfig := webhook.Config{
+			URLs:        cfg.Webhook.URLs,
+			Secret:      cfg.Webhook.Secret,
+			MaxAttempts: cfg.Webhook.MaxAttempts,
+			Timeout:     cfg.Webhook.Timeout,
+		}
+		for _, event := range cfg.Webhook.Events {
+			webhookConfig.Events = append(webhookConfig.Events, game.EventType(event))
+		}
+		var deadLetters *os.File
+		if cfg.Webhook.DeadLetterFile != "" {
+			deadLetters, err = os.OpenFile(cfg.Webhook.DeadLetterFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+			if err != nil {
+				logger.Error.Printf("Cannot open the webhook dead-letter file: %v", err)
+				os.Exit(1)
+			}
+			webhookConfig.DeadLetter = deadLetters
+		}
+		dispatcher, err = webhook.NewDispatcher(webhookConfig)
+		if err != nil {
+			logger.Error.Printf("Invalid webhook configuration: %v", err)
+			os.Exit(2)
+		}
+		// Deliveries still queued at shutdown get the shutdown timeout to complete; the
+		// dead-letter file is closed once the workers have stopped writing to it
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+			defer cancel()
+			if err := dispatcher.Close(ctx); err != nil {
+				logger.Error.Printf("Webhook deliveries interrupted: %v", err)
+			}
+			if deadLetters != nil {
+				deadLetters.Close()
+			}
+		}()
+		dispatcher.Attach(gameManager.Events())
+		logger.System.Printf("Webhooks enabled: %d URLs", len(cfg.Webhook.URLs))
+	}
+	
+	// Without routing, requests are served by the instance they reach
+	routeToOwner := func(next http.HandlerFunc) http.HandlerFunc { return next }
+	var router *api.OwnershipRouter
+	if cfg.Routing.Mode != "none" {
+		routingConfig := api.RoutingConfig{Mode: cfg.Routing.Mode}
+		if cfg.Routing.Mode == api.RoutingProxy {
+			routingConfig.OwnerURL, err = api.OwnerURLTemplate(cfg.Routing.OwnerURL)
+			if err != nil {
+				logger.Error.Printf("Invalid routing configuration: %v", err)
+				os.Exit(2)
+			}
+		}
+		router, err = api.NewOwnershipRouter(gameManager, routingConfig)
+		if err != nil {
+			logger.Error.Printf("Invalid routing configuration: %v", err)
+			os.Exit(2)
+		}
+		routeToOwner = router.Middleware
+		logger.System.Printf("Game ownership routing enabled: mode=%s, instance=%s", cfg.Routing.Mode, cfg.Routing.InstanceID)
+	}
+	
+	originPolicy, err := api.NewOriginPolicy(cfg.Server.AllowedOrigins, cfg.Server.AllowCredentials)
+	if err != nil {
+		logger.Error.Printf("Invalid origin policy: %v", err)
+		os.Exit(2)
+	}
 	
-	mux.HandleFunc("/initSharedGame", api.WithMiddlewares(gameHandler.InitSharedGame, api.WithCORS, api.WithLogging))
-	mux.HandleFunc("/stats", api.WithMiddlewares(gameHandler.ServerStats, api.WithCORS, api.WithLogging))
-	mux.HandleFunc("/hostGame", api.WithMiddlewares(wsHandler.HostGame, api.WithCORS, api.WithLogging))
-	mux.HandleFunc("/viewGame", api.WithMiddlewares(wsHandler.ViewGame, api.WithCORS, api.WithLogging))
+	trustedProxies, err := api.NewTrustedProxies(cfg.RateLimit.TrustedProxies)
+	if err != nil {
+		logger.Error.Printf("Invalid trusted proxies: %v", err)
+		os.Exit(2)
+	}
+	clientIP := api.ClientIPKey(trustedProxies)
+	createGameLimiter := api.NewRateLimiter("createGame", api.RateLimit{Rate: cfg.RateLimit.CreateGameRate, Burst: cfg.RateLimit.CreateGameBurst})
+	hostConnectLimiter := api.NewRateLimiter("hostConnect", api.RateLimit{Rate: cfg.RateLimit.HostConnectRate, Burst: cfg.RateLimit.HostConnectBurst})
+	viewerConnectLimiter := api.NewRateLimiter("viewerConnect", api.RateLimit{Rate: cfg.RateLimit.ViewerConnectRate, Burst: cfg.RateLimit.ViewerConnectBurst})
+	lobbyJoinLimiter := api.NewRateLimiter("lobbyJoin", api.RateLimit{Rate: cfg.RateLimit.LobbyJoinRate, Burst: cfg.RateLimit.LobbyJoinBurst})
 	
+	gameHandler := api.NewGameHTTPHandlerWithConfig(gameManager, api.Config{
+		MaxBodySize: cfg.Server.MaxBodySize,
+	})
+	wsHandler := websocket.NewGameWSHandlerWithConfig(gameManager, websocket.Config{
+		ReadBufferSize:       cfg.WebSocket.ReadBufferSize,
+		WriteBufferSize:      cfg.WebSocket.WriteBufferSize,
+		CheckOrigin:          originPolicy.CheckOrigin,
+		MessageLimit:         api.RateLimit{Rate: cfg.RateLimit.MessageRate, Burst: cfg.RateLimit.MessageBurst},
+		MaxMessageSize:       cfg.WebSocket.MaxMessageSize,
+		Compression:          cfg.WebSocket.Compression,
+		CompressionLevel:     cfg.WebSocket.CompressionLevel,
+		CompressionThreshold: cfg.WebSocket.CompressionThreshold,
+		WriteTimeout:         cfg.WebSocket.WriteTimeout,
+	})
+	leaderboardHandler := api.NewLeaderboardHandler(board)
+	playerHandler := api.NewPlayerHandler(profiles)
+	tournamentHandler := api.NewTournamentHandler(tournaments)
+	healthHandler := api.NewHealthHandler(gameManager)
+	if redisBroadcaster != nil {
+		healthHandler.AddCheck("broadcast", redisBroadcaster.Ping)
+	}
+	if router != nil {
+		healthHandler.AddCounter("routedToOwner", router.RoutedCount)
+	}
+	if dispatcher != nil {
+		healthHandler.AddCounter("webhooks.delivered", dispatcher.DeliveredCount)
+		healthHandler.AddCounter("webhooks.retried", dispatcher.RetriedCount)
+		healthHandler.AddCounter("webhooks.deadLettered", dispatcher.DeadLetteredCount)
+	}
+	healthHandler.AddCounter("rejectedOrigins", originPolicy.RejectedCount)
+	healthHandler.AddCounter("rateLimited.createGame", createGameLimiter.RejectedCount)
+	healthHandler.AddCounter("rateLimited.hostConnect", hostConnectLimiter.RejectedCount)
+	healthHandler.AddCounter("rateLimited.viewerConnect", viewerConnectLimiter.RejectedCount)
+	healthHandler.AddCounter("rateLimited.lobbyJoin", lobbyJoinLimiter.RejectedCount)
+	healthHandler.AddCounter("compression.messages", wsHandler.CompressedCount)
+	healthHandler.AddCounter("compression.uncompressedBytes", wsHandler.UncompressedBytes)
+	healthHandler.AddCounter("compression.bytesSaved", wsHandler.BytesSaved)
+	
+	mux := http.NewServeMux()
 	
-	port := "8080"
-	if envPort := os.Getenv("PORT"); envPort != "" {
-		port = envPort
+	// The admin API is served on the main listener, or on its own to keep it private
+	var adminServer *http.Server
+	if cfg.Admin.Token != "" {
+		adminHandler := api.NewAdminHandler(gameManager, cfg.Admin.Token)
+		adminMux := mux
+		if cfg.Admin.Port != "" {
+			adminMux = http.NewServeMux()
+			adminServer = &http.Server{
+				Addr:         ":" + cfg.Admin.Port,
+				Handler:      adminMux,
+				ReadTimeout:  cfg.Server.ReadTimeout,
+				WriteTimeout: cfg.Server.WriteTimeout,
+				IdleTimeout:  cfg.Server.IdleTimeout,
+			}
+		}
+		adminMux.HandleFunc(api.AdminPrefix, api.WithMiddlewares(adminHandler.ServeHTTP, api.WithLogging))
 	}
 	
-	logger.System.Printf("Server started on port :%s", port)
+	mux.HandleFunc("/initSharedGame", api.WithMiddlewares(gameHandler.InitSharedGame,
+		createGameLimiter.Middleware(clientIP), originPolicy.WithCORS, api.WithLogging))
+	mux.HandleFunc("/gameInfo", api.WithMiddlewares(gameHandler.GameInfo, originPolicy.WithCORS, routeToOwner, api.WithLogging))
+	mux.HandleFunc("/stats", api.WithMiddlewares(gameHandler.ServerStats, originPolicy.WithCORS, api.WithLogging))
+	// Game requests are routed before any other middleware: the owner applies them
+	mux.HandleFunc("/hostGame", api.WithMiddlewares(wsHandler.HostGame,
+		hostConnectLimiter.Middleware(api.QueryKey("hostId")), hostConnectLimiter.Middleware(clientIP),
+		originPolicy.WithCORS, routeToOwner, api.WithLogging))
+	mux.HandleFunc("/viewGame", api.WithMiddlewares(wsHandler.ViewGame,
+		viewerConnectLimiter.Middleware(clientIP), originPolicy.WithCORS, routeToOwner, api.WithLogging))
+	// A multiplexed connection follows games of any instance but hosts a game of its own
+	mux.HandleFunc("/ws", api.WithMiddlewares(wsHandler.Multiplex,
+		viewerConnectLimiter.Middleware(clientIP), originPolicy.WithCORS, api.WithLogging))
+	mux.HandleFunc("/leaderboard", api.WithMiddlewares(leaderboardHandler.Leaderboard, originPolicy.WithCORS, api.WithLogging))
+	mux.HandleFunc("/leaderboard/live", api.WithMiddlewares(wsHandler.LeaderboardFeed(board),
+		viewerConnectLimiter.Middleware(clientIP), originPolicy.WithCORS, api.WithLogging))
+	mux.HandleFunc(api.PlayersPrefix, api.WithMiddlewares(playerHandler.Profile, originPolicy.WithCORS, api.WithLogging))
+	// Creating a tournament creates the games of its first round
+	mux.HandleFunc("/tournaments", api.WithMiddlewares(tournamentHandler.Create,
+		createGameLimiter.Middleware(clientIP), originPolicy.WithCORS, api.WithLogging))
+	mux.HandleFunc(api.TournamentsPrefix, api.WithMiddlewares(tournamentHandler.Tournament, originPolicy.WithCORS, api.WithLogging))
+	// Players are matched on the instance they reach, which creates their game
+	mux.HandleFunc("/lobby", api.WithMiddlewares(wsHandler.Lobby(matchmaking),
+		lobbyJoinLimiter.Middleware(api.QueryKey("playerId")), lobbyJoinLimiter.Middleware(clientIP),
+		originPolicy.WithCORS, api.WithLogging))
+	mux.HandleFunc("/viewTournament", api.WithMiddlewares(wsHandler.ViewTournament(tournaments),
+		viewerConnectLimiter.Middleware(clientIP), originPolicy.WithCORS, api.WithLogging))
+	mux.HandleFunc("/healthz", healthHandler.Healthz)
+	mux.HandleFunc("/readyz", healthHandler.Readyz)
+	mux.HandleFunc("/debug/status", api.WithMiddlewares(healthHandler.DebugStatus, api.WithLogging))
+	
 	server := &http.Server{
-		Addr:         ":" + port,
+		Addr:         ":" + cfg.Server.Port,
 		Handler:      mux,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
 	
-	err := server.ListenAndServe()
+	listener, err := net.Listen("tcp", server.Addr)
 	if err != nil {
 		logger.Error.Printf("Cannot start server: %v", err)
+		return
+	}
+	healthHandler.SetAccepting(true)
+	logger.System.Printf("Server started on port :%s", cfg.Server.Port)
+	
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+	if adminServer != nil {
+		go func() {
+			if err := adminServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				logger.Error.Printf("Admin server stopped: %v", err)
+			}
+		}()
+		logger.System.Printf("Admin API started on port :%s", cfg.Admin.Port)
+	}
+	
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			logger.Error.Printf("Server stopped: %v", err)
+		}
+		return
+	case sig := <-signals:
+		logger.System.Printf("Received %v, draining before shutdown", sig)
+	}
+	
+	// Clients are warned before their connections are closed
+	if cfg.Server.ShutdownNotice != "" {
+		noticeCtx, cancelNotice := context.WithTimeout(context.Background(), cfg.Server.DrainDelay+time.Second)
+		shutdownAt := time.Now().Add(cfg.Server.DrainDelay).UTC()
+		_, err := gameManager.BroadcastSystemMessage(noticeCtx, game.SystemNotice{
+			Severity:      game.SeverityWarning,
+			Text:          cfg.Server.ShutdownNotice,
+			MaintenanceAt: &shutdownAt,
+		})
+		cancelNotice()
+		if err != nil {
+			logger.Error.Printf("Cannot send the shutdown notice: %v", err)
+		}
+	}
+	
+	// Fail readiness first so the platform stops routing traffic to this
+	// instance, then stop accepting connections.
+	healthHandler.SetDraining(true)
+	time.Sleep(cfg.Server.DrainDelay)
+	healthHandler.SetAccepting(false)
+	
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error.Printf("Graceful shutdown failed: %v", err)
+	}
+	if adminServer != nil {
+		adminServer.Shutdown(ctx)
 	}
-}
\ No newline at end of file
+	logger.System.Printf("Server stopped")
+}
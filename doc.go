@@ -29,17 +29,25 @@ YamsAttackSocket uses a layered architecture with clear separation of concerns:
     - Tracking and updating game state
     - Managing connections between hosts and viewers
     - Collecting statistics about server usage
-    - Performing cleanup of inactive games
+    - Expiring games according to their expiry policy
     - Thread-safe access to shared resources
 
     Key methods:
     - CreateGame(): Creates a new game with initial state
     - GetGame(): Retrieves a game by ID
+    - ConnectHost() / DisconnectHost(): Reserves the host seat with a resume token,
+      numbers the host connections so that a replaced one is ignored, and abandons
+      the game when the host misses its reconnection deadline
+    - PauseGame() / ResumeGame(): Pauses and resumes a game, freezing its state
+    - EndGame(): Finishes a game with the final scores of its players
+    - BroadcastSystemMessage(): Sends a systemNotice to the hosts and viewers of every
+      game, reporting the delivery to each game
     - RemoveGame(): Removes a game from the manager
     - UpdateViewerCount(): Updates statistics for viewers
     - UpdateHostCount(): Updates statistics for hosts
     - GetMetrics(): Retrieves server statistics
-    - cleanupInactiveGames(): Background routine to remove stale games
+    - routineExpireGames(): Background routine removing the games at their expiry,
+      warning them with gameExpiring beforehand
 
  2. GameHTTPHandler (internal/api/handler.go)
     The HTTP API handler responsible for:
@@ -50,7 +58,18 @@ YamsAttackSocket uses a layered architecture with clear separation of concerns:
 
     Key endpoints:
     - POST /initSharedGame: Create a new shared game session
+    - GET /gameInfo: Get the status, state and final standings of a game
     - GET /stats: Get server statistics and metrics
+    - GET /leaderboard: Get the all-time, daily or weekly board of the best Yams
+      scores with the single-game records (LeaderboardHandler, internal/api/leaderboard.go)
+    - GET /players/{id}, GET /players/{id}/games/{gameId}: Get the statistics and
+      recent games of a player, and the archived result of one of these games
+      (PlayerHandler, internal/api/player.go)
+    - POST /tournaments, GET /tournaments/{id}: Create a tournament and get its games
+      and standings (TournamentHandler, internal/api/tournament.go)
+    - /admin/...: Operator API (AdminHandler, internal/api/admin.go) to list, inspect
+      end and delete games, close their connections, send notices and run a cleanup,
+      authenticated with a bearer token
 
  3. GameWSHandler (internal/websocket/handler.go)
     The WebSocket handler responsible for:
@@ -62,7 +81,14 @@ YamsAttackSocket uses a layered architecture with clear separation of concerns:
 
     Key endpoints:
     - WebSocket /hostGame: Connect as a game host
-    - WebSocket /viewGame: Connect as a game viewer
+    - WebSocket /viewGame: Connect as a game viewer, or as a seated player with its
+      seat token
+    - WebSocket /leaderboard/live: Receive the leaderboard, then its changes
+    - WebSocket /viewTournament: Follow a tournament and the messages of all its games,
+      tagged with their game ID
+    - WebSocket /lobby: Queue for a match against online opponents
+    - WebSocket /ws: Follow several games and host one on a single connection, every
+      message being tagged with its game ID
 
  4. Game Object (internal/game/type.go)
     The data structure representing a game session:
@@ -82,25 +108,34 @@ YamsAttackSocket uses a layered architecture with clear separation of concerns:
  2. Host sending game update:
     ```
     Host → WS message → GameWSHandler → Update Game.GameState →
-    Iterate through Game.Viewers → Broadcast update to each viewer
+    GameManager.PublishState() → Broadcaster → Each viewer handler forwards the update
     ```
 
  3. Viewer connecting to a game:
     ```
-    Viewer → WS /viewGame → GameWSHandler → GameManager.GetGame() →
-    Validate game exists → Add connection to Game.Viewers → Send initial state
+    Viewer → WS /viewGame → GameWSHandler → Subscribe to the game topic →
+    GameManager.CurrentState() (local game or retained snapshot) → Send initial state
     ```
 
- 4. Cleanup of inactive games:
+ 4. Host ending the game:
     ```
-    GameManager.cleanupInactiveGames() → Check last activity time →
-    Close connections → Remove game from games map → Update statistics
+    Host → WS endGame message → GameWSHandler → GameManager.EndGame() → Game frozen →
+    gameEnded (final standings) published and retained → Game removed after the retention
+    ```
+
+ 5. Cleanup of inactive games:
+    ```
+    Expiry scheduler → Next expiry check due → Expiry computed from the game policy →
+    gameExpiring warning, or Close connections → Remove game from games map →
+    Update statistics
     ```
 
 # Thread Safety
 
 The codebase is designed to be thread-safe with careful use of mutexes:
-- GameManager.gamesMutex protects access to the games map
+- The games are spread over shards keyed by a hash of the game ID, each protected by
+  its own RWMutex; lookups only take a read lock, and the inactive game cleanup visits
+  the shards one at a time, closing connections after releasing the locks
 - Game.Mutex protects access to individual game data
 - ServerStats.Mutex protects access to statistics counters
 
@@ -116,8 +151,148 @@ Errors are handled through the AppError structure, which provides:
 
 # Server Configuration
 
-The server is configured through environment variables:
-- PORT: The port to listen on (default: 8080)
+The server is configured by the internal/config package from four sources, each one
+overriding the previous: built-in defaults, a YAML or TOML file (--config or
+CONFIG_FILE), environment variables and command-line flags. Running the server with
+--print-config prints the effective configuration as YAML and exits.
+
+Main settings (environment variable / flag, default):
+- PORT / --port: The port to listen on (8080)
+- READ_TIMEOUT, WRITE_TIMEOUT, IDLE_TIMEOUT: HTTP server timeouts (15s, 15s, 60s)
+- DRAIN_DELAY, SHUTDOWN_TIMEOUT: Graceful shutdown timings (5s, 10s)
+- SHUTDOWN_NOTICE: System notice sent to every host and viewer on shutdown, none when
+  empty (a restart warning)
+- ALLOWED_ORIGINS: Comma-separated browser origins allowed for CORS and WebSocket
+  upgrades: "*", exact origins or wildcard subdomains like https://*.example.com (*)
+- ALLOW_CREDENTIALS: Allow credentialed cross-origin requests (false)
+- TRUSTED_PROXIES: Proxy IPs/CIDRs whose Fly-Client-IP and X-Forwarded-For headers
+  are trusted to identify the client IP (none)
+- RATE_LIMIT_CREATE_GAME, RATE_LIMIT_HOST_CONNECT, RATE_LIMIT_VIEWER_CONNECT,
+  RATE_LIMIT_MESSAGE: Token bucket rates in events per second (0.1, 0.5, 1, 20), each
+  with a matching *_BURST setting (10, 10, 20, 40); a zero rate disables the limit
+- GAME_INACTIVITY_TIMEOUT: Idle duration after which a game is removed (2h)
+- GAME_CLEANUP_INTERVAL: Interval between two sweeps of the expired games, a safety
+  net behind the expiry scheduler (1h)
+- GAME_MAX_LIFETIME: Default and longest lifetime of a game whatever its activity, 0
+  for unlimited (0)
+- GAME_EXPIRY_WARNING: Time before its expiry a game receives a gameExpiring message,
+  0 to disable (5m)
+- GAME_PAUSED_INACTIVITY_TIMEOUT: Idle duration after which a paused game is removed,
+  and longest pause a host may announce (12h)
+- GAME_RESULT_RETENTION: Duration a finished game is kept for result pages (1h)
+- GAME_HOST_GRACE_PERIOD: Time a disconnected host has to reconnect with its resume
+  token before the game is abandoned, 0 to never abandon (30s)
+- GAME_DUPLICATE_HOST_POLICY: Second connection of a connected host, takeover (closing
+  the first one) or reject (takeover)
+- GAME_SHARDS: Number of lock-striped shards of the game registry (64)
+- MAX_BODY_SIZE: Maximum size in bytes of a game creation request body (131072)
+- WS_READ_BUFFER_SIZE, WS_WRITE_BUFFER_SIZE: WebSocket buffer sizes (1024)
+- WS_MAX_MESSAGE_SIZE: Maximum size in bytes of a message received from a WebSocket
+  client; larger messages close the connection (65536)
+- WS_COMPRESSION: Negotiate permessage-deflate with the clients offering it (true)
+- WS_COMPRESSION_LEVEL, WS_COMPRESSION_THRESHOLD: Deflate level of the compressed
+  messages, and size in bytes below which messages are sent uncompressed (1, 512)
+- BROADCAST_BACKEND: Backbone carrying game states to viewers, local or redis (local)
+- REDIS_URL: redis:// or rediss:// URL of the Redis backend, required with redis
+- ROUTING_MODE: Game ownership routing, one of none, replay or proxy (none)
+- INSTANCE_ID: ID of this instance, encoded in the game IDs (FLY_MACHINE_ID)
+- ROUTING_OWNER_URL: URL template of the owning instance for the proxy mode, such as
+  http://{instance}.vm.my-app.internal:8080
+- WEBHOOK_URLS: Comma-separated URLs receiving the game lifecycle events (none)
+- WEBHOOK_SECRET: Secret signing the webhook payloads (unsigned when empty)
+- WEBHOOK_EVENTS: Comma-separated event types sent, all when empty
+- WEBHOOK_MAX_ATTEMPTS, WEBHOOK_TIMEOUT: Delivery attempts and timeout of each (5, 10s)
+- WEBHOOK_DEAD_LETTER_FILE: File receiving the deliveries given up on (none)
+- ADMIN_TOKEN: Bearer token of the admin API, disabled when empty (none)
+- ADMIN_PORT: Separate port serving the admin API, the main port when empty (none)
+- TRACING_EXPORTER: Span exporter, one of none, otlp, stdout or file (none)
+- TRACING_ENDPOINT: OTLP/HTTP collector URL (OTEL_EXPORTER_OTLP_* variables)
+- TRACING_INSECURE: Disable TLS towards the collector (false)
+- TRACING_FILE: Destination of the file exporter (traces.json)
+- TRACING_SAMPLE_RATIO: Fraction of traces recorded, between 0 and 1 (1)
+
+# Tracing
+
+Game lifecycle operations are traced with OpenTelemetry (internal/tracing):
+- InitSharedGame: game creation, with host ID, payload size and game ID
+- HostGame.connect / ViewGame.connect: WebSocket connections
+- HostGame.update: each update received from a host (linked to its connection)
+- HostGame.publish: publication of an update on the broadcast backbone
+
+The trace context (W3C traceparent header) of the HTTP upgrade request is propagated
+to the connection spans.
+
+# Lifecycle Events
+
+The GameManager emits lifecycle events (gameCreated, hostConnected, hostDisconnected,
+viewerJoined, stateUpdated, gamePaused, gameResumed, gameAbandoned, gameEnded,
+gameExpired) on an event bus, see GameManager.Events. The webhook dispatcher
+(internal/webhook) subscribes to it and POSTs
+the events, signed with HMAC-SHA256, to the configured URLs, retrying with an
+exponential backoff and dead-lettering the deliveries that keep failing.
+
+# Leaderboard
+
+The result of every game ended is published on the results topic of the broadcast
+backbone. The leaderboard (internal/leaderboard) of every instance subscribes to it and
+ranks the best scores of the games played with the built-in yams-scorecard schema, the
+only games whose rules the server knows, reading the yams and upper section records
+from their final scorecards. The boards are held in memory and start empty.
+
+The player profiles (internal/profile) subscribe to the same topic and accumulate the
+games played and hosted, the scores and, for Yams games, the bonus rate and category
+averages of every player, with their last finished games.
+
+# Multiplexed Connections
+
+The /ws socket (internal/websocket/mux.go) carries several game subscriptions on one
+connection. Each subscription has its own broadcast subscription and forwarding, and an
+optional window of messages sent ahead of the client acknowledgements: game states held
+back are conflated to the latest one, and a subscription falling behind is ended on its
+own. The connection may also host one game, through the same host session as /hostGame.
+
+# Message Encodings
+
+Every socket negotiates the encoding of its messages with the WebSocket subprotocol:
+msgpack, cbor or json, in this order of preference, JSON being used when the client
+offers none (internal/websocket/encoding.go). Game states stay stored and published in
+JSON; the messages of the broadcaster are converted once per encoding and message,
+however many connections receive them, into a gorilla PreparedMessage whose frames are
+built once per compression setting (BenchmarkBroadcast).
+
+Compressed messages are counted on the network connection of each socket
+(internal/websocket/compression.go): /debug/status reports the messages compressed and
+the bytes saved.
+
+# Tournaments
+
+A tournament (internal/tournament) groups the Yams games of several rounds between the
+same players, in the round-robin or aggregate score format. The tournament manager
+creates the games of each round on the GameManager, follows their end on its event bus
+and creates the games of the next round once every game of the current one is over.
+Tournaments live on the instance that created them; their state is published, retained,
+on the broadcast backbone for the tournament viewers of every instance.
+
+# Lobby
+
+The lobby (internal/lobby) matches the players queued on the /lobby socket for a game
+of 2 to 4 players, in their order of arrival and within a rating range widening with
+their wait. It creates the game of each match with the yams-scorecard schema and
+reserves a seat to each player: the host token is the resume token of the host session,
+and the other players present theirs to /viewGame. The queue is held in memory, per
+instance.
+
+# Horizontal Scaling
+
+Hosts publish game states on a broadcast backbone (internal/broadcast) and viewer
+handlers subscribe to it. With the redis backend, several instances share the same
+Redis server: a viewer connected to any instance follows a game hosted on another one,
+and receives the last state retained in Redis when joining.
+
+Alternatively, each game can be owned by the instance creating it: its game ID is then
+"<instanceID>.<uuid>", and the requests for the game reaching another instance are sent
+to the owner, either with a Fly-Replay response header (replay mode) or through an
+internal reverse proxy hop (proxy mode).
 
 The server includes timeout settings for improved stability:
 - ReadTimeout: 15 seconds
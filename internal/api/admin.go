@@ -0,0 +1,262 @@
+/*
+Admin API
+
+This file implements the AdminHandler component, the operator tooling for the games
+held by this instance. Every request must carry the admin token as a bearer token; the
+API is disabled when no token is configured, and can be served on a separate listener
+kept off the public network.
+
+- GET /admin/games: list the games with their connections
+- GET /admin/games/{id}: a game with its state and connections
+- DELETE /admin/games/{id}: remove a game at once, closing its connections
+- POST /admin/games/{id}/disconnect?target=host|viewers|all: close connections
+- POST /admin/games/{id}/end: end a game with the final scores, as its host would
+- POST /admin/games/{id}/notice: send a system notice to the host and viewers of a game
+- POST /admin/notice: send a system notice to every game, reporting each delivery
+- POST /admin/cleanup: run an inactive game cleanup pass now
+*/
+
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+// AdminPrefix is the path prefix of the admin API
+const AdminPrefix = "/admin/"
+
+// maxEndGameBodySize bounds the body of a game end, which may carry the final state
+const maxEndGameBodySize = 128 << 10
+
+func NewAdminHandler(gameManager *game.GameManager, token string) *AdminHandler {
+	return &AdminHandler{
+		gameManager: gameManager,
+		token:       token,
+	}
+}
+
+// ServeHTTP authenticates the request and routes it to the admin operation.
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		HandleError(w, &AppError{
+			Code:    http.StatusUnauthorized,
+			Message: ErrAdminUnauthorized,
+		})
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, AdminPrefix), "/")
+	segments := strings.Split(path, "/")
+	switch {
+	case path == "games":
+		h.route(w, r, http.MethodGet, h.listGames)
+	case path == "notice":
+		h.route(w, r, http.MethodPost, h.noticeAll)
+	case path == "cleanup":
+		h.route(w, r, http.MethodPost, h.cleanup)
+	case len(segments) == 2 && segments[0] == "games":
+		if r.Method == http.MethodDelete {
+			h.deleteGame(w, r, segments[1])
+			return
+		}
+		h.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			h.gameDetails(w, r, segments[1])
+		})
+	case len(segments) == 3 && segments[0] == "games" && segments[2] == "disconnect":
+		h.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			h.disconnect(w, r, segments[1])
+		})
+	case len(segments) == 3 && segments[0] == "games" && segments[2] == "end":
+		h.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			h.endGame(w, r, segments[1])
+		})
+	case len(segments) == 3 && segments[0] == "games" && segments[2] == "notice":
+		h.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			h.noticeGame(w, r, segments[1])
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *AdminHandler) listGames(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, AdminGamesResponse{Games: h.gameManager.ListGames()})
+}
+
+func (h *AdminHandler) gameDetails(w http.ResponseWriter, r *http.Request, gameID string) {
+	details, err := h.gameManager.Details(gameID)
+	if err != nil {
+		handleAdminError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, details)
+}
+
+func (h *AdminHandler) deleteGame(w http.ResponseWriter, r *http.Request, gameID string) {
+	if err := h.gameManager.DeleteGame(gameID); err != nil {
+		handleAdminError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) disconnect(w http.ResponseWriter, r *http.Request, gameID string) {
+	target := r.URL.Query().Get("target")
+	if target != "host" && target != "viewers" && target != "all" {
+		HandleError(w, &AppError{
+			Code:    http.StatusBadRequest,
+			Message: ErrMissingParam + ": target (host, viewers or all)",
+		})
+		return
+	}
+
+	var response AdminDisconnectResponse
+	if target != "viewers" {
+		disconnected, err := h.gameManager.DisconnectHostConnection(gameID)
+		if err != nil {
+			handleAdminError(w, err)
+			return
+		}
+		response.HostDisconnected = disconnected
+	}
+	if target != "host" {
+		count, err := h.gameManager.DisconnectViewers(gameID)
+		if err != nil {
+			handleAdminError(w, err)
+			return
+		}
+		response.ViewersDisconnected = count
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *AdminHandler) endGame(w http.ResponseWriter, r *http.Request, gameID string) {
+	var req AdminEndGameRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEndGameBodySize)).Decode(&req); err != nil {
+		HandleError(w, &AppError{Code: http.StatusBadRequest, Message: ErrJSONParsing, Err: err})
+		return
+	}
+	ended, err := h.gameManager.EndGame(gameID, req.FinalScores, req.GameState)
+	if err != nil {
+		handleAdminError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ended)
+}
+
+func (h *AdminHandler) noticeGame(w http.ResponseWriter, r *http.Request, gameID string) {
+	notice, appErr := readNotice(w, r)
+	if appErr != nil {
+		HandleError(w, appErr)
+		return
+	}
+	err := h.gameManager.SendNotice(r.Context(), gameID, notice)
+	if errors.Is(err, game.ErrGameNotFound) || errors.Is(err, game.ErrInvalidNotice) {
+		handleAdminError(w, err)
+		return
+	}
+	delivery := game.NoticeDelivery{GameID: gameID, Delivered: err == nil}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	writeJSON(w, http.StatusOK, noticeResponse([]game.NoticeDelivery{delivery}))
+}
+
+func (h *AdminHandler) noticeAll(w http.ResponseWriter, r *http.Request) {
+	notice, appErr := readNotice(w, r)
+	if appErr != nil {
+		HandleError(w, appErr)
+		return
+	}
+	deliveries, err := h.gameManager.BroadcastSystemMessage(r.Context(), notice)
+	if err != nil {
+		handleAdminError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, noticeResponse(deliveries))
+}
+
+func (h *AdminHandler) cleanup(w http.ResponseWriter, r *http.Request) {
+	removed := h.gameManager.CleanupInactiveGames()
+	writeJSON(w, http.StatusOK, AdminCleanupResponse{Removed: removed})
+}
+
+// authorized compares the bearer token of a request with the admin token in constant time.
+func (h *AdminHandler) authorized(r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return found && h.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// route calls handler when the request uses method.
+func (h *AdminHandler) route(w http.ResponseWriter, r *http.Request, method string, handler http.HandlerFunc) {
+	if r.Method != method {
+		HandleError(w, &AppError{
+			Code:    http.StatusMethodNotAllowed,
+			Message: ErrMethodNotAllowed,
+		})
+		return
+	}
+	handler(w, r)
+}
+
+// readNotice decodes a notice request.
+func readNotice(w http.ResponseWriter, r *http.Request) (game.SystemNotice, *AppError) {
+	var req AdminNoticeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		return game.SystemNotice{}, &AppError{Code: http.StatusBadRequest, Message: ErrJSONParsing, Err: err}
+	}
+	return game.SystemNotice{
+		Severity:      req.Severity,
+		Text:          req.Text,
+		MaintenanceAt: req.MaintenanceAt,
+	}, nil
+}
+
+// noticeResponse counts the deliveries of a notice.
+func noticeResponse(deliveries []game.NoticeDelivery) AdminNoticeResponse {
+	response := AdminNoticeResponse{Deliveries: deliveries}
+	for _, delivery := range deliveries {
+		if delivery.Delivered {
+			response.Delivered++
+		} else {
+			response.Failed++
+		}
+	}
+	return response
+}
+
+func handleAdminError(w http.ResponseWriter, err error) {
+	if errors.Is(err, game.ErrGameNotFound) {
+		HandleError(w, &AppError{Code: http.StatusNotFound, Message: ErrGameNotFound})
+		return
+	}
+	var violationErr *game.SchemaViolationError
+	if errors.As(err, &violationErr) {
+		HandleSchemaViolations(w, violationErr)
+		return
+	}
+	if errors.Is(err, game.ErrGameFinished) {
+		HandleError(w, &AppError{Code: http.StatusConflict, Message: ErrGameFinished})
+		return
+	}
+	if errors.Is(err, game.ErrGameAbandoned) {
+		HandleError(w, &AppError{Code: http.StatusConflict, Message: ErrGameAbandoned})
+		return
+	}
+	if errors.Is(err, game.ErrInvalidResults) {
+		HandleError(w, &AppError{Code: http.StatusBadRequest, Message: ErrInvalidResults + ": " + strings.TrimPrefix(err.Error(), game.ErrInvalidResults.Error()+": ")})
+		return
+	}
+	if errors.Is(err, game.ErrInvalidNotice) {
+		HandleError(w, &AppError{Code: http.StatusBadRequest, Message: ErrInvalidNotice + ": " + strings.TrimPrefix(err.Error(), game.ErrInvalidNotice.Error()+": ")})
+		return
+	}
+	HandleError(w, &AppError{Code: http.StatusInternalServerError, Message: err.Error(), Err: err})
+}
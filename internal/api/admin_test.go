@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+func TestAdminHandler(t *testing.T) {
+	gameManager := game.NewGameManager()
+	handler := NewAdminHandler(gameManager, "s3cret")
+	gameID, err := gameManager.CreateGame("alice", []byte(`{"round":1}`))
+	require.NoError(t, err)
+
+	serve := func(method, target, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Missing Or Invalid Token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/admin/games", "", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/admin/games", "", "guess").Code)
+
+		disabled := NewAdminHandler(gameManager, "")
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/admin/games", nil)
+		req.Header.Set("Authorization", "Bearer ")
+		disabled.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "an empty admin token disables the API")
+	})
+
+	t.Run("List Games", func(t *testing.T) {
+		w := serve(http.MethodGet, "/admin/games", "", "s3cret")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response AdminGamesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		if assert.Len(t, response.Games, 1) {
+			assert.Equal(t, gameID, response.Games[0].GameID)
+			assert.Equal(t, "alice", response.Games[0].HostPlayerID)
+			assert.Equal(t, "neverConnected", response.Games[0].HostConnectionState)
+			assert.NotContains(t, w.Body.String(), "round", "the list does not carry the game states")
+		}
+	})
+
+	t.Run("Game Details", func(t *testing.T) {
+		w := serve(http.MethodGet, "/admin/games/"+gameID, "", "s3cret")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var details game.GameDetails
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+		assert.JSONEq(t, `{"round":1}`, string(details.GameState))
+		assert.Nil(t, details.Host)
+		assert.Empty(t, details.ViewerConnections)
+
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/admin/games/unknown", "", "s3cret").Code)
+		assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "/admin/games/"+gameID, "", "s3cret").Code)
+	})
+
+	t.Run("Disconnect", func(t *testing.T) {
+		w := serve(http.MethodPost, "/admin/games/"+gameID+"/disconnect?target=all", "", "s3cret")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"hostDisconnected":false,"viewersDisconnected":0}`, w.Body.String())
+
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/admin/games/"+gameID+"/disconnect", "", "s3cret").Code)
+	})
+
+	t.Run("Notice", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		messages, err := gameManager.Broadcaster().Subscribe(ctx, game.GameTopic(gameID))
+		require.NoError(t, err)
+		defer messages.Close()
+
+		w := serve(http.MethodPost, "/admin/notice",
+			`{"severity":"warning","text":"Maintenance at 10:00","maintenanceAt":"2026-10-18T10:00:00Z"}`, "s3cret")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response AdminNoticeResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 1, response.Delivered)
+		assert.Equal(t, []game.NoticeDelivery{{GameID: gameID, Delivered: true}}, response.Deliveries)
+
+		select {
+		case data := <-messages.Messages():
+			var notice game.SystemNotice
+			require.NoError(t, json.Unmarshal(data, &notice))
+			assert.Equal(t, "systemNotice", notice.Type)
+			assert.Equal(t, game.SeverityWarning, notice.Severity)
+			assert.Equal(t, "Maintenance at 10:00", notice.Text)
+			assert.Equal(t, time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC), notice.MaintenanceAt.UTC())
+		case <-ctx.Done():
+			t.Fatal("notice not published")
+		}
+
+		w = serve(http.MethodPost, "/admin/games/"+gameID+"/notice", `{"text":"Hi"}`, "s3cret")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"delivered":1`)
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/admin/games/"+gameID+"/notice", `{}`, "s3cret").Code)
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/admin/notice", `{"severity":"panic","text":"Hi"}`, "s3cret").Code)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/admin/games/unknown/notice", `{"text":"Hi"}`, "s3cret").Code)
+	})
+
+	t.Run("Cleanup", func(t *testing.T) {
+		w := serve(http.MethodPost, "/admin/cleanup", "", "s3cret")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"removed":0}`, w.Body.String())
+	})
+
+	t.Run("End Game", func(t *testing.T) {
+		ended, err := gameManager.CreateGame("bob", []byte(`{"round":1}`))
+		require.NoError(t, err)
+
+		w := serve(http.MethodPost, "/admin/games/"+ended+"/end",
+			`{"finalScores":[{"playerId":"bob","score":12},{"playerId":"carol","score":30}],"gameState":{"round":13}}`, "s3cret")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var message game.GameEndedMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &message))
+		assert.Equal(t, "gameEnded", message.Type)
+		assert.Equal(t, []game.Standing{{Rank: 1, PlayerID: "carol", Score: 30}, {Rank: 2, PlayerID: "bob", Score: 12}}, message.Standings)
+		assert.JSONEq(t, `{"round":13}`, string(message.GameState))
+
+		info, err := gameManager.Info(context.Background(), ended)
+		require.NoError(t, err)
+		assert.Equal(t, game.StatusFinished, info.Status)
+
+		assert.Equal(t, http.StatusConflict, serve(http.MethodPost, "/admin/games/"+ended+"/end", `{"finalScores":[{"playerId":"bob","score":1}]}`, "s3cret").Code)
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/admin/games/"+gameID+"/end", `{"finalScores":[]}`, "s3cret").Code)
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/admin/games/"+gameID+"/end", `not json`, "s3cret").Code)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/admin/games/unknown/end", `{"finalScores":[{"playerId":"bob","score":1}]}`, "s3cret").Code)
+		assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodGet, "/admin/games/"+ended+"/end", "", "s3cret").Code)
+	})
+
+	t.Run("Delete Game", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/admin/games/"+gameID, "", "s3cret").Code)
+		_, err := gameManager.GetGame(gameID)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/admin/games/"+gameID, "", "s3cret").Code)
+	})
+}
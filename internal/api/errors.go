@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
 	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
 )
 
@@ -15,6 +16,37 @@ const (
 	ErrWebSocketUpgrade = "WebSocket upgrade error"
 	ErrNoBody = "Request body is empty or missing"
 	ErrMissingParam     = "Required parameter missing"
+	ErrPayloadTooLarge  = "Payload too large"
+	ErrInvalidSchema    = "Invalid game state schema"
+	ErrUnknownSchema    = "Unknown game state schema"
+	ErrSchemaViolation  = "Game state does not match the game schema"
+	ErrBroadcastUnavailable = "Game broadcast unavailable"
+	ErrGameFinished         = "Game already finished"
+	ErrInvalidResults       = "Invalid final scores"
+	ErrUnknownMessageType   = "Unknown message type"
+	ErrGamePaused           = "Game paused"
+	ErrGameNotPaused        = "Game not paused"
+	ErrInvalidPause         = "Invalid pause"
+	ErrInvalidResumeToken   = "Invalid resume token"
+	ErrGameAbandoned        = "Game abandoned"
+	ErrHostAlreadyConnected = "Host already connected"
+	ErrAdminUnauthorized    = "Missing or invalid admin token"
+	ErrInvalidNotice        = "Invalid notice"
+	ErrInvalidPolicy        = "Invalid expiry policy"
+	ErrInvalidParam         = "Invalid parameter"
+	ErrPlayerNotFound       = "Player not found"
+	ErrInvalidTournament    = "Invalid tournament"
+	ErrTournamentNotFound   = "Tournament not found"
+	ErrInvalidPlayerToken   = "Invalid player token"
+	ErrInvalidQueueRequest  = "Invalid queue request"
+	ErrAlreadyQueued        = "Already queued"
+	ErrNotQueued            = "Not queued"
+	ErrInvalidSubscription  = "Invalid subscription"
+	ErrAlreadySubscribed    = "Already subscribed"
+	ErrNotSubscribed        = "Not subscribed"
+	ErrTooManySubscriptions = "Too many subscriptions"
+	ErrAlreadyHosting       = "Already hosting a game"
+	ErrNotHosting           = "Not hosting this game"
 )
 
 func (e *AppError) Error() string {
@@ -27,4 +59,14 @@ func (e *AppError) Error() string {
 func HandleError(w http.ResponseWriter, appErr *AppError) {
 	logger.Error.Printf("%s (Code: %d)", appErr.Error(), appErr.Code)
 	http.Error(w, appErr.Message, appErr.Code)
-}
\ No newline at end of file
+}
+
+// HandleSchemaViolations answers with the list of schema violations as JSON, so
+// that clients can point at the invalid values.
+func HandleSchemaViolations(w http.ResponseWriter, violationErr *game.SchemaViolationError) {
+	logger.Error.Printf("%s (Code: %d)", violationErr.Error(), http.StatusUnprocessableEntity)
+	writeJSON(w, http.StatusUnprocessableEntity, SchemaViolationResponse{
+		Error:      ErrSchemaViolation,
+		Violations: violationErr.Violations,
+	})
+}
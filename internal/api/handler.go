@@ -25,19 +25,39 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
 	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/tracing"
 )
 
 
+// DefaultConfig returns the settings used by NewGameHTTPHandler.
+func DefaultConfig() Config {
+	return Config{
+		MaxBodySize: 128 << 10,
+	}
+}
+
 func NewGameHTTPHandler(gameManager *game.GameManager) *GameHTTPHandler {
+	return NewGameHTTPHandlerWithConfig(gameManager, DefaultConfig())
+}
+
+func NewGameHTTPHandlerWithConfig(gameManager *game.GameManager, config Config) *GameHTTPHandler {
 	return &GameHTTPHandler{
 		gameManager: gameManager,
+		config:      config,
 	}
 }
 
 func (h *GameHTTPHandler) InitSharedGame(w http.ResponseWriter, r *http.Request) {
+	_, span := tracing.Tracer().Start(tracing.Extract(r), "InitSharedGame")
+	defer span.End()
+
 	if r.Method != http.MethodPost {
 		HandleError(w, &AppError{
 			Code:    http.StatusMethodNotAllowed,
@@ -54,8 +74,26 @@ func (h *GameHTTPHandler) InitSharedGame(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if r.ContentLength > h.config.MaxBodySize {
+		HandleError(w, &AppError{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: ErrPayloadTooLarge,
+		})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.config.MaxBodySize)
+
 	var req InitGameRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			HandleError(w, &AppError{
+				Code:    http.StatusRequestEntityTooLarge,
+				Message: ErrPayloadTooLarge,
+				Err:     err,
+			})
+			return
+		}
 		HandleError(w, &AppError{
 			Code:    http.StatusBadRequest,
 			Message: ErrJSONParsing,
@@ -79,8 +117,34 @@ func (h *GameHTTPHandler) InitSharedGame(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	gameID, err := h.gameManager.CreateGame(req.HostPlayerID, req.GameState)
+	span.SetAttributes(
+		tracing.AttrHostID.String(req.HostPlayerID),
+		tracing.AttrPayloadSize.Int(len(req.GameState)),
+	)
+
+	opts, appErr := h.gameOptions(req)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Message)
+		HandleError(w, appErr)
+		return
+	}
+
+	gameID, err := h.gameManager.CreateGameWithOptions(req.HostPlayerID, req.GameState, opts)
 	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		var violationErr *game.SchemaViolationError
+		if errors.As(err, &violationErr) {
+			HandleSchemaViolations(w, violationErr)
+			return
+		}
+		if errors.Is(err, game.ErrInvalidPolicy) {
+			HandleError(w, &AppError{
+				Code:    http.StatusBadRequest,
+				Message: ErrInvalidPolicy,
+				Err:     err,
+			})
+			return
+		}
 		HandleError(w, &AppError{
 			Code:    http.StatusInternalServerError,
 			Message: "Failed to create game",
@@ -88,6 +152,7 @@ func (h *GameHTTPHandler) InitSharedGame(w http.ResponseWriter, r *http.Request)
 		})
 		return
 	}
+	span.SetAttributes(tracing.AttrGameID.String(gameID))
 
 	// Get the origin from the request headers
 	origin := r.Header.Get("Origin")
@@ -115,6 +180,84 @@ func (h *GameHTTPHandler) InitSharedGame(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(response)
 }
 
+// gameOptions resolves the schema requested at game creation, either inline or by name,
+// and the expiry policy.
+func (h *GameHTTPHandler) gameOptions(req InitGameRequest) (game.GameOptions, *AppError) {
+	var opts game.GameOptions
+
+	switch {
+	case len(req.Schema) > 0 && req.SchemaName != "":
+		return opts, &AppError{
+			Code:    http.StatusBadRequest,
+			Message: ErrInvalidSchema + ": schema and schemaName are mutually exclusive",
+		}
+	case req.SchemaName != "":
+		schema, exists := h.gameManager.Schemas().Get(req.SchemaName)
+		if !exists {
+			return opts, &AppError{
+				Code:    http.StatusBadRequest,
+				Message: ErrUnknownSchema + ": " + req.SchemaName,
+			}
+		}
+		opts.Schema = schema
+		opts.SchemaName = req.SchemaName
+	case len(req.Schema) > 0:
+		schema, err := game.CompileSchema(req.Schema)
+		if err != nil {
+			return opts, &AppError{
+				Code:    http.StatusBadRequest,
+				Message: ErrInvalidSchema,
+				Err:     err,
+			}
+		}
+		opts.Schema = schema
+		opts.SchemaName = "inline"
+	}
+	if req.Policy != nil {
+		opts.Policy = req.Policy.Policy()
+	}
+	return opts, nil
+}
+
+// GameInfo describes a game: its status ("active" or "finished"), its current state
+// and, once finished, its final standings.
+func (h *GameHTTPHandler) GameInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		HandleError(w, &AppError{
+			Code:    http.StatusMethodNotAllowed,
+			Message: ErrMethodNotAllowed,
+		})
+		return
+	}
+	gameID := r.URL.Query().Get("gameId")
+	if gameID == "" {
+		HandleError(w, &AppError{
+			Code:    http.StatusBadRequest,
+			Message: ErrMissingParam + ": gameId",
+		})
+		return
+	}
+
+	info, err := h.gameManager.Info(r.Context(), gameID)
+	if errors.Is(err, broadcast.ErrNoSnapshot) {
+		HandleError(w, &AppError{
+			Code:    http.StatusNotFound,
+			Message: ErrGameNotFound,
+		})
+		return
+	}
+	if err != nil {
+		HandleError(w, &AppError{
+			Code:    http.StatusServiceUnavailable,
+			Message: ErrBroadcastUnavailable,
+			Err:     err,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
 func (h *GameHTTPHandler) ServerStats(w http.ResponseWriter, r *http.Request) {
 	metrics := h.gameManager.GetMetrics()
 	
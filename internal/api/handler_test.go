@@ -2,13 +2,20 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
 	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/tracing"
 )
 
 func TestInitSharedGame_Integration(t *testing.T) {
@@ -58,6 +65,164 @@ func TestInitSharedGame_Integration(t *testing.T) {
 	})
 }
 
+func TestInitSharedGame_PayloadLimits(t *testing.T) {
+	gameManager := game.NewGameManager()
+	handler := NewGameHTTPHandlerWithConfig(gameManager, Config{MaxBodySize: 64})
+
+	post := func(body string, contentLength int64) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/initSharedGame", bytes.NewBufferString(body))
+		req.ContentLength = contentLength
+		w := httptest.NewRecorder()
+		handler.InitSharedGame(w, req)
+		return w
+	}
+
+	large := `{"hostPlayerId":"player1","gameState":{"padding":"` + string(bytes.Repeat([]byte("x"), 100)) + `"}}`
+
+	t.Run("Declared Body Too Large", func(t *testing.T) {
+		w := post(large, int64(len(large)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("Streamed Body Too Large", func(t *testing.T) {
+		w := post(large, -1)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("Body Within Limit", func(t *testing.T) {
+		body := `{"hostPlayerId":"player1","gameState":{"score":1}}`
+		w := post(body, int64(len(body)))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestInitSharedGame_Schemas(t *testing.T) {
+	gameManager := game.NewGameManager()
+	handler := NewGameHTTPHandler(gameManager)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/initSharedGame", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		handler.InitSharedGame(w, req)
+		return w
+	}
+
+	t.Run("Registered Schema", func(t *testing.T) {
+		w := post(`{"hostPlayerId":"p1","schemaName":"yams-scorecard","gameState":{"players":[{"id":"p1","scores":{}}]}}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response InitGameResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		createdGame, err := gameManager.GetGame(response.GameID)
+		assert.NoError(t, err)
+		assert.Equal(t, game.YamsScorecardSchema, createdGame.SchemaName)
+	})
+
+	t.Run("Unknown Schema", func(t *testing.T) {
+		w := post(`{"hostPlayerId":"p1","schemaName":"chess","gameState":{}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid Inline Schema", func(t *testing.T) {
+		w := post(`{"hostPlayerId":"p1","schema":{"type":12},"gameState":{}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Both Schema And Schema Name", func(t *testing.T) {
+		w := post(`{"hostPlayerId":"p1","schema":{},"schemaName":"yams-scorecard","gameState":{}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Initial State Violates Inline Schema", func(t *testing.T) {
+		w := post(`{"hostPlayerId":"p1","schema":{"type":"object","required":["score"]},"gameState":{"level":1}}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+		var response SchemaViolationResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, ErrSchemaViolation, response.Error)
+		assert.NotEmpty(t, response.Violations)
+	})
+}
+
+func TestInitSharedGame_ExpiryPolicy(t *testing.T) {
+	gameManager := game.NewGameManager()
+	handler := NewGameHTTPHandler(gameManager)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/initSharedGame", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		handler.InitSharedGame(w, req)
+		return w
+	}
+
+	t.Run("Valid Policy", func(t *testing.T) {
+		w := post(`{"hostPlayerId":"p1","gameState":{},"policy":{"idleTimeoutSeconds":600,"maxLifetimeSeconds":7200,"keepWhileViewers":true}}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response InitGameResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		createdGame, err := gameManager.GetGame(response.GameID)
+		assert.NoError(t, err)
+		assert.Equal(t, game.ExpiryPolicy{
+			IdleTimeout:      10 * time.Minute,
+			MaxLifetime:      2 * time.Hour,
+			KeepWhileViewers: true,
+		}, createdGame.Policy)
+	})
+
+	t.Run("Invalid Policy", func(t *testing.T) {
+		w := post(`{"hostPlayerId":"p1","gameState":{},"policy":{"maxLifetimeSeconds":-1}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), ErrInvalidPolicy)
+	})
+}
+
+func TestGameInfo_Integration(t *testing.T) {
+	gameManager := game.NewGameManager()
+	handler := NewGameHTTPHandler(gameManager)
+	gameID, _ := gameManager.CreateGame("player1", []byte(`{"round": 3}`))
+
+	getInfo := func(gameID string) (*httptest.ResponseRecorder, game.GameInfo) {
+		req, _ := http.NewRequest(http.MethodGet, "/gameInfo?gameId="+gameID, nil)
+		w := httptest.NewRecorder()
+		handler.GameInfo(w, req)
+		var info game.GameInfo
+		json.Unmarshal(w.Body.Bytes(), &info)
+		return w, info
+	}
+
+	t.Run("Active Game", func(t *testing.T) {
+		w, info := getInfo(gameID)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, game.StatusActive, info.Status)
+		assert.Equal(t, "neverConnected", info.HostConnectionState)
+		assert.JSONEq(t, `{"round": 3}`, string(info.GameState))
+		assert.Nil(t, info.EndedAt)
+		assert.Empty(t, info.Standings)
+	})
+
+	t.Run("Finished Game", func(t *testing.T) {
+		_, err := gameManager.EndGame(gameID, []game.FinalScore{{PlayerID: "player1", Score: 212}, {PlayerID: "player2", Score: 187}}, nil)
+		assert.NoError(t, err)
+
+		w, info := getInfo(gameID)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, game.StatusFinished, info.Status)
+		assert.NotNil(t, info.EndedAt)
+		assert.Equal(t, []game.Standing{{Rank: 1, PlayerID: "player1", Score: 212}, {Rank: 2, PlayerID: "player2", Score: 187}}, info.Standings)
+	})
+
+	t.Run("Unknown Game", func(t *testing.T) {
+		w, _ := getInfo("unknown")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Missing Game ID", func(t *testing.T) {
+		w, _ := getInfo("")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
 func TestServerStats_Integration(t *testing.T) {
 	gameManager := game.NewGameManager()
 	handler := NewGameHTTPHandler(gameManager)
@@ -83,4 +248,45 @@ func TestServerStats_Integration(t *testing.T) {
 	assert.GreaterOrEqual(t, metrics.ActiveGames, int(2), "Should have at least 2 active games")
 	
 	t.Logf("Server metrics: %+v", metrics)
-}
\ No newline at end of file
+}
+
+func TestInitSharedGame_Tracing(t *testing.T) {
+	_, err := tracing.Init(context.Background(), tracing.Config{Exporter: tracing.ExporterNone})
+	assert.NoError(t, err)
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	handler := NewGameHTTPHandler(game.NewGameManager())
+
+	bodyBytes, _ := json.Marshal(InitGameRequest{
+		HostPlayerID: "player1",
+		GameState:    []byte(`{"state":"initial"}`),
+	})
+	req, _ := http.NewRequest(http.MethodPost, "/initSharedGame", bytes.NewBuffer(bodyBytes))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	w := httptest.NewRecorder()
+	handler.InitSharedGame(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response InitGameResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		span := spans[0]
+		assert.Equal(t, "InitSharedGame", span.Name())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+
+		attributes := map[string]string{}
+		for _, attr := range span.Attributes() {
+			attributes[string(attr.Key)] = attr.Value.Emit()
+		}
+		assert.Equal(t, response.GameID, attributes[string(tracing.AttrGameID)])
+		assert.Equal(t, "19", attributes[string(tracing.AttrPayloadSize)])
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Health Endpoints
+
+This file implements the HealthHandler component, which exposes the probes used by the
+hosting platform and by the monitoring workflow to decide whether an instance should
+receive traffic:
+
+- GET /healthz: liveness, the process is up and able to answer HTTP requests
+- GET /readyz: readiness, the server accepts connections, every dependency check
+  passes (game store reachable, ...) and the instance is not draining
+- GET /debug/status: detailed JSON report (goroutines, memory, open sockets, last
+  cleanup run, dependency checks, counters) for operators
+
+During a graceful shutdown the instance is marked as draining so that /readyz starts
+failing and the platform stops routing new games and viewers to it, while existing
+connections are allowed to finish.
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+func NewHealthHandler(gameManager *game.GameManager) *HealthHandler {
+	h := &HealthHandler{
+		gameManager: gameManager,
+		checks:      make(map[string]HealthCheck),
+		counters:    make(map[string]func() int64),
+	}
+	h.AddCheck("store", gameManager.Ping)
+	return h
+}
+
+// AddCheck registers a dependency check evaluated by /readyz and /debug/status.
+func (h *HealthHandler) AddCheck(name string, check HealthCheck) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.checks[name] = check
+}
+
+// AddCounter registers a counter reported by /debug/status.
+func (h *HealthHandler) AddCounter(name string, counter func() int64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.counters[name] = counter
+}
+
+// SetAccepting records whether the server listener is accepting connections.
+func (h *HealthHandler) SetAccepting(accepting bool) {
+	h.accepting.Store(accepting)
+}
+
+// SetDraining marks the instance as shutting down: readiness fails from now on.
+func (h *HealthHandler) SetDraining(draining bool) {
+	h.draining.Store(draining)
+}
+
+func (h *HealthHandler) IsDraining() bool {
+	return h.draining.Load()
+}
+
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	checks, healthy := h.runChecks(r.Context())
+
+	response := ReadinessResponse{
+		Status:    "ready",
+		Accepting: h.accepting.Load(),
+		Draining:  h.draining.Load(),
+		Checks:    checks,
+	}
+
+	code := http.StatusOK
+	if !healthy || !response.Accepting || response.Draining {
+		response.Status = "unavailable"
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, response)
+}
+
+func (h *HealthHandler) DebugStatus(w http.ResponseWriter, r *http.Request) {
+	checks, healthy := h.runChecks(r.Context())
+	metrics := h.gameManager.GetMetrics()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	response := DebugStatusResponse{
+		Status:          "ok",
+		Accepting:       h.accepting.Load(),
+		Draining:        h.draining.Load(),
+		Uptime:          time.Since(metrics.StartTime).String(),
+		Goroutines:      runtime.NumGoroutine(),
+		ActiveGames:     metrics.ActiveGames,
+		OpenConnections: metrics.OpenConnections,
+		Memory: MemoryStatus{
+			AllocBytes:     mem.Alloc,
+			HeapInuseBytes: mem.HeapInuse,
+			SysBytes:       mem.Sys,
+			NumGC:          mem.NumGC,
+		},
+		Checks:   checks,
+		Counters: h.readCounters(),
+	}
+	if !metrics.LastCleanup.IsZero() {
+		response.LastCleanup = metrics.LastCleanup.Format(time.RFC3339)
+	}
+	if !healthy {
+		response.Status = "degraded"
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// runChecks evaluates every registered dependency check with a shared timeout.
+func (h *HealthHandler) runChecks(ctx context.Context) (map[string]string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	h.mutex.RLock()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	h.mutex.RUnlock()
+	sort.Strings(names)
+
+	results := make(map[string]string, len(names))
+	healthy := true
+	for _, name := range names {
+		h.mutex.RLock()
+		check := h.checks[name]
+		h.mutex.RUnlock()
+
+		if err := check(ctx); err != nil {
+			results[name] = err.Error()
+			healthy = false
+		} else {
+			results[name] = "ok"
+		}
+	}
+	return results, healthy
+}
+
+func (h *HealthHandler) readCounters() map[string]int64 {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	counters := make(map[string]int64, len(h.counters))
+	for name, counter := range h.counters {
+		counters[name] = counter()
+	}
+	return counters
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
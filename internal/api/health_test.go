@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+func TestHealthz(t *testing.T) {
+	handler := NewHealthHandler(game.NewGameManager())
+
+	w := httptest.NewRecorder()
+	handler.Healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReadyz(t *testing.T) {
+	readyz := func(handler *HealthHandler) (int, ReadinessResponse) {
+		w := httptest.NewRecorder()
+		handler.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var response ReadinessResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	t.Run("Not Accepting Connections Yet", func(t *testing.T) {
+		handler := NewHealthHandler(game.NewGameManager())
+
+		code, response := readyz(handler)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.False(t, response.Accepting)
+	})
+
+	t.Run("Ready", func(t *testing.T) {
+		handler := NewHealthHandler(game.NewGameManager())
+		handler.SetAccepting(true)
+
+		code, response := readyz(handler)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "ready", response.Status)
+		assert.Equal(t, "ok", response.Checks["store"])
+	})
+
+	t.Run("Draining", func(t *testing.T) {
+		handler := NewHealthHandler(game.NewGameManager())
+		handler.SetAccepting(true)
+		handler.SetDraining(true)
+
+		code, response := readyz(handler)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.True(t, response.Draining)
+		assert.True(t, handler.IsDraining())
+	})
+
+	t.Run("Failing Dependency", func(t *testing.T) {
+		handler := NewHealthHandler(game.NewGameManager())
+		handler.SetAccepting(true)
+		handler.AddCheck("broker", func(ctx context.Context) error {
+			return errors.New("connection refused")
+		})
+
+		code, response := readyz(handler)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "connection refused", response.Checks["broker"])
+		assert.Equal(t, "ok", response.Checks["store"])
+	})
+}
+
+func TestDebugStatus(t *testing.T) {
+	gameManager := game.NewGameManager()
+	handler := NewHealthHandler(gameManager)
+	handler.SetAccepting(true)
+
+	gameManager.CreateGame("player1", []byte(`{}`))
+	gameManager.UpdateOpenConnections(3)
+	gameManager.CleanupInactiveGames()
+
+	w := httptest.NewRecorder()
+	handler.DebugStatus(w, httptest.NewRequest(http.MethodGet, "/debug/status", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response DebugStatusResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	assert.Equal(t, "ok", response.Status)
+	assert.Equal(t, 1, response.ActiveGames)
+	assert.Equal(t, 3, response.OpenConnections)
+	assert.Greater(t, response.Goroutines, 0)
+	assert.Greater(t, response.Memory.SysBytes, uint64(0))
+	assert.NotEmpty(t, response.LastCleanup)
+	assert.NotEmpty(t, response.Uptime)
+}
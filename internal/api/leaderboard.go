@@ -0,0 +1,68 @@
+/*
+Leaderboard API
+
+This file implements the LeaderboardHandler component, serving the boards of the best
+Yams scores across games:
+
+- GET /leaderboard?period=all|daily|weekly&limit=N: the top N players of a board (10 by
+  default, at most 100) with the all-time single-game records
+
+The live changes are pushed by the leaderboard WebSocket feed.
+*/
+
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/leaderboard"
+)
+
+const (
+	// DefaultLeaderboardLimit is the number of entries returned without a limit
+	DefaultLeaderboardLimit = 10
+	// MaxLeaderboardLimit is the largest number of entries returned
+	MaxLeaderboardLimit = 100
+)
+
+func NewLeaderboardHandler(board *leaderboard.Leaderboard) *LeaderboardHandler {
+	return &LeaderboardHandler{board: board}
+}
+
+// Leaderboard returns the top of a board, the all-time board by default.
+func (h *LeaderboardHandler) Leaderboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		HandleError(w, &AppError{
+			Code:    http.StatusMethodNotAllowed,
+			Message: ErrMethodNotAllowed,
+		})
+		return
+	}
+
+	period := leaderboard.Period(r.URL.Query().Get("period"))
+	if period == "" {
+		period = leaderboard.PeriodAllTime
+	}
+	if !leaderboard.ValidPeriod(period) {
+		HandleError(w, &AppError{
+			Code:    http.StatusBadRequest,
+			Message: ErrInvalidParam + ": period must be all, daily or weekly",
+		})
+		return
+	}
+	limit := DefaultLeaderboardLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > MaxLeaderboardLimit {
+			HandleError(w, &AppError{
+				Code:    http.StatusBadRequest,
+				Message: ErrInvalidParam + ": limit must be between 1 and " + strconv.Itoa(MaxLeaderboardLimit),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	writeJSON(w, http.StatusOK, h.board.Board(period, limit))
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/leaderboard"
+)
+
+func TestLeaderboardHandler(t *testing.T) {
+	board := leaderboard.New()
+	defer board.Close()
+	handler := NewLeaderboardHandler(board)
+	board.Record(game.GameResult{
+		GameID:     "g1",
+		SchemaName: game.YamsScorecardSchema,
+		EndedAt:    time.Now(),
+		Players: []game.PlayerResult{
+			{Standing: game.Standing{Rank: 1, PlayerID: "alice", Score: 270}, Scorecard: &game.Scorecard{Yams: 1}},
+			{Standing: game.Standing{Rank: 2, PlayerID: "bob", Score: 240}},
+		},
+	})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Leaderboard(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	t.Run("All-Time Board By Default", func(t *testing.T) {
+		w := get("/leaderboard")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response leaderboard.Board
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, leaderboard.PeriodAllTime, response.Period)
+		assert.Len(t, response.Entries, 2)
+		assert.Equal(t, "alice", response.Records.MostYams.PlayerID)
+	})
+
+	t.Run("Weekly Board With Limit", func(t *testing.T) {
+		w := get("/leaderboard?period=weekly&limit=1")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response leaderboard.Board
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.NotNil(t, response.Since)
+		assert.Len(t, response.Entries, 1)
+	})
+
+	t.Run("Invalid Parameters", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get("/leaderboard?period=monthly").Code)
+		assert.Equal(t, http.StatusBadRequest, get("/leaderboard?limit=0").Code)
+		assert.Equal(t, http.StatusBadRequest, get("/leaderboard?limit=1000").Code)
+	})
+}
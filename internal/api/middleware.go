@@ -16,19 +16,10 @@ func WithLogging(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// WithCORS applies a CORS policy accepting every origin.
+// Use OriginPolicy.WithCORS to restrict the allowed origins.
 func WithCORS(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*") 
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		
-		next(w, r)
-	}
+	return allowAllOrigins.WithCORS(next)
 }
 
 func WithMiddlewares(handler http.HandlerFunc, middlewares ...func(http.HandlerFunc) http.HandlerFunc) http.HandlerFunc {
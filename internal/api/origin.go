@@ -0,0 +1,159 @@
+/*
+Origin Policy
+
+This file implements the OriginPolicy component, which decides which web origins may
+use the service. The same policy is enforced by the CORS middleware for HTTP endpoints
+and by the WebSocket upgrader (CheckOrigin) for /hostGame and /viewGame, so a site that
+is not on the allowlist can neither create games nor drive a host socket.
+
+Allowed origins are configured as:
+- "*": every origin (the historical behavior, incompatible with credentials)
+- "https://app.example.com": an exact origin (scheme, host and optional port)
+- "https://*.example.com": any subdomain of example.com over https, at any depth,
+  excluding example.com itself
+
+Requests without an Origin header (native clients, curl, server-to-server) are not
+subject to the policy. Rejected origins are logged and counted.
+*/
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+const (
+	ErrOriginNotAllowed = "Origin not allowed"
+
+	corsAllowMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	corsAllowHeaders = "Content-Type, Authorization"
+	corsMaxAge       = "600"
+)
+
+var allowAllOrigins = &OriginPolicy{allowAll: true}
+
+func NewOriginPolicy(allowedOrigins []string, allowCredentials bool) (*OriginPolicy, error) {
+	policy := &OriginPolicy{
+		exact:            make(map[string]bool),
+		allowCredentials: allowCredentials,
+	}
+
+	for _, pattern := range allowedOrigins {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*" {
+			policy.allowAll = true
+			continue
+		}
+
+		parsed, err := url.Parse(pattern)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || (parsed.Path != "" && parsed.Path != "/") {
+			return nil, fmt.Errorf("invalid allowed origin %q: expected scheme://host[:port]", pattern)
+		}
+
+		if suffix, ok := strings.CutPrefix(parsed.Host, "*."); ok {
+			if suffix == "" || strings.Contains(suffix, "*") {
+				return nil, fmt.Errorf("invalid allowed origin %q: malformed wildcard", pattern)
+			}
+			policy.wildcards = append(policy.wildcards, wildcardOrigin{scheme: parsed.Scheme, suffix: "." + suffix})
+			continue
+		}
+		if strings.Contains(parsed.Host, "*") {
+			return nil, fmt.Errorf("invalid allowed origin %q: wildcard must be the leftmost label", pattern)
+		}
+		policy.exact[parsed.Scheme+"://"+parsed.Host] = true
+	}
+
+	if policy.allowAll && allowCredentials {
+		return nil, fmt.Errorf("credentialed requests cannot be allowed from every origin")
+	}
+	return policy, nil
+}
+
+// Allowed reports whether a browser origin is on the allowlist.
+func (p *OriginPolicy) Allowed(origin string) bool {
+	if p.allowAll {
+		return true
+	}
+
+	parsed, err := url.Parse(strings.ToLower(origin))
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return false
+	}
+	if p.exact[parsed.Scheme+"://"+parsed.Host] {
+		return true
+	}
+	for _, wildcard := range p.wildcards {
+		if parsed.Scheme == wildcard.scheme && strings.HasSuffix(parsed.Host, wildcard.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOrigin is meant to be used as the WebSocket upgrader's CheckOrigin function.
+func (p *OriginPolicy) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || p.Allowed(origin) {
+		return true
+	}
+	p.reject(r, origin)
+	return false
+}
+
+// WithCORS is a middleware answering CORS preflights and decorating responses for
+// allowed origins. Requests from other origins are refused with 403.
+func (p *OriginPolicy) WithCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+
+		// The response depends on the Origin header unless it is the same for everyone
+		if !p.allowAll || p.allowCredentials {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		if origin != "" {
+			if !p.Allowed(origin) {
+				p.reject(r, origin)
+				HandleError(w, &AppError{
+					Code:    http.StatusForbidden,
+					Message: ErrOriginNotAllowed,
+				})
+				return
+			}
+
+			if p.allowAll && !p.allowCredentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if p.allowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+		}
+
+		if r.Method == "OPTIONS" {
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// RejectedCount returns how many requests were refused because of their origin.
+func (p *OriginPolicy) RejectedCount() int64 {
+	return p.rejected.Load()
+}
+
+func (p *OriginPolicy) reject(r *http.Request, origin string) {
+	count := p.rejected.Add(1)
+	logger.Warn.Printf("Origin rejected: %s %s from %q (total rejected: %d)", r.Method, r.URL.Path, origin, count)
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOriginPolicy(t *testing.T) {
+	t.Run("Invalid Patterns", func(t *testing.T) {
+		for _, pattern := range []string{"example.com", "https://", "https://a.*.example.com", "https://example.com/path"} {
+			_, err := NewOriginPolicy([]string{pattern}, false)
+			assert.Error(t, err, pattern)
+		}
+	})
+
+	t.Run("Credentials With Every Origin", func(t *testing.T) {
+		_, err := NewOriginPolicy([]string{"*"}, true)
+		assert.Error(t, err)
+	})
+}
+
+func TestOriginPolicyAllowed(t *testing.T) {
+	policy, err := NewOriginPolicy([]string{"https://yams.example.com", "https://*.attack.dev", "http://localhost:3000"}, false)
+	require.NoError(t, err)
+
+	allowed := []string{
+		"https://yams.example.com",
+		"https://YAMS.example.com",
+		"https://play.attack.dev",
+		"https://eu.play.attack.dev",
+		"http://localhost:3000",
+	}
+	for _, origin := range allowed {
+		assert.True(t, policy.Allowed(origin), origin)
+	}
+
+	rejected := []string{
+		"http://yams.example.com",
+		"https://evil.example.com",
+		"https://attack.dev",
+		"https://evilattack.dev",
+		"http://play.attack.dev",
+		"http://localhost:3001",
+		"null",
+	}
+	for _, origin := range rejected {
+		assert.False(t, policy.Allowed(origin), origin)
+	}
+}
+
+func TestOriginPolicyWithCORS(t *testing.T) {
+	policy, err := NewOriginPolicy([]string{"https://*.example.com"}, true)
+	require.NoError(t, err)
+
+	called := false
+	handler := policy.WithCORS(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	t.Run("Allowed Origin", func(t *testing.T) {
+		called = false
+		req := httptest.NewRequest(http.MethodPost, "/initSharedGame", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		assert.True(t, called)
+		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "Origin", w.Header().Get("Vary"))
+	})
+
+	t.Run("Preflight", func(t *testing.T) {
+		called = false
+		req := httptest.NewRequest(http.MethodOptions, "/initSharedGame", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		assert.False(t, called)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Access-Control-Allow-Methods"))
+	})
+
+	t.Run("Rejected Origin", func(t *testing.T) {
+		called = false
+		before := policy.RejectedCount()
+		req := httptest.NewRequest(http.MethodPost, "/initSharedGame", nil)
+		req.Header.Set("Origin", "https://evil.test")
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		assert.False(t, called)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, before+1, policy.RejectedCount())
+	})
+
+	t.Run("No Origin Header", func(t *testing.T) {
+		called = false
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+		assert.True(t, called)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
+func TestOriginPolicyCheckOrigin(t *testing.T) {
+	policy, err := NewOriginPolicy([]string{"https://yams.example.com"}, false)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/hostGame", nil)
+	assert.True(t, policy.CheckOrigin(req), "native clients send no Origin")
+
+	req.Header.Set("Origin", "https://yams.example.com")
+	assert.True(t, policy.CheckOrigin(req))
+
+	req.Header.Set("Origin", "https://elsewhere.example.com")
+	assert.False(t, policy.CheckOrigin(req))
+	assert.Equal(t, int64(1), policy.RejectedCount())
+}
+
+func TestWithCORSAllowsEveryOrigin(t *testing.T) {
+	handler := WithCORS(func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+	req.Header.Set("Origin", "https://anywhere.test")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Vary"))
+}
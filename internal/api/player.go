@@ -0,0 +1,73 @@
+/*
+Player API
+
+This file implements the PlayerHandler component, serving the player profiles computed
+from the results of the games ended:
+
+- GET /players/{id}: the statistics and last finished games of a player
+- GET /players/{id}/games/{gameId}: the archived result of one of these games, kept
+  while the profile lists it
+*/
+
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/profile"
+)
+
+// PlayersPrefix is the path prefix of the player profiles
+const PlayersPrefix = "/players/"
+
+func NewPlayerHandler(profiles *profile.Store) *PlayerHandler {
+	return &PlayerHandler{profiles: profiles}
+}
+
+// Profile returns the profile of the player named by the request path, or the result of
+// one of its last games.
+func (h *PlayerHandler) Profile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		HandleError(w, &AppError{
+			Code:    http.StatusMethodNotAllowed,
+			Message: ErrMethodNotAllowed,
+		})
+		return
+	}
+
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, PlayersPrefix), "/")
+	if len(segments) == 3 && segments[1] == "games" {
+		h.result(w, segments[0], segments[2])
+		return
+	}
+	playerID := segments[0]
+	if playerID == "" || len(segments) > 1 {
+		HandleError(w, &AppError{
+			Code:    http.StatusNotFound,
+			Message: ErrPlayerNotFound,
+		})
+		return
+	}
+	playerProfile, exists := h.profiles.Profile(playerID)
+	if !exists {
+		HandleError(w, &AppError{
+			Code:    http.StatusNotFound,
+			Message: ErrPlayerNotFound,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, playerProfile)
+}
+
+func (h *PlayerHandler) result(w http.ResponseWriter, playerID, gameID string) {
+	result, exists := h.profiles.Result(playerID, gameID)
+	if !exists {
+		HandleError(w, &AppError{
+			Code:    http.StatusNotFound,
+			Message: ErrGameNotFound,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/profile"
+)
+
+func TestPlayerHandler(t *testing.T) {
+	profiles := profile.New()
+	handler := NewPlayerHandler(profiles)
+	profiles.Record(game.GameResult{
+		GameID:       "g1",
+		HostPlayerID: "alice",
+		Players:      []game.PlayerResult{{Standing: game.Standing{Rank: 1, PlayerID: "alice", Score: 250}}},
+	})
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Profile(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	w := serve(http.MethodGet, "/players/alice")
+	require.Equal(t, http.StatusOK, w.Code)
+	var response profile.Profile
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "alice", response.PlayerID)
+	assert.Equal(t, 1, response.GamesPlayed)
+	assert.Equal(t, 250, response.BestScore)
+
+	w = serve(http.MethodGet, response.RecentGames[0].ResultURL)
+	require.Equal(t, http.StatusOK, w.Code)
+	var result game.GameResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, "g1", result.GameID)
+	assert.Equal(t, "alice", result.HostPlayerID)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/players/alice/games/g2").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/players/bob/games/g1").Code)
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/players/bob").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/players/").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "/players/alice").Code)
+}
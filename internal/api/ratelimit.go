@@ -0,0 +1,245 @@
+/*
+Rate Limiting
+
+This file implements token-bucket rate limiting for the public endpoints:
+- RateLimiter keeps one bucket per key (client IP, host ID, ...) and is plugged into a
+  route through WithMiddlewares using its Middleware method
+- TokenBucket is a single bucket, used on its own to limit the messages received on
+  one WebSocket connection
+- TrustedProxies resolves the real client IP from Fly-Client-IP / X-Forwarded-For,
+  only when the request comes from a trusted proxy, so clients cannot spoof their IP
+
+Rejected requests are answered with 429 Too Many Requests and a Retry-After header.
+*/
+
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+const (
+	ErrRateLimited = "Too many requests"
+
+	// bucketEvictionInterval is how often idle buckets are dropped from a RateLimiter
+	bucketEvictionInterval = time.Minute
+)
+
+func NewTokenBucket(limit RateLimit) *TokenBucket {
+	return &TokenBucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow consumes a token if one is available. When the bucket is empty it returns
+// false and the delay after which a token will be available.
+func (b *TokenBucket) Allow() (bool, time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.take(time.Now())
+}
+
+func (b *TokenBucket) take(now time.Time) (bool, time.Duration) {
+	if b.limit.Rate <= 0 {
+		return true, 0
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// full reports whether the bucket would be back to its burst capacity at now.
+func (b *TokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst)
+}
+
+func NewRateLimiter(name string, limit RateLimit) *RateLimiter {
+	return &RateLimiter{
+		name:      name,
+		limit:     limit,
+		buckets:   make(map[string]*TokenBucket),
+		lastEvict: time.Now(),
+	}
+}
+
+// Allow consumes a token from the bucket of key.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	if l.limit.Rate <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.lastEvict) > bucketEvictionInterval {
+		l.evictIdle(now)
+	}
+
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &TokenBucket{limit: l.limit, tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+
+	allowed, wait := bucket.take(now)
+	if !allowed {
+		l.rejected.Add(1)
+	}
+	return allowed, wait
+}
+
+// Middleware limits the requests sharing the same key. Requests for which keyFunc
+// returns an empty key are not limited.
+func (l *RateLimiter) Middleware(keyFunc KeyFunc) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			key := keyFunc(r)
+			if key == "" {
+				next(w, r)
+				return
+			}
+
+			if allowed, wait := l.Allow(key); !allowed {
+				w.Header().Set("Retry-After", RetryAfterSeconds(wait))
+				HandleError(w, &AppError{
+					Code:    http.StatusTooManyRequests,
+					Message: ErrRateLimited,
+					Err:     fmt.Errorf("%s limit reached for %s", l.name, key),
+				})
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// RejectedCount returns how many requests were refused by this limiter.
+func (l *RateLimiter) RejectedCount() int64 {
+	return l.rejected.Load()
+}
+
+// evictIdle drops the buckets that have refilled completely: they are equivalent
+// to a new bucket. Must be called with the mutex held.
+func (l *RateLimiter) evictIdle(now time.Time) {
+	for key, bucket := range l.buckets {
+		if bucket.full(now) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastEvict = now
+	logger.Debug.Printf("Rate limiter %s: %d active buckets", l.name, len(l.buckets))
+}
+
+// RetryAfterSeconds formats a delay for the Retry-After header (whole seconds, at least 1).
+func RetryAfterSeconds(wait time.Duration) string {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
+
+// QueryKey keys requests by a query parameter, e.g. the hostId of /hostGame.
+func QueryKey(param string) KeyFunc {
+	return func(r *http.Request) string {
+		if value := r.URL.Query().Get(param); value != "" {
+			return param + ":" + value
+		}
+		return ""
+	}
+}
+
+// ClientIPKey keys requests by client IP address.
+func ClientIPKey(proxies *TrustedProxies) KeyFunc {
+	return func(r *http.Request) string {
+		return "ip:" + proxies.ClientIP(r)
+	}
+}
+
+func NewTrustedProxies(cidrs []string) (*TrustedProxies, error) {
+	proxies := &TrustedProxies{}
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		proxies.networks = append(proxies.networks, network)
+	}
+	return proxies, nil
+}
+
+// ClientIP returns the IP address of the client. Forwarding headers are only
+// honored when the direct peer is a trusted proxy.
+func (p *TrustedProxies) ClientIP(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if p == nil || !p.trusted(remote) {
+		return remote
+	}
+
+	if flyIP := strings.TrimSpace(r.Header.Get("Fly-Client-IP")); net.ParseIP(flyIP) != nil {
+		return flyIP
+	}
+
+	// Walk X-Forwarded-For from the closest hop: the first untrusted address is the client
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		if !p.trusted(hop) {
+			return hop
+		}
+		remote = hop
+	}
+	return remote
+}
+
+func (p *TrustedProxies) trusted(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := NewTokenBucket(RateLimit{Rate: 2, Burst: 3})
+	start := bucket.last
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := bucket.take(start)
+		assert.True(t, allowed, "burst token %d", i)
+	}
+
+	allowed, wait := bucket.take(start)
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	allowed, _ = bucket.take(start.Add(500 * time.Millisecond))
+	assert.True(t, allowed, "a token is refilled after 1/rate seconds")
+
+	assert.False(t, bucket.full(start.Add(time.Second)))
+	assert.True(t, bucket.full(start.Add(2*time.Second)))
+}
+
+func TestTokenBucketDisabled(t *testing.T) {
+	bucket := NewTokenBucket(RateLimit{})
+	for i := 0; i < 100; i++ {
+		allowed, _ := bucket.Allow()
+		assert.True(t, allowed)
+	}
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	limiter := NewRateLimiter("test", RateLimit{Rate: 0.001, Burst: 2})
+
+	for i := 0; i < 2; i++ {
+		allowed, _ := limiter.Allow("ip:1.1.1.1")
+		assert.True(t, allowed)
+	}
+	allowed, wait := limiter.Allow("ip:1.1.1.1")
+	assert.False(t, allowed)
+	assert.Greater(t, wait, time.Duration(0))
+
+	allowed, _ = limiter.Allow("ip:2.2.2.2")
+	assert.True(t, allowed, "each key has its own bucket")
+	assert.Equal(t, int64(1), limiter.RejectedCount())
+}
+
+func TestRateLimiterEvictsIdleBuckets(t *testing.T) {
+	limiter := NewRateLimiter("test", RateLimit{Rate: 100, Burst: 1})
+	limiter.Allow("ip:1.1.1.1")
+	assert.Len(t, limiter.buckets, 1)
+
+	limiter.evictIdle(time.Now().Add(time.Second))
+	assert.Empty(t, limiter.buckets)
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	limiter := NewRateLimiter("createGame", RateLimit{Rate: 0.01, Burst: 1})
+	handler := WithMiddlewares(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, limiter.Middleware(QueryKey("hostId")))
+
+	request := func(hostID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/hostGame?hostId="+hostID, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request("alice").Code)
+
+	w := request("alice")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "100", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, request("bob").Code)
+	assert.Equal(t, http.StatusOK, request("").Code, "requests without key are not limited")
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	assert.Equal(t, "1", RetryAfterSeconds(0))
+	assert.Equal(t, "1", RetryAfterSeconds(200*time.Millisecond))
+	assert.Equal(t, "3", RetryAfterSeconds(2100*time.Millisecond))
+}
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	proxies, err := NewTrustedProxies([]string{"10.0.0.0/8", "fdaa::1"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{
+			name:       "Direct Client Ignores Headers",
+			remoteAddr: "203.0.113.7:5000",
+			headers:    map[string]string{"Fly-Client-IP": "1.2.3.4", "X-Forwarded-For": "1.2.3.4"},
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "Fly Client IP From Trusted Proxy",
+			remoteAddr: "[fdaa::1]:443",
+			headers:    map[string]string{"Fly-Client-IP": "198.51.100.4"},
+			expected:   "198.51.100.4",
+		},
+		{
+			name:       "Forwarded For Skips Trusted Hops",
+			remoteAddr: "10.0.0.2:80",
+			headers:    map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.9, 10.0.0.5"},
+			expected:   "198.51.100.9",
+		},
+		{
+			name:       "Trusted Proxy Without Headers",
+			remoteAddr: "10.0.0.2:80",
+			expected:   "10.0.0.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/viewGame", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			assert.Equal(t, tt.expected, proxies.ClientIP(req))
+		})
+	}
+
+	_, err = NewTrustedProxies([]string{"not-an-ip"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,158 @@
+/*
+Game Ownership Routing
+
+This file implements the routing of game requests to the instance owning the game, as
+an alternative to sharing the game messages across instances. The owning instance is
+read from the game ID (see game.OwnerInstance), and a request reaching another instance
+is either:
+- replayed: answered with a Fly-Replay header asking the Fly.io proxy to send the same
+  request again to the owning machine (mode "replay")
+- proxied: forwarded to the owning instance through an internal reverse proxy hop,
+  WebSocket upgrades included (mode "proxy")
+
+Each request is routed at most once: a request already replayed or forwarded that
+still misses its owner is answered with 404, as the owner no longer exists.
+*/
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+const (
+	ErrGameNotOwned     = "Game owned by another instance"
+	ErrOwnerUnreachable = "Game owner unreachable"
+
+	// RoutingReplay answers with a Fly-Replay header
+	RoutingReplay = "replay"
+	// RoutingProxy forwards the request to the owning instance
+	RoutingProxy = "proxy"
+
+	// ReplayHeader asks the Fly.io proxy to replay the request on another machine
+	ReplayHeader = "Fly-Replay"
+	// ReplaySourceHeader is set by the Fly.io proxy on replayed requests
+	ReplaySourceHeader = "Fly-Replay-Src"
+	// ForwardedByHeader is set on the requests forwarded by the proxy mode
+	ForwardedByHeader = "X-Yams-Forwarded-By"
+
+	// instancePlaceholder is replaced by the instance ID in owner URL templates
+	instancePlaceholder = "{instance}"
+)
+
+func NewOwnershipRouter(gameManager *game.GameManager, config RoutingConfig) (*OwnershipRouter, error) {
+	switch config.Mode {
+	case RoutingReplay:
+	case RoutingProxy:
+		if config.OwnerURL == nil {
+			return nil, fmt.Errorf("the proxy routing mode needs the URL of the owning instances")
+		}
+	default:
+		return nil, fmt.Errorf("unknown routing mode %q, expected %s or %s", config.Mode, RoutingReplay, RoutingProxy)
+	}
+	if gameManager.InstanceID() == "" {
+		return nil, fmt.Errorf("routing requires an instance ID")
+	}
+
+	return &OwnershipRouter{
+		gameManager: gameManager,
+		config:      config,
+	}, nil
+}
+
+// OwnerURLTemplate resolves instance URLs from a template containing "{instance}",
+// such as http://{instance}.vm.my-app.internal:8080 on Fly.io.
+func OwnerURLTemplate(template string) (func(instanceID string) (*url.URL, error), error) {
+	if !strings.Contains(template, instancePlaceholder) {
+		return nil, fmt.Errorf("owner URL template %q must contain %s", template, instancePlaceholder)
+	}
+	if _, err := url.Parse(strings.ReplaceAll(template, instancePlaceholder, "instance")); err != nil {
+		return nil, fmt.Errorf("invalid owner URL template: %w", err)
+	}
+
+	return func(instanceID string) (*url.URL, error) {
+		return url.Parse(strings.ReplaceAll(template, instancePlaceholder, instanceID))
+	}, nil
+}
+
+// Middleware routes the requests carrying a gameId query parameter to the instance
+// owning the game. Requests for local games, or without game, are served by next.
+func (o *OwnershipRouter) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		gameID := r.URL.Query().Get("gameId")
+		if gameID == "" || o.gameManager.Owns(gameID) {
+			next(w, r)
+			return
+		}
+		owner, _ := game.OwnerInstance(gameID)
+		if !game.ValidInstanceID(owner) {
+			HandleError(w, &AppError{
+				Code:    http.StatusNotFound,
+				Message: ErrGameNotFound,
+				Err:     fmt.Errorf("invalid owner instance in game ID %q", gameID),
+			})
+			return
+		}
+
+		if r.Header.Get(ReplaySourceHeader) != "" || r.Header.Get(ForwardedByHeader) != "" {
+			HandleError(w, &AppError{
+				Code:    http.StatusNotFound,
+				Message: ErrGameNotFound,
+				Err:     fmt.Errorf("request already routed, owner %s of game %s is gone", owner, gameID),
+			})
+			return
+		}
+		o.routed.Add(1)
+
+		if o.config.Mode == RoutingReplay {
+			logger.Debug.Printf("Replaying %s on instance %s (GameID=%s)", r.URL.Path, owner, gameID)
+			w.Header().Set(ReplayHeader, "instance="+owner)
+			http.Error(w, ErrGameNotOwned, http.StatusMisdirectedRequest)
+			return
+		}
+
+		proxy, err := o.proxyFor(owner)
+		if err != nil {
+			HandleError(w, &AppError{
+				Code:    http.StatusBadGateway,
+				Message: ErrOwnerUnreachable,
+				Err:     err,
+			})
+			return
+		}
+		logger.Debug.Printf("Forwarding %s to instance %s (GameID=%s)", r.URL.Path, owner, gameID)
+		r.Header.Set(ForwardedByHeader, o.gameManager.InstanceID())
+		proxy.ServeHTTP(w, r)
+	}
+}
+
+// RoutedCount returns how many requests were sent to another instance.
+func (o *OwnershipRouter) RoutedCount() int64 {
+	return o.routed.Load()
+}
+
+// proxyFor returns a reverse proxy towards an instance. Proxies are cheap to build and
+// share the default transport connections, so they are not cached: the instance IDs
+// come from client input.
+func (o *OwnershipRouter) proxyFor(instanceID string) (*httputil.ReverseProxy, error) {
+	target, err := o.config.OwnerURL(instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve instance %s: %w", instanceID, err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		HandleError(w, &AppError{
+			Code:    http.StatusBadGateway,
+			Message: ErrOwnerUnreachable,
+			Err:     fmt.Errorf("instance %s: %w", instanceID, err),
+		})
+	}
+	return proxy, nil
+}
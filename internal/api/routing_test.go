@@ -0,0 +1,223 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+// testInstance is one server instance of an in-process cluster
+type testInstance struct {
+	manager *game.GameManager
+	router  *OwnershipRouter
+	server  *httptest.Server
+}
+
+// newCluster starts one instance per ID. Each instance answers /gameInfo and /viewGame
+// with its own ID, behind the ownership router.
+func newCluster(t *testing.T, mode string, instanceIDs ...string) map[string]*testInstance {
+	cluster := make(map[string]*testInstance)
+	ownerURL := func(instanceID string) (*url.URL, error) {
+		instance, exists := cluster[instanceID]
+		if !exists {
+			return url.Parse("http://127.0.0.1:1")
+		}
+		return url.Parse(instance.server.URL)
+	}
+
+	for _, instanceID := range instanceIDs {
+		config := game.DefaultConfig()
+		config.InstanceID = instanceID
+		manager := game.NewGameManagerWithConfig(config)
+		router, err := NewOwnershipRouter(manager, RoutingConfig{Mode: mode, OwnerURL: ownerURL})
+		require.NoError(t, err)
+
+		servedBy := instanceID
+		upgrader := websocket.Upgrader{}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/gameInfo", router.Middleware(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := manager.GetGame(r.URL.Query().Get("gameId")); err != nil {
+				http.Error(w, ErrGameNotFound, http.StatusNotFound)
+				return
+			}
+			io.WriteString(w, servedBy)
+		}))
+		mux.HandleFunc("/viewGame", router.Middleware(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.WriteMessage(websocket.TextMessage, []byte(servedBy))
+		}))
+
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		cluster[instanceID] = &testInstance{manager: manager, router: router, server: server}
+	}
+	return cluster
+}
+
+// flyProxy mimics the Fly.io proxy: requests go to the entry instance and are replayed
+// once on the instance named by a Fly-Replay response header.
+func flyProxy(t *testing.T, cluster map[string]*testInstance, entry string, path string) *http.Response {
+	resp, err := http.Get(cluster[entry].server.URL + path)
+	require.NoError(t, err)
+
+	replay := resp.Header.Get(ReplayHeader)
+	if replay == "" {
+		return resp
+	}
+	resp.Body.Close()
+
+	target := strings.TrimPrefix(replay, "instance=")
+	req, _ := http.NewRequest(http.MethodGet, cluster[target].server.URL+path, nil)
+	req.Header.Set(ReplaySourceHeader, "instance="+entry+";region=cdg")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestReplayRouting(t *testing.T) {
+	cluster := newCluster(t, RoutingReplay, "machine-a", "machine-b")
+	gameID, err := cluster["machine-b"].manager.CreateGame("player1", []byte(`{}`))
+	require.NoError(t, err)
+
+	t.Run("Owner Serves Directly", func(t *testing.T) {
+		resp := flyProxy(t, cluster, "machine-b", "/gameInfo?gameId="+gameID)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "machine-b", readBody(t, resp))
+	})
+
+	t.Run("Other Instance Asks For A Replay", func(t *testing.T) {
+		resp, err := http.Get(cluster["machine-a"].server.URL + "/gameInfo?gameId=" + gameID)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMisdirectedRequest, resp.StatusCode)
+		assert.Equal(t, "instance=machine-b", resp.Header.Get(ReplayHeader))
+
+		resp = flyProxy(t, cluster, "machine-a", "/gameInfo?gameId="+gameID)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "machine-b", readBody(t, resp))
+	})
+
+	t.Run("WebSocket Upgrade Is Replayed", func(t *testing.T) {
+		wsURL := "ws" + strings.TrimPrefix(cluster["machine-a"].server.URL, "http") + "/viewGame?gameId=" + gameID
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		assert.Error(t, err)
+		if assert.NotNil(t, resp) {
+			assert.Equal(t, "instance=machine-b", resp.Header.Get(ReplayHeader))
+		}
+	})
+
+	t.Run("Replayed Request Is Not Replayed Again", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, cluster["machine-a"].server.URL+"/gameInfo?gameId="+gameID, nil)
+		req.Header.Set(ReplaySourceHeader, "instance=machine-b")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get(ReplayHeader))
+	})
+
+	assert.Equal(t, int64(3), cluster["machine-a"].router.RoutedCount())
+	assert.Equal(t, int64(0), cluster["machine-b"].router.RoutedCount())
+}
+
+func TestProxyRouting(t *testing.T) {
+	cluster := newCluster(t, RoutingProxy, "machine-a", "machine-b", "machine-c")
+	gameID, err := cluster["machine-b"].manager.CreateGame("player1", []byte(`{}`))
+	require.NoError(t, err)
+
+	t.Run("REST Request Is Forwarded", func(t *testing.T) {
+		for _, entry := range []string{"machine-a", "machine-b", "machine-c"} {
+			resp, err := http.Get(cluster[entry].server.URL + "/gameInfo?gameId=" + gameID)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "machine-b", readBody(t, resp), "request entering on %s", entry)
+		}
+	})
+
+	t.Run("WebSocket Is Forwarded", func(t *testing.T) {
+		wsURL := "ws" + strings.TrimPrefix(cluster["machine-c"].server.URL, "http") + "/viewGame?gameId=" + gameID
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, "machine-b", string(message))
+	})
+
+	t.Run("Forwarded Request Is Not Forwarded Again", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, cluster["machine-a"].server.URL+"/gameInfo?gameId="+gameID, nil)
+		req.Header.Set(ForwardedByHeader, "machine-c")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Unreachable Owner", func(t *testing.T) {
+		resp, err := http.Get(cluster["machine-a"].server.URL + "/gameInfo?gameId=machine-z.0b6e1f2c")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	})
+
+	t.Run("Invalid Owner", func(t *testing.T) {
+		resp, err := http.Get(cluster["machine-a"].server.URL + "/gameInfo?gameId=" + url.QueryEscape("evil:80/x.0b6e1f2c"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Games Without Owner Are Served Locally", func(t *testing.T) {
+		routed := cluster["machine-a"].router.RoutedCount()
+		resp, err := http.Get(cluster["machine-a"].server.URL + "/gameInfo?gameId=0b6e1f2c-5c1e-4b7a-9d7e-2f1f0c3b9a11")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "answered by machine-a itself")
+		assert.Equal(t, routed, cluster["machine-a"].router.RoutedCount())
+	})
+}
+
+func TestNewOwnershipRouter(t *testing.T) {
+	config := game.DefaultConfig()
+	config.InstanceID = "machine-a"
+	manager := game.NewGameManagerWithConfig(config)
+
+	_, err := NewOwnershipRouter(manager, RoutingConfig{Mode: "teleport"})
+	assert.Error(t, err)
+	_, err = NewOwnershipRouter(manager, RoutingConfig{Mode: RoutingProxy})
+	assert.Error(t, err, "the proxy mode needs owner URLs")
+	_, err = NewOwnershipRouter(game.NewGameManager(), RoutingConfig{Mode: RoutingReplay})
+	assert.Error(t, err, "routing needs an instance ID")
+
+	ownerURL, err := OwnerURLTemplate("http://{instance}.vm.yams.internal:8080")
+	require.NoError(t, err)
+	resolved, err := ownerURL("148ed193b95e89")
+	require.NoError(t, err)
+	assert.Equal(t, "http://148ed193b95e89.vm.yams.internal:8080", resolved.String())
+
+	_, err = OwnerURLTemplate("http://yams.internal:8080")
+	assert.Error(t, err)
+}
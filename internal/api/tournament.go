@@ -0,0 +1,126 @@
+/*
+Tournament API
+
+This file implements the TournamentHandler component, serving the tournaments grouping
+Yams games into rounds:
+
+- POST /tournaments: create a tournament and the games of its first round
+- GET /tournaments/{id}: the rounds, games and standings of a tournament
+
+The changes of a tournament and the messages of its games are pushed by the tournament
+viewer WebSocket.
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/tournament"
+)
+
+// TournamentsPrefix is the path prefix of the tournaments
+const TournamentsPrefix = "/tournaments/"
+
+// maxTournamentBodySize bounds the body of a tournament creation
+const maxTournamentBodySize = 16 << 10
+
+func NewTournamentHandler(tournaments *tournament.Manager) *TournamentHandler {
+	return &TournamentHandler{tournaments: tournaments}
+}
+
+// Create starts a tournament from the options of the request body.
+func (h *TournamentHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		HandleError(w, &AppError{
+			Code:    http.StatusMethodNotAllowed,
+			Message: ErrMethodNotAllowed,
+		})
+		return
+	}
+	if r.Body == nil || r.ContentLength == 0 {
+		HandleError(w, &AppError{
+			Code:    http.StatusBadRequest,
+			Message: ErrNoBody,
+		})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxTournamentBodySize)
+
+	var opts tournament.Options
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			HandleError(w, &AppError{
+				Code:    http.StatusRequestEntityTooLarge,
+				Message: ErrPayloadTooLarge,
+				Err:     err,
+			})
+			return
+		}
+		HandleError(w, &AppError{
+			Code:    http.StatusBadRequest,
+			Message: ErrJSONParsing,
+			Err:     err,
+		})
+		return
+	}
+
+	created, err := h.tournaments.Create(opts)
+	if errors.Is(err, tournament.ErrInvalidTournament) {
+		HandleError(w, &AppError{
+			Code:    http.StatusBadRequest,
+			Message: ErrInvalidTournament + ": " + strings.TrimPrefix(err.Error(), tournament.ErrInvalidTournament.Error()+": "),
+		})
+		return
+	}
+	if err != nil {
+		HandleError(w, &AppError{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to create tournament",
+			Err:     err,
+		})
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// Tournament returns the tournament named by the request path.
+func (h *TournamentHandler) Tournament(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		HandleError(w, &AppError{
+			Code:    http.StatusMethodNotAllowed,
+			Message: ErrMethodNotAllowed,
+		})
+		return
+	}
+
+	tournamentID := strings.TrimPrefix(r.URL.Path, TournamentsPrefix)
+	if tournamentID == "" || strings.Contains(tournamentID, "/") {
+		HandleError(w, &AppError{
+			Code:    http.StatusNotFound,
+			Message: ErrTournamentNotFound,
+		})
+		return
+	}
+	found, err := h.tournaments.Tournament(r.Context(), tournamentID)
+	if errors.Is(err, tournament.ErrNotFound) {
+		HandleError(w, &AppError{
+			Code:    http.StatusNotFound,
+			Message: ErrTournamentNotFound,
+		})
+		return
+	}
+	if err != nil {
+		HandleError(w, &AppError{
+			Code:    http.StatusServiceUnavailable,
+			Message: ErrBroadcastUnavailable,
+			Err:     err,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, found)
+}
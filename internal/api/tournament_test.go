@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/tournament"
+)
+
+func TestTournamentHandler(t *testing.T) {
+	tournaments := tournament.NewManager(game.NewGameManager())
+	defer tournaments.Close()
+	handler := NewTournamentHandler(tournaments)
+
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Create(w, httptest.NewRequest(http.MethodPost, "/tournaments", strings.NewReader(body)))
+		return w
+	}
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Tournament(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	t.Run("Create And Get", func(t *testing.T) {
+		w := create(`{"name":"Friday","format":"aggregate","players":["alice","bob","carol"],"rounds":2}`)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var created tournament.Tournament
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.Equal(t, "Friday", created.Name)
+		assert.Equal(t, tournament.DefaultTableSize, created.TableSize)
+		require.Len(t, created.Matches, 1)
+		assert.NotEmpty(t, created.Matches[0].GameID)
+
+		w = get(TournamentsPrefix + created.TournamentID)
+		require.Equal(t, http.StatusOK, w.Code)
+		var found tournament.Tournament
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &found))
+		assert.Equal(t, created.TournamentID, found.TournamentID)
+		assert.Len(t, found.Standings, 3)
+	})
+
+	t.Run("Invalid Tournament", func(t *testing.T) {
+		w := create(`{"format":"roundRobin","players":["alice"]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), ErrInvalidTournament)
+
+		assert.Equal(t, http.StatusBadRequest, create(`{"format":`).Code)
+	})
+
+	t.Run("Unknown Tournament", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get(TournamentsPrefix+"unknown").Code)
+		assert.Equal(t, http.StatusNotFound, get(TournamentsPrefix).Code)
+	})
+
+	t.Run("Method Not Allowed", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.Create(w, httptest.NewRequest(http.MethodGet, "/tournaments", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
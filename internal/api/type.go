@@ -1,19 +1,42 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/leaderboard"
+	"github.com/vincentvignali/yamsAttackSocket/internal/profile"
+	"github.com/vincentvignali/yamsAttackSocket/internal/tournament"
 )
 
 
+// Config holds the GameHTTPHandler settings
+type Config struct {
+	// MaxBodySize is the maximum size of a request body in bytes
+	MaxBodySize int64
+}
+
 type GameHTTPHandler struct {
 	gameManager *game.GameManager
+	config      Config
 }
 
 type InitGameRequest struct {
 	HostPlayerID string          `json:"hostPlayerId"`
 	GameState    json.RawMessage `json:"gameState"`
+	// Schema is an optional JSON Schema every game state must match
+	Schema json.RawMessage `json:"schema,omitempty"`
+	// SchemaName selects a schema registered on the server instead of Schema
+	SchemaName string `json:"schemaName,omitempty"`
+	// Policy optionally decides when the game expires instead of the server defaults
+	Policy *game.PolicyInfo `json:"policy,omitempty"`
 }
 
 type InitGameResponse struct {
@@ -21,8 +44,170 @@ type InitGameResponse struct {
 	ShareURL string `json:"shareUrl"`
 }
 
+type SchemaViolationResponse struct {
+	Error      string                 `json:"error"`
+	Violations []game.SchemaViolation `json:"violations"`
+}
+
 type AppError struct {
 	Code    int
 	Message string
 	Err     error
-}
\ No newline at end of file
+}
+
+// AdminHandler serves the operator API, authenticated with a bearer token
+type AdminHandler struct {
+	gameManager *game.GameManager
+	token       string
+}
+
+// LeaderboardHandler serves the leaderboard of the best Yams scores
+type LeaderboardHandler struct {
+	board *leaderboard.Leaderboard
+}
+
+// PlayerHandler serves the player profiles
+type PlayerHandler struct {
+	profiles *profile.Store
+}
+
+// TournamentHandler creates the tournaments and serves their standings
+type TournamentHandler struct {
+	tournaments *tournament.Manager
+}
+
+type AdminGamesResponse struct {
+	Games []game.GameDetails `json:"games"`
+}
+
+type AdminDisconnectResponse struct {
+	HostDisconnected    bool `json:"hostDisconnected"`
+	ViewersDisconnected int  `json:"viewersDisconnected"`
+}
+
+// AdminEndGameRequest carries the final scores and, optionally, the final state of a
+// game, as in the endGame message of its host
+type AdminEndGameRequest struct {
+	FinalScores []game.FinalScore `json:"finalScores"`
+	GameState   json.RawMessage   `json:"gameState,omitempty"`
+}
+
+type AdminNoticeRequest struct {
+	Severity      game.Severity `json:"severity"`
+	Text          string        `json:"text"`
+	MaintenanceAt *time.Time    `json:"maintenanceAt,omitempty"`
+}
+
+// AdminNoticeResponse counts the games a notice was sent to, and reports the delivery
+// to each of them
+type AdminNoticeResponse struct {
+	Delivered  int                   `json:"delivered"`
+	Failed     int                   `json:"failed"`
+	Deliveries []game.NoticeDelivery `json:"deliveries"`
+}
+
+type AdminCleanupResponse struct {
+	Removed int `json:"removed"`
+}
+
+// HealthCheck reports whether a dependency is usable, returning nil when healthy
+type HealthCheck func(ctx context.Context) error
+
+type HealthHandler struct {
+	gameManager *game.GameManager
+	checks      map[string]HealthCheck
+	counters    map[string]func() int64
+	mutex       sync.RWMutex
+	accepting   atomic.Bool
+	draining    atomic.Bool
+}
+
+type ReadinessResponse struct {
+	Status    string            `json:"status"`
+	Accepting bool              `json:"accepting"`
+	Draining  bool              `json:"draining"`
+	Checks    map[string]string `json:"checks"`
+}
+
+type MemoryStatus struct {
+	AllocBytes     uint64 `json:"allocBytes"`
+	HeapInuseBytes uint64 `json:"heapInuseBytes"`
+	SysBytes       uint64 `json:"sysBytes"`
+	NumGC          uint32 `json:"numGC"`
+}
+
+type DebugStatusResponse struct {
+	Status          string            `json:"status"`
+	Accepting       bool              `json:"accepting"`
+	Draining        bool              `json:"draining"`
+	Uptime          string            `json:"uptime"`
+	Goroutines      int               `json:"goroutines"`
+	ActiveGames     int               `json:"activeGames"`
+	OpenConnections int               `json:"openConnections"`
+	LastCleanup     string            `json:"lastCleanup,omitempty"`
+	Memory          MemoryStatus      `json:"memory"`
+	Checks          map[string]string `json:"checks"`
+	Counters        map[string]int64  `json:"counters,omitempty"`
+}
+
+// OriginPolicy is the allowlist of browser origins enforced for CORS and WebSocket upgrades
+type OriginPolicy struct {
+	allowAll         bool
+	exact            map[string]bool
+	wildcards        []wildcardOrigin
+	allowCredentials bool
+	rejected         atomic.Int64
+}
+
+// wildcardOrigin matches every subdomain of a domain for a given scheme
+type wildcardOrigin struct {
+	scheme string
+	suffix string
+}
+
+// RateLimit describes a token bucket: Rate tokens per second, up to Burst tokens.
+// A zero Rate disables the limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type TokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+// RateLimiter holds one token bucket per key
+type RateLimiter struct {
+	name      string
+	limit     RateLimit
+	buckets   map[string]*TokenBucket
+	lastEvict time.Time
+	mutex     sync.Mutex
+	rejected  atomic.Int64
+}
+
+// KeyFunc extracts the rate limiting key of a request
+type KeyFunc func(r *http.Request) string
+
+// TrustedProxies lists the networks whose forwarding headers are trusted
+type TrustedProxies struct {
+	networks []*net.IPNet
+}
+
+// RoutingConfig holds the OwnershipRouter settings
+type RoutingConfig struct {
+	// Mode is RoutingReplay or RoutingProxy
+	Mode string
+	// OwnerURL resolves the base URL of an instance, used by the proxy mode
+	OwnerURL func(instanceID string) (*url.URL, error)
+}
+
+// OwnershipRouter sends the requests for a game to the instance owning it
+type OwnershipRouter struct {
+	gameManager *game.GameManager
+	config      RoutingConfig
+	routed      atomic.Int64
+}
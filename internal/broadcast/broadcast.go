@@ -0,0 +1,201 @@
+/*
+Broadcast Backbone
+
+This package decouples the hosts publishing game states from the viewers receiving them.
+HostGame publishes every message for a game on the game topic, and each viewer handler
+subscribes to that topic, instead of writing to connections held in a Game.
+
+Two implementations are provided:
+- Local keeps everything in process: a single server instance
+- Redis relays messages through a Redis server with PUBLISH/SUBSCRIBE, and stores the
+  retained snapshots with SET/GET, so hosts and viewers of a game can be connected to
+  different instances
+
+Within a process, messages are fanned out to the subscriptions by a hub. A subscription
+that cannot keep up (its buffer is full) is ended with ErrSlowSubscriber rather than
+blocking the publisher.
+*/
+
+package broadcast
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+// DefaultBufferSize is the number of pending messages per subscription
+const DefaultBufferSize = 64
+
+func newHub(bufferSize int) *hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &hub{
+		bufferSize:    bufferSize,
+		subscriptions: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// subscribe registers a new subscription. first reports whether it is the only
+// subscription of topic.
+func (h *hub) subscribe(topic string) (subscription *Subscription, first bool, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return nil, false, ErrClosed
+	}
+
+	subscription = &Subscription{
+		topic:    topic,
+		messages: make(chan []byte, h.bufferSize),
+		hub:      h,
+	}
+	subscriptions, exists := h.subscriptions[topic]
+	if !exists {
+		subscriptions = make(map[*Subscription]struct{})
+		h.subscriptions[topic] = subscriptions
+	}
+	subscriptions[subscription] = struct{}{}
+	return subscription, !exists, nil
+}
+
+// deliver hands data to every subscription of topic without blocking.
+func (h *hub) deliver(topic string, data []byte) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delivered := 0
+	for subscription := range h.subscriptions[topic] {
+		select {
+		case subscription.messages <- data:
+			delivered++
+		default:
+			logger.Warn.Printf("Broadcast: slow subscriber dropped on topic %s", topic)
+			h.end(subscription, ErrSlowSubscriber)
+		}
+	}
+	return delivered
+}
+
+// end removes a subscription and closes its channel. Must be called with the mutex held.
+func (h *hub) end(subscription *Subscription, err error) {
+	subscriptions, exists := h.subscriptions[subscription.topic]
+	if !exists {
+		return
+	}
+	if _, exists := subscriptions[subscription]; !exists {
+		return
+	}
+
+	delete(subscriptions, subscription)
+	subscription.err = err
+	close(subscription.messages)
+
+	if len(subscriptions) == 0 {
+		delete(h.subscriptions, subscription.topic)
+		if h.onEmpty != nil {
+			h.onEmpty(subscription.topic)
+		}
+	}
+}
+
+// topics returns the topics having at least one subscription.
+func (h *hub) topics() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	topics := make([]string, 0, len(h.subscriptions))
+	for topic := range h.subscriptions {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// close ends every subscription with err.
+func (h *hub) close(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.closed = true
+	for _, subscriptions := range h.subscriptions {
+		for subscription := range subscriptions {
+			h.end(subscription, err)
+		}
+	}
+}
+
+// Topic returns the subscribed topic.
+func (s *Subscription) Topic() string {
+	return s.topic
+}
+
+// Messages returns the channel of received messages, closed when the subscription ends.
+func (s *Subscription) Messages() <-chan []byte {
+	return s.messages
+}
+
+// Err tells why the subscription ended. It must be called after Messages is closed.
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// Close ends the subscription. It is safe to call several times.
+func (s *Subscription) Close() error {
+	s.once.Do(func() {
+		s.hub.mutex.Lock()
+		defer s.hub.mutex.Unlock()
+		s.hub.end(s, nil)
+	})
+	return nil
+}
+
+func NewLocal() *Local {
+	return &Local{
+		hub:       newHub(DefaultBufferSize),
+		snapshots: make(map[string][]byte),
+	}
+}
+
+func (l *Local) Publish(ctx context.Context, topic string, data []byte, retain bool) error {
+	// The subscribers and the snapshot share a copy the caller cannot modify
+	data = bytes.Clone(data)
+	if retain {
+		l.mutex.Lock()
+		l.snapshots[topic] = data
+		l.mutex.Unlock()
+	}
+	l.hub.deliver(topic, data)
+	return nil
+}
+
+func (l *Local) Subscribe(ctx context.Context, topic string) (*Subscription, error) {
+	subscription, _, err := l.hub.subscribe(topic)
+	return subscription, err
+}
+
+func (l *Local) Snapshot(ctx context.Context, topic string) ([]byte, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	data, exists := l.snapshots[topic]
+	if !exists {
+		return nil, ErrNoSnapshot
+	}
+	return data, nil
+}
+
+func (l *Local) Forget(ctx context.Context, topic string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.snapshots, topic)
+	return nil
+}
+
+func (l *Local) Close() error {
+	l.hub.close(ErrClosed)
+	return nil
+}
@@ -0,0 +1,119 @@
+package broadcast
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receive waits for the next message of a subscription.
+func receive(t *testing.T, subscription *Subscription) []byte {
+	t.Helper()
+	select {
+	case data, ok := <-subscription.Messages():
+		require.True(t, ok, "subscription ended: %v", subscription.Err())
+		return data
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no message received on %s", subscription.Topic())
+		return nil
+	}
+}
+
+func TestLocalPublishSubscribe(t *testing.T) {
+	ctx := context.Background()
+	local := NewLocal()
+	defer local.Close()
+
+	first, err := local.Subscribe(ctx, "game:1")
+	require.NoError(t, err)
+	second, err := local.Subscribe(ctx, "game:1")
+	require.NoError(t, err)
+	other, err := local.Subscribe(ctx, "game:2")
+	require.NoError(t, err)
+
+	require.NoError(t, local.Publish(ctx, "game:1", []byte(`{"score":1}`), false))
+
+	assert.Equal(t, `{"score":1}`, string(receive(t, first)))
+	assert.Equal(t, `{"score":1}`, string(receive(t, second)))
+	assert.Empty(t, other.Messages(), "topics are isolated")
+
+	second.Close()
+	second.Close()
+	_, open := <-second.Messages()
+	assert.False(t, open)
+	assert.NoError(t, second.Err())
+}
+
+func TestLocalPublishCopiesData(t *testing.T) {
+	ctx := context.Background()
+	local := NewLocal()
+	defer local.Close()
+
+	subscription, err := local.Subscribe(ctx, "game:1")
+	require.NoError(t, err)
+	buffer := []byte(`{"score":1}`)
+	require.NoError(t, local.Publish(ctx, "game:1", buffer, true))
+	copy(buffer, `{"score":2}`)
+
+	assert.Equal(t, `{"score":1}`, string(receive(t, subscription)), "the publisher may reuse its buffer")
+	snapshot, err := local.Snapshot(ctx, "game:1")
+	require.NoError(t, err)
+	assert.Equal(t, `{"score":1}`, string(snapshot))
+}
+
+func TestLocalSnapshots(t *testing.T) {
+	ctx := context.Background()
+	local := NewLocal()
+
+	_, err := local.Snapshot(ctx, "game:1")
+	assert.ErrorIs(t, err, ErrNoSnapshot)
+
+	require.NoError(t, local.Publish(ctx, "game:1", []byte("retained"), true))
+	require.NoError(t, local.Publish(ctx, "game:1", []byte("transient"), false))
+
+	snapshot, err := local.Snapshot(ctx, "game:1")
+	require.NoError(t, err)
+	assert.Equal(t, "retained", string(snapshot))
+
+	require.NoError(t, local.Forget(ctx, "game:1"))
+	_, err = local.Snapshot(ctx, "game:1")
+	assert.ErrorIs(t, err, ErrNoSnapshot)
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	ctx := context.Background()
+	local := NewLocal()
+
+	slow, err := local.Subscribe(ctx, "game:1")
+	require.NoError(t, err)
+
+	for i := 0; i <= DefaultBufferSize; i++ {
+		local.Publish(ctx, "game:1", []byte("state"), false)
+	}
+
+	received := 0
+	for range slow.Messages() {
+		received++
+	}
+	assert.Equal(t, DefaultBufferSize, received)
+	assert.ErrorIs(t, slow.Err(), ErrSlowSubscriber)
+}
+
+func TestLocalClose(t *testing.T) {
+	ctx := context.Background()
+	local := NewLocal()
+
+	subscription, err := local.Subscribe(ctx, "game:1")
+	require.NoError(t, err)
+
+	local.Close()
+	_, open := <-subscription.Messages()
+	assert.False(t, open)
+	assert.ErrorIs(t, subscription.Err(), ErrClosed)
+
+	_, err = local.Subscribe(ctx, "game:1")
+	assert.ErrorIs(t, err, ErrClosed)
+}
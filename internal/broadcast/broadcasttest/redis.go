@@ -0,0 +1,325 @@
+/*
+Package broadcasttest provides a stand-in for a Redis server, speaking just enough of
+the protocol for the Redis broadcaster: PUBLISH, SUBSCRIBE, UNSUBSCRIBE, SET (with PX),
+GET, DEL, AUTH, SELECT and PING. It lets tests run several server instances sharing a
+broadcast backbone without an external dependency.
+*/
+
+package broadcasttest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// RedisServer is an in-memory server listening on a local port
+type RedisServer struct {
+	// Addr is the host:port to connect to
+	Addr string
+
+	listener net.Listener
+	password string
+
+	mutex       sync.Mutex
+	values      map[string]entry
+	subscribers map[string]map[*client]struct{}
+	clients     map[*client]struct{}
+	published   int
+	// held are the SUBSCRIBE acknowledgements withheld by HoldSubscriptions
+	held    []func()
+	holding bool
+}
+
+type entry struct {
+	value   string
+	expires time.Time
+}
+
+type client struct {
+	conn          net.Conn
+	writer        *bufio.Writer
+	writeMutex    sync.Mutex
+	authenticated bool
+	channels      map[string]struct{}
+}
+
+// NewRedisServer starts a server closed at the end of the test. When password is not
+// empty, clients must authenticate with AUTH.
+func NewRedisServer(t testing.TB, password string) *RedisServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("broadcasttest: listen: %v", err)
+	}
+
+	s := &RedisServer{
+		Addr:        listener.Addr().String(),
+		listener:    listener,
+		password:    password,
+		values:      make(map[string]entry),
+		subscribers: make(map[string]map[*client]struct{}),
+		clients:     make(map[*client]struct{}),
+	}
+	go s.accept()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// URL returns the redis:// URL of the server.
+func (s *RedisServer) URL() string {
+	if s.password != "" {
+		return "redis://:" + s.password + "@" + s.Addr
+	}
+	return "redis://" + s.Addr
+}
+
+// Close stops the server and closes every client connection.
+func (s *RedisServer) Close() {
+	s.listener.Close()
+	s.DropConnections()
+}
+
+// DropConnections closes every client connection, as a server restart would.
+func (s *RedisServer) DropConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for c := range s.clients {
+		c.conn.Close()
+	}
+}
+
+// Subscribers returns how many connections are subscribed to channel.
+func (s *RedisServer) Subscribers(channel string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.subscribers[channel])
+}
+
+// HoldSubscriptions withholds the acknowledgements of the next SUBSCRIBE commands until
+// ReleaseSubscriptions; the subscriptions themselves take effect.
+func (s *RedisServer) HoldSubscriptions() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.holding = true
+}
+
+// ReleaseSubscriptions sends the acknowledgements withheld since HoldSubscriptions.
+func (s *RedisServer) ReleaseSubscriptions() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, acknowledge := range s.held {
+		acknowledge()
+	}
+	s.held = nil
+	s.holding = false
+}
+
+// Published returns how many messages were published.
+func (s *RedisServer) Published() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.published
+}
+
+// Get returns the value stored at key, if any.
+func (s *RedisServer) Get(key string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.get(key)
+}
+
+func (s *RedisServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &client{
+			conn:          conn,
+			writer:        bufio.NewWriter(conn),
+			authenticated: s.password == "",
+			channels:      make(map[string]struct{}),
+		}
+		s.mutex.Lock()
+		s.clients[c] = struct{}{}
+		s.mutex.Unlock()
+		go s.serve(c)
+	}
+}
+
+func (s *RedisServer) serve(c *client) {
+	defer func() {
+		c.conn.Close()
+		s.mutex.Lock()
+		for channel := range c.channels {
+			delete(s.subscribers[channel], c)
+		}
+		delete(s.clients, c)
+		s.mutex.Unlock()
+	}()
+
+	reader := bufio.NewReader(c.conn)
+	for {
+		command, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		s.execute(c, command)
+	}
+}
+
+func (s *RedisServer) execute(c *client, command []string) {
+	name := strings.ToUpper(command[0])
+	args := command[1:]
+
+	if name == "AUTH" {
+		if len(args) == 1 && args[0] == s.password {
+			c.authenticated = true
+			c.reply("+OK\r\n")
+		} else {
+			c.reply("-WRONGPASS invalid password\r\n")
+		}
+		return
+	}
+	if !c.authenticated {
+		c.reply("-NOAUTH Authentication required.\r\n")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch name {
+	case "PING":
+		c.reply("+PONG\r\n")
+	case "SELECT":
+		c.reply("+OK\r\n")
+	case "SET":
+		if len(args) < 2 {
+			c.reply("-ERR wrong number of arguments for 'set' command\r\n")
+			return
+		}
+		value := entry{value: args[1]}
+		if len(args) == 4 && strings.EqualFold(args[2], "PX") {
+			ms, _ := strconv.Atoi(args[3])
+			value.expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		s.values[args[0]] = value
+		c.reply("+OK\r\n")
+	case "GET":
+		if value, exists := s.get(args[0]); exists {
+			c.reply(bulk(value))
+		} else {
+			c.reply("$-1\r\n")
+		}
+	case "DEL":
+		deleted := 0
+		for _, key := range args {
+			if _, exists := s.values[key]; exists {
+				delete(s.values, key)
+				deleted++
+			}
+		}
+		c.reply(fmt.Sprintf(":%d\r\n", deleted))
+	case "PUBLISH":
+		s.published++
+		receivers := 0
+		for subscriber := range s.subscribers[args[0]] {
+			subscriber.reply("*3\r\n" + bulk("message") + bulk(args[0]) + bulk(args[1]))
+			receivers++
+		}
+		c.reply(fmt.Sprintf(":%d\r\n", receivers))
+	case "SUBSCRIBE":
+		for _, channel := range args {
+			if s.subscribers[channel] == nil {
+				s.subscribers[channel] = make(map[*client]struct{})
+			}
+			s.subscribers[channel][c] = struct{}{}
+			c.channels[channel] = struct{}{}
+			acknowledgement := fmt.Sprintf("*3\r\n%s%s:%d\r\n", bulk("subscribe"), bulk(channel), len(c.channels))
+			if s.holding {
+				s.held = append(s.held, func() { c.reply(acknowledgement) })
+			} else {
+				c.reply(acknowledgement)
+			}
+		}
+	case "UNSUBSCRIBE":
+		for _, channel := range args {
+			delete(s.subscribers[channel], c)
+			delete(c.channels, channel)
+			c.reply(fmt.Sprintf("*3\r\n%s%s:%d\r\n", bulk("unsubscribe"), bulk(channel), len(c.channels)))
+		}
+	default:
+		c.reply(fmt.Sprintf("-ERR unknown command '%s'\r\n", command[0]))
+	}
+}
+
+// get returns a value unless it expired. Must be called with the mutex held.
+func (s *RedisServer) get(key string) (string, bool) {
+	value, exists := s.values[key]
+	if !exists {
+		return "", false
+	}
+	if !value.expires.IsZero() && time.Now().After(value.expires) {
+		delete(s.values, key)
+		return "", false
+	}
+	return value.value, true
+}
+
+func (c *client) reply(data string) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.writer.WriteString(data)
+	c.writer.Flush()
+}
+
+func bulk(value string) string {
+	return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+}
+
+// readCommand decodes a command sent as an array of bulk strings.
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected command %q", line)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid command length %q", line)
+	}
+
+	command := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid argument length %q", header)
+		}
+		argument := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, argument); err != nil {
+			return nil, err
+		}
+		command = append(command, string(argument[:size]))
+	}
+	return command, nil
+}
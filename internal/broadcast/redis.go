@@ -0,0 +1,556 @@
+package broadcast
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+Redis Broadcaster
+
+This file implements the networked Broadcaster on top of the Redis serialization
+protocol (RESP2). It only needs PUBLISH, SUBSCRIBE, UNSUBSCRIBE, SET, GET, DEL, AUTH,
+SELECT and PING, so it works with Redis, Valkey, KeyDB or Upstash alike.
+
+Each instance subscribes once per topic, whatever its number of local subscribers,
+and fans messages out locally. When the subscriber connection is lost, it is
+re-established with an exponential backoff and every active topic is subscribed again;
+messages published meanwhile are lost, but viewers catch up with the next state.
+*/
+
+const (
+	defaultKeyPrefix   = "yams:"
+	defaultDialTimeout = 5 * time.Second
+	// commandTimeout bounds a command when the context has no deadline
+	commandTimeout = 5 * time.Second
+
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 5 * time.Second
+)
+
+// ParseRedisURL reads a redis://[:password@]host[:port][/db] URL (rediss:// for TLS).
+func ParseRedisURL(rawURL string) (RedisConfig, error) {
+	config := RedisConfig{}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return config, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	switch parsed.Scheme {
+	case "redis":
+	case "rediss":
+		config.TLS = true
+	default:
+		return config, fmt.Errorf("invalid Redis URL scheme %q, expected redis or rediss", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return config, fmt.Errorf("invalid Redis URL: missing host")
+	}
+
+	port := parsed.Port()
+	if port == "" {
+		port = "6379"
+	}
+	config.Addr = net.JoinHostPort(parsed.Hostname(), port)
+
+	if parsed.User != nil {
+		if password, set := parsed.User.Password(); set {
+			config.Password = password
+		} else {
+			config.Password = parsed.User.Username()
+		}
+	}
+
+	if db := strings.TrimPrefix(parsed.Path, "/"); db != "" {
+		config.DB, err = strconv.Atoi(db)
+		if err != nil {
+			return config, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	return config, nil
+}
+
+// NewRedis connects to the Redis server and starts receiving the subscribed topics.
+func NewRedis(ctx context.Context, config RedisConfig) (*Redis, error) {
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = defaultDialTimeout
+	}
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = defaultKeyPrefix
+	}
+
+	r := &Redis{
+		config:  config,
+		hub:     newHub(config.BufferSize),
+		pending: make(map[string]chan struct{}),
+		done:    make(chan struct{}),
+	}
+	r.hub.onEmpty = func(topic string) {
+		go r.unsubscribe(topic)
+	}
+
+	commands, err := r.dial(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	r.commands = commands
+
+	subscriber, err := r.dial(ctx, false)
+	if err != nil {
+		commands.conn.Close()
+		return nil, err
+	}
+	r.subscriber = subscriber
+
+	r.wg.Add(1)
+	go r.receive()
+
+	logger.System.Printf("Broadcast: connected to Redis at %s", config.Addr)
+	return r, nil
+}
+
+func (r *Redis) Publish(ctx context.Context, topic string, data []byte, retain bool) error {
+	publish := []string{"PUBLISH", r.channel(topic), string(data)}
+	if !retain {
+		_, err := r.do(ctx, publish)
+		return err
+	}
+	_, err := r.do(ctx, r.setSnapshot(topic, data), publish)
+	return err
+}
+
+func (r *Redis) setSnapshot(topic string, data []byte) []string {
+	command := []string{"SET", r.snapshotKey(topic), string(data)}
+	if r.config.SnapshotTTL > 0 {
+		command = append(command, "PX", strconv.FormatInt(r.config.SnapshotTTL.Milliseconds(), 10))
+	}
+	return command
+}
+
+// Subscribe returns once the server has acknowledged the subscription, so that a
+// snapshot read afterwards cannot miss a message published in between. Subscriptions
+// to a topic whose acknowledgement is pending wait for it too.
+func (r *Redis) Subscribe(ctx context.Context, topic string) (*Subscription, error) {
+	channel := r.channel(topic)
+
+	r.subscriberMutex.Lock()
+	subscription, first, err := r.hub.subscribe(topic)
+	if err != nil {
+		r.subscriberMutex.Unlock()
+		return nil, err
+	}
+	if first {
+		if r.pending[channel] == nil {
+			r.pending[channel] = make(chan struct{})
+		}
+		if r.subscriber != nil {
+			// On failure, the receive loop reconnects and subscribes every topic again
+			if err := r.subscriber.send(commandDeadline(ctx), []string{"SUBSCRIBE", channel}); err != nil {
+				logger.Warn.Printf("Broadcast: SUBSCRIBE %s failed: %v", channel, err)
+				r.subscriber.conn.Close()
+			}
+		}
+	}
+	acknowledged := r.pending[channel]
+	r.subscriberMutex.Unlock()
+
+	if acknowledged == nil {
+		return subscription, nil
+	}
+	select {
+	case <-acknowledged:
+		return subscription, nil
+	case <-ctx.Done():
+		subscription.Close()
+		return nil, fmt.Errorf("subscribe to %s: %w", topic, ctx.Err())
+	case <-r.done:
+		subscription.Close()
+		return nil, ErrClosed
+	}
+}
+
+// unsubscribe stops receiving a topic that has no local subscription left.
+func (r *Redis) unsubscribe(topic string) {
+	r.subscriberMutex.Lock()
+	defer r.subscriberMutex.Unlock()
+
+	r.hub.mutex.Lock()
+	_, resubscribed := r.hub.subscriptions[topic]
+	r.hub.mutex.Unlock()
+	if resubscribed || r.subscriber == nil {
+		return
+	}
+
+	deadline := time.Now().Add(commandTimeout)
+	if err := r.subscriber.send(deadline, []string{"UNSUBSCRIBE", r.channel(topic)}); err != nil {
+		logger.Debug.Printf("Broadcast: UNSUBSCRIBE %s failed: %v", topic, err)
+	}
+}
+
+func (r *Redis) Snapshot(ctx context.Context, topic string) ([]byte, error) {
+	replies, err := r.do(ctx, []string{"GET", r.snapshotKey(topic)})
+	if err != nil {
+		return nil, err
+	}
+	data, ok := replies[0].([]byte)
+	if !ok {
+		return nil, ErrNoSnapshot
+	}
+	return data, nil
+}
+
+func (r *Redis) Forget(ctx context.Context, topic string) error {
+	_, err := r.do(ctx, []string{"DEL", r.snapshotKey(topic)})
+	return err
+}
+
+// Ping checks that the Redis server answers before ctx expires.
+func (r *Redis) Ping(ctx context.Context) error {
+	_, err := r.do(ctx, []string{"PING"})
+	return err
+}
+
+func (r *Redis) Close() error {
+	r.subscriberMutex.Lock()
+	if r.closed {
+		r.subscriberMutex.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	if r.subscriber != nil {
+		r.subscriber.conn.Close()
+	}
+	r.subscriberMutex.Unlock()
+
+	r.commandMutex.Lock()
+	if r.commands != nil {
+		r.commands.conn.Close()
+		r.commands = nil
+	}
+	r.commandMutex.Unlock()
+
+	r.wg.Wait()
+	r.hub.close(ErrClosed)
+	return nil
+}
+
+// do sends commands in a single round trip and returns their replies. A broken
+// connection is replaced and the commands are sent once more.
+func (r *Redis) do(ctx context.Context, commands ...[]string) ([]interface{}, error) {
+	r.commandMutex.Lock()
+	defer r.commandMutex.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		select {
+		case <-r.done:
+			return nil, ErrClosed
+		default:
+		}
+
+		if r.commands == nil {
+			if r.commands, err = r.dial(ctx, true); err != nil {
+				return nil, err
+			}
+		}
+
+		var replies []interface{}
+		replies, err = r.commands.roundTrip(commandDeadline(ctx), commands)
+		if err == nil {
+			for _, reply := range replies {
+				if replyErr, isErr := reply.(redisError); isErr {
+					return nil, replyErr
+				}
+			}
+			return replies, nil
+		}
+
+		r.commands.conn.Close()
+		r.commands = nil
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("redis: %w", err)
+}
+
+// receive reads the messages of the subscribed topics until the broadcaster is closed.
+func (r *Redis) receive() {
+	defer r.wg.Done()
+
+	delay := minReconnectDelay
+	for {
+		r.subscriberMutex.Lock()
+		subscriber := r.subscriber
+		r.subscriberMutex.Unlock()
+
+		if subscriber == nil {
+			select {
+			case <-r.done:
+				return
+			case <-time.After(delay):
+			}
+			if err := r.resubscribe(); err != nil {
+				logger.Warn.Printf("Broadcast: Redis reconnection failed, retrying in %v: %v", delay, err)
+				delay = min(2*delay, maxReconnectDelay)
+				continue
+			}
+			logger.System.Printf("Broadcast: Redis subscriber reconnected")
+			delay = minReconnectDelay
+			continue
+		}
+
+		reply, err := subscriber.read()
+		if err != nil {
+			select {
+			case <-r.done:
+				return
+			default:
+			}
+			logger.Warn.Printf("Broadcast: Redis subscriber connection lost: %v", err)
+			r.subscriberMutex.Lock()
+			subscriber.conn.Close()
+			r.subscriber = nil
+			r.subscriberMutex.Unlock()
+			continue
+		}
+		r.dispatch(reply)
+	}
+}
+
+// dispatch handles a push received on the subscriber connection.
+func (r *Redis) dispatch(reply interface{}) {
+	push, ok := reply.([]interface{})
+	if !ok || len(push) < 3 {
+		return
+	}
+	kind, _ := push[0].([]byte)
+	channel, _ := push[1].([]byte)
+
+	switch string(kind) {
+	case "message":
+		if data, ok := push[2].([]byte); ok {
+			r.hub.deliver(strings.TrimPrefix(string(channel), r.config.KeyPrefix), data)
+		}
+	case "subscribe":
+		r.subscriberMutex.Lock()
+		if acknowledged, exists := r.pending[string(channel)]; exists {
+			close(acknowledged)
+			delete(r.pending, string(channel))
+		}
+		r.subscriberMutex.Unlock()
+	}
+}
+
+// resubscribe opens a new subscriber connection and subscribes every active topic.
+func (r *Redis) resubscribe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.DialTimeout)
+	defer cancel()
+
+	subscriber, err := r.dial(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	r.subscriberMutex.Lock()
+	defer r.subscriberMutex.Unlock()
+
+	if r.closed {
+		subscriber.conn.Close()
+		return nil
+	}
+
+	if topics := r.hub.topics(); len(topics) > 0 {
+		command := []string{"SUBSCRIBE"}
+		for _, topic := range topics {
+			command = append(command, r.channel(topic))
+		}
+		if err := subscriber.send(time.Now().Add(commandTimeout), command); err != nil {
+			subscriber.conn.Close()
+			return err
+		}
+	}
+	r.subscriber = subscriber
+	return nil
+}
+
+// dial opens an authenticated connection. The database is only selected on command
+// connections: pub/sub channels are shared by every database.
+func (r *Redis) dial(ctx context.Context, selectDB bool) (*redisConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.DialTimeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if r.config.TLS {
+		host, _, _ := net.SplitHostPort(r.config.Addr)
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}}
+		conn, err = dialer.DialContext(ctx, "tcp", r.config.Addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", r.config.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: dial %s: %w", r.config.Addr, err)
+	}
+
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+
+	var handshake [][]string
+	if r.config.Password != "" {
+		handshake = append(handshake, []string{"AUTH", r.config.Password})
+	}
+	if selectDB && r.config.DB != 0 {
+		handshake = append(handshake, []string{"SELECT", strconv.Itoa(r.config.DB)})
+	}
+	if len(handshake) > 0 {
+		replies, err := c.roundTrip(commandDeadline(ctx), handshake)
+		if err == nil {
+			for _, reply := range replies {
+				if replyErr, isErr := reply.(redisError); isErr {
+					err = replyErr
+					break
+				}
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis: handshake with %s: %w", r.config.Addr, err)
+		}
+	}
+	return c, nil
+}
+
+func (r *Redis) channel(topic string) string {
+	return r.config.KeyPrefix + topic
+}
+
+func (r *Redis) snapshotKey(topic string) string {
+	return r.config.KeyPrefix + "snapshot:" + topic
+}
+
+// commandDeadline returns the deadline of ctx, or the default command timeout.
+func commandDeadline(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+	return time.Now().Add(commandTimeout)
+}
+
+// roundTrip writes commands and reads one reply per command.
+func (c *redisConn) roundTrip(deadline time.Time, commands [][]string) ([]interface{}, error) {
+	c.conn.SetDeadline(deadline)
+	defer c.conn.SetDeadline(time.Time{})
+
+	for _, command := range commands {
+		writeCommand(c.writer, command)
+	}
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, 0, len(commands))
+	for range commands {
+		reply, err := readReply(c.reader)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
+
+// send writes a command without waiting for its reply.
+func (c *redisConn) send(deadline time.Time, command []string) error {
+	c.conn.SetWriteDeadline(deadline)
+	defer c.conn.SetWriteDeadline(time.Time{})
+
+	writeCommand(c.writer, command)
+	return c.writer.Flush()
+}
+
+func (c *redisConn) read() (interface{}, error) {
+	return readReply(c.reader)
+}
+
+// writeCommand encodes a command as an array of bulk strings.
+func writeCommand(w *bufio.Writer, command []string) {
+	fmt.Fprintf(w, "*%d\r\n", len(command))
+	for _, arg := range command {
+		fmt.Fprintf(w, "$%d\r\n", len(arg))
+		w.WriteString(arg)
+		w.WriteString("\r\n")
+	}
+}
+
+// readReply decodes a reply: simple strings as string, bulk strings as []byte,
+// integers as int64, errors as redisError, arrays as []interface{} and nil replies as nil.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return redisError(payload), nil
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed bulk length %q", payload)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed array length %q", payload)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			item, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown reply type %q", kind)
+	}
+}
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+var _ Broadcaster = (*Redis)(nil)
+var _ Broadcaster = (*Local)(nil)
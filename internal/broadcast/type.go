@@ -0,0 +1,118 @@
+package broadcast
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrClosed is returned by a Broadcaster used after Close
+	ErrClosed = errors.New("broadcaster closed")
+	// ErrSlowSubscriber ends a subscription whose buffer is full
+	ErrSlowSubscriber = errors.New("subscriber too slow, messages dropped")
+	// ErrNoSnapshot is returned by Snapshot when no message was retained for a topic
+	ErrNoSnapshot = errors.New("no snapshot for topic")
+)
+
+// Broadcaster delivers messages published on a topic to every subscriber of that
+// topic, possibly across several server instances.
+type Broadcaster interface {
+	// Publish sends data to the subscribers of topic. When retain is true, data also
+	// replaces the snapshot of the topic. Publish does not keep data, which the caller
+	// may reuse once it returns.
+	Publish(ctx context.Context, topic string, data []byte, retain bool) error
+	// Subscribe starts receiving the messages published on topic from now on.
+	Subscribe(ctx context.Context, topic string) (*Subscription, error)
+	// Snapshot returns the last retained message of topic, or ErrNoSnapshot.
+	Snapshot(ctx context.Context, topic string) ([]byte, error)
+	// Forget drops the snapshot of topic.
+	Forget(ctx context.Context, topic string) error
+	// Close ends every subscription and releases the broadcaster resources.
+	Close() error
+}
+
+// Subscription receives the messages of one topic. Messages is closed when the
+// subscription ends; Err then tells why (nil after Close). A message received is
+// shared by every subscription of the topic and must not be modified.
+type Subscription struct {
+	topic    string
+	messages chan []byte
+	hub      *hub
+	once     sync.Once
+	err      error
+}
+
+// hub fans messages out to the local subscriptions of each topic
+type hub struct {
+	bufferSize    int
+	subscriptions map[string]map[*Subscription]struct{}
+	mutex         sync.Mutex
+	closed        bool
+	// onEmpty is called with the hub mutex held when the last subscription of a topic ends
+	onEmpty func(topic string)
+}
+
+// Local is the in-process Broadcaster: hosts and viewers must share the same process.
+type Local struct {
+	hub       *hub
+	snapshots map[string][]byte
+	mutex     sync.RWMutex
+}
+
+// RedisConfig holds the settings of the Redis broadcaster
+type RedisConfig struct {
+	// Addr is the host:port of the Redis server
+	Addr string
+	// TLS enables TLS towards the server (rediss:// URLs)
+	TLS bool
+	// Password is sent with AUTH when not empty
+	Password string
+	// DB is the database holding the snapshots (pub/sub is server-wide)
+	DB int
+	// SnapshotTTL is how long a snapshot survives without being refreshed; 0 keeps it forever
+	SnapshotTTL time.Duration
+	// KeyPrefix namespaces the channels and keys used by the server ("yams:" by default)
+	KeyPrefix string
+	// DialTimeout bounds the connection to the server
+	DialTimeout time.Duration
+	// BufferSize is the number of pending messages per subscription
+	BufferSize int
+}
+
+// Redis is a Broadcaster relaying messages through a Redis server (or any server
+// speaking the same protocol), so that hosts and viewers can sit on different instances.
+// Each instance holds one connection for commands and one connection subscribed to the
+// topics its local subscribers listen to.
+type Redis struct {
+	config RedisConfig
+	hub    *hub
+	prefix string
+
+	commands *redisConn
+	// commandMutex serializes request/response exchanges on the command connection
+	commandMutex sync.Mutex
+
+	subscriber *redisConn
+	// subscriberMutex guards subscriber and its writes; reads happen in the receive loop only
+	subscriberMutex sync.Mutex
+	// pending holds, per channel, a channel closed when the server acknowledges its subscription
+	pending map[string]chan struct{}
+
+	done   chan struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// redisConn is a connection speaking the Redis serialization protocol (RESP)
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// redisError is an error reply sent by the server
+type redisError string
@@ -0,0 +1,541 @@
+package config
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+/*
+Configuration Loading
+
+This file builds the server Config from four sources, applied in order of increasing
+precedence:
+
+ 1. Built-in defaults (Default)
+ 2. A YAML (.yaml, .yml) or TOML (.toml) file given by --config or CONFIG_FILE
+ 3. Environment variables (env tags, e.g. PORT, GAME_INACTIVITY_TIMEOUT)
+ 4. Command-line flags (flag tags, e.g. --port, --game-inactivity-timeout)
+
+Sources are mapped onto the Config struct through its field tags, so adding a setting
+only requires declaring a tagged field and its default. The resulting configuration is
+validated before being handed to the components.
+
+Settings tagged secret are masked when the configuration is printed: secret:"true"
+values are replaced with "***", and secret:"url" values lose the credentials of their
+userinfo.
+*/
+
+const configFileEnv = "CONFIG_FILE"
+
+// maskedSecret is printed in place of a secret setting
+const maskedSecret = "***"
+
+// Default returns the configuration used when no source overrides a value.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:            "8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    15 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			DrainDelay:      5 * time.Second,
+			ShutdownTimeout: 10 * time.Second,
+			ShutdownNotice:  "The server is restarting, you will be reconnected in a moment.",
+			AllowedOrigins:  []string{"*"},
+			MaxBodySize:     128 << 10,
+		},
+		Game: GameConfig{
+			InactivityTimeout:       2 * time.Hour,
+			CleanupInterval:         time.Hour,
+			ExpiryWarning:           5 * time.Minute,
+			PausedInactivityTimeout: 12 * time.Hour,
+			ResultRetention:         time.Hour,
+			HostGracePeriod:         30 * time.Second,
+			DuplicateHostPolicy:     string(game.DuplicateHostTakeover),
+			Shards:                  game.DefaultShardCount,
+		},
+		WebSocket: WebSocketConfig{
+			ReadBufferSize:       1024,
+			WriteBufferSize:      1024,
+			MaxMessageSize:       64 << 10,
+			Compression:          true,
+			CompressionLevel:     flate.BestSpeed,
+			CompressionThreshold: 512,
+			WriteTimeout:         10 * time.Second,
+		},
+		RateLimit: RateLimitConfig{
+			TrustedProxies:     []string{},
+			CreateGameRate:     0.1,
+			CreateGameBurst:    10,
+			HostConnectRate:    0.5,
+			HostConnectBurst:   10,
+			ViewerConnectRate:  1,
+			ViewerConnectBurst: 20,
+			LobbyJoinRate:      0.5,
+			LobbyJoinBurst:     10,
+			MessageRate:        20,
+			MessageBurst:       40,
+		},
+		Broadcast: BroadcastConfig{
+			Backend: "local",
+		},
+		Routing: RoutingConfig{
+			Mode: "none",
+		},
+		Webhook: WebhookConfig{
+			URLs:        []string{},
+			Events:      []string{},
+			MaxAttempts: 5,
+			Timeout:     10 * time.Second,
+		},
+		Lobby: LobbyConfig{
+			QueueTimeout:      2 * time.Minute,
+			RatingRange:       100,
+			RatingRangeGrowth: 10,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			File:        "traces.json",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load builds the configuration from the command-line arguments (without the
+// program name) and the environment looked up through getenv.
+func Load(args []string, getenv func(string) string) (*Config, Options, error) {
+	cfg := Default()
+	var opts Options
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.StringVar(&opts.ConfigFile, "config", "", "path of a YAML or TOML configuration file")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration and exit")
+
+	flagValues := make(map[string]*rawFlag)
+	for _, f := range fields(cfg) {
+		if f.flag == "" {
+			continue
+		}
+		raw := &rawFlag{isBool: f.value.Kind() == reflect.Bool}
+		flagValues[f.flag] = raw
+		fs.Var(raw, f.flag, f.usage)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, opts, fmt.Errorf("invalid command line: %w", err)
+	}
+
+	if opts.ConfigFile == "" {
+		opts.ConfigFile = getenv(configFileEnv)
+	}
+	if opts.ConfigFile != "" {
+		if err := loadFile(cfg, opts.ConfigFile); err != nil {
+			return nil, opts, err
+		}
+	}
+
+	for _, f := range fields(cfg) {
+		if f.env == "" {
+			continue
+		}
+		if raw := getenv(f.env); raw != "" {
+			if err := setValue(f.value, raw); err != nil {
+				return nil, opts, fmt.Errorf("invalid environment variable %s: %w", f.env, err)
+			}
+		}
+	}
+
+	for _, f := range fields(cfg) {
+		raw, ok := flagValues[f.flag]
+		if !ok || !raw.set {
+			continue
+		}
+		if err := setValue(f.value, raw.value); err != nil {
+			return nil, opts, fmt.Errorf("invalid flag --%s: %w", f.flag, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, opts, err
+	}
+	return cfg, opts, nil
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port must be a number between 1 and 65535, got %q", c.Server.Port))
+	}
+	if c.Admin.Port != "" {
+		if port, err := strconv.Atoi(c.Admin.Port); err != nil || port < 1 || port > 65535 {
+			errs = append(errs, fmt.Errorf("admin.port must be a number between 1 and 65535, got %q", c.Admin.Port))
+		}
+		if c.Admin.Port == c.Server.Port {
+			errs = append(errs, fmt.Errorf("admin.port must differ from server.port, leave it empty to serve the admin API on the main port"))
+		}
+		if c.Admin.Token == "" {
+			errs = append(errs, fmt.Errorf("admin.token is required with admin.port"))
+		}
+	}
+	positiveDurations := map[string]time.Duration{
+		"server.readTimeout":           c.Server.ReadTimeout,
+		"server.writeTimeout":          c.Server.WriteTimeout,
+		"server.idleTimeout":           c.Server.IdleTimeout,
+		"server.shutdownTimeout":       c.Server.ShutdownTimeout,
+		"game.inactivityTimeout":       c.Game.InactivityTimeout,
+		"game.cleanupInterval":         c.Game.CleanupInterval,
+		"game.pausedInactivityTimeout": c.Game.PausedInactivityTimeout,
+		"lobby.queueTimeout":           c.Lobby.QueueTimeout,
+	}
+	for _, name := range sortedKeys(positiveDurations) {
+		if positiveDurations[name] <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %v", name, positiveDurations[name]))
+		}
+	}
+	if c.Game.ResultRetention < 0 {
+		errs = append(errs, fmt.Errorf("game.resultRetention must not be negative, got %v", c.Game.ResultRetention))
+	}
+	if c.Game.HostGracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("game.hostGracePeriod must not be negative, got %v", c.Game.HostGracePeriod))
+	}
+	if c.Game.MaxLifetime < 0 {
+		errs = append(errs, fmt.Errorf("game.maxLifetime must not be negative, got %v", c.Game.MaxLifetime))
+	}
+	if c.Game.ExpiryWarning < 0 {
+		errs = append(errs, fmt.Errorf("game.expiryWarning must not be negative, got %v", c.Game.ExpiryWarning))
+	}
+	if c.Lobby.RatingRange < 0 || c.Lobby.RatingRangeGrowth < 0 {
+		errs = append(errs, fmt.Errorf("lobby rating ranges must not be negative, got ratingRange=%d ratingRangeGrowth=%d",
+			c.Lobby.RatingRange, c.Lobby.RatingRangeGrowth))
+	}
+	if c.Server.ShutdownNotice != "" {
+		if err := (game.SystemNotice{Text: c.Server.ShutdownNotice}).Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("server.shutdownNotice: %w", err))
+		}
+	}
+	switch game.DuplicateHostPolicy(c.Game.DuplicateHostPolicy) {
+	case game.DuplicateHostTakeover, game.DuplicateHostReject:
+	default:
+		errs = append(errs, fmt.Errorf("game.duplicateHostPolicy must be takeover or reject, got %q", c.Game.DuplicateHostPolicy))
+	}
+	if c.Game.Shards < 1 {
+		errs = append(errs, fmt.Errorf("game.shards must be at least 1, got %d", c.Game.Shards))
+	}
+	if c.Server.DrainDelay < 0 {
+		errs = append(errs, fmt.Errorf("server.drainDelay must not be negative, got %v", c.Server.DrainDelay))
+	}
+	if len(c.Server.AllowedOrigins) == 0 {
+		errs = append(errs, fmt.Errorf("server.allowedOrigins must not be empty"))
+	}
+	for _, origin := range c.Server.AllowedOrigins {
+		if origin == "*" && c.Server.AllowCredentials {
+			errs = append(errs, fmt.Errorf("server.allowCredentials cannot be combined with the \"*\" origin"))
+		}
+	}
+	if c.WebSocket.ReadBufferSize <= 0 || c.WebSocket.WriteBufferSize <= 0 {
+		errs = append(errs, fmt.Errorf("websocket buffer sizes must be positive, got read=%d write=%d",
+			c.WebSocket.ReadBufferSize, c.WebSocket.WriteBufferSize))
+	}
+	if c.Server.MaxBodySize <= 0 || c.WebSocket.MaxMessageSize <= 0 {
+		errs = append(errs, fmt.Errorf("payload size limits must be positive, got server.maxBodySize=%d websocket.maxMessageSize=%d",
+			c.Server.MaxBodySize, c.WebSocket.MaxMessageSize))
+	}
+	if c.WebSocket.CompressionLevel < flate.HuffmanOnly || c.WebSocket.CompressionLevel > flate.BestCompression {
+		errs = append(errs, fmt.Errorf("websocket.compressionLevel must be between %d and %d, got %d",
+			flate.HuffmanOnly, flate.BestCompression, c.WebSocket.CompressionLevel))
+	}
+	if c.WebSocket.CompressionThreshold < 0 {
+		errs = append(errs, fmt.Errorf("websocket.compressionThreshold must not be negative, got %d", c.WebSocket.CompressionThreshold))
+	}
+	if c.WebSocket.WriteTimeout < 0 {
+		errs = append(errs, fmt.Errorf("websocket.writeTimeout must not be negative, got %v", c.WebSocket.WriteTimeout))
+	}
+	limits := []struct {
+		name  string
+		rate  float64
+		burst int
+	}{
+		{"rateLimit.createGame", c.RateLimit.CreateGameRate, c.RateLimit.CreateGameBurst},
+		{"rateLimit.hostConnect", c.RateLimit.HostConnectRate, c.RateLimit.HostConnectBurst},
+		{"rateLimit.viewerConnect", c.RateLimit.ViewerConnectRate, c.RateLimit.ViewerConnectBurst},
+		{"rateLimit.lobbyJoin", c.RateLimit.LobbyJoinRate, c.RateLimit.LobbyJoinBurst},
+		{"rateLimit.message", c.RateLimit.MessageRate, c.RateLimit.MessageBurst},
+	}
+	for _, limit := range limits {
+		if limit.rate < 0 {
+			errs = append(errs, fmt.Errorf("%sRate must not be negative, got %v", limit.name, limit.rate))
+		}
+		if limit.rate > 0 && limit.burst < 1 {
+			errs = append(errs, fmt.Errorf("%sBurst must be at least 1 when the limit is enabled, got %d", limit.name, limit.burst))
+		}
+	}
+	switch c.Broadcast.Backend {
+	case "local":
+	case "redis":
+		if !strings.HasPrefix(c.Broadcast.RedisURL, "redis://") && !strings.HasPrefix(c.Broadcast.RedisURL, "rediss://") {
+			errs = append(errs, fmt.Errorf("broadcast.redisUrl must be a redis:// or rediss:// URL with the redis backend, got %q", c.Broadcast.RedisURL))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("broadcast.backend must be local or redis, got %q", c.Broadcast.Backend))
+	}
+	switch c.Routing.Mode {
+	case "none":
+	case "replay", "proxy":
+		if c.Routing.InstanceID == "" {
+			errs = append(errs, fmt.Errorf("routing.instanceId is required with the %s routing mode", c.Routing.Mode))
+		}
+		if c.Routing.Mode == "proxy" && !strings.Contains(c.Routing.OwnerURL, "{instance}") {
+			errs = append(errs, fmt.Errorf("routing.ownerUrl must contain {instance} with the proxy routing mode, got %q", c.Routing.OwnerURL))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("routing.mode must be one of none, replay or proxy, got %q", c.Routing.Mode))
+	}
+	if c.Routing.InstanceID != "" && !game.ValidInstanceID(c.Routing.InstanceID) {
+		errs = append(errs, fmt.Errorf("routing.instanceId must only contain letters, digits, '-' and '_', got %q", c.Routing.InstanceID))
+	}
+	for _, rawURL := range c.Webhook.URLs {
+		if parsed, err := url.Parse(rawURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("webhook.urls must be http or https URLs, got %q", rawURL))
+		}
+	}
+	for _, event := range c.Webhook.Events {
+		if !game.ValidEventType(game.EventType(event)) {
+			errs = append(errs, fmt.Errorf("webhook.events contains the unknown event %q", event))
+		}
+	}
+	if c.Webhook.MaxAttempts < 1 || c.Webhook.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("webhook.maxAttempts and webhook.timeout must be positive, got %d and %v",
+			c.Webhook.MaxAttempts, c.Webhook.Timeout))
+	}
+	switch c.Tracing.Exporter {
+	case "", "none", "otlp", "stdout", "file":
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter must be one of none, otlp, stdout or file, got %q", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sampleRatio must be between 0 and 1, got %v", c.Tracing.SampleRatio))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Print writes the effective configuration as YAML, in the file format accepted by Load.
+// Secret settings are masked.
+func (c *Config) Print(w io.Writer) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(toNode(reflect.ValueOf(c).Elem())); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func loadFile(cfg *Config, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("cannot parse config file %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(content), cfg)
+		if err != nil {
+			return fmt.Errorf("cannot parse config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("cannot parse config file %s: unknown key %q", path, undecoded[0].String())
+		}
+	default:
+		return fmt.Errorf("unsupported config file format %q (expected .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	return nil
+}
+
+// field is a leaf setting of the Config struct together with its source names.
+type field struct {
+	value reflect.Value
+	env   string
+	flag  string
+	usage string
+}
+
+func fields(cfg *Config) []field {
+	var result []field
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			fieldValue := v.Field(i)
+			if fieldValue.Kind() == reflect.Struct && fieldValue.Type() != reflect.TypeOf(time.Duration(0)) {
+				walk(fieldValue)
+				continue
+			}
+			tag := t.Field(i).Tag
+			result = append(result, field{
+				value: fieldValue,
+				env:   tag.Get("env"),
+				flag:  tag.Get("flag"),
+				usage: tag.Get("usage"),
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem())
+	return result
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// toNode converts a config struct into an ordered YAML mapping, rendering durations
+// as strings (e.g. "5m0s") rather than nanosecond counts.
+func toNode(v reflect.Value) *yaml.Node {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: time.Duration(v.Int()).String()}
+	}
+	if v.Kind() != reflect.Struct {
+		node := &yaml.Node{}
+		node.Encode(v.Interface())
+		return node
+	}
+
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		mapping.Content = append(mapping.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+			toNode(mask(v.Field(i), t.Field(i).Tag.Get("secret"))),
+		)
+	}
+	return mapping
+}
+
+// mask returns a setting as printed, according to its secret tag.
+func mask(v reflect.Value, secret string) reflect.Value {
+	switch {
+	case secret == "url" && v.Kind() == reflect.String:
+		return reflect.ValueOf(withoutUserinfo(v.String()))
+	case secret == "url" && v.Kind() == reflect.Slice:
+		urls := make([]string, v.Len())
+		for i := range urls {
+			urls[i] = withoutUserinfo(v.Index(i).String())
+		}
+		return reflect.ValueOf(urls)
+	case secret == "true" && !v.IsZero():
+		return reflect.ValueOf(maskedSecret)
+	}
+	return v
+}
+
+// withoutUserinfo removes the credentials from a URL.
+func withoutUserinfo(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.User = nil
+	return u.String()
+}
+
+func sortedKeys(m map[string]time.Duration) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// rawFlag records the raw value of a configuration flag so that it can be applied
+// after the file and environment sources.
+type rawFlag struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (f *rawFlag) String() string { return f.value }
+
+func (f *rawFlag) Set(value string) error {
+	f.value = value
+	f.set = true
+	return nil
+}
+
+func (f *rawFlag) IsBoolFlag() bool { return f.isBool }
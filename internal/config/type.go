@@ -0,0 +1,133 @@
+package config
+
+import "time"
+
+// Config holds every tunable setting of the server.
+//
+// Each leaf field declares its file key (yaml/toml tags), its environment variable
+// (env tag) and its command-line flag (flag tag). Values are applied in this order,
+// each source overriding the previous one: defaults, config file, environment, flags.
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Game      GameConfig      `yaml:"game" toml:"game"`
+	WebSocket WebSocketConfig `yaml:"websocket" toml:"websocket"`
+	RateLimit RateLimitConfig `yaml:"rateLimit" toml:"rateLimit"`
+	Broadcast BroadcastConfig `yaml:"broadcast" toml:"broadcast"`
+	Routing   RoutingConfig   `yaml:"routing" toml:"routing"`
+	Webhook   WebhookConfig   `yaml:"webhook" toml:"webhook"`
+	Admin     AdminConfig     `yaml:"admin" toml:"admin"`
+	Lobby     LobbyConfig     `yaml:"lobby" toml:"lobby"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+}
+
+type ServerConfig struct {
+	Port            string        `yaml:"port" toml:"port" env:"PORT" flag:"port" usage:"port to listen on"`
+	ReadTimeout     time.Duration `yaml:"readTimeout" toml:"readTimeout" env:"READ_TIMEOUT" flag:"read-timeout" usage:"maximum duration for reading a request"`
+	WriteTimeout    time.Duration `yaml:"writeTimeout" toml:"writeTimeout" env:"WRITE_TIMEOUT" flag:"write-timeout" usage:"maximum duration before timing out a response write"`
+	IdleTimeout     time.Duration `yaml:"idleTimeout" toml:"idleTimeout" env:"IDLE_TIMEOUT" flag:"idle-timeout" usage:"maximum keep-alive idle duration"`
+	DrainDelay      time.Duration `yaml:"drainDelay" toml:"drainDelay" env:"DRAIN_DELAY" flag:"drain-delay" usage:"time spent failing readiness before closing the listener on shutdown"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" usage:"maximum duration of a graceful shutdown"`
+	// ShutdownNotice is sent to every host and viewer when the server starts draining
+	ShutdownNotice string `yaml:"shutdownNotice" toml:"shutdownNotice" env:"SHUTDOWN_NOTICE" flag:"shutdown-notice" usage:"system notice sent to every client on shutdown, none when empty"`
+	// AllowedOrigins lists the browser origins allowed for CORS and WebSocket upgrades:
+	// "*", exact origins (https://app.example.com) or wildcard subdomains (https://*.example.com)
+	AllowedOrigins   []string `yaml:"allowedOrigins" toml:"allowedOrigins" env:"ALLOWED_ORIGINS" flag:"allowed-origins" usage:"comma-separated list of allowed browser origins"`
+	AllowCredentials bool     `yaml:"allowCredentials" toml:"allowCredentials" env:"ALLOW_CREDENTIALS" flag:"allow-credentials" usage:"allow credentialed cross-origin requests"`
+	MaxBodySize      int64    `yaml:"maxBodySize" toml:"maxBodySize" env:"MAX_BODY_SIZE" flag:"max-body-size" usage:"maximum HTTP request body size in bytes"`
+}
+
+type GameConfig struct {
+	InactivityTimeout       time.Duration `yaml:"inactivityTimeout" toml:"inactivityTimeout" env:"GAME_INACTIVITY_TIMEOUT" flag:"game-inactivity-timeout" usage:"idle duration after which a game is removed"`
+	CleanupInterval         time.Duration `yaml:"cleanupInterval" toml:"cleanupInterval" env:"GAME_CLEANUP_INTERVAL" flag:"game-cleanup-interval" usage:"interval between two sweeps of the expired games, behind the expiry scheduler"`
+	MaxLifetime             time.Duration `yaml:"maxLifetime" toml:"maxLifetime" env:"GAME_MAX_LIFETIME" flag:"game-max-lifetime" usage:"default and longest lifetime of a game whatever its activity, 0 for unlimited"`
+	ExpiryWarning           time.Duration `yaml:"expiryWarning" toml:"expiryWarning" env:"GAME_EXPIRY_WARNING" flag:"game-expiry-warning" usage:"time before its expiry a game is warned with a gameExpiring message, 0 to disable"`
+	PausedInactivityTimeout time.Duration `yaml:"pausedInactivityTimeout" toml:"pausedInactivityTimeout" env:"GAME_PAUSED_INACTIVITY_TIMEOUT" flag:"game-paused-inactivity-timeout" usage:"idle duration after which a paused game is removed, and longest announced pause"`
+	ResultRetention         time.Duration `yaml:"resultRetention" toml:"resultRetention" env:"GAME_RESULT_RETENTION" flag:"game-result-retention" usage:"duration a finished game is kept for result pages before removal"`
+	HostGracePeriod         time.Duration `yaml:"hostGracePeriod" toml:"hostGracePeriod" env:"GAME_HOST_GRACE_PERIOD" flag:"game-host-grace-period" usage:"time a disconnected host has to reconnect before the game is abandoned, 0 to never abandon"`
+	DuplicateHostPolicy     string        `yaml:"duplicateHostPolicy" toml:"duplicateHostPolicy" env:"GAME_DUPLICATE_HOST_POLICY" flag:"game-duplicate-host-policy" usage:"second host connection to a game: takeover closes the first one, reject refuses it"`
+	Shards                  int           `yaml:"shards" toml:"shards" env:"GAME_SHARDS" flag:"game-shards" usage:"number of lock-striped shards of the game registry"`
+}
+
+type WebSocketConfig struct {
+	ReadBufferSize  int   `yaml:"readBufferSize" toml:"readBufferSize" env:"WS_READ_BUFFER_SIZE" flag:"ws-read-buffer-size" usage:"WebSocket read buffer size in bytes"`
+	WriteBufferSize int   `yaml:"writeBufferSize" toml:"writeBufferSize" env:"WS_WRITE_BUFFER_SIZE" flag:"ws-write-buffer-size" usage:"WebSocket write buffer size in bytes"`
+	MaxMessageSize  int64 `yaml:"maxMessageSize" toml:"maxMessageSize" env:"WS_MAX_MESSAGE_SIZE" flag:"ws-max-message-size" usage:"maximum inbound WebSocket message size in bytes"`
+	// Compression negotiates permessage-deflate with the clients supporting it
+	Compression          bool `yaml:"compression" toml:"compression" env:"WS_COMPRESSION" flag:"ws-compression" usage:"negotiate permessage-deflate compression with the clients supporting it"`
+	CompressionLevel     int  `yaml:"compressionLevel" toml:"compressionLevel" env:"WS_COMPRESSION_LEVEL" flag:"ws-compression-level" usage:"deflate level of compressed messages, from -2 (Huffman only) to 9 (best compression)"`
+	CompressionThreshold int  `yaml:"compressionThreshold" toml:"compressionThreshold" env:"WS_COMPRESSION_THRESHOLD" flag:"ws-compression-threshold" usage:"size in bytes below which outbound messages are not compressed"`
+	// WriteTimeout bounds each outbound message write
+	WriteTimeout time.Duration `yaml:"writeTimeout" toml:"writeTimeout" env:"WS_WRITE_TIMEOUT" flag:"ws-write-timeout" usage:"maximum duration of an outbound WebSocket message write, 0 for unlimited"`
+}
+
+// RateLimitConfig holds the token bucket limits: rates are in events per second
+// (0 disables the limit) and bursts are the number of events allowed at once.
+type RateLimitConfig struct {
+	TrustedProxies     []string `yaml:"trustedProxies" toml:"trustedProxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies" usage:"comma-separated proxy IPs or CIDRs whose Fly-Client-IP/X-Forwarded-For headers are trusted"`
+	CreateGameRate     float64  `yaml:"createGameRate" toml:"createGameRate" env:"RATE_LIMIT_CREATE_GAME" flag:"rate-limit-create-game" usage:"games created per second per client IP"`
+	CreateGameBurst    int      `yaml:"createGameBurst" toml:"createGameBurst" env:"RATE_LIMIT_CREATE_GAME_BURST" flag:"rate-limit-create-game-burst" usage:"game creation burst per client IP"`
+	HostConnectRate    float64  `yaml:"hostConnectRate" toml:"hostConnectRate" env:"RATE_LIMIT_HOST_CONNECT" flag:"rate-limit-host-connect" usage:"host connection attempts per second per client IP and per host ID"`
+	HostConnectBurst   int      `yaml:"hostConnectBurst" toml:"hostConnectBurst" env:"RATE_LIMIT_HOST_CONNECT_BURST" flag:"rate-limit-host-connect-burst" usage:"host connection burst"`
+	ViewerConnectRate  float64  `yaml:"viewerConnectRate" toml:"viewerConnectRate" env:"RATE_LIMIT_VIEWER_CONNECT" flag:"rate-limit-viewer-connect" usage:"viewer connection attempts per second per client IP"`
+	ViewerConnectBurst int      `yaml:"viewerConnectBurst" toml:"viewerConnectBurst" env:"RATE_LIMIT_VIEWER_CONNECT_BURST" flag:"rate-limit-viewer-connect-burst" usage:"viewer connection burst"`
+	LobbyJoinRate      float64  `yaml:"lobbyJoinRate" toml:"lobbyJoinRate" env:"RATE_LIMIT_LOBBY_JOIN" flag:"rate-limit-lobby-join" usage:"lobby connection attempts per second per client IP and per player ID"`
+	LobbyJoinBurst     int      `yaml:"lobbyJoinBurst" toml:"lobbyJoinBurst" env:"RATE_LIMIT_LOBBY_JOIN_BURST" flag:"rate-limit-lobby-join-burst" usage:"lobby connection burst"`
+	MessageRate        float64  `yaml:"messageRate" toml:"messageRate" env:"RATE_LIMIT_MESSAGE" flag:"rate-limit-message" usage:"inbound WebSocket messages per second per connection"`
+	MessageBurst       int      `yaml:"messageBurst" toml:"messageBurst" env:"RATE_LIMIT_MESSAGE_BURST" flag:"rate-limit-message-burst" usage:"inbound WebSocket message burst"`
+}
+
+// BroadcastConfig selects the backbone carrying game states from hosts to viewers.
+// The local backend requires every host and viewer of a game to reach the same instance.
+type BroadcastConfig struct {
+	Backend  string `yaml:"backend" toml:"backend" env:"BROADCAST_BACKEND" flag:"broadcast-backend" usage:"broadcast backend: local or redis"`
+	RedisURL string `yaml:"redisUrl" toml:"redisUrl" env:"REDIS_URL" flag:"redis-url" usage:"redis:// or rediss:// URL of the Redis broadcast backend" secret:"url"`
+}
+
+// RoutingConfig makes each game owned by the instance creating it: requests for a game
+// reaching another instance are replayed (Fly-Replay header) or proxied to the owner.
+type RoutingConfig struct {
+	Mode       string `yaml:"mode" toml:"mode" env:"ROUTING_MODE" flag:"routing-mode" usage:"game ownership routing: none, replay or proxy"`
+	InstanceID string `yaml:"instanceId" toml:"instanceId" env:"INSTANCE_ID" flag:"instance-id" usage:"ID of this instance, encoded in the IDs of the games it creates"`
+	OwnerURL   string `yaml:"ownerUrl" toml:"ownerUrl" env:"ROUTING_OWNER_URL" flag:"routing-owner-url" usage:"URL template of the owning instance for the proxy mode, containing {instance}"`
+}
+
+// WebhookConfig POSTs the game lifecycle events to our backend. Webhooks are disabled
+// when no URL is set.
+type WebhookConfig struct {
+	URLs           []string      `yaml:"urls" toml:"urls" env:"WEBHOOK_URLS" flag:"webhook-urls" usage:"comma-separated list of URLs receiving the game lifecycle events" secret:"url"`
+	Secret         string        `yaml:"secret" toml:"secret" env:"WEBHOOK_SECRET" flag:"webhook-secret" usage:"secret signing the webhook payloads" secret:"true"`
+	Events         []string      `yaml:"events" toml:"events" env:"WEBHOOK_EVENTS" flag:"webhook-events" usage:"comma-separated list of the events sent, all when empty"`
+	MaxAttempts    int           `yaml:"maxAttempts" toml:"maxAttempts" env:"WEBHOOK_MAX_ATTEMPTS" flag:"webhook-max-attempts" usage:"delivery attempts before a webhook is dead-lettered"`
+	Timeout        time.Duration `yaml:"timeout" toml:"timeout" env:"WEBHOOK_TIMEOUT" flag:"webhook-timeout" usage:"maximum duration of a webhook delivery attempt"`
+	DeadLetterFile string        `yaml:"deadLetterFile" toml:"deadLetterFile" env:"WEBHOOK_DEAD_LETTER_FILE" flag:"webhook-dead-letter-file" usage:"file receiving the webhooks given up on, one JSON document per line"`
+}
+
+// AdminConfig enables the operator API under /admin/ when a token is set, on the main
+// listener or on a separate port.
+type AdminConfig struct {
+	Token string `yaml:"token" toml:"token" env:"ADMIN_TOKEN" flag:"admin-token" usage:"bearer token of the admin API, disabled when empty" secret:"true"`
+	Port  string `yaml:"port" toml:"port" env:"ADMIN_PORT" flag:"admin-port" usage:"separate port serving the admin API, the main port when empty"`
+}
+
+// LobbyConfig tunes the matchmaking of the players queued on the lobby socket.
+type LobbyConfig struct {
+	QueueTimeout      time.Duration `yaml:"queueTimeout" toml:"queueTimeout" env:"LOBBY_QUEUE_TIMEOUT" flag:"lobby-queue-timeout" usage:"time a player waits for a match before leaving the queue"`
+	RatingRange       int           `yaml:"ratingRange" toml:"ratingRange" env:"LOBBY_RATING_RANGE" flag:"lobby-rating-range" usage:"largest rating difference between matched players when they join the queue"`
+	RatingRangeGrowth int           `yaml:"ratingRangeGrowth" toml:"ratingRangeGrowth" env:"LOBBY_RATING_RANGE_GROWTH" flag:"lobby-rating-range-growth" usage:"widening of the rating range for every second of waiting"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter" usage:"span exporter: none, otlp, stdout or file"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT" flag:"tracing-endpoint" usage:"OTLP/HTTP collector URL"`
+	Insecure    bool    `yaml:"insecure" toml:"insecure" env:"TRACING_INSECURE" flag:"tracing-insecure" usage:"disable TLS towards the OTLP collector"`
+	File        string  `yaml:"file" toml:"file" env:"TRACING_FILE" flag:"tracing-file" usage:"destination of the file exporter"`
+	SampleRatio float64 `yaml:"sampleRatio" toml:"sampleRatio" env:"TRACING_SAMPLE_RATIO" flag:"tracing-sample-ratio" usage:"fraction of traces recorded, between 0 and 1"`
+}
+
+// Options are the command-line switches that are not configuration values.
+type Options struct {
+	// ConfigFile is the path of the YAML or TOML file to load, if any
+	ConfigFile string
+	// PrintConfig asks the server to print the effective configuration and exit
+	PrintConfig bool
+}
@@ -0,0 +1,130 @@
+package game
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+Game Administration
+
+Operations used by the admin API to inspect and act on the games held by this
+instance: listing the games with their connections, closing the host or viewer
+connections and deleting a game (notices are in notice.go). Connections are collected
+under the game mutex and closed after releasing it.
+*/
+
+// ErrGameNotFound is returned for a game this instance does not hold
+var ErrGameNotFound = errors.New("game not found")
+
+// adminCloseReason is the close reason of the connections closed by an operator
+const adminCloseReason = "disconnected by operator"
+
+// Details describes a game held by this instance, with its connections.
+func (m *GameManager) Details(gameID string) (GameDetails, error) {
+	game, err := m.GetGame(gameID)
+	if err != nil {
+		return GameDetails{}, ErrGameNotFound
+	}
+	return m.details(game), nil
+}
+
+// ListGames describes the games held by this instance, oldest first, without their state.
+func (m *GameManager) ListGames() []GameDetails {
+	games := m.Games()
+	list := make([]GameDetails, 0, len(games))
+	for _, game := range games {
+		gameDetails := m.details(game)
+		gameDetails.GameState = nil
+		list = append(list, gameDetails)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(*list[j].CreatedAt)
+	})
+	return list
+}
+
+// DisconnectHostConnection closes the host connection of a game, reporting whether the
+// host was connected. The host may reconnect like after any other disconnection.
+func (m *GameManager) DisconnectHostConnection(gameID string) (bool, error) {
+	game, err := m.GetGame(gameID)
+	if err != nil {
+		return false, ErrGameNotFound
+	}
+	game.Mutex.Lock()
+	conn := game.HostConn
+	game.Mutex.Unlock()
+	if conn == nil {
+		return false, nil
+	}
+
+	logger.Warn.Printf("Admin: host connection closed: GameID=%s", gameID)
+	closeByOperator(conn)
+	return true, nil
+}
+
+// DisconnectViewers closes the local viewer connections of a game and returns their count.
+func (m *GameManager) DisconnectViewers(gameID string) (int, error) {
+	game, err := m.GetGame(gameID)
+	if err != nil {
+		return 0, ErrGameNotFound
+	}
+	game.Mutex.Lock()
+	viewers := append([]*websocket.Conn(nil), game.Viewers...)
+	game.Mutex.Unlock()
+
+	logger.Warn.Printf("Admin: %d viewer connections closed: GameID=%s", len(viewers), gameID)
+	for _, viewer := range viewers {
+		closeByOperator(viewer)
+	}
+	return len(viewers), nil
+}
+
+// DeleteGame removes a game at once and closes its connections.
+func (m *GameManager) DeleteGame(gameID string) error {
+	game, err := m.GetGame(gameID)
+	if err != nil {
+		return ErrGameNotFound
+	}
+	logger.Warn.Printf("Admin: game deleted: GameID=%s", gameID)
+	m.RemoveGame(gameID)
+	closeConnections(game)
+	return nil
+}
+
+// details describes a game with its connections.
+func (m *GameManager) details(game *Game) GameDetails {
+	game.Mutex.Lock()
+	defer game.Mutex.Unlock()
+
+	gameDetails := GameDetails{
+		GameInfo:          localInfo(game),
+		HostPlayerID:      game.HostPlayerID,
+		SchemaName:        game.SchemaName,
+		Policy:            NewPolicyInfo(game.Policy),
+		ViewerConnections: make([]Connection, 0, len(game.Viewers)),
+	}
+	if expiresAt, _, ok := m.expiry(game, time.Now()); ok {
+		gameDetails.ExpiresAt = &expiresAt
+	}
+	if game.HostConn != nil {
+		gameDetails.Host = &Connection{RemoteAddr: game.HostConn.RemoteAddr().String()}
+	}
+	for _, viewer := range game.Viewers {
+		gameDetails.ViewerConnections = append(gameDetails.ViewerConnections, Connection{RemoteAddr: viewer.RemoteAddr().String()})
+	}
+	return gameDetails
+}
+
+// closeByOperator closes a connection with a close frame telling the client why.
+func closeByOperator(conn *websocket.Conn) {
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, adminCloseReason),
+		time.Now().Add(time.Second))
+	conn.Close()
+}
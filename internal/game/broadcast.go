@@ -0,0 +1,114 @@
+package game
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+Game Broadcasts
+
+This file connects the games to the broadcast backbone. Each game has two topics:
+- the game topic carries the messages sent to its viewers; the last game state is
+  retained as the topic snapshot, so a viewer connected to another instance than the
+  host can receive the current state and know that the game exists
+- the host topic carries the messages sent to its host (such as viewerJoined)
+
+Messages are published already encoded, and forwarded to the clients as they are.
+*/
+
+// publishTimeout bounds the publications made on behalf of the GameManager
+const publishTimeout = 5 * time.Second
+
+// gameRemovedMessage tells the viewers that the game no longer exists
+var gameRemovedMessage = []byte(`{"type":"gameRemoved","message":"The game has been removed"}`)
+
+// GameTopic returns the topic carrying the messages sent to the viewers of a game.
+func GameTopic(gameID string) string {
+	return "game:" + gameID
+}
+
+// HostTopic returns the topic carrying the messages sent to the host of a game.
+func HostTopic(gameID string) string {
+	return "host:" + gameID
+}
+
+// Broadcaster returns the backbone the game messages are published on.
+func (m *GameManager) Broadcaster() broadcast.Broadcaster {
+	return m.broadcaster
+}
+
+// PublishState sends a game state to every viewer of the game and retains it as the
+// state received by the next viewers.
+func (m *GameManager) PublishState(ctx context.Context, gameID string, state json.RawMessage) error {
+	data, err := json.Marshal(StateMessage{Type: "gameState", GameState: state})
+	if err != nil {
+		return err
+	}
+	return m.broadcaster.Publish(ctx, GameTopic(gameID), data, true)
+}
+
+// PublishToViewers sends a message to every viewer of the game.
+func (m *GameManager) PublishToViewers(ctx context.Context, gameID string, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return m.broadcaster.Publish(ctx, GameTopic(gameID), data, false)
+}
+
+// PublishToHost sends a message to the host of the game, wherever it is connected.
+func (m *GameManager) PublishToHost(ctx context.Context, gameID string, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return m.broadcaster.Publish(ctx, HostTopic(gameID), data, false)
+}
+
+// CurrentState returns the state sent to a new viewer: the state held by this instance
+// when it owns the game, the retained snapshot otherwise. It returns
+// broadcast.ErrNoSnapshot when the game is unknown everywhere.
+func (m *GameManager) CurrentState(ctx context.Context, gameID string) ([]byte, error) {
+	if game, err := m.GetGame(gameID); err == nil {
+		game.Mutex.Lock()
+		defer game.Mutex.Unlock()
+		switch game.Status {
+		case StatusFinished:
+			return json.Marshal(endedMessage(game))
+		case StatusPaused:
+			return json.Marshal(pausedMessage(game))
+		case StatusAbandoned:
+			return json.Marshal(abandonedMessage(game))
+		}
+		return json.Marshal(StateMessage{Type: "gameState", GameState: game.GameState})
+	}
+	return m.broadcaster.Snapshot(ctx, GameTopic(gameID))
+}
+
+// IsGameRemoved reports whether a message received on a game topic announces that the
+// game was removed.
+func IsGameRemoved(data []byte) bool {
+	return bytes.Equal(data, gameRemovedMessage)
+}
+
+// announceRemoval tells the viewers of removed games, on every instance, that the game
+// is gone and drops the retained states.
+func (m *GameManager) announceRemoval(gameIDs ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	for _, gameID := range gameIDs {
+		if err := m.broadcaster.Publish(ctx, GameTopic(gameID), gameRemovedMessage, false); err != nil {
+			logger.Warn.Printf("Cannot announce the removal of game %s: %v", gameID, err)
+		}
+		if err := m.broadcaster.Forget(ctx, GameTopic(gameID)); err != nil {
+			logger.Warn.Printf("Cannot drop the retained state of game %s: %v", gameID, err)
+		}
+	}
+}
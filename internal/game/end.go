@@ -0,0 +1,221 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+Game End
+
+A host ends its game by sending the final scores. The game is then finished: its state
+is frozen, the viewers receive the final standings in a gameEnded message, retained
+for the viewers joining afterwards, and the game is kept for the result retention
+period so that result pages can still be served, before being removed.
+*/
+
+var (
+	// ErrGameFinished is returned when ending or updating a game already finished
+	ErrGameFinished = errors.New("game already finished")
+	// ErrInvalidResults is returned when the final scores cannot be ranked
+	ErrInvalidResults = errors.New("invalid final scores")
+)
+
+// String returns the name of the state used by the REST API.
+func (s HostConnectionState) String() string {
+	switch s {
+	case HostNeverConnected:
+		return "neverConnected"
+	case HostConnected:
+		return "connected"
+	case HostDisconnected:
+		return "disconnected"
+	default:
+		return "unknown"
+	}
+}
+
+// Standings ranks the players by decreasing score. Players with the same score share
+// the same rank, and the next rank skips accordingly (1, 1, 3).
+func Standings(scores []FinalScore) ([]Standing, error) {
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("%w: no score", ErrInvalidResults)
+	}
+	seen := make(map[string]bool, len(scores))
+	for _, score := range scores {
+		if score.PlayerID == "" {
+			return nil, fmt.Errorf("%w: missing playerId", ErrInvalidResults)
+		}
+		if seen[score.PlayerID] {
+			return nil, fmt.Errorf("%w: duplicate player %s", ErrInvalidResults, score.PlayerID)
+		}
+		seen[score.PlayerID] = true
+	}
+
+	sorted := append([]FinalScore(nil), scores...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Score > sorted[j].Score
+	})
+	standings := make([]Standing, len(sorted))
+	for i, score := range sorted {
+		rank := i + 1
+		if i > 0 && score.Score == sorted[i-1].Score {
+			rank = standings[i-1].Rank
+		}
+		standings[i] = Standing{Rank: rank, PlayerID: score.PlayerID, Score: score.Score}
+	}
+	return standings, nil
+}
+
+// EndGame finishes a game with the final scores and, when not nil, a final state. The
+// final scores of a Yams game must match the scorecards of its final state. The
+// viewers receive the returned gameEnded message, and the game is removed after the
+// result retention period.
+func (m *GameManager) EndGame(gameID string, scores []FinalScore, finalState json.RawMessage) (GameEndedMessage, error) {
+	game, err := m.GetGame(gameID)
+	if err != nil {
+		return GameEndedMessage{}, ErrGameNotFound
+	}
+	standings, err := Standings(scores)
+	if err != nil {
+		return GameEndedMessage{}, err
+	}
+	if finalState != nil {
+		if violations := ValidateState(game.Schema, finalState); len(violations) > 0 {
+			return GameEndedMessage{}, &SchemaViolationError{Violations: violations}
+		}
+	}
+
+	game.Mutex.Lock()
+	switch game.Status {
+	case StatusFinished:
+		game.Mutex.Unlock()
+		return GameEndedMessage{}, ErrGameFinished
+	case StatusAbandoned:
+		game.Mutex.Unlock()
+		return GameEndedMessage{}, ErrGameAbandoned
+	}
+	if game.SchemaName == YamsScorecardSchema {
+		state := game.GameState
+		if finalState != nil {
+			state = finalState
+		}
+		if err := checkYamsScores(scores, state); err != nil {
+			game.Mutex.Unlock()
+			return GameEndedMessage{}, err
+		}
+	}
+	now := time.Now()
+	if finalState != nil {
+		game.GameState = finalState
+	}
+	game.Status = StatusFinished
+	game.Pause = nil
+	game.EndedAt = now
+	game.Standings = standings
+	game.LastActivity = now
+	message := endedMessage(game)
+	result := gameResult(game)
+	game.Mutex.Unlock()
+
+	logger.Info.Printf("Game ended: GameID=%s, %d players, removal in %v", gameID, len(standings), m.config.ResultRetention)
+
+	// The gameEnded message replaces the retained state: viewers joining during the
+	// retention period receive the final standings
+	m.publishRetained(gameID, message)
+	m.publishResult(result)
+
+	m.Emit(EventGameEnded, gameID, map[string]interface{}{
+		"standings": standings,
+	})
+
+	time.AfterFunc(m.config.ResultRetention, func() {
+		m.RemoveGame(gameID)
+	})
+	return message, nil
+}
+
+// Info describes a game held by this instance or, failing that, retained by the
+// broadcaster. It returns broadcast.ErrNoSnapshot when the game is unknown everywhere.
+func (m *GameManager) Info(ctx context.Context, gameID string) (GameInfo, error) {
+	if game, err := m.GetGame(gameID); err == nil {
+		game.Mutex.Lock()
+		defer game.Mutex.Unlock()
+		return localInfo(game), nil
+	}
+
+	data, err := m.broadcaster.Snapshot(ctx, GameTopic(gameID))
+	if err != nil {
+		return GameInfo{}, err
+	}
+	// The retained message is a gameState, gamePaused, gameResumed or gameEnded message
+	var retained struct {
+		GameEndedMessage
+		PauseInfo
+	}
+	if err := json.Unmarshal(data, &retained); err != nil {
+		return GameInfo{}, fmt.Errorf("invalid retained message for game %s: %w", gameID, err)
+	}
+	info := GameInfo{
+		GameID:    gameID,
+		Status:    StatusActive,
+		GameState: retained.GameState,
+	}
+	switch retained.Type {
+	case "gamePaused":
+		info.Status = StatusPaused
+		info.Pause = &retained.PauseInfo
+	case "gameAbandoned":
+		info.Status = StatusAbandoned
+	case "gameEnded":
+		info.Status = StatusFinished
+		info.Standings = retained.Standings
+		info.EndedAt = &retained.EndedAt
+	}
+	return info, nil
+}
+
+// endedMessage returns the gameEnded message of a finished game. The game mutex must
+// be held.
+func endedMessage(game *Game) GameEndedMessage {
+	return GameEndedMessage{
+		Type:      "gameEnded",
+		Standings: game.Standings,
+		GameState: game.GameState,
+		EndedAt:   game.EndedAt,
+	}
+}
+
+// localInfo describes a game held by this instance. The game mutex must be held.
+func localInfo(game *Game) GameInfo {
+	createdAt, lastActivity := game.CreatedAt, game.LastActivity
+	info := GameInfo{
+		GameID:              game.GameID,
+		Status:              game.Status,
+		HostConnectionState: game.HostConnectionState.String(),
+		Viewers:             len(game.Viewers),
+		CreatedAt:           &createdAt,
+		LastActivity:        &lastActivity,
+		Standings:           game.Standings,
+		GameState:           game.GameState,
+	}
+	if game.Pause != nil {
+		pause := *game.Pause
+		info.Pause = &pause
+	}
+	if !game.ReconnectDeadline.IsZero() {
+		deadline := game.ReconnectDeadline
+		info.ReconnectDeadline = &deadline
+	}
+	if game.Status == StatusFinished {
+		endedAt := game.EndedAt
+		info.EndedAt = &endedAt
+	}
+	return info
+}
@@ -0,0 +1,141 @@
+package game
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+Game Lifecycle Events
+
+The GameManager emits an Event at each step of a game's life on its EventBus, so that
+other components (webhooks, metrics, ...) can react without the game code knowing
+about them. Events are emitted by the instance where they happen: a viewer joining a
+game owned by another instance is reported by the instance the viewer is connected to.
+*/
+
+const (
+	// EventGameCreated : a game was created
+	EventGameCreated EventType = "gameCreated"
+	// EventHostConnected : the host connected or reconnected to its game
+	EventHostConnected EventType = "hostConnected"
+	// EventHostDisconnected : the host connection was lost
+	EventHostDisconnected EventType = "hostDisconnected"
+	// EventViewerJoined : a viewer started watching a game
+	EventViewerJoined EventType = "viewerJoined"
+	// EventStateUpdated : the host pushed a new game state
+	EventStateUpdated EventType = "stateUpdated"
+	// EventGamePaused : the host paused the game
+	EventGamePaused EventType = "gamePaused"
+	// EventGameResumed : the host resumed the game
+	EventGameResumed EventType = "gameResumed"
+	// EventGameAbandoned : the host did not reconnect within the grace period
+	EventGameAbandoned EventType = "gameAbandoned"
+	// EventGameEnded : the host ended the game, or the game was removed before its end
+	// (not after being abandoned)
+	EventGameEnded EventType = "gameEnded"
+	// EventGameExpired : the game was removed by the inactivity cleanup
+	EventGameExpired EventType = "gameExpired"
+)
+
+// EventTypes lists every event type emitted by the GameManager.
+func EventTypes() []EventType {
+	return []EventType{
+		EventGameCreated,
+		EventHostConnected,
+		EventHostDisconnected,
+		EventViewerJoined,
+		EventStateUpdated,
+		EventGamePaused,
+		EventGameResumed,
+		EventGameAbandoned,
+		EventGameEnded,
+		EventGameExpired,
+	}
+}
+
+// ValidEventType reports whether an event type is emitted by the GameManager.
+func ValidEventType(eventType EventType) bool {
+	for _, known := range EventTypes() {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		handlers: make(map[int]eventSubscription),
+	}
+}
+
+// Subscribe calls handler for every emitted event of the given types, or of any type
+// when none is given. The returned function ends the subscription.
+func (b *EventBus) Subscribe(handler EventHandler, types ...EventType) func() {
+	subscription := eventSubscription{handler: handler}
+	if len(types) > 0 {
+		subscription.types = make(map[EventType]bool, len(types))
+		for _, eventType := range types {
+			subscription.types[eventType] = true
+		}
+	}
+
+	b.mutex.Lock()
+	id := b.nextID
+	b.nextID++
+	b.handlers[id] = subscription
+	b.mutex.Unlock()
+
+	return func() {
+		b.mutex.Lock()
+		delete(b.handlers, id)
+		b.mutex.Unlock()
+	}
+}
+
+// Emit delivers an event to the subscribed handlers. A panicking handler is logged and
+// does not prevent the delivery to the others.
+func (b *EventBus) Emit(event Event) {
+	b.mutex.RLock()
+	handlers := make([]EventHandler, 0, len(b.handlers))
+	for _, subscription := range b.handlers {
+		if subscription.types == nil || subscription.types[event.Type] {
+			handlers = append(handlers, subscription.handler)
+		}
+	}
+	b.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		callHandler(handler, event)
+	}
+}
+
+func callHandler(handler EventHandler, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error.Printf("Event handler panicked on %s (GameID=%s): %v", event.Type, event.GameID, r)
+		}
+	}()
+	handler(event)
+}
+
+// Events returns the bus on which the GameManager emits the game lifecycle events.
+func (m *GameManager) Events() *EventBus {
+	return m.events
+}
+
+// Emit emits a lifecycle event of a game on the manager's bus.
+func (m *GameManager) Emit(eventType EventType, gameID string, data map[string]interface{}) {
+	m.events.Emit(Event{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		GameID:     gameID,
+		InstanceID: m.config.InstanceID,
+		Time:       time.Now().UTC(),
+		Data:       data,
+	})
+}
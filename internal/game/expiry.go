@@ -0,0 +1,347 @@
+package game
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+Game Expiry
+
+Each game is removed when it expires, according to the expiry policy chosen at its
+creation:
+- it expires after being idle for its idle timeout (the server inactivity timeout by
+  default, longer while paused)
+- KeepWhileViewers counts the presence of viewers connected to this instance as activity
+- KeepUntilEnded never expires an idle game, only its lifetime bounds it; without a
+  lifetime, the idle timeout of paused games applies
+- it expires MaxLifetime after its creation whatever its activity, the server max
+  lifetime being the default and the upper bound
+Finished and abandoned games do not expire: they are removed at the end of their
+retention period.
+
+The expiry scheduler keeps the next check of every game in a min-heap and sleeps until
+the earliest one, instead of scanning every game periodically. Checks are lazy: activity
+only postpones the expiry of a game, so a check computes the expiry again from the
+current state and either warns the game, removes it or schedules the next check. The host
+and the viewers receive a gameExpiring message ExpiryWarning before the expiry (at most
+half the timeout or lifetime for short ones). ResumeGame, which can bring an expiry
+closer, schedules a new check.
+
+CleanupInactiveGames remains as a sweep over every game, run every CleanupInterval as a
+safety net and by the operators on demand.
+*/
+
+// ErrInvalidPolicy is returned for an expiry policy with out of range durations
+var ErrInvalidPolicy = errors.New("invalid expiry policy")
+
+// maxPolicyDuration bounds the durations of a per-game expiry policy
+const maxPolicyDuration = 7 * 24 * time.Hour
+
+// Reasons of an expiry
+const (
+	ExpiryIdle     = "idle"
+	ExpiryLifetime = "lifetime"
+)
+
+// ValidatePolicy checks an expiry policy requested at game creation. Zero durations
+// select the server defaults.
+func (m *GameManager) ValidatePolicy(policy ExpiryPolicy) error {
+	if policy.IdleTimeout < 0 || policy.MaxLifetime < 0 {
+		return fmt.Errorf("%w: negative duration", ErrInvalidPolicy)
+	}
+	if limit := m.pausedInactivityTimeout(); policy.IdleTimeout > limit {
+		return fmt.Errorf("%w: idle timeout longer than %v", ErrInvalidPolicy, limit)
+	}
+	limit := maxPolicyDuration
+	if m.config.MaxLifetime > 0 {
+		limit = min(limit, m.config.MaxLifetime)
+	}
+	if policy.MaxLifetime > limit {
+		return fmt.Errorf("%w: max lifetime longer than %v", ErrInvalidPolicy, limit)
+	}
+	return nil
+}
+
+// NewPolicyInfo describes an expiry policy.
+func NewPolicyInfo(policy ExpiryPolicy) PolicyInfo {
+	return PolicyInfo{
+		IdleTimeoutSeconds: int64(policy.IdleTimeout / time.Second),
+		MaxLifetimeSeconds: int64(policy.MaxLifetime / time.Second),
+		KeepWhileViewers:   policy.KeepWhileViewers,
+		KeepUntilEnded:     policy.KeepUntilEnded,
+	}
+}
+
+// Policy returns the expiry policy described.
+func (p PolicyInfo) Policy() ExpiryPolicy {
+	return ExpiryPolicy{
+		IdleTimeout:      time.Duration(p.IdleTimeoutSeconds) * time.Second,
+		MaxLifetime:      time.Duration(p.MaxLifetimeSeconds) * time.Second,
+		KeepWhileViewers: p.KeepWhileViewers,
+		KeepUntilEnded:   p.KeepUntilEnded,
+	}
+}
+
+// ExpiresAt returns when a game held by this instance will expire if nothing happens,
+// and false for games that do not expire.
+func (m *GameManager) ExpiresAt(gameID string) (time.Time, bool) {
+	game, err := m.GetGame(gameID)
+	if err != nil {
+		return time.Time{}, false
+	}
+	game.Mutex.Lock()
+	defer game.Mutex.Unlock()
+	at, _, ok := m.expiry(game, time.Now())
+	return at, ok
+}
+
+// maxLifetime returns the lifetime of a game, 0 when unlimited.
+func (m *GameManager) maxLifetime(game *Game) time.Duration {
+	if game.Policy.MaxLifetime > 0 {
+		return game.Policy.MaxLifetime
+	}
+	return m.config.MaxLifetime
+}
+
+// expiry returns when a game expires and why; ok is false for finished and abandoned
+// games. The game mutex must be held.
+func (m *GameManager) expiry(game *Game, now time.Time) (at time.Time, reason string, ok bool) {
+	if game.Status == StatusFinished || game.Status == StatusAbandoned {
+		return time.Time{}, "", false
+	}
+
+	lifetime := m.maxLifetime(game)
+	if !game.Policy.KeepUntilEnded || lifetime == 0 {
+		lastActivity := game.LastActivity
+		if game.Policy.KeepWhileViewers && len(game.Viewers) > 0 {
+			lastActivity = now
+		}
+		at, reason = lastActivity.Add(m.inactivityTimeout(game)), ExpiryIdle
+	}
+	if lifetime > 0 {
+		if end := game.CreatedAt.Add(lifetime); at.IsZero() || end.Before(at) {
+			at, reason = end, ExpiryLifetime
+		}
+	}
+	return at, reason, true
+}
+
+// warningLead returns how long before an expiry the game is warned. The game mutex must
+// be held.
+func (m *GameManager) warningLead(game *Game, reason string) time.Duration {
+	period := m.inactivityTimeout(game)
+	if reason == ExpiryLifetime {
+		period = m.maxLifetime(game)
+	}
+	return min(m.config.ExpiryWarning, period/2)
+}
+
+// expired reports whether a game has expired. The game mutex must not be held.
+func (m *GameManager) expired(game *Game, now time.Time) bool {
+	game.Mutex.Lock()
+	defer game.Mutex.Unlock()
+	at, _, ok := m.expiry(game, now)
+	return ok && !now.Before(at)
+}
+
+// expireGame removes a game if it is still expired, closes its connections and returns
+// whether it was removed. The announcement of the removal is left to the caller.
+func (m *GameManager) expireGame(shard *gameShard, gameID string, now time.Time) bool {
+	// The game may have been updated or removed since it was found expired
+	game, ok := shard.removeIf(gameID, func(game *Game) bool { return !m.expired(game, now) })
+	if !ok {
+		return false
+	}
+	m.expiries.forget(gameID)
+
+	game.Mutex.Lock()
+	inactiveFor := now.Sub(game.LastActivity)
+	_, reason, _ := m.expiry(game, now)
+	game.Mutex.Unlock()
+	closeConnections(game)
+
+	logger.Warn.Printf("Game expired: GameID=%s, reason=%s (inactive for %v)", gameID, reason, inactiveFor)
+	m.Emit(EventGameExpired, gameID, map[string]interface{}{
+		"reason":          reason,
+		"inactiveSeconds": int64(inactiveFor.Seconds()),
+	})
+	return true
+}
+
+// scheduleExpiry schedules the next expiry check of a game.
+func (m *GameManager) scheduleExpiry(game *Game) {
+	now := time.Now()
+	game.Mutex.Lock()
+	at, reason, ok := m.expiry(game, now)
+	if ok {
+		if warnAt := at.Add(-m.warningLead(game, reason)); now.Before(warnAt) && !game.ExpiryWarnedAt.Equal(at) {
+			at = warnAt
+		}
+	}
+	game.Mutex.Unlock()
+
+	if ok {
+		m.expiries.schedule(game.GameID, at)
+	}
+}
+
+// checkExpiry removes a game whose expiry is reached, warns it when its expiry is near,
+// and schedules its next check otherwise.
+func (m *GameManager) checkExpiry(gameID string, now time.Time) {
+	shard := m.shardFor(gameID)
+	game, exists := shard.get(gameID)
+	if !exists {
+		return
+	}
+
+	game.Mutex.Lock()
+	at, reason, ok := m.expiry(game, now)
+	if !ok {
+		game.Mutex.Unlock()
+		return
+	}
+	if !now.Before(at) {
+		game.Mutex.Unlock()
+		if m.expireGame(shard, gameID, now) {
+			m.Stats.Mutex.Lock()
+			m.Stats.ActiveGames--
+			m.Stats.Mutex.Unlock()
+			m.announceRemoval(gameID)
+		}
+		return
+	}
+	warn := !game.ExpiryWarnedAt.Equal(at) && !now.Before(at.Add(-m.warningLead(game, reason)))
+	if warn {
+		game.ExpiryWarnedAt = at
+	}
+	game.Mutex.Unlock()
+
+	if warn {
+		m.warnExpiry(gameID, GameExpiringMessage{
+			Type:        "gameExpiring",
+			Reason:      reason,
+			ExpiresAt:   at.UTC(),
+			RemainingMs: at.Sub(now).Milliseconds(),
+		})
+	}
+	m.scheduleExpiry(game)
+}
+
+// warnExpiry sends a gameExpiring message to the host and the viewers of a game.
+func (m *GameManager) warnExpiry(gameID string, message GameExpiringMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	logger.Info.Printf("Game expiring: GameID=%s, reason=%s, at %s", gameID, message.Reason, message.ExpiresAt.Format(time.RFC3339))
+	if err := m.PublishToViewers(ctx, gameID, message); err != nil {
+		logger.Warn.Printf("Cannot warn the viewers of game %s of its expiry: %v", gameID, err)
+	}
+	if err := m.PublishToHost(ctx, gameID, message); err != nil {
+		logger.Warn.Printf("Cannot warn the host of game %s of its expiry: %v", gameID, err)
+	}
+}
+
+// routineExpireGames runs the expiry checks as they become due.
+func (m *GameManager) routineExpireGames() {
+	for {
+		// Without any check scheduled, only a new schedule wakes the scheduler up
+		var timer *time.Timer
+		var due <-chan time.Time
+		if next, ok := m.expiries.next(); ok {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+		select {
+		case <-due:
+		case <-m.expiries.wake:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		now := time.Now()
+		for _, gameID := range m.expiries.due(now) {
+			m.checkExpiry(gameID, now)
+		}
+	}
+}
+
+func newExpiryScheduler() *expiryScheduler {
+	return &expiryScheduler{
+		scheduled: make(map[string]time.Time),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// schedule replaces the next check of a game, waking the scheduler up when it becomes
+// the earliest one.
+func (s *expiryScheduler) schedule(gameID string, at time.Time) {
+	s.mutex.Lock()
+	earliest := len(s.queue) == 0 || at.Before(s.queue[0].at)
+	s.scheduled[gameID] = at
+	heap.Push(&s.queue, expiryCheck{gameID: gameID, at: at})
+	s.mutex.Unlock()
+
+	if earliest {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// forget cancels the next check of a game.
+func (s *expiryScheduler) forget(gameID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.scheduled, gameID)
+}
+
+// next returns the time of the earliest check.
+func (s *expiryScheduler) next() (time.Time, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.queue) == 0 {
+		return time.Time{}, false
+	}
+	return s.queue[0].at, true
+}
+
+// due pops the checks due at now and returns their games. Checks replaced by a later
+// schedule or forgotten are dropped.
+func (s *expiryScheduler) due(now time.Time) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var gameIDs []string
+	for len(s.queue) > 0 && !now.Before(s.queue[0].at) {
+		check := heap.Pop(&s.queue).(expiryCheck)
+		if at, ok := s.scheduled[check.gameID]; !ok || !at.Equal(check.at) {
+			continue
+		}
+		delete(s.scheduled, check.gameID)
+		gameIDs = append(gameIDs, check.gameID)
+	}
+	return gameIDs
+}
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *expiryQueue) Push(x interface{}) {
+	*q = append(*q, x.(expiryCheck))
+}
+
+func (q *expiryQueue) Pop() interface{} {
+	old := *q
+	check := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return check
+}
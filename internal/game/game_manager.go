@@ -1,11 +1,13 @@
 package game
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
 	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
 )
 
@@ -16,7 +18,7 @@ This file implements the GameManager, which is the central component responsible
 - Creating, tracking, and managing game instances
 - Handling game lifecycle (creation, access, removal)
 - Managing websocket connections for hosts and viewers
-- Performing periodic cleanup of inactive games
+- Expiring games according to their expiry policy
 - Collecting and providing server metrics and statistics
 
 The GameManager acts as a service layer between the API handlers (HTTP and WebSocket)
@@ -32,51 +34,105 @@ Key responsibilities:
 
 
 
+// DefaultConfig returns the settings used by NewGameManager.
+func DefaultConfig() Config {
+	return Config{
+		InactivityTimeout:       2 * time.Hour,
+		CleanupInterval:         time.Hour,
+		ResultRetention:         time.Hour,
+		PausedInactivityTimeout: 12 * time.Hour,
+		HostGracePeriod:         30 * time.Second,
+		ExpiryWarning:           5 * time.Minute,
+	}
+}
+
 func NewGameManager() *GameManager {
+	return NewGameManagerWithConfig(DefaultConfig())
+}
+
+func NewGameManagerWithConfig(config Config) *GameManager {
+	broadcaster := config.Broadcaster
+	if broadcaster == nil {
+		broadcaster = broadcast.NewLocal()
+	}
+
 	manager := &GameManager{
-		games: make(map[string]*Game),
+		config:      config,
+		shards:      newShards(config.ShardCount),
+		expiries:    newExpiryScheduler(),
+		schemas:     NewSchemaRegistry(),
+		broadcaster: broadcaster,
+		events:      NewEventBus(),
 		Stats: &ServerStats{
 			StartTime: time.Now(),
 		},
 	}
 	
+	go manager.routineExpireGames()
 	go manager.routineCleanupInactiveGames()
 	
 	return manager
 }
 
 func (m *GameManager) CreateGame(hostPlayerID string, initialState []byte) (string, error) {
-	gameID := uuid.New().String()
+	return m.CreateGameWithOptions(hostPlayerID, initialState, GameOptions{})
+}
+
+func (m *GameManager) CreateGameWithOptions(hostPlayerID string, initialState []byte, opts GameOptions) (string, error) {
+	if violations := ValidateState(opts.Schema, initialState); len(violations) > 0 {
+		return "", &SchemaViolationError{Violations: violations}
+	}
+	if err := m.ValidatePolicy(opts.Policy); err != nil {
+		return "", err
+	}
+	
+	gameID := newGameID(m.config.InstanceID, uuid.New().String())
 	now := time.Now()
 	
 	game := &Game{
 		GameID:       gameID,
+		Status:       StatusActive,
 		HostPlayerID: hostPlayerID,
 		GameState:    initialState,
 		Viewers:      make([]*websocket.Conn, 0),
 		CreatedAt:    now,
 		LastActivity: now,
+		Schema:       opts.Schema,
+		SchemaName:   opts.SchemaName,
+		Policy:       opts.Policy,
 	}
 	
-	m.gamesMutex.Lock()
-	m.games[gameID] = game
-	gameCount := len(m.games)
-	m.gamesMutex.Unlock()
+	m.shardFor(gameID).put(game)
+	m.scheduleExpiry(game)
 	
 	m.Stats.Mutex.Lock()
-	m.Stats.ActiveGames = gameCount
+	m.Stats.ActiveGames++
 	m.Stats.TotalGamesCreated++
+	gameCount := m.Stats.ActiveGames
 	m.Stats.Mutex.Unlock()
 	
 	logger.Info.Printf("New game created: ID=%s, Host=%s (Total: %d active games)", gameID, hostPlayerID, gameCount)
+	m.Emit(EventGameCreated, gameID, map[string]interface{}{
+		"hostPlayerId": hostPlayerID,
+	})
+	
+	// Retain the initial state so that viewers on other instances can join right away
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := m.PublishState(ctx, gameID, initialState); err != nil {
+		logger.Warn.Printf("Cannot publish the initial state of game %s: %v", gameID, err)
+	}
 	
 	return gameID, nil
 }
+
+// Schemas returns the registry of the schemas selectable at game creation.
+func (m *GameManager) Schemas() *SchemaRegistry {
+	return m.schemas
+}
+
 func (m *GameManager) GetGame(gameID string) (*Game, error) {
-	m.gamesMutex.Lock()
-	defer m.gamesMutex.Unlock()
-	
-	game, exists := m.games[gameID]
+	game, exists := m.shardFor(gameID).get(gameID)
 	if !exists {
 		return nil, fmt.Errorf("game with ID %s not found", gameID)
 	}
@@ -84,64 +140,62 @@ func (m *GameManager) GetGame(gameID string) (*Game, error) {
 }
 
 func (m *GameManager) RemoveGame(gameID string) {
-	m.gamesMutex.Lock()
-	delete(m.games, gameID)
-	gameCount := len(m.games)
-	m.gamesMutex.Unlock()
+	game, removed := m.shardFor(gameID).remove(gameID)
+	if !removed {
+		return
+	}
+	m.expiries.forget(gameID)
+	game.Mutex.Lock()
+	announced := game.Status == StatusFinished || game.Status == StatusAbandoned
+	game.Mutex.Unlock()
 	
 	m.Stats.Mutex.Lock()
-	m.Stats.ActiveGames = gameCount
+	m.Stats.ActiveGames--
+	gameCount := m.Stats.ActiveGames
 	m.Stats.Mutex.Unlock()
 	
 	logger.Info.Printf("Game removed: GameID=%s (Remaining: %d active games)", gameID, gameCount)
+	// A finished or abandoned game already announced its end
+	if !announced {
+		m.Emit(EventGameEnded, gameID, nil)
+	}
+	
+	m.announceRemoval(gameID)
 }
 
 func (m *GameManager) routineCleanupInactiveGames() {
 	for {
-		time.Sleep(5 * time.Minute)
+		time.Sleep(m.config.CleanupInterval)
 		m.CleanupInactiveGames()
 	}
 }
 
-func (m *GameManager) CleanupInactiveGames() {
-		now := time.Now()
-		var toDelete []string
-		
-		m.gamesMutex.Lock()
-		for id, game := range m.games {
-			game.Mutex.Lock()
-			inactiveTime := now.Sub(game.LastActivity)
-			game.Mutex.Unlock()
-			
-			if inactiveTime > 2*time.Hour  {
-				toDelete = append(toDelete, id)
-			}
-		}
-		
-		for _, id := range toDelete {
-			game := m.games[id]
-			
-			game.Mutex.Lock()
-			if game.HostConn != nil {
-				game.HostConn.Close()
-			}
-			for _, viewer := range game.Viewers {
-				viewer.Close()
+// CleanupInactiveGames removes the expired games and returns their count. Shards are
+// scanned one at a time under a read lock; each candidate is removed under the write
+// lock only if it is still expired, and its connections are closed once the locks are
+// released.
+func (m *GameManager) CleanupInactiveGames() int {
+	now := time.Now()
+	
+	var removed []string
+	for _, shard := range m.shards {
+		for _, game := range shard.snapshot() {
+			if m.expired(game, now) && m.expireGame(shard, game.GameID, now) {
+				removed = append(removed, game.GameID)
 			}
-			game.Mutex.Unlock()
-			
-			delete(m.games, id)
-			logger.Warn.Printf("Cleanup: game removed due to inactivity: GameID=%s (inactive for %v)", id, now.Sub(game.LastActivity))
 		}
-		
-		gameCount := len(m.games)
-		m.gamesMutex.Unlock()
-		
-		m.Stats.Mutex.Lock()
-		m.Stats.ActiveGames = gameCount
-		m.Stats.Mutex.Unlock()
-		
-		logger.System.Printf("Cleanup completed: %d games removed, %d active games remaining", len(toDelete), gameCount)
+	}
+	
+	m.Stats.Mutex.Lock()
+	m.Stats.ActiveGames -= len(removed)
+	m.Stats.LastCleanup = now
+	gameCount := m.Stats.ActiveGames
+	m.Stats.Mutex.Unlock()
+	
+	m.announceRemoval(removed...)
+	
+	logger.System.Printf("Cleanup completed: %d games removed, %d active games remaining", len(removed), gameCount)
+	return len(removed)
 }
 
 func (m *GameManager) GetMetrics() ServerStats {
@@ -153,7 +207,9 @@ func (m *GameManager) GetMetrics() ServerStats {
 		ActiveGames:          m.Stats.ActiveGames,
 		TotalViewers:         m.Stats.TotalViewers,
 		TotalHostConnections: m.Stats.TotalHostConnections,
+		OpenConnections:      m.Stats.OpenConnections,
 		StartTime:            m.Stats.StartTime,
+		LastCleanup:          m.Stats.LastCleanup,
 	}
 }
 
@@ -170,3 +226,30 @@ func (m *GameManager) UpdateHostCount(delta int) {
 	
 	m.Stats.TotalHostConnections += delta
 }
+
+func (m *GameManager) UpdateOpenConnections(delta int) {
+	m.Stats.Mutex.Lock()
+	defer m.Stats.Mutex.Unlock()
+	
+	m.Stats.OpenConnections += delta
+}
+
+// Ping checks that the game store can be accessed before ctx expires.
+// A store stuck behind a held lock is reported as unreachable.
+func (m *GameManager) Ping(ctx context.Context) error {
+	acquired := make(chan struct{})
+	go func() {
+		for _, shard := range m.shards {
+			shard.mutex.RLock()
+			shard.mutex.RUnlock()
+		}
+		close(acquired)
+	}()
+	
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("game store unreachable: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,133 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchmarkGames is the number of games alive during the benchmarks
+const benchmarkGames = 10000
+
+// newBenchmarkManager returns a manager holding benchmarkGames games, and their IDs.
+func newBenchmarkManager(b *testing.B, shards int) (*GameManager, []string) {
+	config := DefaultConfig()
+	config.ShardCount = shards
+	manager := NewGameManagerWithConfig(config)
+
+	gameIDs := make([]string, benchmarkGames)
+	for i := range gameIDs {
+		gameID, err := manager.CreateGame("player"+strconv.Itoa(i), []byte(`{}`))
+		if err != nil {
+			b.Fatal(err)
+		}
+		gameIDs[i] = gameID
+	}
+	return manager, gameIDs
+}
+
+// shardCounts compares a single lock, as before sharding, with the default sharding.
+var shardCounts = []int{1, DefaultShardCount}
+
+func BenchmarkGetGame(b *testing.B) {
+	for _, shards := range shardCounts {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			manager, gameIDs := newBenchmarkManager(b, shards)
+			var next atomic.Int64
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(next.Add(1)) * 7919
+				for pb.Next() {
+					if _, err := manager.GetGame(gameIDs[i%len(gameIDs)]); err != nil {
+						b.Error(err)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkCreateGame(b *testing.B) {
+	for _, shards := range shardCounts {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			config := DefaultConfig()
+			config.ShardCount = shards
+			manager := NewGameManagerWithConfig(config)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := manager.CreateGame("player", []byte(`{}`)); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMixedWorkload runs lookups with one create and remove every 16 operations,
+// close to the traffic of a server where games come and go while being watched.
+func BenchmarkMixedWorkload(b *testing.B) {
+	for _, shards := range shardCounts {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			manager, gameIDs := newBenchmarkManager(b, shards)
+			var next atomic.Int64
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(next.Add(1)) * 7919
+				for pb.Next() {
+					if i%16 == 0 {
+						gameID, _ := manager.CreateGame("player", []byte(`{}`))
+						manager.RemoveGame(gameID)
+					} else {
+						manager.GetGame(gameIDs[i%len(gameIDs)])
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkGetGameDuringCleanup measures lookups while cleanup sweeps run continuously.
+func BenchmarkGetGameDuringCleanup(b *testing.B) {
+	for _, shards := range shardCounts {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			manager, gameIDs := newBenchmarkManager(b, shards)
+			var next atomic.Int64
+
+			done := make(chan struct{})
+			swept := make(chan struct{})
+			go func() {
+				defer close(swept)
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						manager.CleanupInactiveGames()
+						time.Sleep(time.Millisecond)
+					}
+				}
+			}()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(next.Add(1)) * 7919
+				for pb.Next() {
+					manager.GetGame(gameIDs[i%len(gameIDs)])
+					i++
+				}
+			})
+			b.StopTimer()
+			close(done)
+			<-swept
+		})
+	}
+}
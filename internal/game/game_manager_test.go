@@ -1,13 +1,18 @@
 package game
 
 import (
+	"context"
 	"encoding/json"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
 )
 
 type GameManagerTestSuite struct {
@@ -41,6 +46,28 @@ func (suite *GameManagerTestSuite) TestCreateGame() {
 	assert.Equal(t, 1, stats.TotalGamesCreated)
 }
 
+func (suite *GameManagerTestSuite) TestGameOwnership() {
+	t := suite.T()
+	
+	owner := NewGameManagerWithConfig(Config{InactivityTimeout: time.Hour, CleanupInterval: time.Hour, InstanceID: "148ed193b95e89"})
+	other := NewGameManagerWithConfig(Config{InactivityTimeout: time.Hour, CleanupInterval: time.Hour, InstanceID: "e784079b449483"})
+	
+	gameID, err := owner.CreateGame("player123", []byte(`{}`))
+	assert.NoError(t, err)
+	
+	instanceID, found := OwnerInstance(gameID)
+	assert.True(t, found)
+	assert.Equal(t, "148ed193b95e89", instanceID)
+	assert.True(t, owner.Owns(gameID))
+	assert.False(t, other.Owns(gameID))
+	
+	// Games created without an instance ID have no owner and are served locally
+	localID, _ := suite.Manager.CreateGame("player123", []byte(`{}`))
+	_, found = OwnerInstance(localID)
+	assert.False(t, found)
+	assert.True(t, other.Owns(localID))
+}
+
 func (suite *GameManagerTestSuite) TestGetGame() {
 	t := suite.T()
 	
@@ -182,6 +209,617 @@ func (suite *GameManagerTestSuite) TestCleanupInactiveGamesInterval() {
 	assert.NotNil(t, activeGame)
 }
 
+func (suite *GameManagerTestSuite) TestCleanupUsesConfiguredTimeout() {
+	t := suite.T()
+	
+	config := DefaultConfig()
+	config.InactivityTimeout = time.Minute
+	manager := NewGameManagerWithConfig(config)
+	
+	staleGameID, _ := manager.CreateGame("stalePlayer", []byte(`{}`))
+	freshGameID, _ := manager.CreateGame("freshPlayer", []byte(`{}`))
+	
+	staleGame, _ := manager.GetGame(staleGameID)
+	staleGame.Mutex.Lock()
+	staleGame.LastActivity = time.Now().Add(-2 * time.Minute)
+	staleGame.Mutex.Unlock()
+	
+	manager.CleanupInactiveGames()
+	
+	_, err := manager.GetGame(staleGameID)
+	assert.Error(t, err)
+	_, err = manager.GetGame(freshGameID)
+	assert.NoError(t, err)
+}
+
+func (suite *GameManagerTestSuite) TestShardedRegistry() {
+	t := suite.T()
+	
+	config := DefaultConfig()
+	config.ShardCount = 8
+	manager := NewGameManagerWithConfig(config)
+	
+	var wg sync.WaitGroup
+	gameIDs := make(chan string, 200)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gameID, err := manager.CreateGame("player", []byte(`{}`))
+			assert.NoError(t, err)
+			_, err = manager.GetGame(gameID)
+			assert.NoError(t, err)
+			gameIDs <- gameID
+		}()
+	}
+	wg.Wait()
+	close(gameIDs)
+	
+	used := 0
+	for _, shard := range manager.shards {
+		if len(shard.games) > 0 {
+			used++
+		}
+	}
+	assert.Equal(t, 8, used, "games are spread over every shard")
+	assert.Len(t, manager.Games(), 200)
+	assert.Equal(t, 200, manager.GetMetrics().ActiveGames)
+	
+	for gameID := range gameIDs {
+		manager.RemoveGame(gameID)
+	}
+	// Removing an unknown game does not change the count
+	manager.RemoveGame(uuid.New().String())
+	assert.Equal(t, 0, manager.GetMetrics().ActiveGames)
+	assert.Empty(t, manager.Games())
+}
+
+func (suite *GameManagerTestSuite) TestLifecycleEvents() {
+	t := suite.T()
+	
+	var all, expired []Event
+	var mutex sync.Mutex
+	stopAll := suite.Manager.Events().Subscribe(func(event Event) {
+		mutex.Lock()
+		all = append(all, event)
+		mutex.Unlock()
+	})
+	suite.Manager.Events().Subscribe(func(event Event) {
+		expired = append(expired, event)
+	}, EventGameExpired)
+	suite.Manager.Events().Subscribe(func(event Event) {
+		panic("broken handler")
+	})
+	
+	endedID, _ := suite.Manager.CreateGame("player1", []byte(`{}`))
+	expiredID, _ := suite.Manager.CreateGame("player2", []byte(`{}`))
+	suite.Manager.RemoveGame(endedID)
+	
+	game, _ := suite.Manager.GetGame(expiredID)
+	game.Mutex.Lock()
+	game.LastActivity = time.Now().Add(-3 * time.Hour)
+	game.Mutex.Unlock()
+	suite.Manager.CleanupInactiveGames()
+	
+	stopAll()
+	suite.Manager.CreateGame("player3", []byte(`{}`))
+	
+	types := make([]EventType, len(all))
+	for i, event := range all {
+		types[i] = event.Type
+		assert.NotEmpty(t, event.ID)
+		assert.False(t, event.Time.IsZero())
+	}
+	assert.Equal(t, []EventType{EventGameCreated, EventGameCreated, EventGameEnded, EventGameExpired}, types)
+	assert.Equal(t, "player1", all[0].Data["hostPlayerId"])
+	assert.Equal(t, endedID, all[2].GameID)
+	
+	if assert.Len(t, expired, 1) {
+		assert.Equal(t, expiredID, expired[0].GameID)
+		assert.GreaterOrEqual(t, expired[0].Data["inactiveSeconds"], int64(3*3600))
+	}
+}
+
+func (suite *GameManagerTestSuite) TestStandings() {
+	t := suite.T()
+	
+	standings, err := Standings([]FinalScore{
+		{PlayerID: "alice", Score: 210},
+		{PlayerID: "bob", Score: 245},
+		{PlayerID: "carol", Score: 210},
+		{PlayerID: "dave", Score: 180},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Standing{
+		{Rank: 1, PlayerID: "bob", Score: 245},
+		{Rank: 2, PlayerID: "alice", Score: 210},
+		{Rank: 2, PlayerID: "carol", Score: 210},
+		{Rank: 4, PlayerID: "dave", Score: 180},
+	}, standings)
+	
+	_, err = Standings(nil)
+	assert.ErrorIs(t, err, ErrInvalidResults)
+	_, err = Standings([]FinalScore{{PlayerID: "alice"}, {PlayerID: "alice"}})
+	assert.ErrorIs(t, err, ErrInvalidResults)
+	_, err = Standings([]FinalScore{{Score: 12}})
+	assert.ErrorIs(t, err, ErrInvalidResults)
+}
+
+func (suite *GameManagerTestSuite) TestEndGame() {
+	t := suite.T()
+	
+	config := DefaultConfig()
+	config.ResultRetention = 100 * time.Millisecond
+	config.InactivityTimeout = time.Minute
+	manager := NewGameManagerWithConfig(config)
+	gameID, _ := manager.CreateGame("alice", []byte(`{"round":12}`))
+	
+	var ended []Event
+	var mutex sync.Mutex
+	manager.Events().Subscribe(func(event Event) {
+		mutex.Lock()
+		ended = append(ended, event)
+		mutex.Unlock()
+	}, EventGameEnded)
+	
+	message, err := manager.EndGame(gameID, []FinalScore{{PlayerID: "alice", Score: 240}, {PlayerID: "bob", Score: 251}}, json.RawMessage(`{"round":13}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "gameEnded", message.Type)
+	assert.Equal(t, "bob", message.Standings[0].PlayerID)
+	assert.JSONEq(t, `{"round":13}`, string(message.GameState))
+	
+	_, err = manager.EndGame(gameID, []FinalScore{{PlayerID: "alice", Score: 1}}, nil)
+	assert.ErrorIs(t, err, ErrGameFinished)
+	
+	// Late viewers receive the final standings
+	current, err := manager.CurrentState(context.Background(), gameID)
+	assert.NoError(t, err)
+	assert.Contains(t, string(current), `"type":"gameEnded"`)
+	info, err := manager.Info(context.Background(), gameID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusFinished, info.Status)
+	assert.NotNil(t, info.EndedAt)
+	assert.Len(t, info.Standings, 2)
+	
+	// Finished games outlive the inactivity timeout until the end of their retention
+	game, _ := manager.GetGame(gameID)
+	game.Mutex.Lock()
+	game.LastActivity = time.Now().Add(-2 * time.Minute)
+	game.Mutex.Unlock()
+	manager.CleanupInactiveGames()
+	_, err = manager.GetGame(gameID)
+	assert.NoError(t, err)
+	
+	assert.Eventually(t, func() bool {
+		_, err := manager.GetGame(gameID)
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	
+	mutex.Lock()
+	defer mutex.Unlock()
+	if assert.Len(t, ended, 1, "the removal after the retention is not another end") {
+		assert.NotNil(t, ended[0].Data["standings"])
+	}
+}
+
+func (suite *GameManagerTestSuite) TestEndYamsGameWithSpoofedScores() {
+	t := suite.T()
+
+	manager := NewGameManager()
+	schema, _ := manager.Schemas().Get(YamsScorecardSchema)
+	state := []byte(`{"players":[{"id":"alice","scores":{"sixes":24,"bonus":35,"yams":50,"extraYams":1}},{"id":"bob","scores":{"ones":3,"chance":22}}]}`)
+	gameID, err := manager.CreateGameWithOptions("alice", state, GameOptions{Schema: schema, SchemaName: YamsScorecardSchema})
+	assert.NoError(t, err)
+
+	for name, scores := range map[string][]FinalScore{
+		"spoofed score":  {{PlayerID: "alice", Score: 209}, {PlayerID: "bob", Score: 375}},
+		"unknown player": {{PlayerID: "alice", Score: 209}, {PlayerID: "mallory", Score: 25}},
+		"missing player": {{PlayerID: "alice", Score: 209}},
+	} {
+		_, err := manager.EndGame(gameID, scores, nil)
+		assert.ErrorIs(t, err, ErrInvalidResults, name)
+	}
+	// The scores are checked against the final state when one is sent
+	_, err = manager.EndGame(gameID, []FinalScore{{PlayerID: "alice", Score: 209}, {PlayerID: "bob", Score: 25}},
+		json.RawMessage(`{"players":[{"id":"alice","scores":{"sixes":24,"bonus":35,"yams":50,"extraYams":1}},{"id":"bob","scores":{"ones":3,"chance":22,"fullHouse":25}}]}`))
+	assert.ErrorIs(t, err, ErrInvalidResults)
+
+	info, err := manager.Info(context.Background(), gameID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusActive, info.Status, "rejected ends leave the game running")
+
+	message, err := manager.EndGame(gameID, []FinalScore{{PlayerID: "alice", Score: 209}, {PlayerID: "bob", Score: 25}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Standing{{Rank: 1, PlayerID: "alice", Score: 209}, {Rank: 2, PlayerID: "bob", Score: 25}}, message.Standings)
+}
+
+func (suite *GameManagerTestSuite) TestInfoOfRemoteGame() {
+	t := suite.T()
+	
+	shared := broadcast.NewLocal()
+	owner := NewGameManagerWithConfig(Config{InactivityTimeout: time.Hour, CleanupInterval: time.Hour, ResultRetention: time.Hour, Broadcaster: shared})
+	other := NewGameManagerWithConfig(Config{InactivityTimeout: time.Hour, CleanupInterval: time.Hour, Broadcaster: shared})
+	gameID, _ := owner.CreateGame("alice", []byte(`{"round":1}`))
+	
+	info, err := other.Info(context.Background(), gameID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusActive, info.Status)
+	assert.JSONEq(t, `{"round":1}`, string(info.GameState))
+	assert.Nil(t, info.CreatedAt, "connection details are only known to the owner")
+	
+	owner.EndGame(gameID, []FinalScore{{PlayerID: "alice", Score: 99}}, nil)
+	info, err = other.Info(context.Background(), gameID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusFinished, info.Status)
+	assert.Equal(t, []Standing{{Rank: 1, PlayerID: "alice", Score: 99}}, info.Standings)
+	
+	_, err = other.Info(context.Background(), "unknown")
+	assert.ErrorIs(t, err, broadcast.ErrNoSnapshot)
+}
+
+func (suite *GameManagerTestSuite) TestPauseAndResume() {
+	t := suite.T()
+	
+	config := DefaultConfig()
+	config.InactivityTimeout = time.Minute
+	config.PausedInactivityTimeout = time.Hour
+	manager := NewGameManagerWithConfig(config)
+	gameID, _ := manager.CreateGame("alice", []byte(`{"round":4}`))
+	
+	var events []EventType
+	manager.Events().Subscribe(func(event Event) {
+		events = append(events, event.Type)
+	}, EventGamePaused, EventGameResumed)
+	
+	_, err := manager.ResumeGame(gameID)
+	assert.ErrorIs(t, err, ErrGameNotPaused)
+	_, err = manager.PauseGame(gameID, "", 2*time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidPause, "longer than the paused inactivity timeout")
+	
+	paused, err := manager.PauseGame(gameID, "Dinner break", 30*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "gamePaused", paused.Type)
+	assert.Equal(t, "Dinner break", paused.Reason)
+	assert.Equal(t, int64(30*60*1000), paused.ExpectedDurationMs)
+	_, err = manager.PauseGame(gameID, "", 0)
+	assert.ErrorIs(t, err, ErrGamePaused)
+	
+	current, _ := manager.CurrentState(context.Background(), gameID)
+	assert.Contains(t, string(current), `"type":"gamePaused"`)
+	info, _ := manager.Info(context.Background(), gameID)
+	assert.Equal(t, StatusPaused, info.Status)
+	assert.Equal(t, "Dinner break", info.Pause.Reason)
+	
+	// A paused game outlives the inactivity timeout
+	game, _ := manager.GetGame(gameID)
+	game.Mutex.Lock()
+	game.LastActivity = time.Now().Add(-10 * time.Minute)
+	game.Mutex.Unlock()
+	manager.CleanupInactiveGames()
+	_, err = manager.GetGame(gameID)
+	assert.NoError(t, err)
+	
+	resumed, err := manager.ResumeGame(gameID)
+	assert.NoError(t, err)
+	assert.Equal(t, "gameResumed", resumed.Type)
+	assert.JSONEq(t, `{"round":4}`, string(resumed.GameState))
+	info, _ = manager.Info(context.Background(), gameID)
+	assert.Equal(t, StatusActive, info.Status)
+	assert.Nil(t, info.Pause)
+	assert.Equal(t, []EventType{EventGamePaused, EventGameResumed}, events)
+	
+	// Once resumed, the usual inactivity timeout applies again
+	game.Mutex.Lock()
+	game.LastActivity = time.Now().Add(-10 * time.Minute)
+	game.Mutex.Unlock()
+	manager.CleanupInactiveGames()
+	_, err = manager.GetGame(gameID)
+	assert.Error(t, err)
+}
+
+func (suite *GameManagerTestSuite) TestHostGracePeriod() {
+	t := suite.T()
+	
+	config := DefaultConfig()
+	config.HostGracePeriod = 50 * time.Millisecond
+	config.ResultRetention = time.Hour
+	manager := NewGameManagerWithConfig(config)
+	gameID, _ := manager.CreateGame("alice", []byte(`{"round":2}`))
+	game, _ := manager.GetGame(gameID)
+	
+	abandoned := make(chan Event, 1)
+	manager.Events().Subscribe(func(event Event) {
+		abandoned <- event
+	}, EventGameAbandoned)
+	
+	// The first connection opens the host session
+	session, err := manager.ConnectHost(game, nil, "")
+	assert.NoError(t, err)
+	assert.True(t, session.FirstConnection)
+	assert.NotEmpty(t, session.ResumeToken)
+	
+	// Then the seat is reserved to the holder of the resume token
+	assert.ErrorIs(t, manager.CheckHostSeat(game, ""), ErrInvalidResumeToken)
+	assert.ErrorIs(t, manager.CheckHostSeat(game, "guess"), ErrInvalidResumeToken)
+	assert.NoError(t, manager.CheckHostSeat(game, session.ResumeToken))
+	
+	// Reconnecting within the grace period keeps the game active
+	deadline, abandonable, err := manager.DisconnectHost(game, session.Generation)
+	assert.NoError(t, err)
+	assert.True(t, abandonable)
+	assert.WithinDuration(t, time.Now().Add(50*time.Millisecond), deadline, 20*time.Millisecond)
+	info, _ := manager.Info(context.Background(), gameID)
+	assert.Equal(t, deadline, *info.ReconnectDeadline)
+	reconnected, err := manager.ConnectHost(game, nil, session.ResumeToken)
+	assert.NoError(t, err)
+	assert.True(t, reconnected.Reconnected)
+	assert.Equal(t, session.ResumeToken, reconnected.ResumeToken)
+	time.Sleep(100 * time.Millisecond)
+	info, _ = manager.Info(context.Background(), gameID)
+	assert.Equal(t, StatusActive, info.Status)
+	assert.Nil(t, info.ReconnectDeadline)
+	
+	// Missing the deadline abandons the game
+	manager.DisconnectHost(game, reconnected.Generation)
+	select {
+	case event := <-abandoned:
+		assert.Equal(t, gameID, event.GameID)
+	case <-time.After(time.Second):
+		t.Fatal("game not abandoned")
+	}
+	info, _ = manager.Info(context.Background(), gameID)
+	assert.Equal(t, StatusAbandoned, info.Status)
+	current, _ := manager.CurrentState(context.Background(), gameID)
+	assert.Contains(t, string(current), `"type":"gameAbandoned"`)
+	assert.ErrorIs(t, manager.CheckHostSeat(game, session.ResumeToken), ErrGameAbandoned)
+	_, err = manager.EndGame(gameID, []FinalScore{{PlayerID: "alice", Score: 10}}, nil)
+	assert.ErrorIs(t, err, ErrGameAbandoned)
+	
+	// An abandoned game is kept for the result retention, like a finished one
+	game.Mutex.Lock()
+	game.LastActivity = time.Now().Add(-24 * time.Hour)
+	game.Mutex.Unlock()
+	manager.CleanupInactiveGames()
+	_, err = manager.GetGame(gameID)
+	assert.NoError(t, err)
+}
+
+func (suite *GameManagerTestSuite) TestPausedGameIsNotAbandoned() {
+	t := suite.T()
+	
+	config := DefaultConfig()
+	config.HostGracePeriod = 10 * time.Millisecond
+	manager := NewGameManagerWithConfig(config)
+	gameID, _ := manager.CreateGame("alice", []byte(`{}`))
+	game, _ := manager.GetGame(gameID)
+	
+	session, _ := manager.ConnectHost(game, nil, "")
+	_, err := manager.PauseGame(gameID, "", 0)
+	assert.NoError(t, err)
+	_, abandonable, _ := manager.DisconnectHost(game, session.Generation)
+	assert.False(t, abandonable)
+	time.Sleep(50 * time.Millisecond)
+	info, _ := manager.Info(context.Background(), gameID)
+	assert.Equal(t, StatusPaused, info.Status)
+}
+
+func (suite *GameManagerTestSuite) TestDuplicateHostConnections() {
+	t := suite.T()
+	
+	gameID, _ := suite.Manager.CreateGame("alice", []byte(`{}`))
+	game, _ := suite.Manager.GetGame(gameID)
+	first, _ := suite.Manager.ConnectHost(game, &websocket.Conn{}, "")
+	
+	// With the default policy, a second connection takes over the first one
+	second, err := suite.Manager.ConnectHost(game, nil, first.ResumeToken)
+	assert.NoError(t, err)
+	assert.NotNil(t, second.Replaced)
+	assert.Greater(t, second.Generation, first.Generation)
+	assert.False(t, suite.Manager.IsCurrentHost(game, first.Generation))
+	
+	// The replaced connection cannot mark the host disconnected
+	_, _, err = suite.Manager.DisconnectHost(game, first.Generation)
+	assert.ErrorIs(t, err, ErrStaleHostConnection)
+	assert.Equal(t, HostConnected, game.HostConnectionState)
+	
+	config := DefaultConfig()
+	config.DuplicateHostPolicy = DuplicateHostReject
+	manager := NewGameManagerWithConfig(config)
+	gameID, _ = manager.CreateGame("alice", []byte(`{}`))
+	game, _ = manager.GetGame(gameID)
+	first, _ = manager.ConnectHost(game, nil, "")
+	_, err = manager.ConnectHost(game, nil, first.ResumeToken)
+	assert.ErrorIs(t, err, ErrHostAlreadyConnected)
+	assert.True(t, manager.IsCurrentHost(game, first.Generation))
+}
+
+func (suite *GameManagerTestSuite) TestBroadcastSystemMessage() {
+	t := suite.T()
+	
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	firstID, _ := suite.Manager.CreateGame("alice", []byte(`{}`))
+	secondID, _ := suite.Manager.CreateGame("bob", []byte(`{}`))
+	viewers, err := suite.Manager.Broadcaster().Subscribe(ctx, GameTopic(firstID))
+	assert.NoError(t, err)
+	defer viewers.Close()
+	host, err := suite.Manager.Broadcaster().Subscribe(ctx, HostTopic(secondID))
+	assert.NoError(t, err)
+	defer host.Close()
+	
+	_, err = suite.Manager.BroadcastSystemMessage(ctx, SystemNotice{Severity: "loud", Text: "Hi"})
+	assert.ErrorIs(t, err, ErrInvalidNotice)
+	_, err = suite.Manager.BroadcastSystemMessage(ctx, SystemNotice{})
+	assert.ErrorIs(t, err, ErrInvalidNotice)
+	
+	deliveries, err := suite.Manager.BroadcastSystemMessage(ctx, SystemNotice{Text: "Deploying in 5 minutes"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []NoticeDelivery{
+		{GameID: firstID, Delivered: true},
+		{GameID: secondID, Delivered: true},
+	}, deliveries)
+	
+	// Hosts and viewers of every game receive the notice
+	for _, subscription := range []*broadcast.Subscription{viewers, host} {
+		select {
+		case data := <-subscription.Messages():
+			var notice SystemNotice
+			assert.NoError(t, json.Unmarshal(data, &notice))
+			assert.Equal(t, "systemNotice", notice.Type)
+			assert.Equal(t, SeverityInfo, notice.Severity)
+			assert.Equal(t, "Deploying in 5 minutes", notice.Text)
+			assert.Nil(t, notice.MaintenanceAt)
+		case <-ctx.Done():
+			t.Fatal("notice not received")
+		}
+	}
+	
+	assert.ErrorIs(t, suite.Manager.SendNotice(ctx, "unknown", SystemNotice{Text: "Hi"}), ErrGameNotFound)
+}
+
+func (suite *GameManagerTestSuite) TestExpiryPolicies() {
+	t := suite.T()
+	
+	config := DefaultConfig()
+	config.InactivityTimeout = time.Minute
+	config.PausedInactivityTimeout = time.Hour
+	config.MaxLifetime = 24 * time.Hour
+	manager := NewGameManagerWithConfig(config)
+	
+	_, err := manager.CreateGameWithOptions("alice", []byte(`{}`), GameOptions{Policy: ExpiryPolicy{IdleTimeout: -time.Second}})
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+	_, err = manager.CreateGameWithOptions("alice", []byte(`{}`), GameOptions{Policy: ExpiryPolicy{IdleTimeout: 2 * time.Hour}})
+	assert.ErrorIs(t, err, ErrInvalidPolicy, "idle timeout longer than the paused one")
+	_, err = manager.CreateGameWithOptions("alice", []byte(`{}`), GameOptions{Policy: ExpiryPolicy{MaxLifetime: 48 * time.Hour}})
+	assert.ErrorIs(t, err, ErrInvalidPolicy, "lifetime longer than the server one")
+	
+	create := func(policy ExpiryPolicy) *Game {
+		gameID, err := manager.CreateGameWithOptions("alice", []byte(`{}`), GameOptions{Policy: policy})
+		assert.NoError(t, err)
+		game, _ := manager.GetGame(gameID)
+		game.Mutex.Lock()
+		game.LastActivity = time.Now().Add(-30 * time.Minute)
+		game.Mutex.Unlock()
+		return game
+	}
+	idle := create(ExpiryPolicy{})
+	patient := create(ExpiryPolicy{IdleTimeout: 45 * time.Minute})
+	watched := create(ExpiryPolicy{KeepWhileViewers: true})
+	watched.Mutex.Lock()
+	watched.Viewers = append(watched.Viewers, nil)
+	watched.Mutex.Unlock()
+	kept := create(ExpiryPolicy{KeepUntilEnded: true, MaxLifetime: time.Hour})
+	shortLived := create(ExpiryPolicy{IdleTimeout: time.Hour, MaxLifetime: 20 * time.Minute})
+	shortLived.Mutex.Lock()
+	shortLived.CreatedAt = time.Now().Add(-30 * time.Minute)
+	shortLived.Mutex.Unlock()
+	
+	expiresAt, ok := manager.ExpiresAt(kept.GameID)
+	assert.True(t, ok)
+	assert.WithinDuration(t, kept.CreatedAt.Add(time.Hour), expiresAt, time.Millisecond, "only the lifetime bounds a game kept until ended")
+	details, _ := manager.Details(patient.GameID)
+	assert.Equal(t, int64(45*60), details.Policy.IdleTimeoutSeconds)
+	assert.NotNil(t, details.ExpiresAt)
+	
+	var expired []Event
+	manager.Events().Subscribe(func(event Event) {
+		expired = append(expired, event)
+	}, EventGameExpired)
+	
+	assert.Equal(t, 2, manager.CleanupInactiveGames())
+	for _, game := range []*Game{idle, shortLived} {
+		_, err := manager.GetGame(game.GameID)
+		assert.Error(t, err)
+	}
+	for _, game := range []*Game{patient, watched, kept} {
+		_, err := manager.GetGame(game.GameID)
+		assert.NoError(t, err)
+	}
+	reasons := map[string]interface{}{}
+	for _, event := range expired {
+		reasons[event.GameID] = event.Data["reason"]
+	}
+	assert.Equal(t, map[string]interface{}{idle.GameID: ExpiryIdle, shortLived.GameID: ExpiryLifetime}, reasons)
+	
+	// Once the viewers are gone, the idle timeout applies again
+	watched.Mutex.Lock()
+	watched.Viewers = nil
+	watched.Mutex.Unlock()
+	assert.Equal(t, 1, manager.CleanupInactiveGames())
+	_, err = manager.GetGame(watched.GameID)
+	assert.Error(t, err)
+}
+
+func (suite *GameManagerTestSuite) TestExpiryScheduler() {
+	t := suite.T()
+	
+	config := DefaultConfig()
+	config.InactivityTimeout = 200 * time.Millisecond
+	manager := NewGameManagerWithConfig(config)
+	
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	gameID, _ := manager.CreateGame("alice", []byte(`{}`))
+	viewers, err := manager.Broadcaster().Subscribe(ctx, GameTopic(gameID))
+	assert.NoError(t, err)
+	defer viewers.Close()
+	host, err := manager.Broadcaster().Subscribe(ctx, HostTopic(gameID))
+	assert.NoError(t, err)
+	defer host.Close()
+	
+	// Both are warned once, half the timeout before the expiry, then the game is removed
+	for _, subscription := range []*broadcast.Subscription{viewers, host} {
+		select {
+		case data := <-subscription.Messages():
+			var message GameExpiringMessage
+			assert.NoError(t, json.Unmarshal(data, &message))
+			assert.Equal(t, "gameExpiring", message.Type)
+			assert.Equal(t, ExpiryIdle, message.Reason)
+			assert.LessOrEqual(t, message.RemainingMs, int64(100))
+		case <-ctx.Done():
+			t.Fatal("expiry warning not received")
+		}
+	}
+	select {
+	case data := <-viewers.Messages():
+		assert.True(t, IsGameRemoved(data))
+	case <-ctx.Done():
+		t.Fatal("removal not announced")
+	}
+	_, err = manager.GetGame(gameID)
+	assert.Error(t, err)
+	assert.Equal(t, 0, manager.GetMetrics().ActiveGames)
+}
+
+func (suite *GameManagerTestSuite) TestReserveSeats() {
+	t := suite.T()
+	
+	gameID, _ := suite.Manager.CreateGame("alice", []byte(`{}`))
+	game, _ := suite.Manager.GetGame(gameID)
+	
+	tokens, err := suite.Manager.ReserveSeats(gameID, []string{"alice", "bob", "carol"})
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 3)
+	_, err = suite.Manager.ReserveSeats(gameID, []string{"alice", "bob"})
+	assert.ErrorIs(t, err, ErrSeatsReserved)
+	_, err = suite.Manager.ReserveSeats("unknown", []string{"alice"})
+	assert.ErrorIs(t, err, ErrGameNotFound)
+	
+	// The host seat is reserved to the host token from the first connection
+	assert.ErrorIs(t, suite.Manager.CheckHostSeat(game, ""), ErrInvalidResumeToken)
+	assert.ErrorIs(t, suite.Manager.CheckHostSeat(game, tokens["bob"]), ErrInvalidResumeToken)
+	session, err := suite.Manager.ConnectHost(game, nil, tokens["alice"])
+	assert.NoError(t, err)
+	assert.Equal(t, tokens["alice"], session.ResumeToken)
+	
+	// The other players hold their own seat only
+	assert.NoError(t, suite.Manager.CheckPlayerSeat(game, "bob", tokens["bob"]))
+	assert.NoError(t, suite.Manager.CheckPlayerSeat(game, "carol", tokens["carol"]))
+	assert.ErrorIs(t, suite.Manager.CheckPlayerSeat(game, "bob", tokens["carol"]), ErrInvalidPlayerToken)
+	assert.ErrorIs(t, suite.Manager.CheckPlayerSeat(game, "alice", tokens["alice"]), ErrInvalidPlayerToken)
+	assert.ErrorIs(t, suite.Manager.CheckPlayerSeat(game, "dave", ""), ErrInvalidPlayerToken)
+}
+
 func TestGameManagerSuite(t *testing.T) {
 	suite.Run(t, new(GameManagerTestSuite))
 }
\ No newline at end of file
@@ -0,0 +1,199 @@
+package game
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+Host Sessions
+
+The first host connection of a game opens a host session and receives its resume
+token. From then on, the host seat is reserved to that session: connecting as host
+requires the token, not only the host ID. When the host connection drops, the host has
+HostGracePeriod to come back; the viewers are told how long they may have to wait, and
+a host missing the deadline abandons the game, which can then no longer be hosted and
+is removed after the result retention period.
+
+A host opening a second connection while connected, from another tab for instance, is
+either refused or takes over, closing the old connection, depending on the
+DuplicateHostPolicy. Each host connection gets a generation number: a connection
+replaced by a newer one can neither update the game nor mark the host disconnected.
+*/
+
+var (
+	// ErrInvalidResumeToken is returned when a host connects without its session token
+	ErrInvalidResumeToken = errors.New("invalid resume token")
+	// ErrGameAbandoned is returned when connecting to a game abandoned by its host
+	ErrGameAbandoned = errors.New("game abandoned")
+	// ErrHostAlreadyConnected is returned when the host connects twice with the reject policy
+	ErrHostAlreadyConnected = errors.New("host already connected")
+	// ErrStaleHostConnection is returned for a host connection replaced by a newer one
+	ErrStaleHostConnection = errors.New("host connection replaced by a newer one")
+)
+
+// HostSession describes an accepted host connection
+type HostSession struct {
+	// ResumeToken must be presented by the next connections of the host
+	ResumeToken string
+	// FirstConnection is true when the host session was just opened
+	FirstConnection bool
+	// Reconnected is true when the host came back after a disconnection
+	Reconnected bool
+	// Generation identifies the connection in the later calls for this host session
+	Generation uint64
+	// Replaced is the connection taken over by this one, to be closed by the caller
+	Replaced *websocket.Conn
+}
+
+// CheckHostSeat reports whether a host presenting resumeToken may connect to a game,
+// so that a refused host gets an HTTP status before the WebSocket upgrade. ConnectHost
+// checks again when taking the seat.
+func (m *GameManager) CheckHostSeat(game *Game, resumeToken string) error {
+	game.Mutex.Lock()
+	defer game.Mutex.Unlock()
+	return m.checkHostSeat(game, resumeToken)
+}
+
+// ConnectHost makes conn the host connection of a game. The first connection opens the
+// host session; the next ones must present its resume token.
+func (m *GameManager) ConnectHost(game *Game, conn *websocket.Conn, resumeToken string) (HostSession, error) {
+	game.Mutex.Lock()
+	defer game.Mutex.Unlock()
+
+	if err := m.checkHostSeat(game, resumeToken); err != nil {
+		return HostSession{}, err
+	}
+	if game.ResumeToken == "" {
+		token, err := newResumeToken()
+		if err != nil {
+			return HostSession{}, err
+		}
+		game.ResumeToken = token
+	}
+
+	game.HostGeneration++
+	session := HostSession{
+		ResumeToken:     game.ResumeToken,
+		FirstConnection: game.HostConnectionState == HostNeverConnected,
+		Reconnected:     game.HostConnectionState == HostDisconnected,
+		Generation:      game.HostGeneration,
+	}
+	if game.HostConnectionState == HostConnected {
+		session.Replaced = game.HostConn
+	}
+	game.HostConn = conn
+	game.HostConnectionState = HostConnected
+	game.ReconnectDeadline = time.Time{}
+	game.LastActivity = time.Now()
+	return session, nil
+}
+
+// IsCurrentHost reports whether the host connection of a generation is still the host
+// connection of the game.
+func (m *GameManager) IsCurrentHost(game *Game, generation uint64) bool {
+	game.Mutex.Lock()
+	defer game.Mutex.Unlock()
+	return game.HostGeneration == generation
+}
+
+// DisconnectHost records the loss of the host connection of a generation. When the game
+// can be abandoned, it returns the deadline for the host to come back, and the game is
+// abandoned if the host misses it. A connection replaced by a newer one changes nothing
+// and gets ErrStaleHostConnection.
+func (m *GameManager) DisconnectHost(game *Game, generation uint64) (deadline time.Time, abandonable bool, err error) {
+	game.Mutex.Lock()
+	defer game.Mutex.Unlock()
+
+	if game.HostGeneration != generation {
+		return time.Time{}, false, ErrStaleHostConnection
+	}
+	now := time.Now()
+	game.HostConn = nil
+	game.HostConnectionState = HostDisconnected
+	game.LastActivity = now
+
+	// Paused games wait for their host as long as they are kept; finished games need no host
+	if m.config.HostGracePeriod <= 0 || game.Status != StatusActive {
+		game.ReconnectDeadline = time.Time{}
+		return time.Time{}, false, nil
+	}
+	deadline = now.Add(m.config.HostGracePeriod)
+	game.ReconnectDeadline = deadline
+	time.AfterFunc(m.config.HostGracePeriod, func() {
+		m.abandonGame(game, deadline)
+	})
+	return deadline, true, nil
+}
+
+// abandonGame abandons a game whose host missed the reconnection deadline. Nothing
+// happens if the host came back since, even to leave again with a new deadline.
+func (m *GameManager) abandonGame(game *Game, deadline time.Time) {
+	game.Mutex.Lock()
+	if game.HostConnectionState != HostDisconnected || !game.ReconnectDeadline.Equal(deadline) || game.Status != StatusActive {
+		game.Mutex.Unlock()
+		return
+	}
+	now := time.Now()
+	game.Status = StatusAbandoned
+	game.AbandonedAt = now
+	game.ReconnectDeadline = time.Time{}
+	message := abandonedMessage(game)
+	game.Mutex.Unlock()
+
+	if _, err := m.GetGame(game.GameID); err != nil {
+		return
+	}
+	logger.Warn.Printf("Game abandoned, host did not reconnect within %v: GameID=%s", m.config.HostGracePeriod, game.GameID)
+	m.publishRetained(game.GameID, message)
+	m.Emit(EventGameAbandoned, game.GameID, map[string]interface{}{
+		"gracePeriodMs": m.config.HostGracePeriod.Milliseconds(),
+	})
+	time.AfterFunc(m.config.ResultRetention, func() {
+		m.RemoveGame(game.GameID)
+	})
+}
+
+// HostGracePeriod returns how long a disconnected host has to come back.
+func (m *GameManager) HostGracePeriod() time.Duration {
+	return m.config.HostGracePeriod
+}
+
+// checkHostSeat checks a host connection attempt. The game mutex must be held.
+func (m *GameManager) checkHostSeat(game *Game, resumeToken string) error {
+	if game.Status == StatusAbandoned {
+		return ErrGameAbandoned
+	}
+	if game.ResumeToken != "" && subtle.ConstantTimeCompare([]byte(game.ResumeToken), []byte(resumeToken)) != 1 {
+		return ErrInvalidResumeToken
+	}
+	if game.HostConnectionState == HostConnected && m.config.DuplicateHostPolicy == DuplicateHostReject {
+		return ErrHostAlreadyConnected
+	}
+	return nil
+}
+
+// abandonedMessage returns the gameAbandoned message of an abandoned game. The game
+// mutex must be held.
+func abandonedMessage(game *Game) GameAbandonedMessage {
+	return GameAbandonedMessage{
+		Type:        "gameAbandoned",
+		AbandonedAt: game.AbandonedAt,
+		GameState:   game.GameState,
+	}
+}
+
+func newResumeToken() (string, error) {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
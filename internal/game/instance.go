@@ -0,0 +1,59 @@
+package game
+
+import "strings"
+
+/*
+Game Ownership
+
+When the GameManager is configured with an instance ID, every game it creates is owned
+by that instance, and the game ID carries the owner: "<instanceID>.<uuid>". Any
+instance can thus tell, from the game ID alone, where the game lives and route the
+request there. Game IDs without an instance prefix are owned by whichever instance
+holds them.
+*/
+
+// instanceSeparator separates the owning instance from the random part of a game ID
+const instanceSeparator = "."
+
+// newGameID returns a game ID owned by instanceID.
+func newGameID(instanceID, random string) string {
+	if instanceID == "" {
+		return random
+	}
+	return instanceID + instanceSeparator + random
+}
+
+// OwnerInstance returns the instance encoded in a game ID, if any.
+func OwnerInstance(gameID string) (string, bool) {
+	instanceID, _, found := strings.Cut(gameID, instanceSeparator)
+	if !found || instanceID == "" {
+		return "", false
+	}
+	return instanceID, true
+}
+
+// ValidInstanceID reports whether an instance ID only holds letters, digits, '-' and
+// '_': instance IDs read from game IDs are client input, used to build internal URLs.
+func ValidInstanceID(instanceID string) bool {
+	if instanceID == "" || len(instanceID) > 64 {
+		return false
+	}
+	for _, c := range instanceID {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// InstanceID returns the ID of this instance, empty when ownership is not used.
+func (m *GameManager) InstanceID() string {
+	return m.config.InstanceID
+}
+
+// Owns reports whether a game is owned by this instance. Games without an owner in
+// their ID are considered local.
+func (m *GameManager) Owns(gameID string) bool {
+	owner, found := OwnerInstance(gameID)
+	return !found || owner == m.config.InstanceID
+}
@@ -0,0 +1,107 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+System Notices
+
+Operators reach the hosts and viewers with systemNotice messages, either for one game
+or for every game held by this instance, before a deployment for instance. Notices are
+published on the host and game topics, so they also reach the viewers connected to
+other instances; they are not retained, a client connecting later does not receive them.
+*/
+
+// ErrInvalidNotice is returned for a notice without text, with a text too long or with
+// an unknown severity
+var ErrInvalidNotice = errors.New("invalid notice")
+
+// maxNoticeLength bounds the text of a notice, in bytes
+const maxNoticeLength = 500
+
+// Severity tells the clients how to display a notice
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Validate checks a notice before it is sent. An empty severity is accepted as info.
+func (n SystemNotice) Validate() error {
+	switch n.Severity {
+	case "", SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return fmt.Errorf("%w: unknown severity %q", ErrInvalidNotice, n.Severity)
+	}
+	if n.Text == "" {
+		return fmt.Errorf("%w: empty text", ErrInvalidNotice)
+	}
+	if len(n.Text) > maxNoticeLength {
+		return fmt.Errorf("%w: text longer than %d bytes", ErrInvalidNotice, maxNoticeLength)
+	}
+	return nil
+}
+
+// SendNotice sends a systemNotice message to the host and the viewers of a game held by
+// this instance.
+func (m *GameManager) SendNotice(ctx context.Context, gameID string, notice SystemNotice) error {
+	if err := notice.Validate(); err != nil {
+		return err
+	}
+	if _, err := m.GetGame(gameID); err != nil {
+		return ErrGameNotFound
+	}
+	return m.sendNotice(ctx, gameID, prepareNotice(notice))
+}
+
+// BroadcastSystemMessage sends a systemNotice message to the host and the viewers of
+// every game held by this instance, and reports the delivery to each game.
+func (m *GameManager) BroadcastSystemMessage(ctx context.Context, notice SystemNotice) ([]NoticeDelivery, error) {
+	if err := notice.Validate(); err != nil {
+		return nil, err
+	}
+	notice = prepareNotice(notice)
+
+	games := m.Games()
+	deliveries := make([]NoticeDelivery, 0, len(games))
+	failed := 0
+	for _, game := range games {
+		delivery := NoticeDelivery{GameID: game.GameID, Delivered: true}
+		if err := m.sendNotice(ctx, game.GameID, notice); err != nil {
+			delivery.Delivered = false
+			delivery.Error = err.Error()
+			failed++
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	logger.System.Printf("System notice (%s) sent to %d games, %d failed: %s", notice.Severity, len(games)-failed, failed, notice.Text)
+	return deliveries, nil
+}
+
+func (m *GameManager) sendNotice(ctx context.Context, gameID string, notice SystemNotice) error {
+	if err := m.PublishToViewers(ctx, gameID, notice); err != nil {
+		return fmt.Errorf("viewers not reached: %w", err)
+	}
+	if err := m.PublishToHost(ctx, gameID, notice); err != nil {
+		return fmt.Errorf("host not reached: %w", err)
+	}
+	return nil
+}
+
+// prepareNotice fills the fields set by the server.
+func prepareNotice(notice SystemNotice) SystemNotice {
+	notice.Type = "systemNotice"
+	if notice.Severity == "" {
+		notice.Severity = SeverityInfo
+	}
+	notice.SentAt = time.Now().UTC()
+	return notice
+}
@@ -0,0 +1,158 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+Game Pause
+
+A host stepping away pauses its game rather than leaving the viewers in front of a
+stale board. While paused, the game refuses state updates, its viewers know why and for
+how long (gamePaused message, retained for the viewers joining meanwhile), and the
+inactivity cleanup grants it PausedInactivityTimeout instead of InactivityTimeout.
+*/
+
+// maxPauseReasonLength bounds the pause reason shown to the viewers
+const maxPauseReasonLength = 200
+
+var (
+	// ErrGamePaused is returned when pausing or updating a paused game
+	ErrGamePaused = errors.New("game paused")
+	// ErrGameNotPaused is returned when resuming a game that is not paused
+	ErrGameNotPaused = errors.New("game not paused")
+	// ErrInvalidPause is returned when the reason or expected duration are not acceptable
+	ErrInvalidPause = errors.New("invalid pause")
+)
+
+// PauseGame pauses an active game. reason and expectedDuration are optional (empty and 0).
+func (m *GameManager) PauseGame(gameID string, reason string, expectedDuration time.Duration) (GamePausedMessage, error) {
+	game, err := m.GetGame(gameID)
+	if err != nil {
+		return GamePausedMessage{}, err
+	}
+	if len(reason) > maxPauseReasonLength {
+		return GamePausedMessage{}, fmt.Errorf("%w: reason longer than %d bytes", ErrInvalidPause, maxPauseReasonLength)
+	}
+	if expectedDuration < 0 || expectedDuration > m.pausedInactivityTimeout() {
+		return GamePausedMessage{}, fmt.Errorf("%w: expected duration must be between 0 and %v", ErrInvalidPause, m.pausedInactivityTimeout())
+	}
+
+	game.Mutex.Lock()
+	switch game.Status {
+	case StatusPaused:
+		game.Mutex.Unlock()
+		return GamePausedMessage{}, ErrGamePaused
+	case StatusFinished:
+		game.Mutex.Unlock()
+		return GamePausedMessage{}, ErrGameFinished
+	case StatusAbandoned:
+		game.Mutex.Unlock()
+		return GamePausedMessage{}, ErrGameAbandoned
+	}
+	now := time.Now()
+	game.Status = StatusPaused
+	game.Pause = &PauseInfo{
+		Reason:             reason,
+		ExpectedDurationMs: expectedDuration.Milliseconds(),
+		PausedAt:           now.UTC(),
+	}
+	game.LastActivity = now
+	message := pausedMessage(game)
+	game.Mutex.Unlock()
+
+	logger.Info.Printf("Game paused: GameID=%s, expected duration %v", gameID, expectedDuration)
+	m.publishRetained(gameID, message)
+	m.Emit(EventGamePaused, gameID, map[string]interface{}{
+		"reason":             reason,
+		"expectedDurationMs": expectedDuration.Milliseconds(),
+	})
+	return message, nil
+}
+
+// ResumeGame resumes a paused game.
+func (m *GameManager) ResumeGame(gameID string) (GameResumedMessage, error) {
+	game, err := m.GetGame(gameID)
+	if err != nil {
+		return GameResumedMessage{}, err
+	}
+
+	game.Mutex.Lock()
+	if game.Status != StatusPaused {
+		game.Mutex.Unlock()
+		if game.Status == StatusFinished {
+			return GameResumedMessage{}, ErrGameFinished
+		}
+		return GameResumedMessage{}, ErrGameNotPaused
+	}
+	now := time.Now()
+	pausedFor := now.Sub(game.Pause.PausedAt)
+	game.Status = StatusActive
+	game.Pause = nil
+	game.LastActivity = now
+	message := GameResumedMessage{
+		Type:        "gameResumed",
+		PausedForMs: pausedFor.Milliseconds(),
+		GameState:   game.GameState,
+	}
+	game.Mutex.Unlock()
+
+	logger.Info.Printf("Game resumed: GameID=%s, paused for %v", gameID, pausedFor.Round(time.Second))
+	m.publishRetained(gameID, message)
+	// The expiry of the game comes back to its idle timeout
+	m.scheduleExpiry(game)
+	m.Emit(EventGameResumed, gameID, map[string]interface{}{
+		"pausedForMs": pausedFor.Milliseconds(),
+	})
+	return message, nil
+}
+
+// pausedInactivityTimeout returns the idle duration granted to paused games.
+func (m *GameManager) pausedInactivityTimeout() time.Duration {
+	return max(m.config.InactivityTimeout, m.config.PausedInactivityTimeout)
+}
+
+// inactivityTimeout returns the idle duration after which a game is removed: its policy
+// idle timeout or the server one, lengthened while paused or kept until ended. The game
+// mutex must be held.
+func (m *GameManager) inactivityTimeout(game *Game) time.Duration {
+	timeout := m.config.InactivityTimeout
+	if game.Policy.IdleTimeout > 0 {
+		timeout = game.Policy.IdleTimeout
+	}
+	if game.Status == StatusPaused || game.Policy.KeepUntilEnded {
+		return max(timeout, m.pausedInactivityTimeout())
+	}
+	return timeout
+}
+
+// pausedMessage returns the gamePaused message of a paused game. The game mutex must be
+// held.
+func pausedMessage(game *Game) GamePausedMessage {
+	return GamePausedMessage{
+		Type:      "gamePaused",
+		PauseInfo: *game.Pause,
+		GameState: game.GameState,
+	}
+}
+
+// publishRetained sends a message carrying the game state to the viewers, and retains
+// it for the viewers joining afterwards.
+func (m *GameManager) publishRetained(gameID string, message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		logger.Error.Printf("Cannot encode message for game %s: %v", gameID, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := m.broadcaster.Publish(ctx, GameTopic(gameID), data, true); err != nil {
+		logger.Warn.Printf("Cannot publish to the viewers of game %s: %v", gameID, err)
+	}
+}
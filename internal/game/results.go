@@ -0,0 +1,199 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+Game Results
+
+When a game ends, its result is published on the results topic of the broadcaster, so
+that the features aggregating results across games, such as the leaderboard and the
+player profiles, receive the results of the games ended on every instance. Results are
+not retained: a subscriber only receives the games ended after it subscribed.
+
+The server only knows the rules of the games validated with the built-in Yams scorecard
+schema: for them, the result also carries the scorecard of each player, read from the
+final state, and the final scores sent by the host must be the totals of the scorecards
+(see checkYamsScores). Other games only carry the final scores sent by the host.
+*/
+
+// ResultsTopic is the topic carrying the result of every game ended
+const ResultsTopic = "results"
+
+// resubscribeDelay is the wait before subscribing again to the results after a failure
+const resubscribeDelay = time.Second
+
+// upperCategories are the categories of the upper section of a Yams scorecard
+var upperCategories = []string{"ones", "twos", "threes", "fours", "fives", "sixes"}
+
+const (
+	// yamsScore is the score of the yams category when a yams was scored
+	yamsScore = 50
+	// extraYamsScore is the score of each extra yams
+	extraYamsScore = 100
+)
+
+// ListenResults calls record with every result published on the broadcaster until ctx
+// is done. The subscription is made before returning, so no result published afterwards
+// is missed; when it fails later, it is made again and the results published meanwhile
+// are lost. record is called from a single goroutine.
+func ListenResults(ctx context.Context, broadcaster broadcast.Broadcaster, record func(GameResult)) error {
+	results, err := broadcaster.Subscribe(ctx, ResultsTopic)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			receiveResults(ctx, results, record)
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn.Printf("Results subscription ended: %v", results.Err())
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(resubscribeDelay):
+				}
+				if results, err = broadcaster.Subscribe(ctx, ResultsTopic); err == nil {
+					break
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// receiveResults records the results of a subscription until it ends or ctx is done.
+func receiveResults(ctx context.Context, results *broadcast.Subscription, record func(GameResult)) {
+	defer results.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case data, ok := <-results.Messages():
+			if !ok {
+				return
+			}
+			var result GameResult
+			if err := json.Unmarshal(data, &result); err != nil {
+				logger.Warn.Printf("Invalid game result received: %v", err)
+				continue
+			}
+			record(result)
+		}
+	}
+}
+
+// IsYams reports whether the game was played with the Yams scorecard schema, whose
+// players have a scorecard.
+func (r GameResult) IsYams() bool {
+	return r.SchemaName == YamsScorecardSchema
+}
+
+// gameResult returns the result of a finished game. The game mutex must be held.
+func gameResult(game *Game) GameResult {
+	result := GameResult{
+		GameID:       game.GameID,
+		HostPlayerID: game.HostPlayerID,
+		SchemaName:   game.SchemaName,
+		EndedAt:      game.EndedAt.UTC(),
+		Players:      make([]PlayerResult, 0, len(game.Standings)),
+	}
+	var cards map[string]*Scorecard
+	if result.IsYams() {
+		cards = scorecards(game.GameState)
+	}
+	for _, standing := range game.Standings {
+		result.Players = append(result.Players, PlayerResult{
+			Standing:  standing,
+			Scorecard: cards[standing.PlayerID],
+		})
+	}
+	return result
+}
+
+// scorecards reads the scorecard of each player from a state matching the Yams
+// scorecard schema.
+func scorecards(state json.RawMessage) map[string]*Scorecard {
+	var yams struct {
+		Players []struct {
+			ID     string          `json:"id"`
+			Scores map[string]*int `json:"scores"`
+		} `json:"players"`
+	}
+	if err := json.Unmarshal(state, &yams); err != nil {
+		return nil
+	}
+
+	cards := make(map[string]*Scorecard, len(yams.Players))
+	for _, player := range yams.Players {
+		card := &Scorecard{Categories: make(map[string]int)}
+		for category, score := range player.Scores {
+			if score == nil {
+				continue
+			}
+			switch category {
+			case "bonus":
+				card.Bonus = *score > 0
+				card.Total += *score
+			case "extraYams":
+				card.Yams += *score
+				card.Total += *score * extraYamsScore
+			default:
+				card.Categories[category] = *score
+				card.Total += *score
+			}
+		}
+		for _, category := range upperCategories {
+			card.UpperSection += card.Categories[category]
+		}
+		if card.Categories["yams"] == yamsScore {
+			card.Yams++
+		}
+		cards[player.ID] = card
+	}
+	return cards
+}
+
+// checkYamsScores checks that the final scores of a Yams game are those of the players
+// of its final state, each the total of the player's scorecard, so that a host cannot
+// report scores its scorecards do not justify.
+func checkYamsScores(scores []FinalScore, state json.RawMessage) error {
+	cards := scorecards(state)
+	if len(scores) != len(cards) {
+		return fmt.Errorf("%w: %d scores for %d players in the final state", ErrInvalidResults, len(scores), len(cards))
+	}
+	for _, score := range scores {
+		card, exists := cards[score.PlayerID]
+		if !exists {
+			return fmt.Errorf("%w: player %s is not in the final state", ErrInvalidResults, score.PlayerID)
+		}
+		if score.Score != card.Total {
+			return fmt.Errorf("%w: score %d of player %s differs from the scorecard total %d", ErrInvalidResults, score.Score, score.PlayerID, card.Total)
+		}
+	}
+	return nil
+}
+
+// publishResult publishes the result of a game on the results topic.
+func (m *GameManager) publishResult(result GameResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		logger.Error.Printf("Cannot encode the result of game %s: %v", result.GameID, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := m.broadcaster.Publish(ctx, ResultsTopic, data, false); err != nil {
+		logger.Warn.Printf("Cannot publish the result of game %s: %v", result.GameID, err)
+	}
+}
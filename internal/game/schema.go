@@ -0,0 +1,175 @@
+package game
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+/*
+Game State Schemas
+
+This file implements the optional JSON Schema validation of game states. A game can be
+created with a schema, either supplied inline by the client or selected by name among
+the schemas registered on the server (such as the built-in Yams scorecard schema).
+Every state pushed by the host is then validated before being stored and broadcast,
+and violations are reported as a list of (path, message) pairs.
+
+Schemas are compiled without access to the network or the file system: external
+references ($ref to another URL) are rejected.
+*/
+
+// YamsScorecardSchema is the name of the built-in Yams scorecard schema
+const YamsScorecardSchema = "yams-scorecard"
+
+//go:embed schemas/*.json
+var builtinSchemas embed.FS
+
+var builtinSchemaFiles = map[string]string{
+	YamsScorecardSchema: "schemas/yams-scorecard.json",
+}
+
+// YamsScorecard returns a game state matching the Yams scorecard schema, with an empty
+// scorecard for each player.
+func YamsScorecard(players []string) json.RawMessage {
+	type scorecard struct {
+		ID     string         `json:"id"`
+		Scores map[string]int `json:"scores"`
+	}
+	state := struct {
+		Players []scorecard `json:"players"`
+	}{}
+	for _, player := range players {
+		state.Players = append(state.Players, scorecard{ID: player, Scores: map[string]int{}})
+	}
+	data, _ := json.Marshal(state)
+	return data
+}
+
+func NewSchemaRegistry() *SchemaRegistry {
+	registry := &SchemaRegistry{schemas: make(map[string]*jsonschema.Schema)}
+
+	for name, file := range builtinSchemaFiles {
+		content, err := builtinSchemas.ReadFile(file)
+		if err != nil {
+			panic(fmt.Sprintf("missing built-in schema %s: %v", name, err))
+		}
+		if err := registry.Register(name, content); err != nil {
+			panic(fmt.Sprintf("invalid built-in schema %s: %v", name, err))
+		}
+	}
+	return registry
+}
+
+// Register compiles a schema and makes it selectable by name at game creation.
+func (r *SchemaRegistry) Register(name string, schema []byte) error {
+	compiled, err := CompileSchema(schema)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.schemas[name] = compiled
+	return nil
+}
+
+func (r *SchemaRegistry) Get(name string) (*jsonschema.Schema, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	schema, exists := r.schemas[name]
+	return schema, exists
+}
+
+// Names returns the registered schema names in alphabetical order.
+func (r *SchemaRegistry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.schemas))
+	for name := range r.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CompileSchema compiles a JSON Schema document supplied by a client or the server.
+func CompileSchema(schema []byte) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("external schema references are not allowed: %s", url)
+	}
+
+	const url = "inline://game-state.json"
+	if err := compiler.AddResource(url, bytes.NewReader(schema)); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return compiled, nil
+}
+
+// ValidateState checks a game state against a schema. It returns nil when the state
+// is valid or when there is no schema.
+func ValidateState(schema *jsonschema.Schema, state json.RawMessage) []SchemaViolation {
+	if schema == nil {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(state))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return []SchemaViolation{{Path: "", Message: "invalid JSON: " + err.Error()}}
+	}
+
+	err := schema.Validate(document)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []SchemaViolation{{Path: "", Message: err.Error()}}
+	}
+
+	var violations []SchemaViolation
+	collectViolations(validationErr, &violations)
+	return violations
+}
+
+// collectViolations keeps the leaves of the validation error tree: they point at the
+// precise values that failed, while their parents only repeat that a subschema failed.
+func collectViolations(err *jsonschema.ValidationError, violations *[]SchemaViolation) {
+	if len(err.Causes) == 0 {
+		*violations = append(*violations, SchemaViolation{
+			Path:    err.InstanceLocation,
+			Message: strings.TrimSpace(err.Message),
+		})
+		return
+	}
+	for _, cause := range err.Causes {
+		collectViolations(cause, violations)
+	}
+}
+
+func (e *SchemaViolationError) Error() string {
+	if len(e.Violations) == 0 {
+		return "game state does not match the game schema"
+	}
+	first := e.Violations[0]
+	return fmt.Sprintf("game state does not match the game schema: %s: %s (%d violations)",
+		first.Path, first.Message, len(e.Violations))
+}
@@ -0,0 +1,88 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinYamsScorecardSchema(t *testing.T) {
+	registry := NewSchemaRegistry()
+	assert.Contains(t, registry.Names(), YamsScorecardSchema)
+
+	schema, exists := registry.Get(YamsScorecardSchema)
+	require.True(t, exists)
+
+	valid := json.RawMessage(`{
+		"round": 3,
+		"dice": [1, 6, 6, 6, 2],
+		"players": [
+			{"id": "p1", "name": "Alice", "scores": {"ones": 3, "sixes": 24, "yams": 50, "fullHouse": null}},
+			{"id": "p2", "scores": {}}
+		]
+	}`)
+	assert.Empty(t, ValidateState(schema, valid))
+
+	invalid := json.RawMessage(`{
+		"players": [
+			{"id": "p1", "scores": {"yams": 45, "sevens": 7}}
+		],
+		"dice": [0]
+	}`)
+	violations := ValidateState(schema, invalid)
+	paths := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		paths = append(paths, violation.Path)
+		assert.NotEmpty(t, violation.Message)
+	}
+	assert.Contains(t, paths, "/players/0/scores/yams")
+	assert.Contains(t, paths, "/players/0/scores")
+	assert.Contains(t, paths, "/dice/0")
+}
+
+func TestValidateStateWithoutSchema(t *testing.T) {
+	assert.Nil(t, ValidateState(nil, json.RawMessage(`not even json`)))
+}
+
+func TestValidateStateInvalidJSON(t *testing.T) {
+	schema, err := CompileSchema([]byte(`{"type": "object"}`))
+	require.NoError(t, err)
+
+	violations := ValidateState(schema, json.RawMessage(`{"unterminated": `))
+	require.Len(t, violations, 1)
+	assert.Equal(t, "", violations[0].Path)
+}
+
+func TestCompileSchema(t *testing.T) {
+	_, err := CompileSchema([]byte(`{"type": "object", "required": ["score"]}`))
+	assert.NoError(t, err)
+
+	_, err = CompileSchema([]byte(`{"type": 42}`))
+	assert.Error(t, err, "invalid schema keyword")
+
+	_, err = CompileSchema([]byte(`{"$ref": "file:///etc/passwd"}`))
+	assert.Error(t, err, "external references must not be loaded")
+}
+
+func TestCreateGameWithSchema(t *testing.T) {
+	manager := NewGameManager()
+	schema, err := CompileSchema([]byte(`{"type": "object", "required": ["score"]}`))
+	require.NoError(t, err)
+
+	gameID, err := manager.CreateGameWithOptions("player1", []byte(`{"score": 0}`), GameOptions{Schema: schema, SchemaName: "inline"})
+	require.NoError(t, err)
+
+	game, _ := manager.GetGame(gameID)
+	assert.Equal(t, "inline", game.SchemaName)
+	assert.Empty(t, ValidateState(game.Schema, json.RawMessage(`{"score": 12}`)))
+	assert.NotEmpty(t, ValidateState(game.Schema, json.RawMessage(`{"level": 12}`)))
+
+	_, err = manager.CreateGameWithOptions("player2", []byte(`{}`), GameOptions{Schema: schema})
+	var violationErr *SchemaViolationError
+	require.True(t, errors.As(err, &violationErr))
+	assert.NotEmpty(t, violationErr.Violations)
+	assert.Equal(t, 1, manager.GetMetrics().ActiveGames, "invalid games are not created")
+}
@@ -0,0 +1,70 @@
+package game
+
+import (
+	"crypto/subtle"
+	"errors"
+)
+
+/*
+Player Seats
+
+A game created for known players, by the matchmaking lobby for instance, reserves a
+seat to each of them with a token given to that player only. The host seat token is the
+resume token of the host session, so that only the host player can open it. The other
+players present their token when connecting as viewers, which identifies them to the
+host instead of joining as anonymous viewers.
+*/
+
+var (
+	// ErrSeatsReserved is returned when reserving the seats of a game twice, or once its
+	// host connected
+	ErrSeatsReserved = errors.New("seats already reserved")
+	// ErrInvalidPlayerToken is returned when a player connects without the token of its seat
+	ErrInvalidPlayerToken = errors.New("invalid player token")
+)
+
+// ReserveSeats reserves a seat to each player of a game that its host never opened,
+// and returns their tokens by player ID. The host player, among the players or not,
+// gets the resume token of the host session.
+func (m *GameManager) ReserveSeats(gameID string, players []string) (map[string]string, error) {
+	game, err := m.GetGame(gameID)
+	if err != nil {
+		return nil, ErrGameNotFound
+	}
+	game.Mutex.Lock()
+	defer game.Mutex.Unlock()
+	if game.ResumeToken != "" || game.PlayerTokens != nil {
+		return nil, ErrSeatsReserved
+	}
+
+	tokens := make(map[string]string, len(players)+1)
+	for _, player := range append([]string{game.HostPlayerID}, players...) {
+		if _, exists := tokens[player]; exists {
+			continue
+		}
+		token, err := newResumeToken()
+		if err != nil {
+			return nil, err
+		}
+		tokens[player] = token
+	}
+	game.ResumeToken = tokens[game.HostPlayerID]
+	game.PlayerTokens = make(map[string]string, len(tokens)-1)
+	for player, token := range tokens {
+		if player != game.HostPlayerID {
+			game.PlayerTokens[player] = token
+		}
+	}
+	return tokens, nil
+}
+
+// CheckPlayerSeat reports whether a player presenting token holds a seat of a game.
+func (m *GameManager) CheckPlayerSeat(game *Game, playerID, token string) error {
+	game.Mutex.Lock()
+	defer game.Mutex.Unlock()
+	expected, exists := game.PlayerTokens[playerID]
+	if !exists || subtle.ConstantTimeCompare([]byte(expected), []byte(token)) != 1 {
+		return ErrInvalidPlayerToken
+	}
+	return nil
+}
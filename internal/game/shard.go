@@ -0,0 +1,115 @@
+package game
+
+import (
+	"hash/fnv"
+)
+
+/*
+Game Registry Shards
+
+The games are spread over N shards keyed by a hash of the game ID, each with its own
+RWMutex, so that lookups of different games never wait on each other and lookups of the
+same game only share a read lock. Operations spanning every game (cleanup, ping) visit
+the shards one at a time and never hold a shard lock across network I/O.
+*/
+
+// DefaultShardCount is the number of shards used when Config.ShardCount is not set
+const DefaultShardCount = 64
+
+func newShards(count int) []*gameShard {
+	if count <= 0 {
+		count = DefaultShardCount
+	}
+	shards := make([]*gameShard, count)
+	for i := range shards {
+		shards[i] = &gameShard{games: make(map[string]*Game)}
+	}
+	return shards
+}
+
+// shardFor returns the shard holding a game ID.
+func (m *GameManager) shardFor(gameID string) *gameShard {
+	hash := fnv.New32a()
+	hash.Write([]byte(gameID))
+	return m.shards[hash.Sum32()%uint32(len(m.shards))]
+}
+
+func (s *gameShard) get(gameID string) (*Game, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	game, exists := s.games[gameID]
+	return game, exists
+}
+
+func (s *gameShard) put(game *Game) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.games[game.GameID] = game
+}
+
+// remove deletes a game and returns it, if it was present.
+func (s *gameShard) remove(gameID string) (*Game, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	game, exists := s.games[gameID]
+	if exists {
+		delete(s.games, gameID)
+	}
+	return game, exists
+}
+
+// snapshot returns the games of the shard at the time of the call.
+func (s *gameShard) snapshot() []*Game {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	games := make([]*Game, 0, len(s.games))
+	for _, game := range s.games {
+		games = append(games, game)
+	}
+	return games
+}
+
+// removeIf deletes a game only if it is still present and keep returns false. keep is
+// called with the shard lock held and must not perform I/O.
+func (s *gameShard) removeIf(gameID string, keep func(*Game) bool) (*Game, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	game, exists := s.games[gameID]
+	if !exists || keep(game) {
+		return nil, false
+	}
+	delete(s.games, gameID)
+	return game, true
+}
+
+// Games returns the games held by this instance at the time of the call.
+func (m *GameManager) Games() []*Game {
+	var games []*Game
+	for _, shard := range m.shards {
+		games = append(games, shard.snapshot()...)
+	}
+	return games
+}
+
+// closeConnections closes the host and viewer connections of a removed game. The
+// connections are collected under the game mutex and closed after releasing it.
+func closeConnections(game *Game) {
+	game.Mutex.Lock()
+	conns := make([]interface{ Close() error }, 0, len(game.Viewers)+1)
+	if game.HostConn != nil {
+		conns = append(conns, game.HostConn)
+	}
+	for _, viewer := range game.Viewers {
+		conns = append(conns, viewer)
+	}
+	game.Mutex.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
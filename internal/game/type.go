@@ -6,6 +6,9 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
 )
 
 type HostConnectionState int
@@ -19,22 +22,305 @@ const (
 	HostDisconnected
 )
 
+// GameStatus is the stage of a game's life
+type GameStatus string
+
+const (
+	// StatusActive : the game is being played
+	StatusActive GameStatus = "active"
+	// StatusPaused : the host paused the game, state updates are refused until it resumes
+	StatusPaused GameStatus = "paused"
+	// StatusFinished : the host ended the game, its state is frozen
+	StatusFinished GameStatus = "finished"
+	// StatusAbandoned : the host did not come back within the grace period
+	StatusAbandoned GameStatus = "abandoned"
+)
+
+// Config holds the GameManager settings
+type Config struct {
+	// InactivityTimeout is the idle duration after which a game is removed
+	InactivityTimeout time.Duration
+	// CleanupInterval is the interval between two sweeps of the expired games, a safety
+	// net behind the expiry scheduler
+	CleanupInterval time.Duration
+	// MaxLifetime is the default and longest lifetime of a game; 0 is unlimited
+	MaxLifetime time.Duration
+	// ExpiryWarning is how long before its expiry a game receives a gameExpiring
+	// message; 0 disables the warnings
+	ExpiryWarning time.Duration
+	// Broadcaster carries the game messages to the viewers; nil uses an in-process
+	// broadcaster, which requires the hosts and viewers of a game to share this instance
+	Broadcaster broadcast.Broadcaster
+	// InstanceID identifies this instance in the IDs of the games it creates, so that
+	// requests for a game can be routed to its owner; empty disables ownership
+	InstanceID string
+	// ShardCount is the number of lock-striped shards of the game registry
+	ShardCount int
+	// ResultRetention is how long a finished game is kept, for result pages, before
+	// being removed
+	ResultRetention time.Duration
+	// PausedInactivityTimeout replaces InactivityTimeout, when longer, for paused games;
+	// it also bounds the expected duration of a pause
+	PausedInactivityTimeout time.Duration
+	// HostGracePeriod is how long a disconnected host has to reconnect before the game
+	// is abandoned; 0 never abandons games
+	HostGracePeriod time.Duration
+	// DuplicateHostPolicy decides what happens when the host opens a second connection
+	// while connected; empty means DuplicateHostTakeover
+	DuplicateHostPolicy DuplicateHostPolicy
+}
+
+// DuplicateHostPolicy decides between two host connections to the same game
+type DuplicateHostPolicy string
+
+const (
+	// DuplicateHostTakeover : the new connection replaces the old one, which is closed
+	DuplicateHostTakeover DuplicateHostPolicy = "takeover"
+	// DuplicateHostReject : the new connection is refused while the host is connected
+	DuplicateHostReject DuplicateHostPolicy = "reject"
+)
+
+// gameShard holds the games whose ID hashes to it
+type gameShard struct {
+	games map[string]*Game
+	mutex sync.RWMutex
+}
+
 type GameManager struct {
-	games      map[string]*Game
-	gamesMutex sync.Mutex
-	Stats      *ServerStats
+	config      Config
+	shards      []*gameShard
+	expiries    *expiryScheduler
+	schemas     *SchemaRegistry
+	broadcaster broadcast.Broadcaster
+	events      *EventBus
+	Stats       *ServerStats
+}
+
+// GameOptions are the optional settings of a game chosen at creation
+type GameOptions struct {
+	// Schema validates every game state pushed by the host; nil disables validation
+	Schema *jsonschema.Schema
+	// SchemaName identifies Schema, for logging and reporting
+	SchemaName string
+	// Policy decides when the game expires
+	Policy ExpiryPolicy
+}
+
+// ExpiryPolicy decides when a game is removed; zero durations select the server defaults
+type ExpiryPolicy struct {
+	// IdleTimeout is the idle duration after which the game expires
+	IdleTimeout time.Duration
+	// MaxLifetime is the duration after its creation at which the game expires, active
+	// or not
+	MaxLifetime time.Duration
+	// KeepWhileViewers counts the presence of viewers as activity
+	KeepWhileViewers bool
+	// KeepUntilEnded keeps an idle game until the host ends it, within its lifetime
+	KeepUntilEnded bool
+}
+
+// expiryScheduler holds the next expiry check of every game
+type expiryScheduler struct {
+	queue expiryQueue
+	// scheduled is the current check of each game; the queue entries that differ are
+	// stale and dropped when due
+	scheduled map[string]time.Time
+	// wake interrupts the wait for the earliest check when an earlier one is scheduled
+	wake  chan struct{}
+	mutex sync.Mutex
 }
 
+// expiryCheck is a scheduled expiry check of a game
+type expiryCheck struct {
+	gameID string
+	at     time.Time
+}
+
+// expiryQueue is a min-heap of expiry checks ordered by time
+type expiryQueue []expiryCheck
+
 type Game struct {
 	HostConnectionState HostConnectionState
+	Status              GameStatus
 	GameID              string          `json:"gameId"`
 	HostPlayerID        string          `json:"hostPlayerId"`
 	GameState           json.RawMessage `json:"gameState"`
 	HostConn            *websocket.Conn
+	// Viewers are the viewers connected to this instance; viewers connected to other
+	// instances receive the game messages through the broadcaster
 	Viewers             []*websocket.Conn
 	Mutex               sync.Mutex
 	CreatedAt           time.Time
 	LastActivity        time.Time
+	Schema              *jsonschema.Schema
+	SchemaName          string
+	Policy              ExpiryPolicy
+	// ExpiryWarnedAt is the expiry the host and viewers were last warned of
+	ExpiryWarnedAt time.Time
+	// ResumeToken is issued to the first host connection and required from the next ones
+	ResumeToken string
+	// HostGeneration numbers the host connections; only the latest one may act as host
+	HostGeneration uint64
+	// PlayerTokens are the tokens of the seats reserved to the other players, by player ID
+	PlayerTokens map[string]string
+	// ReconnectDeadline is set while a disconnected host may still come back
+	ReconnectDeadline time.Time
+	AbandonedAt       time.Time
+	// Pause is set while the game is paused
+	Pause *PauseInfo
+	// EndedAt and Standings are set when the host ends the game
+	EndedAt   time.Time
+	Standings []Standing
+}
+
+// StateMessage carries a game state to the viewers
+type StateMessage struct {
+	Type      string          `json:"type"`
+	GameState json.RawMessage `json:"gameState"`
+}
+
+// FinalScore is the score of a player sent by the host to end a game
+type FinalScore struct {
+	PlayerID string `json:"playerId"`
+	Score    int    `json:"score"`
+}
+
+// Standing is the final position of a player; tied players share the same rank
+type Standing struct {
+	Rank     int    `json:"rank"`
+	PlayerID string `json:"playerId"`
+	Score    int    `json:"score"`
+}
+
+// GameEndedMessage carries the final standings to the viewers
+type GameEndedMessage struct {
+	Type      string          `json:"type"`
+	Standings []Standing      `json:"standings"`
+	GameState json.RawMessage `json:"gameState"`
+	EndedAt   time.Time       `json:"endedAt"`
+}
+
+// GameResult is the result of a finished game, published on the results topic
+type GameResult struct {
+	GameID       string         `json:"gameId"`
+	HostPlayerID string         `json:"hostPlayerId"`
+	SchemaName   string         `json:"schemaName,omitempty"`
+	EndedAt      time.Time      `json:"endedAt"`
+	Players      []PlayerResult `json:"players"`
+}
+
+// PlayerResult is the final standing of a player and, for Yams games, its scorecard
+type PlayerResult struct {
+	Standing
+	Scorecard *Scorecard `json:"scorecard,omitempty"`
+}
+
+// Scorecard summarizes the final Yams scorecard of a player
+type Scorecard struct {
+	// Categories are the scores of the filled categories, bonus and extra yams aside
+	Categories   map[string]int `json:"categories"`
+	UpperSection int            `json:"upperSection"`
+	Bonus        bool           `json:"bonus"`
+	// Yams counts the yams scored, extra yams included
+	Yams int `json:"yams"`
+	// Total is the score of the scorecard: its categories, bonus and extra yams
+	Total int `json:"total"`
+}
+
+// PauseInfo describes the pause of a game
+type PauseInfo struct {
+	// Reason is an optional explanation for the viewers
+	Reason string `json:"reason,omitempty"`
+	// ExpectedDurationMs is the optional duration announced by the host
+	ExpectedDurationMs int64     `json:"expectedDurationMs,omitempty"`
+	PausedAt           time.Time `json:"pausedAt"`
+}
+
+// GamePausedMessage tells the viewers that the host paused the game
+type GamePausedMessage struct {
+	Type string `json:"type"`
+	PauseInfo
+	GameState json.RawMessage `json:"gameState"`
+}
+
+// GameResumedMessage tells the viewers that the host resumed the game
+type GameResumedMessage struct {
+	Type        string          `json:"type"`
+	PausedForMs int64           `json:"pausedForMs"`
+	GameState   json.RawMessage `json:"gameState"`
+}
+
+// GameAbandonedMessage tells the viewers that the host will not come back
+type GameAbandonedMessage struct {
+	Type        string          `json:"type"`
+	AbandonedAt time.Time       `json:"abandonedAt"`
+	GameState   json.RawMessage `json:"gameState"`
+}
+
+// GameExpiringMessage warns the host and the viewers that the game will soon be removed
+type GameExpiringMessage struct {
+	Type string `json:"type"`
+	// Reason is "idle" when activity would postpone the expiry, "lifetime" otherwise
+	Reason      string    `json:"reason"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	RemainingMs int64     `json:"remainingMs"`
+}
+
+// GameInfo describes a game for the REST API. Games owned by another instance are
+// described from their retained message, without the connection details.
+type GameInfo struct {
+	GameID              string          `json:"gameId"`
+	Status              GameStatus      `json:"status"`
+	HostConnectionState string          `json:"hostConnectionState,omitempty"`
+	Viewers             int             `json:"viewers"`
+	CreatedAt           *time.Time      `json:"createdAt,omitempty"`
+	LastActivity        *time.Time      `json:"lastActivity,omitempty"`
+	ReconnectDeadline   *time.Time      `json:"reconnectDeadline,omitempty"`
+	Pause               *PauseInfo      `json:"pause,omitempty"`
+	EndedAt             *time.Time      `json:"endedAt,omitempty"`
+	Standings           []Standing      `json:"standings,omitempty"`
+	GameState           json.RawMessage `json:"gameState"`
+}
+
+// GameDetails describes a game and its connections for the admin API
+type GameDetails struct {
+	GameInfo
+	HostPlayerID      string       `json:"hostPlayerId"`
+	SchemaName        string       `json:"schemaName,omitempty"`
+	Policy            PolicyInfo   `json:"policy"`
+	ExpiresAt         *time.Time   `json:"expiresAt,omitempty"`
+	Host              *Connection  `json:"host,omitempty"`
+	ViewerConnections []Connection `json:"viewerConnections"`
+}
+
+// PolicyInfo describes the expiry policy of a game, 0 durations being the server defaults
+type PolicyInfo struct {
+	IdleTimeoutSeconds int64 `json:"idleTimeoutSeconds,omitempty"`
+	MaxLifetimeSeconds int64 `json:"maxLifetimeSeconds,omitempty"`
+	KeepWhileViewers   bool  `json:"keepWhileViewers,omitempty"`
+	KeepUntilEnded     bool  `json:"keepUntilEnded,omitempty"`
+}
+
+// Connection describes a WebSocket connection held by this instance
+type Connection struct {
+	RemoteAddr string `json:"remoteAddr"`
+}
+
+// SystemNotice is a message from the operators to the hosts and viewers of the games
+type SystemNotice struct {
+	Type     string   `json:"type"`
+	Severity Severity `json:"severity"`
+	Text     string   `json:"text"`
+	// MaintenanceAt is the optional start of a scheduled maintenance
+	MaintenanceAt *time.Time `json:"maintenanceAt,omitempty"`
+	SentAt        time.Time  `json:"sentAt"`
+}
+
+// NoticeDelivery reports the delivery of a system notice to a game
+type NoticeDelivery struct {
+	GameID    string `json:"gameId"`
+	Delivered bool   `json:"delivered"`
+	Error     string `json:"error,omitempty"`
 }
 
 type ServerStats struct {
@@ -42,7 +328,9 @@ type ServerStats struct {
 	ActiveGames          int
 	TotalViewers         int
 	TotalHostConnections int
+	OpenConnections      int
 	StartTime            time.Time
+	LastCleanup          time.Time
 	Mutex                sync.RWMutex
 }
 
@@ -54,3 +342,52 @@ type ServerStatsResponse struct {
 	Uptime               string `json:"uptime"`
 	StartTime            string `json:"startTime"`
 }
+
+// SchemaRegistry holds the game state schemas selectable by name
+type SchemaRegistry struct {
+	schemas map[string]*jsonschema.Schema
+	mutex   sync.RWMutex
+}
+
+// SchemaViolation locates a value of a game state that does not match the game schema
+type SchemaViolation struct {
+	// Path is the JSON pointer of the invalid value (empty for the whole document)
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// SchemaViolationError is returned when a game state does not match the game schema
+type SchemaViolationError struct {
+	Violations []SchemaViolation
+}
+
+// EventType names a game lifecycle event
+type EventType string
+
+// Event describes something that happened to a game
+type Event struct {
+	// ID uniquely identifies the event, so that consumers can drop duplicates
+	ID         string                 `json:"id"`
+	Type       EventType              `json:"type"`
+	GameID     string                 `json:"gameId"`
+	InstanceID string                 `json:"instanceId,omitempty"`
+	Time       time.Time              `json:"time"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// EventHandler receives the events of an EventBus. It is called synchronously by the
+// code emitting the event and must not block.
+type EventHandler func(Event)
+
+// EventBus dispatches the game lifecycle events to their subscribers
+type EventBus struct {
+	handlers map[int]eventSubscription
+	nextID   int
+	mutex    sync.RWMutex
+}
+
+// eventSubscription is a handler and the event types it receives (all when empty)
+type eventSubscription struct {
+	handler EventHandler
+	types   map[EventType]bool
+}
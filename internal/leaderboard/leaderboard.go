@@ -0,0 +1,234 @@
+/*
+Leaderboard
+
+This package ranks the best Yams scores of the players across games. It records the
+results of the games played with the built-in Yams scorecard schema, the only games
+whose rules the server knows; the scores of other games are not comparable and are
+ignored.
+
+Results are received from the results topic of the broadcaster, on which the game
+manager of every instance publishes the games it ends, so every instance holds the
+same leaderboard. The leaderboard lives in memory: it starts empty and only counts the
+games ended since the instance started.
+
+Each board keeps the best single-game score of each player over its period (all-time,
+the current UTC day or the current week starting on Monday); the daily and weekly
+boards start over at the beginning of each period. The all-time records keep the most
+yams scored in a game and the highest upper section. Every change is pushed to the live
+subscribers as a leaderboardUpdate message.
+*/
+
+package leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+// feedTopic is the topic of the live feed
+const feedTopic = "leaderboard"
+
+// Periods lists the periods of the boards
+var Periods = []Period{PeriodAllTime, PeriodDaily, PeriodWeekly}
+
+// ValidPeriod reports whether a period names a board.
+func ValidPeriod(period Period) bool {
+	for _, known := range Periods {
+		if period == known {
+			return true
+		}
+	}
+	return false
+}
+
+func New() *Leaderboard {
+	boards := make(map[Period]*board, len(Periods))
+	for _, period := range Periods {
+		boards[period] = &board{best: make(map[string]Entry)}
+	}
+	return &Leaderboard{
+		boards: boards,
+		feed:   broadcast.NewLocal(),
+		now:    time.Now,
+	}
+}
+
+// Listen records the results published on the broadcaster until ctx is done.
+func (l *Leaderboard) Listen(ctx context.Context, broadcaster broadcast.Broadcaster) error {
+	return game.ListenResults(ctx, broadcaster, func(result game.GameResult) {
+		l.Record(result)
+	})
+}
+
+// Record adds the result of a game to the boards and returns the changes, nil when the
+// game is not a Yams game or changes nothing. The changes are also pushed to the live
+// subscribers.
+func (l *Leaderboard) Record(result game.GameResult) *Update {
+	if !result.IsYams() {
+		return nil
+	}
+
+	l.mutex.Lock()
+	l.roll()
+	update := &Update{Type: "leaderboardUpdate", GameID: result.GameID, Changes: []Change{}}
+	brokeRecord := false
+	for _, player := range result.Players {
+		entry := Entry{
+			PlayerID:   player.PlayerID,
+			Score:      player.Score,
+			GameID:     result.GameID,
+			AchievedAt: result.EndedAt,
+		}
+		for _, period := range Periods {
+			b := l.boards[period]
+			if result.EndedAt.Before(b.start) {
+				continue
+			}
+			if best, exists := b.best[entry.PlayerID]; exists && best.Score >= entry.Score {
+				continue
+			}
+			b.best[entry.PlayerID] = entry
+			update.Changes = append(update.Changes, Change{Period: period, Entry: entry})
+		}
+
+		if player.Scorecard == nil {
+			continue
+		}
+		if beat(l.records.MostYams, player.Scorecard.Yams) {
+			l.records.MostYams = &Record{PlayerID: player.PlayerID, Value: player.Scorecard.Yams, GameID: result.GameID, AchievedAt: result.EndedAt}
+			brokeRecord = true
+		}
+		if beat(l.records.HighestUpperSection, player.Scorecard.UpperSection) {
+			l.records.HighestUpperSection = &Record{PlayerID: player.PlayerID, Value: player.Scorecard.UpperSection, GameID: result.GameID, AchievedAt: result.EndedAt}
+			brokeRecord = true
+		}
+	}
+	// Ranks are computed once every player of the game is on the boards
+	for i, change := range update.Changes {
+		update.Changes[i].Rank = l.boards[change.Period].rank(change.Score)
+	}
+	if brokeRecord {
+		records := l.records
+		update.Records = &records
+	}
+	l.mutex.Unlock()
+
+	if len(update.Changes) == 0 && update.Records == nil {
+		return nil
+	}
+	l.publish(update)
+	return update
+}
+
+// Board returns the top limit entries of a board with the records.
+func (l *Leaderboard) Board(period Period, limit int) Board {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.roll()
+
+	b := l.boards[period]
+	top := Board{
+		Period:  period,
+		Entries: b.ranked(limit),
+		Records: l.records,
+	}
+	if !b.start.IsZero() {
+		since := b.start
+		top.Since = &since
+	}
+	return top
+}
+
+// Snapshot returns the top limit entries of every board, sent first by the live feed.
+func (l *Leaderboard) Snapshot(limit int) Snapshot {
+	snapshot := Snapshot{Type: "leaderboard", Boards: make([]Board, 0, len(Periods))}
+	for _, period := range Periods {
+		snapshot.Boards = append(snapshot.Boards, l.Board(period, limit))
+	}
+	return snapshot
+}
+
+// Subscribe starts receiving the leaderboardUpdate messages. A subscriber too slow to
+// keep up is dropped with broadcast.ErrSlowSubscriber.
+func (l *Leaderboard) Subscribe(ctx context.Context) (*broadcast.Subscription, error) {
+	return l.feed.Subscribe(ctx, feedTopic)
+}
+
+// Close ends the live subscriptions.
+func (l *Leaderboard) Close() error {
+	return l.feed.Close()
+}
+
+// publish pushes an update to the live subscribers.
+func (l *Leaderboard) publish(update *Update) {
+	data, err := json.Marshal(update)
+	if err != nil {
+		logger.Error.Printf("Leaderboard: cannot encode update: %v", err)
+		return
+	}
+	if err := l.feed.Publish(context.Background(), feedTopic, data, false); err != nil && !errors.Is(err, broadcast.ErrClosed) {
+		logger.Warn.Printf("Leaderboard: cannot publish update: %v", err)
+	}
+}
+
+// roll starts the daily and weekly boards over when their period is over. The mutex
+// must be held.
+func (l *Leaderboard) roll() {
+	now := l.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	// Weeks start on Monday
+	week := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	for period, start := range map[Period]time.Time{PeriodDaily: day, PeriodWeekly: week} {
+		if b := l.boards[period]; !b.start.Equal(start) {
+			l.boards[period] = &board{start: start, best: make(map[string]Entry)}
+		}
+	}
+}
+
+// ranked returns the top limit entries, best score first. Players with the same score
+// share the same rank, the earliest to achieve it being listed first.
+func (b *board) ranked(limit int) []Entry {
+	entries := make([]Entry, 0, len(b.best))
+	for _, entry := range b.best {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Score != entries[j].Score {
+			return entries[i].Score > entries[j].Score
+		}
+		return entries[i].AchievedAt.Before(entries[j].AchievedAt)
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].Score == entries[i-1].Score {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+	return entries
+}
+
+// rank returns the rank of a score on the board.
+func (b *board) rank(score int) int {
+	rank := 1
+	for _, entry := range b.best {
+		if entry.Score > score {
+			rank++
+		}
+	}
+	return rank
+}
+
+// beat reports whether a value breaks a record; a zero value never does.
+func beat(record *Record, value int) bool {
+	return value > 0 && (record == nil || value > record.Value)
+}
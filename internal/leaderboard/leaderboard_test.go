@@ -0,0 +1,123 @@
+package leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+// yamsResult returns the result of a Yams game ended at endedAt
+func yamsResult(gameID string, endedAt time.Time, players ...game.PlayerResult) game.GameResult {
+	return game.GameResult{
+		GameID:     gameID,
+		SchemaName: game.YamsScorecardSchema,
+		EndedAt:    endedAt,
+		Players:    players,
+	}
+}
+
+func player(playerID string, score, yams, upperSection int) game.PlayerResult {
+	return game.PlayerResult{
+		Standing:  game.Standing{PlayerID: playerID, Score: score},
+		Scorecard: &game.Scorecard{Yams: yams, UpperSection: upperSection},
+	}
+}
+
+func TestRecord(t *testing.T) {
+	// Wednesday: the week started on Monday the 12th
+	now := time.Date(2026, 10, 14, 18, 0, 0, 0, time.UTC)
+	board := New()
+	board.now = func() time.Time { return now }
+
+	assert.Nil(t, board.Record(game.GameResult{GameID: "chess", EndedAt: now, Players: []game.PlayerResult{player("alice", 900, 0, 0)}}),
+		"only Yams games are ranked")
+
+	lastWeek := yamsResult("g1", now.AddDate(0, 0, -7), player("alice", 310, 2, 70), player("bob", 250, 0, 60))
+	update := board.Record(lastWeek)
+	require.NotNil(t, update)
+	assert.Equal(t, "leaderboardUpdate", update.Type)
+	assert.Len(t, update.Changes, 2, "on the all-time board only")
+	require.NotNil(t, update.Records)
+	assert.Equal(t, 2, update.Records.MostYams.Value)
+
+	monday := yamsResult("g2", now.AddDate(0, 0, -2), player("bob", 280, 1, 63), player("carol", 180, 0, 40))
+	update = board.Record(monday)
+	require.NotNil(t, update)
+	assert.Nil(t, update.Records, "no record broken")
+	assert.Contains(t, update.Changes, Change{Period: PeriodAllTime, Entry: Entry{Rank: 2, PlayerID: "bob", Score: 280, GameID: "g2", AchievedAt: monday.EndedAt}})
+
+	today := yamsResult("g3", now.Add(-time.Hour), player("carol", 280, 3, 84), player("alice", 200, 0, 50))
+	update = board.Record(today)
+	require.NotNil(t, update)
+	assert.Equal(t, "carol", update.Records.MostYams.PlayerID)
+	assert.Equal(t, 84, update.Records.HighestUpperSection.Value)
+
+	allTime := board.Board(PeriodAllTime, 10)
+	assert.Nil(t, allTime.Since)
+	assert.Equal(t, []Entry{
+		{Rank: 1, PlayerID: "alice", Score: 310, GameID: "g1", AchievedAt: lastWeek.EndedAt},
+		{Rank: 2, PlayerID: "bob", Score: 280, GameID: "g2", AchievedAt: monday.EndedAt},
+		{Rank: 2, PlayerID: "carol", Score: 280, GameID: "g3", AchievedAt: today.EndedAt},
+	}, allTime.Entries, "ties share the rank, earliest first")
+	assert.Equal(t, "g3", allTime.Records.MostYams.GameID)
+
+	weekly := board.Board(PeriodWeekly, 10)
+	assert.Equal(t, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), *weekly.Since)
+	assert.Len(t, weekly.Entries, 3)
+	assert.Equal(t, 200, weekly.Entries[2].Score, "alice's best of the week")
+
+	daily := board.Board(PeriodDaily, 1)
+	assert.Equal(t, []Entry{{Rank: 1, PlayerID: "carol", Score: 280, GameID: "g3", AchievedAt: today.EndedAt}}, daily.Entries)
+
+	// The daily board starts over the next day
+	now = now.Add(24 * time.Hour)
+	assert.Empty(t, board.Board(PeriodDaily, 10).Entries)
+	assert.Len(t, board.Board(PeriodWeekly, 10).Entries, 3)
+}
+
+func TestListen(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	broadcaster := broadcast.NewLocal()
+	manager := game.NewGameManagerWithConfig(game.Config{
+		InactivityTimeout: time.Hour,
+		CleanupInterval:   time.Hour,
+		ResultRetention:   time.Hour,
+		Broadcaster:       broadcaster,
+	})
+	board := New()
+	defer board.Close()
+	require.NoError(t, board.Listen(ctx, broadcaster))
+	updates, err := board.Subscribe(ctx)
+	require.NoError(t, err)
+	defer updates.Close()
+
+	schema, _ := manager.Schemas().Get(game.YamsScorecardSchema)
+	state := []byte(`{"players":[{"id":"alice","scores":{"sixes":24,"yams":50,"extraYams":1}},{"id":"bob","scores":{"ones":3}}]}`)
+	gameID, err := manager.CreateGameWithOptions("alice", state, game.GameOptions{Schema: schema, SchemaName: game.YamsScorecardSchema})
+	require.NoError(t, err)
+	_, err = manager.EndGame(gameID, []game.FinalScore{{PlayerID: "alice", Score: 174}, {PlayerID: "bob", Score: 3}}, nil)
+	require.NoError(t, err)
+
+	select {
+	case data := <-updates.Messages():
+		var update Update
+		require.NoError(t, json.Unmarshal(data, &update))
+		assert.Equal(t, gameID, update.GameID)
+		assert.Len(t, update.Changes, 6, "two players on three boards")
+		require.NotNil(t, update.Records)
+		assert.Equal(t, Record{PlayerID: "alice", Value: 2, GameID: gameID, AchievedAt: update.Records.MostYams.AchievedAt}, *update.Records.MostYams)
+		assert.Equal(t, 24, update.Records.HighestUpperSection.Value)
+	case <-ctx.Done():
+		t.Fatal("leaderboard update not received")
+	}
+	assert.Len(t, board.Board(PeriodDaily, 10).Entries, 2)
+}
@@ -0,0 +1,93 @@
+package leaderboard
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
+)
+
+// Period selects the games counted by a board
+type Period string
+
+const (
+	// PeriodAllTime counts every game recorded
+	PeriodAllTime Period = "all"
+	// PeriodDaily counts the games ended since midnight UTC
+	PeriodDaily Period = "daily"
+	// PeriodWeekly counts the games ended since Monday midnight UTC
+	PeriodWeekly Period = "weekly"
+)
+
+// Leaderboard ranks the best Yams scores of the players across games
+type Leaderboard struct {
+	boards  map[Period]*board
+	records Records
+	// feed carries the leaderboardUpdate messages to the live subscribers
+	feed  *broadcast.Local
+	now   func() time.Time
+	mutex sync.RWMutex
+}
+
+// board holds the best score of each player over a period
+type board struct {
+	// start is the beginning of the period, zero for all-time
+	start time.Time
+	best  map[string]Entry
+}
+
+// Entry is the best score of a player on a board
+type Entry struct {
+	Rank       int       `json:"rank"`
+	PlayerID   string    `json:"playerId"`
+	Score      int       `json:"score"`
+	GameID     string    `json:"gameId"`
+	AchievedAt time.Time `json:"achievedAt"`
+}
+
+// Record is the best value of a single category achieved in one game
+type Record struct {
+	PlayerID   string    `json:"playerId"`
+	Value      int       `json:"value"`
+	GameID     string    `json:"gameId"`
+	AchievedAt time.Time `json:"achievedAt"`
+}
+
+// Records are the all-time single-game records
+type Records struct {
+	// MostYams is the most yams scored in a game, extra yams included
+	MostYams *Record `json:"mostYams,omitempty"`
+	// HighestUpperSection is the highest upper section total of a game, bonus aside
+	HighestUpperSection *Record `json:"highestUpperSection,omitempty"`
+}
+
+// Board is the top of the leaderboard over a period
+type Board struct {
+	Period Period `json:"period"`
+	// Since is the beginning of the period, absent for all-time
+	Since   *time.Time `json:"since,omitempty"`
+	Entries []Entry    `json:"entries"`
+	Records Records    `json:"records"`
+}
+
+// Update describes the changes brought by the result of a game
+type Update struct {
+	Type   string `json:"type"`
+	GameID string `json:"gameId"`
+	// Changes are the new best scores, with their new rank
+	Changes []Change `json:"changes"`
+	// Records are set when the game broke a record
+	Records *Records `json:"records,omitempty"`
+}
+
+// Change is the new best score of a player on a board
+type Change struct {
+	Period Period `json:"period"`
+	Entry
+}
+
+// Snapshot is the first message of the live feed: the top of every board
+type Snapshot struct {
+	Type   string  `json:"type"`
+	Boards []Board `json:"boards"`
+}
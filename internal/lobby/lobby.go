@@ -0,0 +1,333 @@
+/*
+Matchmaking Lobby
+
+This package matches the players looking for online opponents. A player joins the queue
+for a game of 2 to 4 players, with an optional skill rating; the players waiting for the
+same size are matched in their order of arrival, the earliest one becoming the host.
+Rated players are only matched with players whose rating is close enough: the accepted
+difference starts at RatingRange and widens with the wait of the players, so that a
+player with an unusual rating still finds opponents. Unrated players match anyone.
+
+For each match, the lobby creates a Yams game with the built-in scorecard schema and
+reserves a seat to each player: the host opens the game with its seat token as resume
+token, the other players identify themselves with theirs when joining it. A player
+leaves the queue when matched, on cancellation, or after QueueTimeout without a match;
+it may then queue again. When the game of a match cannot be created, its players go
+back to their place in the queue.
+
+The queue lives in memory: players are matched with the players queued on the same
+instance.
+*/
+
+package lobby
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+var (
+	// ErrInvalidTicket is returned when queueing with an invalid player or size
+	ErrInvalidTicket = errors.New("invalid queue request")
+	// ErrAlreadyQueued is returned when a player queues while waiting for a match
+	ErrAlreadyQueued = errors.New("player already queued")
+	// ErrClosed is returned when queueing after Close
+	ErrClosed = errors.New("lobby closed")
+)
+
+const (
+	// MinSize and MaxSize bound the number of players of a match
+	MinSize = 2
+	MaxSize = 4
+	// maxPlayerIDLength is the maximum length of a player ID in the Yams scorecard schema
+	maxPlayerIDLength = 128
+)
+
+// DefaultConfig returns the settings used by New.
+func DefaultConfig() Config {
+	return Config{
+		QueueTimeout:      2 * time.Minute,
+		RatingRange:       100,
+		RatingRangeGrowth: 10,
+		MatchInterval:     time.Second,
+	}
+}
+
+func New(games *game.GameManager) *Lobby {
+	return NewWithConfig(games, DefaultConfig())
+}
+
+func NewWithConfig(games *game.GameManager, config Config) *Lobby {
+	l := &Lobby{
+		games:   games,
+		config:  config,
+		tickets: make(map[string]*Ticket),
+		now:     time.Now,
+		done:    make(chan struct{}),
+	}
+	go l.routineMatch()
+	return l
+}
+
+// Join queues a player for a game of size players, and matches the queue.
+func (l *Lobby) Join(playerID string, size int, rating *int) (*Ticket, error) {
+	if playerID == "" || len(playerID) > maxPlayerIDLength {
+		return nil, fmt.Errorf("%w: invalid playerId", ErrInvalidTicket)
+	}
+	if size < MinSize || size > MaxSize {
+		return nil, fmt.Errorf("%w: size between %d and %d expected", ErrInvalidTicket, MinSize, MaxSize)
+	}
+
+	l.mutex.Lock()
+	select {
+	case <-l.done:
+		l.mutex.Unlock()
+		return nil, ErrClosed
+	default:
+	}
+	if _, queued := l.tickets[playerID]; queued {
+		l.mutex.Unlock()
+		return nil, ErrAlreadyQueued
+	}
+	ticket := &Ticket{
+		PlayerID: playerID,
+		Size:     size,
+		Rating:   rating,
+		QueuedAt: l.now(),
+		outcome:  make(chan Outcome, 1),
+	}
+	l.queue = append(l.queue, ticket)
+	l.tickets[playerID] = ticket
+	l.mutex.Unlock()
+
+	logger.Debug.Printf("Lobby: player queued: PlayerID=%s, size=%d", playerID, size)
+	l.match()
+	return ticket, nil
+}
+
+// Cancel removes a ticket from the queue. It returns false when the ticket already left
+// the queue: its outcome is then delivered.
+func (l *Lobby) Cancel(ticket *Ticket) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	ticket.cancelled = true
+	if l.tickets[ticket.PlayerID] != ticket {
+		return false
+	}
+	l.removeLocked(ticket)
+	logger.Debug.Printf("Lobby: player left the queue: PlayerID=%s", ticket.PlayerID)
+	return true
+}
+
+// Queued returns the number of players waiting for a game of size players.
+func (l *Lobby) Queued(size int) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	count := 0
+	for _, ticket := range l.queue {
+		if ticket.Size == size {
+			count++
+		}
+	}
+	return count
+}
+
+// Close stops the matching. The players still queued are never matched.
+func (l *Lobby) Close() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	select {
+	case <-l.done:
+	default:
+		close(l.done)
+	}
+}
+
+// QueueTimeout returns how long a player waits for a match before leaving the queue.
+func (l *Lobby) QueueTimeout() time.Duration {
+	return l.config.QueueTimeout
+}
+
+// Outcome returns the channel receiving the outcome of the ticket, once.
+func (t *Ticket) Outcome() <-chan Outcome {
+	return t.outcome
+}
+
+// routineMatch expires the tickets waiting for too long and matches the players whose
+// rating range widened.
+func (l *Lobby) routineMatch() {
+	ticker := time.NewTicker(l.config.MatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+		l.expire()
+		l.match()
+	}
+}
+
+// expire removes the tickets waiting for QueueTimeout.
+func (l *Lobby) expire() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	for _, ticket := range append([]*Ticket(nil), l.queue...) {
+		if now.Sub(ticket.QueuedAt) >= l.config.QueueTimeout {
+			l.removeLocked(ticket)
+			ticket.outcome <- Outcome{TimedOut: true}
+			logger.Debug.Printf("Lobby: queue timeout: PlayerID=%s", ticket.PlayerID)
+		}
+	}
+}
+
+// match creates the games of the groups of players that can be matched.
+func (l *Lobby) match() {
+	l.mutex.Lock()
+	groups := l.groupLocked()
+	l.mutex.Unlock()
+
+	for _, group := range groups {
+		match, err := l.createMatch(group)
+		if err != nil {
+			logger.Error.Printf("Lobby: cannot create the game of a match: %v", err)
+			l.requeue(group)
+			continue
+		}
+		for _, ticket := range group {
+			ticket.outcome <- Outcome{Match: match}
+		}
+		logger.Info.Printf("Lobby: match found: GameID=%s, %d players", match.GameID, len(match.Players))
+	}
+}
+
+// groupLocked removes from the queue the groups of players that can be matched, the
+// earliest player of each group first. The mutex must be held.
+func (l *Lobby) groupLocked() [][]*Ticket {
+	now := l.now()
+	var groups [][]*Ticket
+	matched := make(map[*Ticket]bool)
+	for i, anchor := range l.queue {
+		if matched[anchor] {
+			continue
+		}
+		group := []*Ticket{anchor}
+		for _, candidate := range l.queue[i+1:] {
+			if len(group) == anchor.Size {
+				break
+			}
+			if matched[candidate] || candidate.Size != anchor.Size || !l.fits(candidate, group, now) {
+				continue
+			}
+			group = append(group, candidate)
+		}
+		if len(group) < anchor.Size {
+			continue
+		}
+		for _, ticket := range group {
+			matched[ticket] = true
+		}
+		groups = append(groups, group)
+	}
+	for _, group := range groups {
+		for _, ticket := range group {
+			l.removeLocked(ticket)
+		}
+	}
+	return groups
+}
+
+// fits reports whether a player can join a group: its rating must be within the range
+// of every rated player of the group, and theirs within its own.
+func (l *Lobby) fits(candidate *Ticket, group []*Ticket, now time.Time) bool {
+	if candidate.Rating == nil {
+		return true
+	}
+	for _, member := range group {
+		if member.Rating == nil {
+			continue
+		}
+		difference := *candidate.Rating - *member.Rating
+		if difference < 0 {
+			difference = -difference
+		}
+		if difference > l.ratingRange(candidate, now) || difference > l.ratingRange(member, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// ratingRange returns the rating difference a player accepts after waiting until now.
+func (l *Lobby) ratingRange(ticket *Ticket, now time.Time) int {
+	waited := int(now.Sub(ticket.QueuedAt) / time.Second)
+	return l.config.RatingRange + waited*l.config.RatingRangeGrowth
+}
+
+// createMatch creates the game of a group, hosted by its earliest player, and reserves
+// the seats of the players.
+func (l *Lobby) createMatch(group []*Ticket) (*Match, error) {
+	players := make([]string, len(group))
+	for i, ticket := range group {
+		players[i] = ticket.PlayerID
+	}
+	schema, _ := l.games.Schemas().Get(game.YamsScorecardSchema)
+	gameID, err := l.games.CreateGameWithOptions(players[0], game.YamsScorecard(players), game.GameOptions{
+		Schema:     schema,
+		SchemaName: game.YamsScorecardSchema,
+	})
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := l.games.ReserveSeats(gameID, players)
+	if err != nil {
+		l.games.RemoveGame(gameID)
+		return nil, err
+	}
+	return &Match{
+		GameID:       gameID,
+		HostPlayerID: players[0],
+		Players:      players,
+		Tokens:       tokens,
+	}, nil
+}
+
+// requeue puts the players of a group whose game failed back to their place in the
+// queue. The players not put back never receive an outcome.
+func (l *Lobby) requeue(group []*Ticket) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	requeued := 0
+	for _, ticket := range group {
+		// A player who cancelled meanwhile, or queued again, is not put back
+		if _, queued := l.tickets[ticket.PlayerID]; queued || ticket.cancelled {
+			continue
+		}
+		l.tickets[ticket.PlayerID] = ticket
+		l.queue = append(l.queue, ticket)
+		requeued++
+	}
+	// Keep the queue in order of arrival
+	for i := len(l.queue) - requeued; i < len(l.queue); i++ {
+		for j := i; j > 0 && l.queue[j].QueuedAt.Before(l.queue[j-1].QueuedAt); j-- {
+			l.queue[j], l.queue[j-1] = l.queue[j-1], l.queue[j]
+		}
+	}
+}
+
+// removeLocked removes a ticket from the queue. The mutex must be held.
+func (l *Lobby) removeLocked(ticket *Ticket) {
+	delete(l.tickets, ticket.PlayerID)
+	for i, queued := range l.queue {
+		if queued == ticket {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package lobby
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+// newTestLobby returns a lobby matching only when asked, and a function moving its clock.
+func newTestLobby(t *testing.T) (*Lobby, *game.GameManager, func(time.Duration)) {
+	games := game.NewGameManagerWithConfig(game.Config{
+		InactivityTimeout: time.Hour,
+		CleanupInterval:   time.Hour,
+		ResultRetention:   time.Hour,
+	})
+	config := DefaultConfig()
+	config.MatchInterval = time.Hour
+	l := NewWithConfig(games, config)
+	t.Cleanup(l.Close)
+
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	return l, games, func(d time.Duration) { now = now.Add(d) }
+}
+
+func rating(value int) *int {
+	return &value
+}
+
+// outcome returns the outcome of a ticket, failing when it is not delivered.
+func outcome(t *testing.T, ticket *Ticket) Outcome {
+	t.Helper()
+	select {
+	case outcome := <-ticket.Outcome():
+		return outcome
+	default:
+		t.Fatalf("no outcome for %s", ticket.PlayerID)
+		return Outcome{}
+	}
+}
+
+func assertWaiting(t *testing.T, ticket *Ticket) {
+	t.Helper()
+	select {
+	case outcome := <-ticket.Outcome():
+		t.Fatalf("unexpected outcome for %s: %+v", ticket.PlayerID, outcome)
+	default:
+	}
+}
+
+func TestJoinValidation(t *testing.T) {
+	l, _, _ := newTestLobby(t)
+
+	_, err := l.Join("", 2, nil)
+	assert.ErrorIs(t, err, ErrInvalidTicket)
+	_, err = l.Join(strings.Repeat("a", maxPlayerIDLength+1), 2, nil)
+	assert.ErrorIs(t, err, ErrInvalidTicket)
+	_, err = l.Join("alice", 1, nil)
+	assert.ErrorIs(t, err, ErrInvalidTicket)
+	_, err = l.Join("alice", 5, nil)
+	assert.ErrorIs(t, err, ErrInvalidTicket)
+
+	_, err = l.Join("alice", 3, nil)
+	require.NoError(t, err)
+	_, err = l.Join("alice", 2, nil)
+	assert.ErrorIs(t, err, ErrAlreadyQueued)
+
+	l.Close()
+	_, err = l.Join("bob", 3, nil)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestMatch(t *testing.T) {
+	l, games, _ := newTestLobby(t)
+
+	alice, _ := l.Join("alice", 3, nil)
+	bob, _ := l.Join("bob", 3, nil)
+	dave, _ := l.Join("dave", 2, nil)
+	assertWaiting(t, alice)
+	assert.Equal(t, 2, l.Queued(3))
+
+	// The third player completes the game of 3 players; the player queued for 2 waits
+	carol, _ := l.Join("carol", 3, nil)
+	match := outcome(t, alice).Match
+	require.NotNil(t, match)
+	assert.Equal(t, "alice", match.HostPlayerID)
+	assert.Equal(t, []string{"alice", "bob", "carol"}, match.Players)
+	assert.Same(t, match, outcome(t, bob).Match)
+	assert.Same(t, match, outcome(t, carol).Match)
+	assertWaiting(t, dave)
+	assert.Equal(t, 0, l.Queued(3))
+	assert.Equal(t, 1, l.Queued(2))
+
+	// The game holds a scorecard and a seat per player
+	current, err := games.GetGame(match.GameID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", current.HostPlayerID)
+	assert.Contains(t, string(current.GameState), `"id":"carol"`)
+	require.Len(t, match.Tokens, 3)
+	assert.Equal(t, match.Tokens["alice"], current.ResumeToken)
+	assert.NoError(t, games.CheckPlayerSeat(current, "bob", match.Tokens["bob"]))
+	assert.NoError(t, games.CheckPlayerSeat(current, "carol", match.Tokens["carol"]))
+
+	// Matched players may queue again
+	_, err = l.Join("alice", 2, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, outcome(t, dave).Match)
+}
+
+func TestRatingRange(t *testing.T) {
+	l, _, advance := newTestLobby(t)
+
+	alice, _ := l.Join("alice", 2, rating(1000))
+	bob, _ := l.Join("bob", 2, rating(1250))
+	assertWaiting(t, alice)
+	assertWaiting(t, bob)
+
+	// A close rating is matched first, even when queued later
+	carol, _ := l.Join("carol", 2, rating(1320))
+	assert.Equal(t, []string{"bob", "carol"}, outcome(t, bob).Match.Players)
+	assertWaiting(t, alice)
+	outcome(t, carol)
+
+	// The range of the waiting players widens with time: alice accepts 1200 after 10s,
+	// but dave, queued then, only 10s later
+	advance(10 * time.Second)
+	dave, _ := l.Join("dave", 2, rating(1200))
+	assertWaiting(t, alice)
+	advance(10 * time.Second)
+	l.match()
+	assert.Equal(t, []string{"alice", "dave"}, outcome(t, alice).Match.Players)
+	outcome(t, dave)
+
+	// Unrated players match anyone
+	erin, _ := l.Join("erin", 2, rating(3000))
+	l.Join("frank", 2, nil)
+	assert.Equal(t, []string{"erin", "frank"}, outcome(t, erin).Match.Players)
+}
+
+func TestQueueTimeout(t *testing.T) {
+	l, _, advance := newTestLobby(t)
+
+	alice, _ := l.Join("alice", 2, rating(1000))
+	advance(time.Minute)
+	bob, _ := l.Join("bob", 2, rating(5000))
+	advance(time.Minute)
+	l.expire()
+
+	assert.True(t, outcome(t, alice).TimedOut)
+	assertWaiting(t, bob)
+	assert.Equal(t, 1, l.Queued(2))
+
+	// A player timed out may queue again
+	alice, err := l.Join("alice", 2, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, outcome(t, alice).Match)
+	assert.NotNil(t, outcome(t, bob).Match)
+}
+
+func TestCancel(t *testing.T) {
+	l, _, _ := newTestLobby(t)
+
+	alice, _ := l.Join("alice", 2, nil)
+	assert.True(t, l.Cancel(alice))
+	assert.False(t, l.Cancel(alice))
+	assert.Equal(t, 0, l.Queued(2))
+
+	// A cancelled player is never matched, and may queue again
+	bob, _ := l.Join("bob", 2, nil)
+	assertWaiting(t, bob)
+	assertWaiting(t, alice)
+	alice, err := l.Join("alice", 2, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, outcome(t, bob).Match)
+
+	// Once matched, cancelling is too late
+	assert.False(t, l.Cancel(alice))
+	assert.NotNil(t, outcome(t, alice).Match)
+}
+
+func TestRequeue(t *testing.T) {
+	l, _, advance := newTestLobby(t)
+
+	alice, _ := l.Join("alice", 3, nil)
+	advance(time.Second)
+	bob, _ := l.Join("bob", 3, nil)
+	advance(time.Second)
+	carol, _ := l.Join("carol", 2, nil)
+	advance(time.Second)
+
+	// The game of alice and bob failed while bob cancelled and carol waited
+	l.mutex.Lock()
+	l.removeLocked(alice)
+	l.removeLocked(bob)
+	l.mutex.Unlock()
+	l.Cancel(bob)
+	l.requeue([]*Ticket{alice, bob})
+
+	// alice is back before carol, bob is not back
+	l.mutex.Lock()
+	assert.Equal(t, []*Ticket{alice, carol}, l.queue)
+	l.mutex.Unlock()
+	assert.Equal(t, 1, l.Queued(3))
+	_, err := l.Join("bob", 3, nil)
+	assert.NoError(t, err)
+}
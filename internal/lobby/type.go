@@ -0,0 +1,64 @@
+package lobby
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+// Config holds the Lobby settings
+type Config struct {
+	// QueueTimeout is how long a player waits for a match before leaving the queue
+	QueueTimeout time.Duration
+	// RatingRange is the largest rating difference accepted between two players of a
+	// match when they join the queue
+	RatingRange int
+	// RatingRangeGrowth widens the rating range of a player for every second of waiting
+	RatingRangeGrowth int
+	// MatchInterval is the period of the matching of the players whose range widened and
+	// of the queue timeouts
+	MatchInterval time.Duration
+}
+
+// Lobby matches the players queued for a game of the same size
+type Lobby struct {
+	games  *game.GameManager
+	config Config
+	// queue holds the waiting tickets, earliest first
+	queue []*Ticket
+	// tickets holds the waiting ticket of each player
+	tickets map[string]*Ticket
+	now     func() time.Time
+	done    chan struct{}
+	mutex   sync.Mutex
+}
+
+// Ticket is the place of a player in the queue
+type Ticket struct {
+	PlayerID string
+	// Size is the number of players of the game wanted, between MinSize and MaxSize
+	Size int
+	// Rating is the skill rating of the player; unrated players match anyone
+	Rating   *int
+	QueuedAt time.Time
+	outcome  chan Outcome
+	// cancelled is set by Cancel, even once the ticket left the queue
+	cancelled bool
+}
+
+// Outcome ends the wait of a ticket: a match, or the queue timeout
+type Outcome struct {
+	Match    *Match
+	TimedOut bool
+}
+
+// Match is a game created for queued players
+type Match struct {
+	GameID       string
+	HostPlayerID string
+	Players      []string
+	// Tokens are the seat tokens of the players, by player ID; the host token is its
+	// resume token
+	Tokens map[string]string
+}
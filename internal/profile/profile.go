@@ -0,0 +1,193 @@
+/*
+Player Profiles
+
+This package keeps a profile for each player ID met in the results of the games ended:
+the games played (as a player of the final standings) and hosted (as the host player
+ID), the wins, the average and best scores and the last finished games with their final
+standings. The games played with the built-in Yams scorecard schema also give the bonus
+rate, the yams scored and the average score of each category.
+
+The game manager removes a finished game after the result retention period, so the
+store archives the result of every game still listed in the last games of a profile;
+the profile links each of them to its archived result.
+
+Results are received from the results topic of the broadcaster, so every instance holds
+the same profiles. Profiles live in memory: they start empty and only count the games
+ended since the instance started.
+*/
+
+package profile
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+// MaxRecentGames is the number of finished games kept in a profile
+const MaxRecentGames = 10
+
+func New() *Store {
+	return &Store{
+		players: make(map[string]*player),
+		results: make(map[string]*archivedResult),
+	}
+}
+
+// Listen records the results published on the broadcaster until ctx is done.
+func (s *Store) Listen(ctx context.Context, broadcaster broadcast.Broadcaster) error {
+	return game.ListenResults(ctx, broadcaster, s.Record)
+}
+
+// Record adds the result of a game to the profiles of its players and of its host.
+func (s *Store) Record(result game.GameResult) {
+	standings := make([]game.Standing, 0, len(result.Players))
+	for _, player := range result.Players {
+		standings = append(standings, player.Standing)
+	}
+	recent := RecentGame{
+		GameID:    result.GameID,
+		EndedAt:   result.EndedAt,
+		Standings: standings,
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.results[result.GameID]; !exists {
+		s.results[result.GameID] = &archivedResult{result: result}
+	}
+
+	hostPlayed := false
+	for _, played := range result.Players {
+		p := s.player(played.PlayerID)
+		p.gamesPlayed++
+		p.totalScore += played.Score
+		if played.Rank == 1 {
+			p.wins++
+		}
+		if p.gamesPlayed == 1 || played.Score > p.bestScore {
+			p.bestScore = played.Score
+		}
+		if card := played.Scorecard; card != nil {
+			p.yamsGames++
+			p.yamsScored += card.Yams
+			if card.Bonus {
+				p.bonusGames++
+			}
+			for category, score := range card.Categories {
+				p.categoryTotals[category] += score
+				p.categoryGames[category]++
+			}
+		}
+
+		entry := recent
+		if played.PlayerID == result.HostPlayerID {
+			entry.Hosted = true
+			p.gamesHosted++
+			hostPlayed = true
+		}
+		s.addRecent(played.PlayerID, p, entry)
+	}
+	if !hostPlayed && result.HostPlayerID != "" {
+		host := s.player(result.HostPlayerID)
+		host.gamesHosted++
+		recent.Hosted = true
+		s.addRecent(result.HostPlayerID, host, recent)
+	}
+	if archived := s.results[result.GameID]; archived.refs == 0 {
+		delete(s.results, result.GameID)
+	}
+}
+
+// Result returns the archived result of a game listed in the last games of a player,
+// false when the player has no such game.
+func (s *Store) Result(playerID, gameID string) (game.GameResult, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	p, exists := s.players[playerID]
+	if !exists {
+		return game.GameResult{}, false
+	}
+	for _, recent := range p.recent {
+		if recent.GameID == gameID {
+			return s.results[gameID].result, true
+		}
+	}
+	return game.GameResult{}, false
+}
+
+// Profile returns the profile of a player, false when the player has no finished game.
+func (s *Store) Profile(playerID string) (Profile, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	p, exists := s.players[playerID]
+	if !exists {
+		return Profile{}, false
+	}
+	profile := Profile{
+		PlayerID:    playerID,
+		GamesPlayed: p.gamesPlayed,
+		GamesHosted: p.gamesHosted,
+		Wins:        p.wins,
+		BestScore:   p.bestScore,
+		RecentGames: append([]RecentGame(nil), p.recent...),
+	}
+	if p.gamesPlayed > 0 {
+		profile.AverageScore = float64(p.totalScore) / float64(p.gamesPlayed)
+	}
+	if p.yamsGames > 0 {
+		profile.Yams = &YamsStats{
+			GamesPlayed:      p.yamsGames,
+			BonusRate:        float64(p.bonusGames) / float64(p.yamsGames),
+			YamsScored:       p.yamsScored,
+			CategoryAverages: make(map[string]float64, len(p.categoryTotals)),
+		}
+		for category, total := range p.categoryTotals {
+			profile.Yams.CategoryAverages[category] = float64(total) / float64(p.categoryGames[category])
+		}
+	}
+	return profile, true
+}
+
+// player returns the accumulator of a player, created on first use. The mutex must be
+// held.
+func (s *Store) player(playerID string) *player {
+	p, exists := s.players[playerID]
+	if !exists {
+		p = &player{
+			categoryTotals: make(map[string]int),
+			categoryGames:  make(map[string]int),
+		}
+		s.players[playerID] = p
+	}
+	return p
+}
+
+// addRecent adds a finished game in front of the recent games of a player, dropping the
+// oldest, and releases the archived results no profile lists anymore. The mutex must be
+// held.
+func (s *Store) addRecent(playerID string, p *player, entry RecentGame) {
+	entry.ResultURL = ResultURL(playerID, entry.GameID)
+	s.results[entry.GameID].refs++
+	p.recent = append([]RecentGame{entry}, p.recent...)
+	if len(p.recent) <= MaxRecentGames {
+		return
+	}
+	for _, dropped := range p.recent[MaxRecentGames:] {
+		archived := s.results[dropped.GameID]
+		if archived.refs--; archived.refs == 0 {
+			delete(s.results, dropped.GameID)
+		}
+	}
+	p.recent = p.recent[:MaxRecentGames]
+}
+
+// ResultURL returns the path of the archived result of a game in the profile of a player.
+func ResultURL(playerID, gameID string) string {
+	return "/players/" + url.PathEscape(playerID) + "/games/" + url.PathEscape(gameID)
+}
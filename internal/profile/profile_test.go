@@ -0,0 +1,157 @@
+package profile_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/profile"
+)
+
+func TestRecord(t *testing.T) {
+	store := profile.New()
+	endedAt := time.Date(2026, 10, 14, 18, 0, 0, 0, time.UTC)
+
+	store.Record(game.GameResult{
+		GameID:       "g1",
+		HostPlayerID: "alice",
+		SchemaName:   game.YamsScorecardSchema,
+		EndedAt:      endedAt,
+		Players: []game.PlayerResult{
+			{Standing: game.Standing{Rank: 1, PlayerID: "alice", Score: 280}, Scorecard: &game.Scorecard{
+				Categories: map[string]int{"sixes": 24, "yams": 50}, Bonus: true, Yams: 2,
+			}},
+			{Standing: game.Standing{Rank: 2, PlayerID: "bob", Score: 200}, Scorecard: &game.Scorecard{
+				Categories: map[string]int{"sixes": 18, "yams": 0},
+			}},
+		},
+	})
+	store.Record(game.GameResult{
+		GameID:       "g2",
+		HostPlayerID: "carol",
+		EndedAt:      endedAt.Add(time.Hour),
+		Players: []game.PlayerResult{
+			{Standing: game.Standing{Rank: 1, PlayerID: "bob", Score: 90}},
+			{Standing: game.Standing{Rank: 2, PlayerID: "alice", Score: 60}},
+		},
+	})
+
+	alice, exists := store.Profile("alice")
+	require.True(t, exists)
+	assert.Equal(t, 2, alice.GamesPlayed)
+	assert.Equal(t, 1, alice.GamesHosted)
+	assert.Equal(t, 1, alice.Wins)
+	assert.Equal(t, 170.0, alice.AverageScore)
+	assert.Equal(t, 280, alice.BestScore)
+	require.NotNil(t, alice.Yams)
+	assert.Equal(t, 1, alice.Yams.GamesPlayed)
+	assert.Equal(t, 1.0, alice.Yams.BonusRate)
+	assert.Equal(t, 2, alice.Yams.YamsScored)
+	assert.Equal(t, map[string]float64{"sixes": 24, "yams": 50}, alice.Yams.CategoryAverages)
+	require.Len(t, alice.RecentGames, 2)
+	assert.Equal(t, "g2", alice.RecentGames[0].GameID, "most recent first")
+	assert.False(t, alice.RecentGames[0].Hosted)
+	assert.True(t, alice.RecentGames[1].Hosted)
+	assert.Equal(t, "/players/alice/games/g1", alice.RecentGames[1].ResultURL)
+	assert.Len(t, alice.RecentGames[1].Standings, 2)
+
+	bob, _ := store.Profile("bob")
+	assert.Equal(t, 0.0, bob.Yams.BonusRate)
+	assert.Equal(t, 145.0, bob.AverageScore)
+
+	// A host who did not play only has hosted games
+	carol, exists := store.Profile("carol")
+	require.True(t, exists)
+	assert.Equal(t, 0, carol.GamesPlayed)
+	assert.Equal(t, 1, carol.GamesHosted)
+	assert.Nil(t, carol.Yams)
+	assert.Len(t, carol.RecentGames, 1)
+
+	_, exists = store.Profile("dave")
+	assert.False(t, exists)
+}
+
+func TestRecentGamesAreBounded(t *testing.T) {
+	store := profile.New()
+	for i := 0; i < profile.MaxRecentGames+5; i++ {
+		store.Record(game.GameResult{
+			GameID:  string(rune('a' + i)),
+			Players: []game.PlayerResult{{Standing: game.Standing{Rank: 1, PlayerID: "alice", Score: i}}},
+		})
+	}
+
+	alice, _ := store.Profile("alice")
+	assert.Equal(t, profile.MaxRecentGames+5, alice.GamesPlayed)
+	assert.Len(t, alice.RecentGames, profile.MaxRecentGames)
+	assert.Equal(t, string(rune('a'+profile.MaxRecentGames+4)), alice.RecentGames[0].GameID)
+}
+
+func TestResultsAreArchived(t *testing.T) {
+	store := profile.New()
+	store.Record(game.GameResult{
+		GameID:       "g0",
+		HostPlayerID: "carol",
+		SchemaName:   game.YamsScorecardSchema,
+		Players: []game.PlayerResult{
+			{Standing: game.Standing{Rank: 1, PlayerID: "alice", Score: 74}, Scorecard: &game.Scorecard{Yams: 1, Total: 74}},
+			{Standing: game.Standing{Rank: 2, PlayerID: "bob", Score: 3}},
+		},
+	})
+
+	result, exists := store.Result("carol", "g0")
+	require.True(t, exists, "the host links to the result too")
+	assert.Equal(t, game.YamsScorecardSchema, result.SchemaName)
+	require.Len(t, result.Players, 2)
+	assert.Equal(t, 74, result.Players[0].Scorecard.Total)
+	_, exists = store.Result("dave", "g0")
+	assert.False(t, exists)
+
+	// Once alice's last games no longer list g0, bob and carol still link to its result
+	for i := 1; i <= profile.MaxRecentGames; i++ {
+		store.Record(game.GameResult{
+			GameID:  "g" + strconv.Itoa(i),
+			Players: []game.PlayerResult{{Standing: game.Standing{Rank: 1, PlayerID: "alice", Score: i}}},
+		})
+	}
+	_, exists = store.Result("alice", "g0")
+	assert.False(t, exists)
+	_, exists = store.Result("bob", "g0")
+	assert.True(t, exists)
+	alice, _ := store.Profile("alice")
+	_, exists = store.Result("alice", alice.RecentGames[profile.MaxRecentGames-1].GameID)
+	assert.True(t, exists)
+}
+
+func TestListen(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	broadcaster := broadcast.NewLocal()
+	manager := game.NewGameManagerWithConfig(game.Config{
+		InactivityTimeout: time.Hour,
+		CleanupInterval:   time.Hour,
+		ResultRetention:   time.Hour,
+		Broadcaster:       broadcaster,
+	})
+	store := profile.New()
+	require.NoError(t, store.Listen(ctx, broadcaster))
+
+	gameID, err := manager.CreateGame("alice", []byte(`{}`))
+	require.NoError(t, err)
+	_, err = manager.EndGame(gameID, []game.FinalScore{{PlayerID: "alice", Score: 12}, {PlayerID: "bob", Score: 30}}, nil)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		bob, exists := store.Profile("bob")
+		return exists && bob.Wins == 1
+	}, time.Second, 10*time.Millisecond)
+	alice, _ := store.Profile("alice")
+	assert.Equal(t, 1, alice.GamesHosted)
+	assert.Equal(t, gameID, alice.RecentGames[0].GameID)
+}
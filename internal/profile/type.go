@@ -0,0 +1,74 @@
+package profile
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+// Store holds the profiles of the players, keyed by player ID
+type Store struct {
+	players map[string]*player
+	// results are the archived results of the games listed in the profiles, by game ID
+	results map[string]*archivedResult
+	mutex   sync.RWMutex
+}
+
+// archivedResult is the result of a finished game with the number of profiles listing it
+type archivedResult struct {
+	result game.GameResult
+	refs   int
+}
+
+// player accumulates the results of a player
+type player struct {
+	gamesPlayed int
+	gamesHosted int
+	wins        int
+	totalScore  int
+	bestScore   int
+	yamsGames   int
+	bonusGames  int
+	yamsScored  int
+	// categoryTotals and categoryGames sum the scores of each Yams category and count
+	// the games where it was filled
+	categoryTotals map[string]int
+	categoryGames  map[string]int
+	// recent are the last finished games, most recent first
+	recent []RecentGame
+}
+
+// Profile describes a player from the results of the games it played or hosted
+type Profile struct {
+	PlayerID     string  `json:"playerId"`
+	GamesPlayed  int     `json:"gamesPlayed"`
+	GamesHosted  int     `json:"gamesHosted"`
+	Wins         int     `json:"wins"`
+	AverageScore float64 `json:"averageScore"`
+	BestScore    int     `json:"bestScore"`
+	// Yams describes the games played with the Yams scorecard schema, if any
+	Yams        *YamsStats   `json:"yams,omitempty"`
+	RecentGames []RecentGame `json:"recentGames"`
+}
+
+// YamsStats are the statistics read from the scorecards of a player
+type YamsStats struct {
+	GamesPlayed int `json:"gamesPlayed"`
+	// BonusRate is the share of the games where the upper section bonus was scored
+	BonusRate  float64 `json:"bonusRate"`
+	YamsScored int     `json:"yamsScored"`
+	// CategoryAverages is the average score of each category over the games where it
+	// was filled
+	CategoryAverages map[string]float64 `json:"categoryAverages"`
+}
+
+// RecentGame is a finished game of a player with its final standings
+type RecentGame struct {
+	GameID    string          `json:"gameId"`
+	EndedAt   time.Time       `json:"endedAt"`
+	Hosted    bool            `json:"hosted"`
+	Standings []game.Standing `json:"standings"`
+	// ResultURL is the archived result of the game, available while the profile lists it
+	ResultURL string `json:"resultUrl"`
+}
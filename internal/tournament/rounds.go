@@ -0,0 +1,175 @@
+package tournament
+
+import (
+	"sort"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+/*
+Rounds and Standings
+
+This file makes the games of each round and ranks the players from the games over.
+Rounds are computed from the players and the round number only, so the games of a
+round do not depend on the results of the previous ones.
+*/
+
+const (
+	// winPoints and drawPoints are earned by a player winning or sharing the best score
+	// of a game
+	winPoints  = 2
+	drawPoints = 1
+)
+
+// pairings returns the players of each game of a round, starting at 1. The first player
+// of each game hosts it.
+func pairings(t *Tournament, round int) [][]string {
+	if t.Format == FormatRoundRobin {
+		return roundRobinPairs(t.Players, round)
+	}
+	return tables(t.Players, t.TableSize, round)
+}
+
+// roundRobinRounds returns the number of rounds needed for every player to meet every
+// other player once.
+func roundRobinRounds(players int) int {
+	if players%2 == 1 {
+		return players
+	}
+	return players - 1
+}
+
+// roundRobinPairs pairs the players with the circle method: the first seat is fixed and
+// the others rotate by one seat each round, the player of seat i meeting the player of
+// the opposite seat. With an odd count, an empty seat is added and the player facing it
+// sits the round out.
+func roundRobinPairs(players []string, round int) [][]string {
+	seats := append([]string(nil), players...)
+	if len(seats)%2 == 1 {
+		seats = append(seats, "")
+	}
+	count := len(seats)
+	rotation := (round - 1) % (count - 1)
+
+	order := make([]string, count)
+	order[0] = seats[0]
+	for i := 1; i < count; i++ {
+		order[i] = seats[1+(i-1+rotation)%(count-1)]
+	}
+
+	pairs := make([][]string, 0, count/2)
+	for i := 0; i < count/2; i++ {
+		first, second := order[i], order[count-1-i]
+		if first == "" || second == "" {
+			continue
+		}
+		// Alternate the hosts of the fixed seat
+		if i == 0 && round%2 == 0 {
+			first, second = second, first
+		}
+		pairs = append(pairs, []string{first, second})
+	}
+	return pairs
+}
+
+// tables seats the players at the fewest tables of at most tableSize players. Players
+// are dealt in rows of one player per table, each row being shifted by its index times
+// the round, so the tables change every round while their sizes stay balanced.
+func tables(players []string, tableSize, round int) [][]string {
+	count := (len(players) + tableSize - 1) / tableSize
+	seated := make([][]string, count)
+	for i, player := range players {
+		row := i / count
+		table := (i + row*(round-1)) % count
+		seated[table] = append(seated[table], player)
+	}
+	return seated
+}
+
+// standings ranks the players from the games over. Round-robin players are ranked by
+// points then total score, aggregate players by total score then points; players equal
+// on both share the same rank.
+func standings(t *Tournament) []Standing {
+	byPlayer := make(map[string]*Standing, len(t.Players))
+	for _, player := range t.Players {
+		byPlayer[player] = &Standing{PlayerID: player}
+	}
+
+	for _, match := range t.Matches {
+		if match.Status == MatchPlaying {
+			continue
+		}
+		// Players missing from the final scores scored nothing
+		scores := make(map[string]int, len(match.Results))
+		for _, result := range match.Results {
+			scores[result.PlayerID] = result.Score
+		}
+		best, leaders := bestScore(match, scores)
+		for _, player := range match.Players {
+			standing := byPlayer[player]
+			standing.Played++
+			standing.TotalScore += scores[player]
+			switch {
+			case match.Status == MatchForfeited || scores[player] < best:
+				standing.Losses++
+			case leaders > 1:
+				standing.Draws++
+				standing.Points += drawPoints
+			default:
+				standing.Wins++
+				standing.Points += winPoints
+			}
+		}
+	}
+
+	ranked := make([]Standing, 0, len(byPlayer))
+	for _, player := range t.Players {
+		ranked = append(ranked, *byPlayer[player])
+	}
+	primary, secondary := func(s Standing) int { return s.Points }, func(s Standing) int { return s.TotalScore }
+	if t.Format == FormatAggregate {
+		primary, secondary = secondary, primary
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if primary(ranked[i]) != primary(ranked[j]) {
+			return primary(ranked[i]) > primary(ranked[j])
+		}
+		return secondary(ranked[i]) > secondary(ranked[j])
+	})
+	for i := range ranked {
+		ranked[i].Rank = i + 1
+		if i > 0 && primary(ranked[i]) == primary(ranked[i-1]) && secondary(ranked[i]) == secondary(ranked[i-1]) {
+			ranked[i].Rank = ranked[i-1].Rank
+		}
+	}
+	return ranked
+}
+
+// bestScore returns the best score of the players of a match and how many players
+// achieved it.
+func bestScore(match Match, scores map[string]int) (best, leaders int) {
+	for i, player := range match.Players {
+		switch score := scores[player]; {
+		case i == 0 || score > best:
+			best, leaders = score, 1
+		case score == best:
+			leaders++
+		}
+	}
+	return best, leaders
+}
+
+// results keeps the final standings of the players of a match.
+func results(match Match, standings []game.Standing) []game.Standing {
+	players := make(map[string]bool, len(match.Players))
+	for _, player := range match.Players {
+		players[player] = true
+	}
+	kept := make([]game.Standing, 0, len(match.Players))
+	for _, standing := range standings {
+		if players[standing.PlayerID] {
+			kept = append(kept, standing)
+		}
+	}
+	return kept
+}
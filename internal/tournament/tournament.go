@@ -0,0 +1,346 @@
+/*
+Tournaments
+
+This package groups Yams games into tournaments. A tournament owns the games of its
+rounds, created on the GameManager with the built-in Yams scorecard schema, one
+scorecard per player, the first player of each game being its host. It follows them
+through the lifecycle events of the manager, so it only knows the games of the instance
+that created it: tournaments live in memory on that instance, like their games.
+
+Two formats are supported:
+- roundRobin: every player meets every other player once in a two-player game, over
+  as many rounds as needed (a player sits each round out when their count is odd). A
+  win is worth 2 points and a draw 1; the total score breaks the ties on points
+- aggregate: the players are seated at tables of up to TableSize players for a fixed
+  number of rounds, with different tables each round; the total score ranks them
+
+When every game of a round is over, the games of the next round are created. A game
+abandoned, expired or removed before its end is forfeited: it counts as lost by its
+players, with no score. Finished tournaments are removed after the retention period.
+
+Every change of a tournament is published, retained, on its topic of the broadcaster,
+so that tournament viewers on any instance follow it and receive its current state when
+joining.
+*/
+
+package tournament
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+var (
+	// ErrInvalidTournament is returned when creating a tournament with invalid options
+	ErrInvalidTournament = errors.New("invalid tournament")
+	// ErrNotFound is returned for a tournament unknown everywhere
+	ErrNotFound = errors.New("tournament not found")
+)
+
+const (
+	// MaxPlayers bounds the players of a tournament
+	MaxPlayers = 16
+	// MaxRounds bounds the rounds of an aggregate tournament
+	MaxRounds = 10
+	// DefaultRounds is the number of rounds of an aggregate tournament by default
+	DefaultRounds = 3
+	// DefaultTableSize is the maximum number of players of an aggregate game by default
+	DefaultTableSize = 4
+	// maxTableSize is the maximum number of scorecards of the Yams scorecard schema
+	maxTableSize = 8
+	// maxPlayerIDLength is the maximum length of a player ID in the Yams scorecard schema
+	maxPlayerIDLength = 128
+)
+
+// publishTimeout bounds the publications of the tournament changes
+const publishTimeout = 5 * time.Second
+
+// tournamentRemovedMessage tells the viewers that the tournament no longer exists
+var tournamentRemovedMessage = []byte(`{"type":"tournamentRemoved","message":"The tournament has been removed"}`)
+
+// Topic returns the topic carrying the changes of a tournament.
+func Topic(tournamentID string) string {
+	return "tournament:" + tournamentID
+}
+
+// IsTournamentRemoved reports whether a message received on a tournament topic
+// announces that the tournament was removed.
+func IsTournamentRemoved(data []byte) bool {
+	return string(data) == string(tournamentRemovedMessage)
+}
+
+// DefaultConfig returns the settings used by NewManager.
+func DefaultConfig() Config {
+	return Config{
+		Retention: 24 * time.Hour,
+	}
+}
+
+func NewManager(games *game.GameManager) *Manager {
+	return NewManagerWithConfig(games, DefaultConfig())
+}
+
+func NewManagerWithConfig(games *game.GameManager, config Config) *Manager {
+	m := &Manager{
+		games:        games,
+		config:       config,
+		tournaments:  make(map[string]*Tournament),
+		tournamentOf: make(map[string]string),
+	}
+	m.unsubscribe = games.Events().Subscribe(m.handleEvent,
+		game.EventGameEnded, game.EventGameAbandoned, game.EventGameExpired)
+	return m
+}
+
+// Close stops following the games. The tournaments under way no longer progress.
+func (m *Manager) Close() {
+	m.unsubscribe()
+}
+
+// Create starts a tournament and the games of its first round.
+func (m *Manager) Create(opts Options) (Tournament, error) {
+	if err := validate(&opts); err != nil {
+		return Tournament{}, err
+	}
+
+	t := &Tournament{
+		TournamentID: uuid.New().String(),
+		Name:         opts.Name,
+		Format:       opts.Format,
+		Status:       StatusRunning,
+		Players:      append([]string(nil), opts.Players...),
+		Rounds:       opts.Rounds,
+		CreatedAt:    time.Now().UTC(),
+		Matches:      []Match{},
+	}
+	if t.Format == FormatAggregate {
+		t.TableSize = opts.TableSize
+	} else {
+		t.Rounds = roundRobinRounds(len(t.Players))
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.tournaments[t.TournamentID] = t
+	m.startRound(t, 1)
+	// Every game of the round may have failed
+	m.advance(t)
+	t.Standings = standings(t)
+	logger.Info.Printf("Tournament created: ID=%s, format=%s, %d players, %d rounds", t.TournamentID, t.Format, len(t.Players), t.Rounds)
+	m.publish(t)
+	return t.copy(), nil
+}
+
+// Tournament returns a tournament: the one held by this instance when it created it,
+// the last published state otherwise.
+func (m *Manager) Tournament(ctx context.Context, tournamentID string) (Tournament, error) {
+	data, err := m.Current(ctx, tournamentID)
+	if err != nil {
+		return Tournament{}, err
+	}
+	var message Message
+	if err := json.Unmarshal(data, &message); err != nil {
+		return Tournament{}, err
+	}
+	return message.Tournament, nil
+}
+
+// Current returns the tournament message sent to a new viewer. It returns ErrNotFound
+// when the tournament is unknown everywhere.
+func (m *Manager) Current(ctx context.Context, tournamentID string) ([]byte, error) {
+	m.mutex.Lock()
+	var message *Message
+	if t, exists := m.tournaments[tournamentID]; exists {
+		message = &Message{Type: "tournament", Tournament: t.copy()}
+	}
+	m.mutex.Unlock()
+	if message != nil {
+		return json.Marshal(message)
+	}
+
+	data, err := m.games.Broadcaster().Snapshot(ctx, Topic(tournamentID))
+	if errors.Is(err, broadcast.ErrNoSnapshot) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// validate checks the options of a new tournament and fills in the defaults.
+func validate(opts *Options) error {
+	switch opts.Format {
+	case FormatRoundRobin, FormatAggregate:
+	default:
+		return fmt.Errorf("%w: unknown format %q", ErrInvalidTournament, opts.Format)
+	}
+	if len(opts.Players) < 2 || len(opts.Players) > MaxPlayers {
+		return fmt.Errorf("%w: between 2 and %d players expected", ErrInvalidTournament, MaxPlayers)
+	}
+	seen := make(map[string]bool, len(opts.Players))
+	for _, player := range opts.Players {
+		if player == "" || len(player) > maxPlayerIDLength {
+			return fmt.Errorf("%w: invalid player ID %q", ErrInvalidTournament, player)
+		}
+		if seen[player] {
+			return fmt.Errorf("%w: duplicate player %s", ErrInvalidTournament, player)
+		}
+		seen[player] = true
+	}
+	if opts.Format == FormatRoundRobin {
+		return nil
+	}
+
+	if opts.Rounds == 0 {
+		opts.Rounds = DefaultRounds
+	}
+	if opts.Rounds < 1 || opts.Rounds > MaxRounds {
+		return fmt.Errorf("%w: between 1 and %d rounds expected", ErrInvalidTournament, MaxRounds)
+	}
+	if opts.TableSize == 0 {
+		opts.TableSize = DefaultTableSize
+	}
+	if opts.TableSize < 2 || opts.TableSize > maxTableSize {
+		return fmt.Errorf("%w: table size between 2 and %d expected", ErrInvalidTournament, maxTableSize)
+	}
+	return nil
+}
+
+// handleEvent records the end of the games of the tournaments.
+func (m *Manager) handleEvent(event game.Event) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	tournamentID, exists := m.tournamentOf[event.GameID]
+	if !exists {
+		return
+	}
+	delete(m.tournamentOf, event.GameID)
+	t := m.tournaments[tournamentID]
+
+	match := t.match(event.GameID)
+	// A game removed before its end is announced as ended, without standings
+	final, ended := event.Data["standings"].([]game.Standing)
+	if event.Type == game.EventGameEnded && ended {
+		match.Status = MatchFinished
+		match.Results = results(*match, final)
+	} else {
+		match.Status = MatchForfeited
+		logger.Warn.Printf("Tournament game forfeited: TournamentID=%s, GameID=%s (%s)", tournamentID, event.GameID, event.Type)
+	}
+
+	m.advance(t)
+	t.Standings = standings(t)
+	m.publish(t)
+}
+
+// advance starts the next round, or finishes the tournament, once every game of the
+// current round is over. The mutex must be held.
+func (m *Manager) advance(t *Tournament) {
+	for t.Status == StatusRunning {
+		for _, match := range t.Matches {
+			if match.Round == t.CurrentRound && match.Status == MatchPlaying {
+				return
+			}
+		}
+		if t.CurrentRound < t.Rounds {
+			m.startRound(t, t.CurrentRound+1)
+			continue
+		}
+
+		endedAt := time.Now().UTC()
+		t.Status = StatusFinished
+		t.EndedAt = &endedAt
+		logger.Info.Printf("Tournament finished: ID=%s, removal in %v", t.TournamentID, m.config.Retention)
+		time.AfterFunc(m.config.Retention, func() {
+			m.remove(t.TournamentID)
+		})
+	}
+}
+
+// startRound creates the games of a round. A game that cannot be created is forfeited,
+// so the round may be over as soon as started. The mutex must be held.
+func (m *Manager) startRound(t *Tournament, round int) {
+	t.CurrentRound = round
+	schema, _ := m.games.Schemas().Get(game.YamsScorecardSchema)
+	for _, players := range pairings(t, round) {
+		match := Match{
+			Round:        round,
+			HostPlayerID: players[0],
+			Players:      players,
+			Status:       MatchPlaying,
+		}
+		gameID, err := m.games.CreateGameWithOptions(players[0], game.YamsScorecard(players), game.GameOptions{
+			Schema:     schema,
+			SchemaName: game.YamsScorecardSchema,
+		})
+		if err != nil {
+			logger.Error.Printf("Cannot create a game of tournament %s: %v", t.TournamentID, err)
+			match.Status = MatchForfeited
+		} else {
+			match.GameID = gameID
+			m.tournamentOf[gameID] = t.TournamentID
+		}
+		t.Matches = append(t.Matches, match)
+	}
+	logger.Info.Printf("Tournament round started: ID=%s, round %d of %d", t.TournamentID, round, t.Rounds)
+}
+
+// remove drops a finished tournament and tells its viewers.
+func (m *Manager) remove(tournamentID string) {
+	m.mutex.Lock()
+	delete(m.tournaments, tournamentID)
+	m.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	broadcaster := m.games.Broadcaster()
+	if err := broadcaster.Publish(ctx, Topic(tournamentID), tournamentRemovedMessage, false); err != nil {
+		logger.Warn.Printf("Cannot announce the removal of tournament %s: %v", tournamentID, err)
+	}
+	if err := broadcaster.Forget(ctx, Topic(tournamentID)); err != nil {
+		logger.Warn.Printf("Cannot drop the retained state of tournament %s: %v", tournamentID, err)
+	}
+}
+
+// publish sends the state of a tournament to its viewers and retains it for the next
+// ones. Publications are made with the mutex held, so that they keep the order of the
+// changes.
+func (m *Manager) publish(t *Tournament) {
+	data, err := json.Marshal(Message{Type: "tournament", Tournament: t.copy()})
+	if err != nil {
+		logger.Error.Printf("Cannot encode tournament %s: %v", t.TournamentID, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := m.games.Broadcaster().Publish(ctx, Topic(t.TournamentID), data, true); err != nil {
+		logger.Warn.Printf("Cannot publish tournament %s: %v", t.TournamentID, err)
+	}
+}
+
+// match returns the match played in a game.
+func (t *Tournament) match(gameID string) *Match {
+	for i := range t.Matches {
+		if t.Matches[i].GameID == gameID {
+			return &t.Matches[i]
+		}
+	}
+	return nil
+}
+
+// copy returns a copy of the tournament sharing nothing mutable with it.
+func (t *Tournament) copy() Tournament {
+	tournament := *t
+	tournament.Players = append([]string(nil), t.Players...)
+	tournament.Matches = append([]Match(nil), t.Matches...)
+	tournament.Standings = append([]Standing(nil), t.Standings...)
+	return tournament
+}
@@ -0,0 +1,183 @@
+package tournament
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+func newTestManager(t *testing.T) (*Manager, *game.GameManager) {
+	games := game.NewGameManagerWithConfig(game.Config{
+		InactivityTimeout: time.Hour,
+		CleanupInterval:   time.Hour,
+		ResultRetention:   time.Hour,
+	})
+	tournaments := NewManager(games)
+	t.Cleanup(tournaments.Close)
+	return tournaments, games
+}
+
+func TestRoundRobinPairs(t *testing.T) {
+	for _, count := range []int{2, 3, 4, 5, 8} {
+		players := make([]string, count)
+		for i := range players {
+			players[i] = string(rune('a' + i))
+		}
+
+		met := make(map[[2]string]int)
+		for round := 1; round <= roundRobinRounds(count); round++ {
+			seated := make(map[string]bool)
+			for _, pair := range roundRobinPairs(players, round) {
+				require.Len(t, pair, 2)
+				for _, player := range pair {
+					assert.False(t, seated[player], "%s plays twice in round %d", player, round)
+					seated[player] = true
+				}
+				if pair[0] > pair[1] {
+					pair = []string{pair[1], pair[0]}
+				}
+				met[[2]string{pair[0], pair[1]}]++
+			}
+			assert.GreaterOrEqual(t, len(seated), count-1, "at most one player sits out")
+		}
+		assert.Len(t, met, count*(count-1)/2, "every pair meets with %d players", count)
+		for pair, games := range met {
+			assert.Equal(t, 1, games, "%v meet once", pair)
+		}
+	}
+}
+
+func TestTables(t *testing.T) {
+	players := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i"}
+	first := tables(players, 4, 1)
+	require.Len(t, first, 3)
+	for _, table := range first {
+		assert.Len(t, table, 3)
+	}
+	second := tables(players, 4, 2)
+	assert.NotEqual(t, first, second, "tables change every round")
+	assert.ElementsMatch(t, players, append(append(second[0], second[1]...), second[2]...))
+
+	assert.Equal(t, [][]string{{"a", "b"}}, tables([]string{"a", "b"}, 4, 3))
+}
+
+func TestCreateValidation(t *testing.T) {
+	tournaments, _ := newTestManager(t)
+	for name, opts := range map[string]Options{
+		"unknown format":   {Format: "knockout", Players: []string{"a", "b"}},
+		"single player":    {Format: FormatRoundRobin, Players: []string{"a"}},
+		"duplicate player": {Format: FormatRoundRobin, Players: []string{"a", "a"}},
+		"empty player":     {Format: FormatAggregate, Players: []string{"a", ""}},
+		"too many rounds":  {Format: FormatAggregate, Players: []string{"a", "b"}, Rounds: MaxRounds + 1},
+		"table too small":  {Format: FormatAggregate, Players: []string{"a", "b"}, TableSize: 1},
+	} {
+		_, err := tournaments.Create(opts)
+		assert.ErrorIs(t, err, ErrInvalidTournament, name)
+	}
+}
+
+func TestRoundRobinTournament(t *testing.T) {
+	tournaments, games := newTestManager(t)
+	created, err := tournaments.Create(Options{Name: "Friday", Format: FormatRoundRobin, Players: []string{"alice", "bob", "carol"}})
+	require.NoError(t, err)
+	assert.Equal(t, 3, created.Rounds)
+	assert.Equal(t, StatusRunning, created.Status)
+	// With three players, one sits each round out
+	require.Len(t, created.Matches, 1)
+
+	scores := map[string]int{"alice": 230, "bob": 200, "carol": 200}
+	for round := 1; round <= 3; round++ {
+		current, err := tournaments.Tournament(context.Background(), created.TournamentID)
+		require.NoError(t, err)
+		require.Equal(t, round, current.CurrentRound)
+		match := current.Matches[len(current.Matches)-1]
+		require.Equal(t, MatchPlaying, match.Status)
+
+		hosted, err := games.GetGame(match.GameID)
+		require.NoError(t, err)
+		assert.Equal(t, match.Players[0], hosted.HostPlayerID)
+		assert.Equal(t, game.YamsScorecardSchema, hosted.SchemaName)
+
+		if round == 2 {
+			// A game removed before its end is forfeited
+			require.NoError(t, games.DeleteGame(match.GameID))
+			continue
+		}
+		final := []game.FinalScore{}
+		for _, player := range match.Players {
+			final = append(final, game.FinalScore{PlayerID: player, Score: scores[player]})
+		}
+		_, err = games.EndGame(match.GameID, final, yamsState(scores, match.Players))
+		require.NoError(t, err)
+	}
+
+	finished, err := tournaments.Tournament(context.Background(), created.TournamentID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusFinished, finished.Status)
+	assert.NotNil(t, finished.EndedAt)
+	require.Len(t, finished.Matches, 3)
+	assert.Equal(t, MatchForfeited, finished.Matches[1].Status)
+
+	// bob and carol drew, the forfeited game is lost by both its players and alice won
+	// her other game
+	draws, losses := 0, 0
+	for _, standing := range finished.Standings {
+		assert.Equal(t, 2, standing.Played)
+		draws += standing.Draws
+		losses += standing.Losses
+	}
+	assert.Equal(t, 2, draws)
+	assert.Equal(t, 3, losses)
+	assert.Equal(t, "alice", finished.Standings[0].PlayerID)
+	assert.Equal(t, 2, finished.Standings[0].Points)
+}
+
+// yamsState returns a Yams scorecard state whose totals are the scores of the players,
+// made of extra yams and chance.
+func yamsState(scores map[string]int, players []string) json.RawMessage {
+	type scorecard struct {
+		ID     string         `json:"id"`
+		Scores map[string]int `json:"scores"`
+	}
+	var state struct {
+		Players []scorecard `json:"players"`
+	}
+	for _, player := range players {
+		score := scores[player]
+		state.Players = append(state.Players, scorecard{ID: player, Scores: map[string]int{"extraYams": score / 100, "chance": score % 100}})
+	}
+	data, _ := json.Marshal(state)
+	return data
+}
+
+func TestStandings(t *testing.T) {
+	tournament := &Tournament{
+		Format:  FormatRoundRobin,
+		Players: []string{"alice", "bob", "carol", "dave"},
+		Matches: []Match{
+			{Players: []string{"alice", "bob"}, Status: MatchFinished, Results: []game.Standing{{Rank: 1, PlayerID: "alice", Score: 200}, {Rank: 2, PlayerID: "bob", Score: 180}}},
+			{Players: []string{"carol", "dave"}, Status: MatchFinished, Results: []game.Standing{{Rank: 1, PlayerID: "carol", Score: 190}, {Rank: 1, PlayerID: "dave", Score: 190}}},
+			{Players: []string{"alice", "carol"}, Status: MatchPlaying},
+		},
+	}
+
+	ranked := standings(tournament)
+	assert.Equal(t, []Standing{
+		{Rank: 1, PlayerID: "alice", Points: 2, Played: 1, Wins: 1, TotalScore: 200},
+		{Rank: 2, PlayerID: "carol", Points: 1, Played: 1, Draws: 1, TotalScore: 190},
+		{Rank: 2, PlayerID: "dave", Points: 1, Played: 1, Draws: 1, TotalScore: 190},
+		{Rank: 4, PlayerID: "bob", Played: 1, Losses: 1, TotalScore: 180},
+	}, ranked)
+
+	// The same games rank the aggregate players by total score first
+	tournament.Format = FormatAggregate
+	tournament.Matches[0].Results[0].Score = 100
+	ranked = standings(tournament)
+	assert.Equal(t, []string{"carol", "dave", "bob", "alice"}, []string{ranked[0].PlayerID, ranked[1].PlayerID, ranked[2].PlayerID, ranked[3].PlayerID})
+}
@@ -0,0 +1,116 @@
+package tournament
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+// Format decides how the games of a tournament are made and how its players are ranked
+type Format string
+
+const (
+	// FormatRoundRobin plays every pair of players once; points rank the players
+	FormatRoundRobin Format = "roundRobin"
+	// FormatAggregate seats the players at tables for a number of rounds; the total
+	// score ranks the players
+	FormatAggregate Format = "aggregate"
+)
+
+// Status is the lifecycle state of a tournament
+type Status string
+
+const (
+	// StatusRunning : the games of the current round are being played
+	StatusRunning Status = "running"
+	// StatusFinished : every round is over, the standings are final
+	StatusFinished Status = "finished"
+)
+
+// MatchStatus is the state of a game of a tournament
+type MatchStatus string
+
+const (
+	// MatchPlaying : the game is being played
+	MatchPlaying MatchStatus = "playing"
+	// MatchFinished : the host ended the game with the final scores
+	MatchFinished MatchStatus = "finished"
+	// MatchForfeited : the game was abandoned, expired or removed before its end
+	MatchForfeited MatchStatus = "forfeited"
+)
+
+// Config holds the Manager settings
+type Config struct {
+	// Retention is how long a finished tournament is kept before being removed
+	Retention time.Duration
+}
+
+// Manager creates the tournaments and follows their games
+type Manager struct {
+	games       *game.GameManager
+	config      Config
+	tournaments map[string]*Tournament
+	// tournamentOf maps the games being played to their tournament
+	tournamentOf map[string]string
+	unsubscribe  func()
+	mutex        sync.Mutex
+}
+
+// Options are the settings of a tournament chosen at its creation
+type Options struct {
+	Name    string   `json:"name,omitempty"`
+	Format  Format   `json:"format"`
+	Players []string `json:"players"`
+	// Rounds is the number of rounds of an aggregate tournament, DefaultRounds when 0
+	Rounds int `json:"rounds,omitempty"`
+	// TableSize is the maximum number of players of an aggregate game, DefaultTableSize
+	// when 0
+	TableSize int `json:"tableSize,omitempty"`
+}
+
+// Tournament groups the games of several rounds between the same players
+type Tournament struct {
+	TournamentID string   `json:"tournamentId"`
+	Name         string   `json:"name,omitempty"`
+	Format       Format   `json:"format"`
+	Status       Status   `json:"status"`
+	Players      []string `json:"players"`
+	Rounds       int      `json:"rounds"`
+	// CurrentRound is the round being played, starting at 1, or the last one once finished
+	CurrentRound int        `json:"currentRound"`
+	TableSize    int        `json:"tableSize,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	EndedAt      *time.Time `json:"endedAt,omitempty"`
+	Matches      []Match    `json:"matches"`
+	Standings    []Standing `json:"standings"`
+}
+
+// Match is a game of a tournament
+type Match struct {
+	Round        int         `json:"round"`
+	GameID       string      `json:"gameId,omitempty"`
+	HostPlayerID string      `json:"hostPlayerId"`
+	Players      []string    `json:"players"`
+	Status       MatchStatus `json:"status"`
+	// Results are the final standings of the game, once finished
+	Results []game.Standing `json:"results,omitempty"`
+}
+
+// Standing is the position of a player in a tournament
+type Standing struct {
+	Rank       int    `json:"rank"`
+	PlayerID   string `json:"playerId"`
+	Points     int    `json:"points"`
+	Played     int    `json:"played"`
+	Wins       int    `json:"wins"`
+	Draws      int    `json:"draws"`
+	Losses     int    `json:"losses"`
+	TotalScore int    `json:"totalScore"`
+}
+
+// Message carries a tournament on its topic, after each change
+type Message struct {
+	Type       string     `json:"type"`
+	Tournament Tournament `json:"tournament"`
+}
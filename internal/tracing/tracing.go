@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+Tracing
+
+This file wires the OpenTelemetry SDK used to trace the game lifecycle: game creation,
+host and viewer connections, every state update received from a host and its fan-out
+to viewers.
+
+Spans are exported through one of the following exporters:
+- otlp: OTLP over HTTP to a collector (endpoint configurable, defaults to the
+  standard OTEL_EXPORTER_OTLP_* environment variables)
+- stdout: pretty-printed spans on the standard output, handy when developing
+- file: spans appended as JSON to a local file, handy in tests
+- none: tracing disabled (spans are no-ops)
+
+Trace context is propagated from incoming HTTP requests (including WebSocket upgrade
+requests) through the W3C traceparent/tracestate and baggage headers.
+*/
+
+const instrumentationName = "github.com/vincentvignali/yamsAttackSocket"
+
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// Span attribute keys shared by the instrumented handlers
+const (
+	AttrGameID      = attribute.Key("game.id")
+	AttrHostID      = attribute.Key("game.host_id")
+	AttrPayloadSize = attribute.Key("game.payload_size")
+	AttrViewerCount = attribute.Key("game.viewer_count")
+	AttrConnection  = attribute.Key("game.connection_type")
+)
+
+// Init installs the global tracer provider and propagator described by cfg.
+// The returned function flushes pending spans and must be called on shutdown.
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var closer io.Closer
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterFile:
+		file, openErr := os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if openErr != nil {
+			return nil, fmt.Errorf("cannot open trace file %s: %w", cfg.FilePath, openErr)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+		}
+		closer = file
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = "yamsAttackSocket"
+	}
+	res := resource.NewSchemaless(semconv.ServiceName(serviceName))
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	logger.System.Printf("Tracing enabled: exporter=%s, sampleRatio=%.2f", cfg.Exporter, cfg.SampleRatio)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Tracer returns the tracer used by every instrumented component.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Extract returns the request context enriched with the trace context carried by
+// the request headers, so spans started from it continue the caller's trace.
+func Extract(r *http.Request) context.Context {
+	return otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+}
@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInitFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+
+	shutdown, err := Init(context.Background(), Config{Exporter: ExporterFile, FilePath: path, SampleRatio: 1})
+	require.NoError(t, err)
+
+	_, span := Tracer().Start(context.Background(), "HostGame.update")
+	span.SetAttributes(AttrGameID.String("game-1"), AttrPayloadSize.Int(42))
+	span.End()
+
+	require.NoError(t, shutdown(context.Background()))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"Name":"HostGame.update"`)
+	assert.Contains(t, string(content), `"game.id"`)
+	assert.Contains(t, string(content), `"game.payload_size"`)
+}
+
+func TestInitSampleNothing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+
+	shutdown, err := Init(context.Background(), Config{Exporter: ExporterFile, FilePath: path, SampleRatio: 0})
+	require.NoError(t, err)
+
+	_, span := Tracer().Start(context.Background(), "HostGame.update")
+	assert.False(t, span.IsRecording())
+	span.End()
+
+	require.NoError(t, shutdown(context.Background()))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, content)
+}
+
+func TestInitDisabled(t *testing.T) {
+	shutdown, err := Init(context.Background(), Config{Exporter: ExporterNone})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestInitUnknownExporter(t *testing.T) {
+	_, err := Init(context.Background(), Config{Exporter: "carrier-pigeon"})
+	assert.Error(t, err)
+}
+
+func TestExtractPropagatesTraceContext(t *testing.T) {
+	_, err := Init(context.Background(), Config{Exporter: ExporterNone})
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest(http.MethodGet, "/viewGame", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	spanContext := trace.SpanContextFromContext(Extract(req))
+	assert.True(t, spanContext.IsValid())
+	assert.True(t, spanContext.IsRemote())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spanContext.TraceID().String())
+}
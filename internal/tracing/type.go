@@ -0,0 +1,16 @@
+package tracing
+
+type Config struct {
+	// Exporter selects where spans are sent: none, otlp, stdout or file
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector URL (e.g. http://localhost:4318/v1/traces)
+	Endpoint string
+	// Insecure disables TLS towards the OTLP collector
+	Insecure bool
+	// FilePath is the destination of the file exporter
+	FilePath string
+	// ServiceName is reported as the service.name resource attribute
+	ServiceName string
+	// SampleRatio is the fraction of root traces recorded, between 0 (none) and 1 (all)
+	SampleRatio float64
+}
@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+// Config holds the Dispatcher settings
+type Config struct {
+	// URLs receive every dispatched event
+	URLs []string
+	// Secret signs the payloads; empty sends them unsigned
+	Secret string
+	// Events restricts the dispatched event types; empty dispatches all of them
+	Events []game.EventType
+	// MaxAttempts is the number of delivery attempts of a payload to a URL
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubled at each retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts
+	MaxBackoff time.Duration
+	// Timeout bounds each delivery attempt
+	Timeout time.Duration
+	// QueueSize is the number of deliveries waiting for a worker; beyond it, new
+	// deliveries are dead-lettered
+	QueueSize int
+	// Workers is the number of concurrent deliveries
+	Workers int
+	// Client sends the requests; nil uses a client with Timeout
+	Client *http.Client
+	// DeadLetter receives, one JSON document per line, the deliveries given up on;
+	// they are always logged
+	DeadLetter io.Writer
+}
+
+// Dispatcher POSTs the game lifecycle events to the configured URLs
+type Dispatcher struct {
+	config          Config
+	client          *http.Client
+	queue           chan *delivery
+	done            chan struct{}
+	closeOnce       sync.Once
+	workers         sync.WaitGroup
+	deadLetterMutex sync.Mutex
+	delivered       atomic.Int64
+	retried         atomic.Int64
+	deadLettered    atomic.Int64
+
+	// ctx bounds the delivery attempts; abort cancels it once Close is over or timed out
+	ctx   context.Context
+	abort context.CancelFunc
+	// closeMutex keeps Close from closing done while Dispatch queues deliveries
+	closeMutex sync.RWMutex
+}
+
+// delivery is one payload to deliver to one URL
+type delivery struct {
+	id        string
+	eventType game.EventType
+	url       string
+	payload   []byte
+	attempts  int
+}
+
+// DeadLetter records a delivery given up on
+type DeadLetter struct {
+	DeliveryID string          `json:"deliveryId"`
+	Event      game.EventType  `json:"event"`
+	URL        string          `json:"url"`
+	Attempts   int             `json:"attempts"`
+	Error      string          `json:"error"`
+	FailedAt   time.Time       `json:"failedAt"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// permanentError is a delivery failure that retrying will not fix
+type permanentError struct {
+	err error
+}
@@ -0,0 +1,361 @@
+/*
+Webhook Dispatcher
+
+This package delivers the game lifecycle events emitted by the GameManager to HTTP
+endpoints of our backend. Each event is POSTed as JSON to every configured URL with
+the headers:
+- X-Yams-Event: the event type
+- X-Yams-Delivery: a delivery ID, identical across the retries of a delivery
+- X-Yams-Timestamp: the Unix time of the attempt
+- X-Yams-Signature: "sha256=" followed by the hex HMAC-SHA256, keyed with the shared
+  secret, of the timestamp, a dot and the body (see Verify)
+
+Deliveries are queued and sent by a pool of workers, so that emitting an event never
+waits for the network. A failed attempt (network error, 5xx or 429 status) is retried
+with an exponential backoff; other statuses fail immediately. Deliveries that still
+fail, or that do not fit in the queue, are written to the dead-letter log. Deliveries
+run concurrently: receivers must not rely on the order of the events.
+
+Closing the dispatcher waits for the queued deliveries. When its deadline passes first,
+the attempts in flight are aborted and every delivery left is dead-lettered, so that no
+delivery is dropped silently and the dead-letter log is no longer written once Close
+returns.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+const (
+	EventHeader     = "X-Yams-Event"
+	DeliveryHeader  = "X-Yams-Delivery"
+	TimestampHeader = "X-Yams-Timestamp"
+	SignatureHeader = "X-Yams-Signature"
+
+	// signaturePrefix names the signature algorithm in SignatureHeader
+	signaturePrefix = "sha256="
+)
+
+// ErrInvalidSignature is returned by Verify when a payload was not signed with the secret
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// DefaultConfig returns the delivery settings used when a Config field is not set.
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:    5,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Timeout:        10 * time.Second,
+		QueueSize:      1024,
+		Workers:        4,
+	}
+}
+
+func NewDispatcher(config Config) (*Dispatcher, error) {
+	if len(config.URLs) == 0 {
+		return nil, fmt.Errorf("no webhook URL configured")
+	}
+	for _, rawURL := range config.URLs {
+		parsed, err := url.Parse(rawURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid webhook URL %q, expected an http or https URL", rawURL)
+		}
+	}
+	for _, eventType := range config.Events {
+		if !game.ValidEventType(eventType) {
+			return nil, fmt.Errorf("unknown webhook event %q", eventType)
+		}
+	}
+
+	defaults := DefaultConfig()
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = defaults.InitialBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaults.MaxBackoff
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	if config.Workers <= 0 {
+		config.Workers = defaults.Workers
+	}
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: config.Timeout}
+	}
+
+	d := &Dispatcher{
+		config: config,
+		client: client,
+		queue:  make(chan *delivery, config.QueueSize),
+		done:   make(chan struct{}),
+	}
+	d.ctx, d.abort = context.WithCancel(context.Background())
+	for i := 0; i < config.Workers; i++ {
+		d.workers.Add(1)
+		go d.work()
+	}
+	return d, nil
+}
+
+// Attach dispatches the events of a bus, restricted to the configured event types. The
+// returned function detaches the dispatcher.
+func (d *Dispatcher) Attach(events *game.EventBus) func() {
+	return events.Subscribe(d.Dispatch, d.config.Events...)
+}
+
+// Dispatch queues an event for delivery to every URL, without waiting.
+func (d *Dispatcher) Dispatch(event game.Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error.Printf("Cannot encode webhook event %s (GameID=%s): %v", event.Type, event.GameID, err)
+		return
+	}
+
+	// The deliveries are queued before Close, which the workers then drain, or after
+	d.closeMutex.RLock()
+	defer d.closeMutex.RUnlock()
+	for i, target := range d.config.URLs {
+		item := &delivery{
+			id:        event.ID + "-" + strconv.Itoa(i),
+			eventType: event.Type,
+			url:       target,
+			payload:   payload,
+		}
+		select {
+		case <-d.done:
+			d.deadLetter(item, errors.New("dispatcher closed"))
+		default:
+			select {
+			case d.queue <- item:
+			default:
+				d.deadLetter(item, errors.New("delivery queue full"))
+			}
+		}
+	}
+}
+
+// Close stops accepting events and waits for the queued deliveries, at most until ctx
+// is done. The attempts in flight are then aborted and the deliveries left are
+// dead-lettered; Close returns once the workers have stopped.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.closeOnce.Do(func() {
+		d.closeMutex.Lock()
+		close(d.done)
+		d.closeMutex.Unlock()
+	})
+
+	finished := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		d.abort()
+		return nil
+	case <-ctx.Done():
+		d.abort()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+// DeliveredCount returns how many deliveries succeeded.
+func (d *Dispatcher) DeliveredCount() int64 {
+	return d.delivered.Load()
+}
+
+// RetriedCount returns how many attempts were retried.
+func (d *Dispatcher) RetriedCount() int64 {
+	return d.retried.Load()
+}
+
+// DeadLetteredCount returns how many deliveries were given up on.
+func (d *Dispatcher) DeadLetteredCount() int64 {
+	return d.deadLettered.Load()
+}
+
+// work delivers queued payloads until the dispatcher is closed and the queue drained.
+func (d *Dispatcher) work() {
+	defer d.workers.Done()
+	for {
+		select {
+		case item := <-d.queue:
+			d.deliver(item)
+		case <-d.done:
+			// Drain the deliveries queued before Close
+			for {
+				select {
+				case item := <-d.queue:
+					d.deliver(item)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver attempts a delivery until it succeeds, fails permanently or runs out of
+// attempts. Once the dispatcher is closed, the pending retries are given up on, and
+// once it is aborted, the deliveries not attempted yet.
+func (d *Dispatcher) deliver(item *delivery) {
+	if d.ctx.Err() != nil {
+		d.deadLetter(item, errors.New("dispatcher closed before delivery"))
+		return
+	}
+
+	backoff := d.config.InitialBackoff
+	for {
+		item.attempts++
+		err := d.attempt(item)
+		if err == nil {
+			d.delivered.Add(1)
+			logger.Debug.Printf("Webhook %s delivered to %s (attempt %d)", item.eventType, item.url, item.attempts)
+			return
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || item.attempts >= d.config.MaxAttempts {
+			d.deadLetter(item, err)
+			return
+		}
+
+		logger.Warn.Printf("Webhook %s to %s failed (attempt %d/%d), retrying in %v: %v",
+			item.eventType, item.url, item.attempts, d.config.MaxAttempts, backoff, err)
+		d.retried.Add(1)
+		select {
+		case <-time.After(backoff):
+		case <-d.done:
+			d.deadLetter(item, fmt.Errorf("dispatcher closed before retry: %w", err))
+			return
+		}
+		backoff = min(2*backoff, d.config.MaxBackoff)
+	}
+}
+
+// attempt sends a delivery once.
+func (d *Dispatcher) attempt(item *delivery) error {
+	ctx, cancel := context.WithTimeout(d.ctx, d.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, item.url, bytes.NewReader(item.payload))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "yamsAttackSocket-webhook")
+	req.Header.Set(EventHeader, string(item.eventType))
+	req.Header.Set(DeliveryHeader, item.id)
+	req.Header.Set(TimestampHeader, timestamp)
+	if d.config.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(d.config.Secret, timestamp, item.payload))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout:
+		return fmt.Errorf("receiver answered %s", resp.Status)
+	default:
+		return &permanentError{err: fmt.Errorf("receiver answered %s", resp.Status)}
+	}
+}
+
+// deadLetter logs a delivery given up on and writes it to the dead-letter log.
+func (d *Dispatcher) deadLetter(item *delivery, err error) {
+	d.deadLettered.Add(1)
+	logger.Error.Printf("Webhook %s to %s dead-lettered after %d attempts: %v", item.eventType, item.url, item.attempts, err)
+	if d.config.DeadLetter == nil {
+		return
+	}
+
+	record, encodeErr := json.Marshal(DeadLetter{
+		DeliveryID: item.id,
+		Event:      item.eventType,
+		URL:        item.url,
+		Attempts:   item.attempts,
+		Error:      err.Error(),
+		FailedAt:   time.Now().UTC(),
+		Payload:    item.payload,
+	})
+	if encodeErr != nil {
+		logger.Error.Printf("Cannot encode dead letter: %v", encodeErr)
+		return
+	}
+	d.deadLetterMutex.Lock()
+	defer d.deadLetterMutex.Unlock()
+	if _, writeErr := d.config.DeadLetter.Write(append(record, '\n')); writeErr != nil {
+		logger.Error.Printf("Cannot write dead letter: %v", writeErr)
+	}
+}
+
+// Sign returns the SignatureHeader value of a payload sent at timestamp.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a received payload, and that it was sent less than
+// tolerance ago to limit replays (0 disables the check).
+func Verify(secret string, header http.Header, payload []byte, tolerance time.Duration) error {
+	timestamp := header.Get(TimestampHeader)
+	expected := Sign(secret, timestamp, payload)
+	if !hmac.Equal([]byte(expected), []byte(header.Get(SignatureHeader))) {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		sentAt, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: invalid timestamp %q", ErrInvalidSignature, timestamp)
+		}
+		if age := time.Since(time.Unix(sentAt, 0)); age > tolerance || age < -tolerance {
+			return fmt.Errorf("%w: sent %v ago", ErrInvalidSignature, age.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,324 @@
+package webhook_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/webhook"
+)
+
+const secret = "s3cr3t"
+
+// receiver is an httptest webhook endpoint answering with the next scripted status, or
+// 204 once the script is over
+type receiver struct {
+	server     *httptest.Server
+	mutex      sync.Mutex
+	statuses   []int
+	attempts   int
+	deliveries []received
+	arrived    chan struct{}
+}
+
+// received is a delivery accepted by the receiver
+type received struct {
+	header http.Header
+	event  game.Event
+	err    error
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses, arrived: make(chan struct{}, 64)}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mutex.Lock()
+		status := http.StatusNoContent
+		if r.attempts < len(r.statuses) {
+			status = r.statuses[r.attempts]
+		}
+		r.attempts++
+		if status < 300 {
+			delivery := received{header: req.Header.Clone(), err: webhook.Verify(secret, req.Header, body, time.Minute)}
+			json.Unmarshal(body, &delivery.event)
+			r.deliveries = append(r.deliveries, delivery)
+		}
+		r.mutex.Unlock()
+
+		w.WriteHeader(status)
+		r.arrived <- struct{}{}
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+// wait blocks until n requests reached the receiver.
+func (r *receiver) wait(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.arrived:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d of %d requests received", i, n)
+		}
+	}
+}
+
+func (r *receiver) received() []received {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]received(nil), r.deliveries...)
+}
+
+// syncBuffer is a dead-letter log safe to read while the dispatcher writes it
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) letters(t *testing.T) []webhook.DeadLetter {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var letters []webhook.DeadLetter
+	decoder := json.NewDecoder(bytes.NewReader(b.buf.Bytes()))
+	for decoder.More() {
+		var letter webhook.DeadLetter
+		require.NoError(t, decoder.Decode(&letter))
+		letters = append(letters, letter)
+	}
+	return letters
+}
+
+func newDispatcher(t *testing.T, config webhook.Config) *webhook.Dispatcher {
+	config.Secret = secret
+	config.InitialBackoff = 5 * time.Millisecond
+	config.MaxBackoff = 20 * time.Millisecond
+	dispatcher, err := webhook.NewDispatcher(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { dispatcher.Close(context.Background()) })
+	return dispatcher
+}
+
+func testEvent(eventType game.EventType) game.Event {
+	return game.Event{ID: "evt-1", Type: eventType, GameID: "game-1", Time: time.Now().UTC()}
+}
+
+func TestSignedDelivery(t *testing.T) {
+	first, second := newReceiver(t), newReceiver(t)
+	dispatcher := newDispatcher(t, webhook.Config{URLs: []string{first.server.URL, second.server.URL}})
+
+	dispatcher.Dispatch(testEvent(game.EventGameCreated))
+	first.wait(t, 1)
+	second.wait(t, 1)
+
+	for _, r := range []*receiver{first, second} {
+		deliveries := r.received()
+		require.Len(t, deliveries, 1)
+		assert.NoError(t, deliveries[0].err, "signature verified by the receiver")
+		assert.Equal(t, "gameCreated", deliveries[0].header.Get(webhook.EventHeader))
+		assert.NotEmpty(t, deliveries[0].header.Get(webhook.DeliveryHeader))
+		assert.Equal(t, game.EventGameCreated, deliveries[0].event.Type)
+		assert.Equal(t, "game-1", deliveries[0].event.GameID)
+	}
+	assert.Eventually(t, func() bool { return dispatcher.DeliveredCount() == 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	r := newReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	dispatcher := newDispatcher(t, webhook.Config{URLs: []string{r.server.URL}})
+
+	dispatcher.Dispatch(testEvent(game.EventStateUpdated))
+	r.wait(t, 3)
+
+	deliveries := r.received()
+	require.Len(t, deliveries, 1)
+	assert.NoError(t, deliveries[0].err)
+	assert.Equal(t, int64(2), dispatcher.RetriedCount())
+	assert.Eventually(t, func() bool { return dispatcher.DeliveredCount() == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int64(0), dispatcher.DeadLetteredCount())
+}
+
+func TestDeadLetter(t *testing.T) {
+	t.Run("Attempts Exhausted", func(t *testing.T) {
+		r := newReceiver(t, 500, 500, 500)
+		deadLetters := &syncBuffer{}
+		dispatcher := newDispatcher(t, webhook.Config{URLs: []string{r.server.URL}, MaxAttempts: 3, DeadLetter: deadLetters})
+
+		dispatcher.Dispatch(testEvent(game.EventGameExpired))
+		r.wait(t, 3)
+
+		assert.Eventually(t, func() bool { return dispatcher.DeadLetteredCount() == 1 }, time.Second, 5*time.Millisecond)
+		letters := deadLetters.letters(t)
+		require.Len(t, letters, 1)
+		assert.Equal(t, game.EventGameExpired, letters[0].Event)
+		assert.Equal(t, 3, letters[0].Attempts)
+		assert.Contains(t, letters[0].Error, "500")
+		assert.Contains(t, string(letters[0].Payload), `"gameId":"game-1"`)
+	})
+
+	t.Run("Client Error Is Not Retried", func(t *testing.T) {
+		r := newReceiver(t, http.StatusBadRequest)
+		deadLetters := &syncBuffer{}
+		dispatcher := newDispatcher(t, webhook.Config{URLs: []string{r.server.URL}, DeadLetter: deadLetters})
+
+		dispatcher.Dispatch(testEvent(game.EventGameEnded))
+		r.wait(t, 1)
+
+		assert.Eventually(t, func() bool { return dispatcher.DeadLetteredCount() == 1 }, time.Second, 5*time.Millisecond)
+		assert.Equal(t, int64(0), dispatcher.RetriedCount())
+		assert.Equal(t, 1, deadLetters.letters(t)[0].Attempts)
+	})
+
+	t.Run("Unreachable Receiver", func(t *testing.T) {
+		deadLetters := &syncBuffer{}
+		dispatcher := newDispatcher(t, webhook.Config{URLs: []string{"http://127.0.0.1:1/hook"}, MaxAttempts: 2, DeadLetter: deadLetters})
+
+		dispatcher.Dispatch(testEvent(game.EventGameEnded))
+		assert.Eventually(t, func() bool { return dispatcher.DeadLetteredCount() == 1 }, 2*time.Second, 5*time.Millisecond)
+		assert.Equal(t, 2, deadLetters.letters(t)[0].Attempts)
+	})
+}
+
+func TestAttachToGameManager(t *testing.T) {
+	r := newReceiver(t)
+	dispatcher := newDispatcher(t, webhook.Config{
+		URLs:   []string{r.server.URL},
+		Events: []game.EventType{game.EventGameCreated, game.EventGameExpired},
+	})
+	manager := game.NewGameManager()
+	detach := dispatcher.Attach(manager.Events())
+	defer detach()
+
+	gameID, err := manager.CreateGame("player1", []byte(`{}`))
+	require.NoError(t, err)
+	manager.RemoveGame(gameID)
+	r.wait(t, 1)
+
+	deliveries := r.received()
+	require.Len(t, deliveries, 1, "gameEnded is filtered out")
+	assert.Equal(t, game.EventGameCreated, deliveries[0].event.Type)
+	assert.Equal(t, gameID, deliveries[0].event.GameID)
+	assert.Equal(t, "player1", deliveries[0].event.Data["hostPlayerId"])
+}
+
+func TestCloseDrainsQueue(t *testing.T) {
+	r := newReceiver(t)
+	dispatcher, err := webhook.NewDispatcher(webhook.Config{URLs: []string{r.server.URL}, Workers: 1})
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		event := testEvent(game.EventStateUpdated)
+		event.ID = "evt-" + strconv.Itoa(i)
+		dispatcher.Dispatch(event)
+	}
+	require.NoError(t, dispatcher.Close(context.Background()))
+	assert.Len(t, r.received(), 10)
+
+	dispatcher.Dispatch(testEvent(game.EventStateUpdated))
+	assert.Equal(t, int64(1), dispatcher.DeadLetteredCount(), "events after Close are dead-lettered")
+}
+
+func TestDispatchWhileClosing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.ReadAll(req.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	for round := 0; round < 20; round++ {
+		dispatcher, err := webhook.NewDispatcher(webhook.Config{URLs: []string{server.URL}, Workers: 2})
+		require.NoError(t, err)
+
+		var dispatching sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			dispatching.Add(1)
+			go func() {
+				defer dispatching.Done()
+				for j := 0; j < 25; j++ {
+					dispatcher.Dispatch(testEvent(game.EventStateUpdated))
+				}
+			}()
+		}
+		require.NoError(t, dispatcher.Close(context.Background()))
+		dispatching.Wait()
+
+		// Every delivery is either delivered or dead-lettered, whenever it was dispatched
+		assert.Equal(t, int64(100), dispatcher.DeliveredCount()+dispatcher.DeadLetteredCount())
+	}
+}
+
+func TestCloseTimeout(t *testing.T) {
+	// The receiver hangs until the request is aborted
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.ReadAll(req.Body)
+		started <- struct{}{}
+		<-req.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	deadLetters := &syncBuffer{}
+	dispatcher, err := webhook.NewDispatcher(webhook.Config{URLs: []string{server.URL}, Workers: 1, DeadLetter: deadLetters})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		event := testEvent(game.EventStateUpdated)
+		event.ID = "evt-" + strconv.Itoa(i)
+		dispatcher.Dispatch(event)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	closing := time.Now()
+	assert.ErrorIs(t, dispatcher.Close(ctx), context.DeadlineExceeded)
+	assert.Less(t, time.Since(closing), time.Second, "the attempt in flight is aborted")
+
+	// Every delivery is dead-lettered before Close returns, the one in flight included
+	assert.Equal(t, int64(5), dispatcher.DeadLetteredCount())
+	assert.Len(t, deadLetters.letters(t), 5)
+	assert.Equal(t, int64(0), dispatcher.DeliveredCount())
+}
+
+func TestVerify(t *testing.T) {
+	payload := []byte(`{"type":"gameCreated"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	header := http.Header{}
+	header.Set(webhook.TimestampHeader, now)
+	header.Set(webhook.SignatureHeader, webhook.Sign(secret, now, payload))
+
+	assert.NoError(t, webhook.Verify(secret, header, payload, time.Minute))
+	assert.ErrorIs(t, webhook.Verify("other", header, payload, time.Minute), webhook.ErrInvalidSignature)
+	assert.ErrorIs(t, webhook.Verify(secret, header, []byte(`{"type":"gameEnded"}`), time.Minute), webhook.ErrInvalidSignature)
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	header.Set(webhook.TimestampHeader, old)
+	header.Set(webhook.SignatureHeader, webhook.Sign(secret, old, payload))
+	assert.ErrorIs(t, webhook.Verify(secret, header, payload, time.Minute), webhook.ErrInvalidSignature, "replayed payload")
+	assert.NoError(t, webhook.Verify(secret, header, payload, 0))
+}
+
+func TestNewDispatcher(t *testing.T) {
+	_, err := webhook.NewDispatcher(webhook.Config{})
+	assert.Error(t, err, "no URL")
+	_, err = webhook.NewDispatcher(webhook.Config{URLs: []string{"ftp://example.com"}})
+	assert.Error(t, err)
+	_, err = webhook.NewDispatcher(webhook.Config{URLs: []string{"https://example.com"}, Events: []game.EventType{"gameWon"}})
+	assert.Error(t, err)
+}
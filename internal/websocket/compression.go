@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+Message Compression
+
+With Config.Compression, permessage-deflate is negotiated with the clients offering it.
+The messages of at least CompressionThreshold bytes, once encoded, are then compressed
+at CompressionLevel; smaller ones, which deflate barely shrinks, are sent as is. The
+prepared messages of the broadcaster are compressed once per level, whatever the number
+of connections receiving them.
+
+The network connection of every upgraded WebSocket counts the bytes written to it, so
+that the bytes saved by a compressed message are measured: the size of its frame
+uncompressed, less the bytes actually sent. It also leads to the handler of the
+connection, whose WriteTimeout bounds each write of a message.
+*/
+
+// upgrade upgrades an HTTP connection to a WebSocket connection, negotiating its
+// compression.
+func (h *GameWSHandler) upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	conn, err := h.upgrader.Upgrade(meteredWriter{
+		ResponseWriter: w,
+		handler:        h,
+		compression:    h.config.Compression && offersCompression(r),
+	}, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !h.config.Compression {
+		return conn, nil
+	}
+	if err := conn.SetCompressionLevel(h.config.CompressionLevel); err != nil {
+		logger.Warn.Printf("Invalid WebSocket compression level %d: %v", h.config.CompressionLevel, err)
+	}
+	return conn, nil
+}
+
+// CompressedCount returns how many messages were sent compressed.
+func (h *GameWSHandler) CompressedCount() int64 {
+	return h.compressedMessages.Load()
+}
+
+// UncompressedBytes returns the size the compressed messages would have had on the
+// wire without compression.
+func (h *GameWSHandler) UncompressedBytes() int64 {
+	return h.uncompressedBytes.Load()
+}
+
+// BytesSaved returns how many bytes compression saved on the wire.
+func (h *GameWSHandler) BytesSaved() int64 {
+	return h.bytesSaved.Load()
+}
+
+// offersCompression reports whether a client offers permessage-deflate, which the
+// upgrader then negotiates.
+func offersCompression(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, extension := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(extension, ";")
+			if strings.TrimSpace(name) == "permessage-deflate" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeFrame makes the write of a message of size bytes, within the write timeout of
+// the handler of the connection.
+func writeFrame(conn *websocket.Conn, size int, write func() error) error {
+	metered, ok := conn.NetConn().(*meteredConn)
+	if !ok {
+		return write()
+	}
+	if timeout := metered.handler.config.WriteTimeout; timeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	return compress(conn, metered, size, write)
+}
+
+// compress makes the write of a message of size bytes, compressed when the connection
+// negotiated compression and the message reaches the threshold.
+func compress(conn *websocket.Conn, metered *meteredConn, size int, write func() error) error {
+	if !metered.compression {
+		return write()
+	}
+	h := metered.handler
+	if size < h.config.CompressionThreshold {
+		conn.EnableWriteCompression(false)
+		return write()
+	}
+
+	conn.EnableWriteCompression(true)
+	before := metered.written.Load()
+	if err := write(); err != nil {
+		return err
+	}
+	uncompressed := int64(frameSize(size))
+	h.compressedMessages.Add(1)
+	h.uncompressedBytes.Add(uncompressed)
+	h.bytesSaved.Add(uncompressed - (metered.written.Load() - before))
+	return nil
+}
+
+// frameSize returns the size of a server frame carrying size bytes.
+func frameSize(size int) int {
+	switch {
+	case size > 65535:
+		return size + 10
+	case size > 125:
+		return size + 4
+	}
+	return size + 2
+}
+
+// Hijack hands the connection over to the upgrader, counting the bytes written to it.
+func (w meteredWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &meteredConn{Conn: conn, handler: w.handler, compression: w.compression}, rw, nil
+}
+
+func (c *meteredConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(int64(n))
+	return n, err
+}
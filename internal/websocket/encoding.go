@@ -0,0 +1,273 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"unsafe"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+/*
+Message Encodings
+
+Clients choose the encoding of their connection with the WebSocket subprotocol: json,
+msgpack or cbor. The first of msgpack, cbor and json offered by the client is selected;
+clients offering none of them, like the clients older than the binary encodings, use
+JSON. JSON messages are sent in text frames, MessagePack and CBOR messages in binary
+frames. Text frames received on a binary connection are read as JSON.
+
+JSON stays the canonical form of the messages: game states are validated, stored and
+published in JSON, and a message is converted when written to a connection using
+another encoding. The messages of the broadcaster are converted once per encoding,
+whatever the number of connections receiving them: the hub hands the same slice to
+every subscription of a topic, so the conversions are cached by slice. The broadcaster
+publishes its own copy of each message, which no subscriber modifies, so a cached slice
+keeps its content. They are cached
+as prepared messages, whose frames are also built once per compression setting.
+*/
+
+// Encoding is the format of the messages of a connection
+type Encoding string
+
+const (
+	EncodingJSON        Encoding = "json"
+	EncodingMessagePack Encoding = "msgpack"
+	EncodingCBOR        Encoding = "cbor"
+)
+
+// subprotocols are the subprotocols of the encodings, in order of preference
+var subprotocols = []string{string(EncodingMessagePack), string(EncodingCBOR), string(EncodingJSON)}
+
+// encodedCacheSize bounds the broadcast messages whose conversions are cached
+const encodedCacheSize = 1024
+
+var (
+	cborEncoding, _ = cbor.EncOptions{ShortestFloat: cbor.ShortestFloat16}.EncMode()
+	cborDecoding, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+)
+
+// broadcastEncodings caches the conversions of the messages of the broadcaster
+var broadcastEncodings = newEncodedCache(encodedCacheSize)
+
+// encodingOf returns the encoding negotiated by a connection.
+func encodingOf(conn *websocket.Conn) Encoding {
+	switch Encoding(conn.Subprotocol()) {
+	case EncodingMessagePack:
+		return EncodingMessagePack
+	case EncodingCBOR:
+		return EncodingCBOR
+	}
+	return EncodingJSON
+}
+
+// writeMessage writes a message in the encoding of a connection.
+func writeMessage(conn *websocket.Conn, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return writeData(conn, data)
+}
+
+// writeData writes a JSON message in the encoding of a connection.
+func writeData(conn *websocket.Conn, data []byte) error {
+	encoding := encodingOf(conn)
+	encoded, err := encode(encoding, data)
+	if err != nil {
+		return err
+	}
+	return writeFrame(conn, len(encoded), func() error {
+		return conn.WriteMessage(frameType(encoding), encoded)
+	})
+}
+
+// writeBroadcast writes a JSON message of the broadcaster in the encoding of a
+// connection, preparing it once per encoding.
+func writeBroadcast(conn *websocket.Conn, data []byte) error {
+	return writeGameMessage(conn, "", data)
+}
+
+// writeGameMessage writes a JSON message of the broadcaster for a game in a gameMessage
+// message, in the encoding of a connection, or as is when gameID is empty. The message
+// is prepared once per encoding.
+func writeGameMessage(conn *websocket.Conn, gameID string, data []byte) error {
+	prepared, err := broadcastEncodings.get(data, gameID, encodingOf(conn))
+	if err != nil {
+		return err
+	}
+	return writeFrame(conn, prepared.size, func() error {
+		return conn.WritePreparedMessage(prepared.message)
+	})
+}
+
+// readMessage reads a message in the encoding of a connection into v, like ReadJSON.
+func readMessage(conn *websocket.Conn, v interface{}) error {
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	if messageType == websocket.BinaryMessage {
+		if data, err = decode(encodingOf(conn), data); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// encode converts a JSON message to an encoding.
+func encode(encoding Encoding, data []byte) ([]byte, error) {
+	if encoding == EncodingJSON {
+		return data, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	value = numbers(value)
+
+	if encoding == EncodingCBOR {
+		return cborEncoding.Marshal(value)
+	}
+	var buffer bytes.Buffer
+	encoder := msgpack.NewEncoder(&buffer)
+	encoder.UseCompactInts(true)
+	encoder.UseCompactFloats(true)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// decode converts a message of an encoding to JSON. Maps must have string keys.
+func decode(encoding Encoding, data []byte) ([]byte, error) {
+	var value interface{}
+	switch encoding {
+	case EncodingMessagePack:
+		if err := msgpack.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+	case EncodingCBOR:
+		if err := cborDecoding.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+	default:
+		return data, nil
+	}
+	return json.Marshal(value)
+}
+
+// numbers replaces the JSON numbers of a decoded value by integers when they are whole,
+// so that they are encoded compactly, and by floats otherwise.
+func numbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, element := range v {
+			v[key] = numbers(element)
+		}
+	case []interface{}:
+		for i, element := range v {
+			v[i] = numbers(element)
+		}
+	}
+	return value
+}
+
+// frameType returns the type of the frames of an encoding.
+func frameType(encoding Encoding) int {
+	if encoding == EncodingJSON {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
+
+func newEncodedCache(size int) *encodedCache {
+	return &encodedCache{
+		entries: make(map[*byte]*encodedMessage, size),
+		order:   make([]*byte, size),
+	}
+}
+
+// get returns a JSON message of the broadcaster prepared in an encoding, tagged with
+// gameID in a gameMessage message when gameID is not empty. Each message is prepared
+// once while cached.
+func (c *encodedCache) get(data []byte, gameID string, encoding Encoding) (preparedMessage, error) {
+	if len(data) == 0 {
+		return prepare(data, gameID, encoding)
+	}
+	key := unsafe.SliceData(data)
+
+	c.mutex.Lock()
+	entry, exists := c.entries[key]
+	// The entry holds its message, so no other message can have the same address; the
+	// messages of the broadcaster are never modified, so only a shorter or longer slice of
+	// the same message can
+	if !exists || len(entry.data) != len(data) {
+		if !exists {
+			if evicted := c.order[c.next]; evicted != nil {
+				delete(c.entries, evicted)
+			}
+			c.order[c.next] = key
+			c.next = (c.next + 1) % len(c.order)
+		}
+		entry = &encodedMessage{data: data, prepared: make(map[encodedVariant]preparedMessage)}
+		c.entries[key] = entry
+	}
+	c.mutex.Unlock()
+
+	// Connections waiting for the same message wait for the first one to prepare it
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+	variant := encodedVariant{gameID: gameID, encoding: encoding}
+	if prepared, done := entry.prepared[variant]; done {
+		return prepared, nil
+	}
+	prepared, err := prepare(data, gameID, encoding)
+	if err != nil {
+		return preparedMessage{}, err
+	}
+	entry.prepared[variant] = prepared
+	return prepared, nil
+}
+
+// prepare converts a JSON message to an encoding, tagged with gameID in a gameMessage
+// message when gameID is not empty, and prepares its frames.
+func prepare(data []byte, gameID string, encoding Encoding) (preparedMessage, error) {
+	encoded, err := convert(data, gameID, encoding)
+	if err != nil {
+		return preparedMessage{}, err
+	}
+	message, err := websocket.NewPreparedMessage(frameType(encoding), encoded)
+	if err != nil {
+		return preparedMessage{}, err
+	}
+	return preparedMessage{message: message, size: len(encoded)}, nil
+}
+
+// convert converts a JSON message to an encoding, tagged with gameID in a gameMessage
+// message when gameID is not empty.
+func convert(data []byte, gameID string, encoding Encoding) ([]byte, error) {
+	if gameID != "" {
+		tagged, err := json.Marshal(GameMessage{
+			Type:    "gameMessage",
+			GameID:  gameID,
+			Message: data,
+		})
+		if err != nil {
+			return nil, err
+		}
+		data = tagged
+	}
+	return encode(encoding, data)
+}
@@ -0,0 +1,117 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+)
+
+// benchmarkViewers are the audiences of the broadcast benchmarks
+var benchmarkViewers = []int{1, 100, 10000}
+
+// discardConn is a network connection dropping what is written to it.
+type discardConn struct {
+	net.Conn
+}
+
+func (discardConn) Write(p []byte) (int, error)      { return len(p), nil }
+func (discardConn) Close() error                     { return nil }
+func (discardConn) SetDeadline(time.Time) error      { return nil }
+func (discardConn) SetWriteDeadline(time.Time) error { return nil }
+
+// hijackRecorder is a response writer handing a discardConn over to the upgrader.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (h hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn := discardConn{}
+	return conn, bufio.NewReadWriter(bufio.NewReader(strings.NewReader("")), bufio.NewWriter(conn)), nil
+}
+
+// newBenchmarkViewers returns server connections negotiating an encoding, and compression
+// when compressed, whose frames are discarded.
+func newBenchmarkViewers(b *testing.B, count int, encoding Encoding, compressed bool) []*websocket.Conn {
+	upgrader := websocket.Upgrader{
+		Subprotocols:      subprotocols,
+		EnableCompression: compressed,
+	}
+	conns := make([]*websocket.Conn, count)
+	for i := range conns {
+		r := httptest.NewRequest(http.MethodGet, "/viewGame", nil)
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		r.Header.Set("Sec-WebSocket-Protocol", string(encoding))
+		if compressed {
+			r.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate")
+		}
+		conn, err := upgrader.Upgrade(hijackRecorder{httptest.NewRecorder()}, r, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		conns[i] = conn
+	}
+	return conns
+}
+
+// benchmarkState returns the state of a Yams game of 4 players, as sent to its viewers.
+func benchmarkState() map[string]interface{} {
+	var state interface{}
+	json.Unmarshal(game.YamsScorecard([]string{"alice", "bob", "carol", "dave"}), &state)
+	return map[string]interface{}{"type": "gameState", "gameState": state}
+}
+
+// BenchmarkBroadcast sends a game state to every viewer of a game: perViewer serializes
+// it for each viewer, as WriteJSON does, while prepared serializes it once and writes
+// the same prepared message to every viewer.
+func BenchmarkBroadcast(b *testing.B) {
+	state := benchmarkState()
+	for _, viewers := range benchmarkViewers {
+		for _, encoding := range []Encoding{EncodingJSON, EncodingMessagePack} {
+			for _, compressed := range []bool{false, true} {
+				name := fmt.Sprintf("viewers=%d/%s/compressed=%t", viewers, encoding, compressed)
+				b.Run(name+"/perViewer", func(b *testing.B) {
+					conns := newBenchmarkViewers(b, viewers, encoding, compressed)
+					b.ReportAllocs()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						for _, conn := range conns {
+							if err := writeMessage(conn, state); err != nil {
+								b.Fatal(err)
+							}
+						}
+					}
+				})
+				b.Run(name+"/prepared", func(b *testing.B) {
+					conns := newBenchmarkViewers(b, viewers, encoding, compressed)
+					b.ReportAllocs()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						// Each state is published once, then handed to every subscription
+						data, err := json.Marshal(state)
+						if err != nil {
+							b.Fatal(err)
+						}
+						for _, conn := range conns {
+							if err := writeBroadcast(conn, data); err != nil {
+								b.Fatal(err)
+							}
+						}
+					}
+				})
+			}
+		}
+	}
+}
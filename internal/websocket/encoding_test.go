@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEncodingRoundTrip vérifie la conversion des messages JSON dans chaque encodage
+func TestEncodingRoundTrip(t *testing.T) {
+	message := []byte(`{"type":"gameState","gameState":{"score":42,"ratio":0.25,"big":12345678901,"dice":[1,6],"name":"yams","over":false,"bonus":null}}`)
+
+	for _, encoding := range []Encoding{EncodingJSON, EncodingMessagePack, EncodingCBOR} {
+		t.Run(string(encoding), func(t *testing.T) {
+			encoded, err := encode(encoding, message)
+			require.NoError(t, err)
+			decoded, err := decode(encoding, encoded)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(message), string(decoded))
+		})
+	}
+
+	// Les encodages binaires sont plus compacts que le JSON
+	for _, encoding := range []Encoding{EncodingMessagePack, EncodingCBOR} {
+		encoded, err := encode(encoding, message)
+		require.NoError(t, err)
+		assert.Less(t, len(encoded), len(message), encoding)
+	}
+
+	_, err := encode(EncodingCBOR, []byte(`{"score":`))
+	assert.Error(t, err)
+	_, err = decode(EncodingMessagePack, []byte{0xc1})
+	assert.Error(t, err)
+}
+
+// TestEncodedCache vérifie qu'un message diffusé est préparé une fois par encodage
+func TestEncodedCache(t *testing.T) {
+	cache := newEncodedCache(2)
+	first := []byte(`{"score":1}`)
+
+	prepared, err := cache.get(first, "", EncodingCBOR)
+	require.NoError(t, err)
+	again, err := cache.get(first, "", EncodingCBOR)
+	require.NoError(t, err)
+	assert.Same(t, prepared.message, again.message)
+	asJSON, err := cache.get(first, "", EncodingJSON)
+	require.NoError(t, err)
+	assert.NotSame(t, prepared.message, asJSON.message)
+	assert.Equal(t, len(first), asJSON.size)
+
+	// Chaque partie enveloppant le message a sa propre conversion
+	tagged, err := cache.get(first, "game-1", EncodingJSON)
+	require.NoError(t, err)
+	assert.NotSame(t, asJSON.message, tagged.message)
+	converted, err := convert(first, "game-1", EncodingJSON)
+	require.NoError(t, err)
+	var message GameMessage
+	require.NoError(t, json.Unmarshal(converted, &message))
+	assert.Equal(t, GameMessage{Type: "gameMessage", GameID: "game-1", Message: first}, message)
+
+	// Les messages les plus anciens sont oubliés au-delà de la taille du cache
+	cache.get([]byte(`{"score":2}`), "", EncodingCBOR)
+	cache.get([]byte(`{"score":3}`), "", EncodingCBOR)
+	cache.mutex.Lock()
+	assert.Len(t, cache.entries, 2)
+	cache.mutex.Unlock()
+	again, err = cache.get(first, "", EncodingCBOR)
+	require.NoError(t, err)
+	assert.NotSame(t, prepared.message, again.message)
+
+	// Une tranche du même message remplace son entrée sans occuper une autre place
+	prefix, err := cache.get(first[:4], "", EncodingJSON)
+	require.NoError(t, err)
+	assert.Equal(t, 4, prefix.size)
+	cache.get([]byte(`{"score":4}`), "", EncodingCBOR)
+	cached, err := cache.get(first[:4], "", EncodingJSON)
+	require.NoError(t, err)
+	assert.Same(t, prefix.message, cached.message)
+}
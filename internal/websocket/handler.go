@@ -1,13 +1,23 @@
 package websocket
 
 import (
+	"compress/flate"
+	"context"
+	"errors"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/vincentvignali/yamsAttackSocket/internal/api"
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
 	"github.com/vincentvignali/yamsAttackSocket/internal/game"
 	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+	"github.com/vincentvignali/yamsAttackSocket/internal/tracing"
 )
 
 /*
@@ -46,15 +56,42 @@ const (
 	HostDisconnected
 )
 
+// notifyTimeout bounds the publication of connection events to the viewers
+const notifyTimeout = 5 * time.Second
+
+// DefaultConfig returns the settings used by NewGameWSHandler.
+func DefaultConfig() Config {
+	return Config{
+		ReadBufferSize:       1024,
+		WriteBufferSize:      1024,
+		Compression:          true,
+		CompressionLevel:     flate.BestSpeed,
+		CompressionThreshold: 512,
+		WriteTimeout:         10 * time.Second,
+	}
+}
+
 func NewGameWSHandler(gameManager *game.GameManager) *GameWSHandler {
+	return NewGameWSHandlerWithConfig(gameManager, DefaultConfig())
+}
+
+func NewGameWSHandlerWithConfig(gameManager *game.GameManager, config Config) *GameWSHandler {
+	checkOrigin := config.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = func(r *http.Request) bool {
+			return true
+		}
+	}
+	
 	return &GameWSHandler{
 		gameManager: gameManager,
+		config:      config,
 		upgrader: websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
+			ReadBufferSize:    config.ReadBufferSize,
+			WriteBufferSize:   config.WriteBufferSize,
+			CheckOrigin:       checkOrigin,
+			Subprotocols:      subprotocols,
+			EnableCompression: config.Compression,
 		},
 	}
 }
@@ -63,7 +100,11 @@ func (h *GameWSHandler) HostGame(w http.ResponseWriter, r *http.Request) {
 	gameID := r.URL.Query().Get("gameId")
 	hostID := r.URL.Query().Get("hostId")
 
+	connectCtx, connectSpan := tracing.Tracer().Start(tracing.Extract(r), "HostGame.connect",
+		trace.WithAttributes(tracing.AttrGameID.String(gameID), tracing.AttrHostID.String(hostID)))
+
 	if gameID == "" {
+		endSpanWithError(connectSpan, api.ErrMissingParam+": gameId")
 		api.HandleError(w, &api.AppError{
 			Code:    http.StatusBadRequest,
 			Message: api.ErrMissingParam + ": gameId",
@@ -71,6 +112,7 @@ func (h *GameWSHandler) HostGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if hostID == "" {
+		endSpanWithError(connectSpan, api.ErrMissingParam+": hostId")
 		api.HandleError(w, &api.AppError{
 			Code:    http.StatusBadRequest,
 			Message: api.ErrMissingParam + ": hostId",
@@ -80,6 +122,7 @@ func (h *GameWSHandler) HostGame(w http.ResponseWriter, r *http.Request) {
 
 	gameObj, err := h.gameManager.GetGame(gameID)
 	if err != nil {
+		endSpanWithError(connectSpan, api.ErrGameNotFound)
 		api.HandleError(w, &api.AppError{
 			Code:    http.StatusNotFound,
 			Message: api.ErrGameNotFound,
@@ -88,6 +131,7 @@ func (h *GameWSHandler) HostGame(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if gameObj.HostPlayerID != hostID {
+		endSpanWithError(connectSpan, api.ErrInvalidHostID)
 		api.HandleError(w, &api.AppError{
 			Code:    http.StatusUnauthorized,
 			Message: api.ErrInvalidHostID,
@@ -95,8 +139,18 @@ func (h *GameWSHandler) HostGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conn, err := h.upgrader.Upgrade(w, r, nil)
+	// Once the host session is open, only the host holding its resume token may connect
+	resumeToken := r.URL.Query().Get("resumeToken")
+	if err := h.gameManager.CheckHostSeat(gameObj, resumeToken); err != nil {
+		appErr := hostSeatError(err)
+		endSpanWithError(connectSpan, appErr.Message)
+		api.HandleError(w, appErr)
+		return
+	}
+
+	conn, err := h.upgrade(w, r)
 	if err != nil {
+		endSpanWithError(connectSpan, api.ErrWebSocketUpgrade)
 		api.HandleError(w, &api.AppError{
 			Code:    http.StatusInternalServerError,
 			Message: api.ErrWebSocketUpgrade,
@@ -104,103 +158,250 @@ func (h *GameWSHandler) HostGame(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	h.gameManager.UpdateOpenConnections(1)
+	defer h.gameManager.UpdateOpenConnections(-1)
+	if h.config.MaxMessageSize > 0 {
+		conn.SetReadLimit(h.config.MaxMessageSize)
+	}
+	h.registerWriteLock(conn)
+	defer h.writeLocks.Delete(conn)
 
-	gameObj.Mutex.Lock()
+	// The seat may have been taken or the game abandoned since the check
+	session, err := h.gameManager.ConnectHost(gameObj, conn, resumeToken)
+	if err != nil {
+		appErr := hostSeatError(err)
+		endSpanWithError(connectSpan, appErr.Message)
+		logger.Warn.Printf("Host connection refused after upgrade (GameID=%s): %v", gameID, err)
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, appErr.Message),
+			time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
 
 	var connectionType string
-	isFirstConnection := gameObj.HostConnectionState == game.HostNeverConnected
-	isReconnection := gameObj.HostConnectionState == game.HostDisconnected
-
-	gameObj.HostConn = conn
-	gameObj.HostConnectionState = game.HostConnected
-	gameObj.LastActivity = time.Now()
-
+	isReconnection := session.Reconnected
 	if isReconnection {
 		connectionType = "reconnected"
-		for i, viewer := range gameObj.Viewers {
-			if err := viewer.WriteJSON(map[string]interface{}{
-				"type":    "hostReconnected",
-				"message": "Host has reconnected to the game",
-			}); err != nil {
-				logger.Debug.Printf("Error notifying viewer %d about host reconnection: %v", i, err)
-			}
-		}
-	} else if isFirstConnection {
+	} else if session.FirstConnection {
 		connectionType = "connected for the first time"
+	} else if session.Replaced != nil {
+		connectionType = "took over its previous connection"
+		h.closeReplacedHost(gameObj, session.Replaced)
 	} else {
 		connectionType = "connected (abnormal state)"
 		logger.Warn.Printf("Host connection in unexpected state: GameID=%s, HostID=%s", gameID, hostID)
 	}
-	gameObj.Mutex.Unlock()
 
-	h.gameManager.Stats.Mutex.Lock()
-	h.gameManager.Stats.TotalHostConnections++
-	h.gameManager.Stats.Mutex.Unlock()
+	// The host learns its resume token before any other message
+	h.sendToHost(gameObj, conn, SessionMessage{
+		Type:          "hostSession",
+		ResumeToken:   session.ResumeToken,
+		GracePeriodMs: h.gameManager.HostGracePeriod().Milliseconds(),
+	})
+
+	// Messages for the host (viewerJoined) may come from viewers of any instance
+	hostMessages, err := h.gameManager.Broadcaster().Subscribe(connectCtx, game.HostTopic(gameID))
+	if err != nil {
+		logger.Warn.Printf("Host will not be notified of viewers (GameID=%s): %v", gameID, err)
+	} else {
+		// The forwarding ends before the write lock of the connection is released
+		forwarded := make(chan struct{})
+		defer func() {
+			hostMessages.Close()
+			<-forwarded
+		}()
+		go func() {
+			defer close(forwarded)
+			h.forwardToHost(gameObj, conn, hostMessages)
+		}()
+	}
 
+	h.announceHost(connectCtx, gameObj, session)
 	logger.Info.Printf("Host %s: GameID=%s, HostID=%s", connectionType, gameID, hostID)
+	connectSpan.SetAttributes(tracing.AttrConnection.String(connectionType))
+	connectSpan.End()
+
+	// Each update is traced as its own root span, linked to the connection span
+	// so that a long-lived host session does not produce a single endless trace.
+	connectLink := trace.LinkFromContext(connectCtx)
+
+	messageBucket := api.NewTokenBucket(h.config.MessageLimit)
 
 	for {
 		var message HostMessage
-		if err := conn.ReadJSON(&message); err != nil {
+		if err := readMessage(conn, &message); err != nil {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				logger.Warn.Printf("Host message exceeds %d bytes, closing connection (GameID=%s)", h.config.MaxMessageSize, gameID)
+			}
 			logger.Error.Printf("Host disconnected (GameID=%s): %v", gameID, err)
 			break
 		}
+		if !h.gameManager.IsCurrentHost(gameObj, session.Generation) {
+			logger.Info.Printf("Message of a replaced host connection dropped: GameID=%s", gameID)
+			break
+		}
 
-		logger.Debug.Printf("Update received: GameID=%s", gameID)
-
-		gameObj.Mutex.Lock()
-		gameObj.GameState = message.GameState
-		gameObj.LastActivity = time.Now()
-		viewerCount := len(gameObj.Viewers)
-
-		var failedViewers []int
-		for i, viewer := range gameObj.Viewers {
-			if err := viewer.WriteJSON(map[string]interface{}{
-				"type":      "gameState",
-				"gameState": gameObj.GameState,
-			}); err != nil {
-				logger.Debug.Printf("Error sending to viewer %d: %v", i, err)
-				failedViewers = append(failedViewers, i)
-			}
+		if allowed, wait := messageBucket.Allow(); !allowed {
+			logger.Warn.Printf("Host message dropped, rate limit reached: GameID=%s", gameID)
+			h.sendToHost(gameObj, conn, ErrorMessage{
+				Type:         "error",
+				Code:         ErrCodeRateLimited,
+				Message:      api.ErrRateLimited,
+				RetryAfterMs: wait.Milliseconds(),
+			})
+			continue
 		}
 
-		if len(failedViewers) > 0 {
-			for i := len(failedViewers) - 1; i >= 0; i-- {
-				index := failedViewers[i]
-				gameObj.Viewers = append(gameObj.Viewers[:index], gameObj.Viewers[index+1:]...)
-				logger.Warn.Printf("Viewer removed after send failure: GameID=%s, index=%d", gameID, index)
-			}
-			viewerCount = len(gameObj.Viewers)
+		reply, current := h.applyHostMessage(r.Context(), connectLink, gameObj, session.Generation, message)
+		if !current {
+			break
+		}
+		if reply != nil {
+			h.sendToHost(gameObj, conn, reply)
 		}
+	}
 
-		gameObj.Mutex.Unlock()
+	h.disconnectHost(gameObj, session.Generation)
+}
 
-		logger.Debug.Printf("Game state broadcast to %d viewers", viewerCount)
+// applyHostMessage applies a message of the host connection of a generation, and returns
+// the reply to send to the host, if any. It returns false when the connection was
+// replaced by a newer one meanwhile.
+func (h *GameWSHandler) applyHostMessage(ctx context.Context, connectLink trace.Link, gameObj *game.Game, generation uint64, message HostMessage) (interface{}, bool) {
+	gameID := gameObj.GameID
+	switch message.Type {
+	case "", MessageGameState:
+	case MessageEndGame:
+		return h.endGame(gameObj, message), true
+	case MessagePause, MessageResume:
+		return h.pauseOrResume(gameObj, message), true
+	default:
+		logger.Warn.Printf("Host message of unknown type %q dropped: GameID=%s", message.Type, gameID)
+		return ErrorMessage{
+			Type:    "error",
+			Code:    ErrCodeUnknownMessage,
+			Message: api.ErrUnknownMessageType + ": " + message.Type,
+		}, true
 	}
 
+	if violations := game.ValidateState(gameObj.Schema, message.GameState); len(violations) > 0 {
+		logger.Warn.Printf("Host update rejected, %d schema violations: GameID=%s, Schema=%s", len(violations), gameID, gameObj.SchemaName)
+		return ErrorMessage{
+			Type:       "error",
+			Code:       ErrCodeSchemaViolation,
+			Message:    api.ErrSchemaViolation,
+			Violations: violations,
+		}, true
+	}
+
+	logger.Debug.Printf("Update received: GameID=%s", gameID)
+
+	updateCtx, updateSpan := tracing.Tracer().Start(ctx, "HostGame.update",
+		trace.WithNewRoot(),
+		trace.WithLinks(connectLink),
+		trace.WithAttributes(
+			tracing.AttrGameID.String(gameID),
+			tracing.AttrPayloadSize.Int(len(message.GameState)),
+		))
+
 	gameObj.Mutex.Lock()
-	gameObj.HostConn = nil
-	gameObj.HostConnectionState = game.HostDisconnected
+	// A replaced connection may have passed the check above before the takeover
+	if gameObj.HostGeneration != generation {
+		gameObj.Mutex.Unlock()
+		updateSpan.End()
+		return nil, false
+	}
+	// The state of a finished or paused game is frozen
+	if gameObj.Status != game.StatusActive {
+		rejection := statusRejection(gameObj.Status)
+		gameObj.Mutex.Unlock()
+		updateSpan.SetStatus(codes.Error, rejection.Message)
+		updateSpan.End()
+		return rejection, true
+	}
+	gameObj.GameState = message.GameState
 	gameObj.LastActivity = time.Now()
+	viewerCount := len(gameObj.Viewers)
 	gameObj.Mutex.Unlock()
 
-	gameObj.Mutex.Lock()
-	for i, viewer := range gameObj.Viewers {
-		if err := viewer.WriteJSON(map[string]interface{}{
-			"type":    "hostDisconnected",
-			"message": "Host has disconnected",
-		}); err != nil {
-			logger.Debug.Printf("Error sending to viewer %d: %v", i, err)
-		}
+	// The state is published once; each viewer handler, on this instance or another,
+	// forwards it to its connection
+	publishCtx, publishSpan := tracing.Tracer().Start(updateCtx, "HostGame.publish",
+		trace.WithAttributes(tracing.AttrViewerCount.Int(viewerCount)))
+	if err := h.gameManager.PublishState(publishCtx, gameID, message.GameState); err != nil {
+		logger.Error.Printf("Cannot publish game state (GameID=%s): %v", gameID, err)
+		publishSpan.RecordError(err)
+		publishSpan.SetStatus(codes.Error, "publish failed")
 	}
-	gameObj.Mutex.Unlock()
+	publishSpan.End()
+	h.gameManager.Emit(game.EventStateUpdated, gameID, map[string]interface{}{
+		"gameState": message.GameState,
+	})
 
+	updateSpan.SetAttributes(tracing.AttrViewerCount.Int(viewerCount))
+	updateSpan.End()
+
+	logger.Debug.Printf("Game state published, %d local viewers", viewerCount)
+	return nil, true
+}
+
+// announceHost tells the viewers and the event subscribers that a host session of a game
+// is open.
+func (h *GameWSHandler) announceHost(ctx context.Context, gameObj *game.Game, session game.HostSession) {
+	if session.Reconnected {
+		h.notifyViewers(ctx, gameObj.GameID, map[string]interface{}{
+			"type":    "hostReconnected",
+			"message": "Host has reconnected to the game",
+		})
+	}
+
+	h.gameManager.Stats.Mutex.Lock()
+	h.gameManager.Stats.TotalHostConnections++
+	h.gameManager.Stats.Mutex.Unlock()
+
+	h.gameManager.Emit(game.EventHostConnected, gameObj.GameID, map[string]interface{}{
+		"hostPlayerId": gameObj.HostPlayerID,
+		"reconnected":  session.Reconnected,
+		"tookOver":     session.Replaced != nil,
+	})
+}
+
+// disconnectHost records the end of the host connection of a generation, and tells the
+// viewers and the event subscribers.
+func (h *GameWSHandler) disconnectHost(gameObj *game.Game, generation uint64) {
+	// Viewers are told how long the host has to come back before the game is abandoned
+	disconnected := HostDisconnectedMessage{
+		Type:    "hostDisconnected",
+		Message: "Host has disconnected",
+	}
+	eventData := map[string]interface{}{
+		"hostPlayerId": gameObj.HostPlayerID,
+	}
+	deadline, abandonable, err := h.gameManager.DisconnectHost(gameObj, generation)
+	if errors.Is(err, game.ErrStaleHostConnection) {
+		// The host is still connected through the connection that replaced this one
+		return
+	}
+	if abandonable {
+		disconnected.GracePeriodMs = h.gameManager.HostGracePeriod().Milliseconds()
+		disconnected.ReconnectDeadline = &deadline
+		eventData["gracePeriodMs"] = disconnected.GracePeriodMs
+		eventData["reconnectDeadline"] = deadline
+	}
+
+	h.notifyViewers(context.Background(), gameObj.GameID, disconnected)
+	h.gameManager.Emit(game.EventHostDisconnected, gameObj.GameID, eventData)
 }
 
 func (h *GameWSHandler) ViewGame(w http.ResponseWriter, r *http.Request) {
 	gameID := r.URL.Query().Get("gameId")
 
+	connectCtx, connectSpan := tracing.Tracer().Start(tracing.Extract(r), "ViewGame.connect",
+		trace.WithAttributes(tracing.AttrGameID.String(gameID)))
+
 	if gameID == "" {
+		endSpanWithError(connectSpan, api.ErrMissingParam+": gameId")
 		api.HandleError(w, &api.AppError{
 			Code:    http.StatusBadRequest,
 			Message: api.ErrMissingParam + ": gameId",
@@ -208,17 +409,60 @@ func (h *GameWSHandler) ViewGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	gameObj, err := h.gameManager.GetGame(gameID)
+	// Subscribe before reading the current state, so that no update is missed in between
+	gameMessages, err := h.gameManager.Broadcaster().Subscribe(connectCtx, game.GameTopic(gameID))
 	if err != nil {
+		endSpanWithError(connectSpan, api.ErrBroadcastUnavailable)
+		api.HandleError(w, &api.AppError{
+			Code:    http.StatusServiceUnavailable,
+			Message: api.ErrBroadcastUnavailable,
+			Err:     err,
+		})
+		return
+	}
+	defer gameMessages.Close()
+
+	// The game may be owned by another instance: its state is then the retained snapshot
+	initialState, err := h.gameManager.CurrentState(connectCtx, gameID)
+	if errors.Is(err, broadcast.ErrNoSnapshot) {
+		endSpanWithError(connectSpan, api.ErrGameNotFound)
 		api.HandleError(w, &api.AppError{
 			Code:    http.StatusNotFound,
 			Message: api.ErrGameNotFound,
 		})
 		return
 	}
+	if err != nil {
+		endSpanWithError(connectSpan, api.ErrBroadcastUnavailable)
+		api.HandleError(w, &api.AppError{
+			Code:    http.StatusServiceUnavailable,
+			Message: api.ErrBroadcastUnavailable,
+			Err:     err,
+		})
+		return
+	}
+	// gameObj is nil when the game is owned by another instance
+	gameObj, _ := h.gameManager.GetGame(gameID)
+
+	// A player holding a seat of the game is announced to the host; seats are checked by
+	// the instance holding the game, elsewhere the player joins as an anonymous viewer
+	playerID := r.URL.Query().Get("playerId")
+	if playerID != "" && gameObj != nil {
+		if err := h.gameManager.CheckPlayerSeat(gameObj, playerID, r.URL.Query().Get("playerToken")); err != nil {
+			endSpanWithError(connectSpan, api.ErrInvalidPlayerToken)
+			api.HandleError(w, &api.AppError{
+				Code:    http.StatusUnauthorized,
+				Message: api.ErrInvalidPlayerToken,
+			})
+			return
+		}
+	} else {
+		playerID = ""
+	}
 
-	conn, err := h.upgrader.Upgrade(w, r, nil)
+	conn, err := h.upgrade(w, r)
 	if err != nil {
+		endSpanWithError(connectSpan, api.ErrWebSocketUpgrade)
 		api.HandleError(w, &api.AppError{
 			Code:    http.StatusInternalServerError,
 			Message: api.ErrWebSocketUpgrade,
@@ -226,36 +470,57 @@ func (h *GameWSHandler) ViewGame(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	h.gameManager.UpdateOpenConnections(1)
+	defer h.gameManager.UpdateOpenConnections(-1)
+	if h.config.MaxMessageSize > 0 {
+		conn.SetReadLimit(h.config.MaxMessageSize)
+	}
 
 	h.gameManager.Stats.Mutex.Lock()
 	h.gameManager.Stats.TotalHostConnections++
 	h.gameManager.Stats.Mutex.Unlock()
 
-	if err := conn.WriteJSON(map[string]interface{}{
-		"type":      "gameState",
-		"gameState": gameObj.GameState,
-	}); err != nil {
+	if err := writeBroadcast(conn, initialState); err != nil {
 		logger.Error.Printf("Error sending initial state to viewer: %v", err)
+		endSpanWithError(connectSpan, "initial state not delivered")
 		conn.Close()
 		return
 	}
 
+	viewerJoined := map[string]string{
+		"type": "viewerJoined",
+	}
+	if playerID != "" {
+		viewerJoined["playerId"] = playerID
+	}
+	if err := h.gameManager.PublishToHost(connectCtx, gameID, viewerJoined); err != nil {
+		logger.Warn.Printf("Unable to notify host of new viewer: %v", err)
+	}
+
 	viewerCount := 0
-	gameObj.Mutex.Lock()
-	gameObj.LastActivity = time.Now()
-	if gameObj.HostConn != nil {
-		if err := gameObj.HostConn.WriteJSON(map[string]string{
-			"type": "viewerJoined",
-		}); err != nil {
-			logger.Warn.Printf("Unable to notify host of new viewer: %v", err)
-		}
+	if gameObj != nil {
+		gameObj.Mutex.Lock()
+		gameObj.LastActivity = time.Now()
+		gameObj.Viewers = append(gameObj.Viewers, conn)
+		viewerCount = len(gameObj.Viewers)
+		gameObj.Mutex.Unlock()
+		logger.Info.Printf("New viewer connected: GameID=%s (total: %d viewers)", gameID, viewerCount)
+	} else {
+		logger.Info.Printf("New viewer connected to a game hosted by another instance: GameID=%s", gameID)
 	}
+	h.gameManager.Emit(game.EventViewerJoined, gameID, map[string]interface{}{
+		"localViewers": viewerCount,
+	})
+	connectSpan.SetAttributes(tracing.AttrViewerCount.Int(viewerCount))
+	connectSpan.End()
 
-	gameObj.Viewers = append(gameObj.Viewers, conn)
-	viewerCount = len(gameObj.Viewers)
-	gameObj.Mutex.Unlock()
+	forwardDone := make(chan struct{})
+	go func() {
+		defer close(forwardDone)
+		forwardToViewer(conn, gameMessages, gameID)
+	}()
 
-	logger.Info.Printf("New viewer connected: GameID=%s (total: %d viewers)", gameID, viewerCount)
+	messageBucket := api.NewTokenBucket(h.config.MessageLimit)
 
 	for {
 		_, _, err := conn.ReadMessage()
@@ -263,8 +528,24 @@ func (h *GameWSHandler) ViewGame(w http.ResponseWriter, r *http.Request) {
 			logger.Debug.Printf("Viewer disconnected: GameID=%s, Error: %v", gameID, err)
 			break
 		}
+		// Viewers are not expected to talk: a flooding viewer is disconnected
+		if allowed, _ := messageBucket.Allow(); !allowed {
+			logger.Warn.Printf("Viewer disconnected, rate limit reached: GameID=%s", gameID)
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, api.ErrRateLimited),
+				time.Now().Add(time.Second))
+			conn.Close()
+			break
+		}
 	}
 
+	gameMessages.Close()
+	<-forwardDone
+
+	if gameObj == nil {
+		logger.Info.Printf("Viewer disconnected: GameID=%s (hosted by another instance)", gameID)
+		return
+	}
 	gameObj.Mutex.Lock()
 	for i, v := range gameObj.Viewers {
 		if v == conn {
@@ -277,3 +558,200 @@ func (h *GameWSHandler) ViewGame(w http.ResponseWriter, r *http.Request) {
 	gameObj.Mutex.Unlock()
 	logger.Info.Printf("Viewer disconnected: GameID=%s (remaining: %d viewers)", gameID, viewerCount)
 }
+
+// endGame finishes the game with the final scores of an endGame message, and returns the
+// gameEnded message or the error to send back to the host.
+func (h *GameWSHandler) endGame(gameObj *game.Game, message HostMessage) interface{} {
+	ended, err := h.gameManager.EndGame(gameObj.GameID, message.FinalScores, message.GameState)
+	if err == nil {
+		return ended
+	}
+
+	logger.Warn.Printf("Game end rejected (GameID=%s): %v", gameObj.GameID, err)
+	var violationErr *game.SchemaViolationError
+	switch {
+	case errors.Is(err, game.ErrGameFinished):
+		return statusRejection(game.StatusFinished)
+	case errors.Is(err, game.ErrGameAbandoned):
+		return statusRejection(game.StatusAbandoned)
+	case errors.Is(err, game.ErrInvalidResults):
+		return ErrorMessage{
+			Type:    "error",
+			Code:    ErrCodeInvalidResults,
+			Message: api.ErrInvalidResults + ": " + strings.TrimPrefix(err.Error(), game.ErrInvalidResults.Error()+": "),
+		}
+	case errors.As(err, &violationErr):
+		return ErrorMessage{
+			Type:       "error",
+			Code:       ErrCodeSchemaViolation,
+			Message:    api.ErrSchemaViolation,
+			Violations: violationErr.Violations,
+		}
+	}
+	return nil
+}
+
+// pauseOrResume pauses or resumes the game, and returns the gamePaused or gameResumed
+// message or the error to send back to the host.
+func (h *GameWSHandler) pauseOrResume(gameObj *game.Game, message HostMessage) interface{} {
+	var reply interface{}
+	var err error
+	if message.Type == MessagePause {
+		expectedDuration := time.Duration(message.ExpectedDurationMs) * time.Millisecond
+		reply, err = h.gameManager.PauseGame(gameObj.GameID, message.Reason, expectedDuration)
+	} else {
+		reply, err = h.gameManager.ResumeGame(gameObj.GameID)
+	}
+	if err == nil {
+		return reply
+	}
+
+	logger.Warn.Printf("Host %s rejected (GameID=%s): %v", message.Type, gameObj.GameID, err)
+	switch {
+	case errors.Is(err, game.ErrGamePaused):
+		return statusRejection(game.StatusPaused)
+	case errors.Is(err, game.ErrGameFinished):
+		return statusRejection(game.StatusFinished)
+	case errors.Is(err, game.ErrGameAbandoned):
+		return statusRejection(game.StatusAbandoned)
+	case errors.Is(err, game.ErrGameNotPaused):
+		return ErrorMessage{
+			Type:    "error",
+			Code:    ErrCodeGameNotPaused,
+			Message: api.ErrGameNotPaused,
+		}
+	case errors.Is(err, game.ErrInvalidPause):
+		return ErrorMessage{
+			Type:    "error",
+			Code:    ErrCodeInvalidPause,
+			Message: api.ErrInvalidPause + ": " + strings.TrimPrefix(err.Error(), game.ErrInvalidPause.Error()+": "),
+		}
+	}
+	return nil
+}
+
+// closeReplacedHost closes a host connection taken over by a new one. The old connection
+// is told why before being closed; its loop then ends without touching the game, its
+// generation being outdated.
+func (h *GameWSHandler) closeReplacedHost(gameObj *game.Game, conn *websocket.Conn) {
+	h.sendToHost(gameObj, conn, map[string]interface{}{
+		"type":    "replacedByNewSession",
+		"message": "Host connected from another session",
+	})
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "replaced by new session"),
+		time.Now().Add(time.Second))
+	conn.Close()
+}
+
+// hostSeatError returns the HTTP error refusing a host connection to a reserved seat.
+func hostSeatError(err error) *api.AppError {
+	if errors.Is(err, game.ErrGameAbandoned) {
+		return &api.AppError{Code: http.StatusGone, Message: api.ErrGameAbandoned}
+	}
+	if errors.Is(err, game.ErrInvalidResumeToken) {
+		return &api.AppError{Code: http.StatusUnauthorized, Message: api.ErrInvalidResumeToken}
+	}
+	if errors.Is(err, game.ErrHostAlreadyConnected) {
+		return &api.AppError{Code: http.StatusConflict, Message: api.ErrHostAlreadyConnected}
+	}
+	return &api.AppError{Code: http.StatusInternalServerError, Message: api.ErrWebSocketUpgrade, Err: err}
+}
+
+// statusRejection returns the error sent to a host whose message is refused because of
+// the status of the game.
+func statusRejection(status game.GameStatus) ErrorMessage {
+	switch status {
+	case game.StatusPaused:
+		return ErrorMessage{Type: "error", Code: ErrCodeGamePaused, Message: api.ErrGamePaused}
+	case game.StatusAbandoned:
+		return ErrorMessage{Type: "error", Code: ErrCodeGameAbandoned, Message: api.ErrGameAbandoned}
+	}
+	return ErrorMessage{Type: "error", Code: ErrCodeGameFinished, Message: api.ErrGameFinished}
+}
+
+// sendToHost writes a message to the host connection. Writes are serialized with the
+// other writes of the connection by its write lock.
+func (h *GameWSHandler) sendToHost(gameObj *game.Game, conn *websocket.Conn, message interface{}) {
+	lock := h.writeLock(conn)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := writeMessage(conn, message); err != nil {
+		logger.Debug.Printf("Error sending to host (GameID=%s): %v", gameObj.GameID, err)
+	}
+}
+
+// forwardToViewer writes the messages of the game topic to a viewer connection until
+// the subscription ends. It is the only writer of the connection once started.
+func forwardToViewer(conn *websocket.Conn, messages *broadcast.Subscription, gameID string) {
+	for data := range messages.Messages() {
+		if err := writeBroadcast(conn, data); err != nil {
+			logger.Debug.Printf("Error sending to viewer (GameID=%s): %v", gameID, err)
+			conn.Close()
+			return
+		}
+		if game.IsGameRemoved(data) {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "game removed"),
+				time.Now().Add(time.Second))
+			conn.Close()
+			return
+		}
+	}
+
+	if err := messages.Err(); err != nil {
+		logger.Warn.Printf("Viewer disconnected (GameID=%s): %v", gameID, err)
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, err.Error()),
+			time.Now().Add(time.Second))
+		conn.Close()
+	}
+}
+
+// forwardToHost writes the messages of the host topic to the host connection until the
+// subscription ends. Writes are serialized with the other writes of the connection by
+// its write lock.
+func (h *GameWSHandler) forwardToHost(gameObj *game.Game, conn *websocket.Conn, messages *broadcast.Subscription) {
+	lock := h.writeLock(conn)
+	for data := range messages.Messages() {
+		lock.Lock()
+		err := writeBroadcast(conn, data)
+		lock.Unlock()
+		if err != nil {
+			logger.Debug.Printf("Error sending to host (GameID=%s): %v", gameObj.GameID, err)
+		}
+	}
+}
+
+// registerWriteLock registers the write lock of a host connection, serializing its
+// writes with those of the connection replacing it. It must be deleted from writeLocks
+// once the connection made its last write.
+func (h *GameWSHandler) registerWriteLock(conn *websocket.Conn) *sync.Mutex {
+	lock := new(sync.Mutex)
+	h.writeLocks.Store(conn, lock)
+	return lock
+}
+
+// writeLock returns the write lock of a host connection.
+func (h *GameWSHandler) writeLock(conn *websocket.Conn) *sync.Mutex {
+	if lock, ok := h.writeLocks.Load(conn); ok {
+		return lock.(*sync.Mutex)
+	}
+	// The connection made its last write: no other write may race with this one
+	return new(sync.Mutex)
+}
+
+// notifyViewers publishes a message to the viewers of a game, logging failures.
+func (h *GameWSHandler) notifyViewers(ctx context.Context, gameID string, message interface{}) {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	if err := h.gameManager.PublishToViewers(ctx, gameID, message); err != nil {
+		logger.Warn.Printf("Cannot notify viewers (GameID=%s): %v", gameID, err)
+	}
+}
+
+// endSpanWithError marks a span as failed before a connection attempt is rejected.
+func endSpanWithError(span trace.Span, description string) {
+	span.SetStatus(codes.Error, description)
+	span.End()
+}
@@ -1,17 +1,33 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"github.com/vincentvignali/yamsAttackSocket/internal/api"
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast/broadcasttest"
 	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/leaderboard"
+	"github.com/vincentvignali/yamsAttackSocket/internal/lobby"
+	"github.com/vincentvignali/yamsAttackSocket/internal/tournament"
+	"github.com/vincentvignali/yamsAttackSocket/internal/tracing"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 // WebSocketTestSuite définit une suite de tests pour les handlers WebSocket
@@ -59,6 +75,15 @@ func (suite *WebSocketTestSuite) ConnectHost() (*websocket.Conn, *http.Response,
 	return dialer.Dial(wsURL, nil)
 }
 
+// ReadSession lit le message hostSession envoyé à l'hôte à la connexion
+func (suite *WebSocketTestSuite) ReadSession(conn *websocket.Conn) SessionMessage {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var session SessionMessage
+	require.NoError(suite.T(), conn.ReadJSON(&session))
+	require.Equal(suite.T(), "hostSession", session.Type)
+	return session
+}
+
 // TestHostGameSuccessfulConnection vérifie qu'un hôte peut se connecter à une partie
 func (suite *WebSocketTestSuite) TestHostGameSuccessfulConnection() {
 	t := suite.T()
@@ -220,7 +245,1315 @@ func (suite *WebSocketTestSuite) TestHostConnectionStateTransitions() {
 	assert.Equal(t, game.HostDisconnected, gameInstance.HostConnectionState)
 }
 
+// TestHostGameRejectedOrigin vérifie qu'une origine refusée ne peut pas ouvrir de socket hôte
+func (suite *WebSocketTestSuite) TestHostGameRejectedOrigin() {
+	t := suite.T()
+
+	config := DefaultConfig()
+	config.CheckOrigin = func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "https://yams.example.com"
+	}
+	suite.WSHandler = NewGameWSHandlerWithConfig(suite.GameManager, config)
+
+	suite.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.WSHandler.HostGame(w, r)
+	}))
+
+	wsURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http") +
+		"?gameId=" + suite.GameID + "&hostId=" + suite.HostID
+
+	// Origine non autorisée : la mise à niveau est refusée
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": []string{"https://evil.test"}})
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	// Origine autorisée : la connexion est établie
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": []string{"https://yams.example.com"}})
+	if assert.NoError(t, err) {
+		conn.Close()
+	}
+}
+
+// TestHostMessageRateLimit vérifie que les messages de l'hôte au-delà de la limite sont rejetés
+func (suite *WebSocketTestSuite) TestHostMessageRateLimit() {
+	t := suite.T()
+
+	config := DefaultConfig()
+	config.MessageLimit = api.RateLimit{Rate: 0.01, Burst: 1}
+	suite.WSHandler = NewGameWSHandlerWithConfig(suite.GameManager, config)
+
+	suite.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.WSHandler.HostGame(w, r)
+	}))
+
+	conn, _, err := suite.ConnectHost()
+	if err != nil {
+		t.Fatalf("Could not connect to WebSocket: %v", err)
+	}
+	defer conn.Close()
+	suite.ReadSession(conn)
+
+	// Le premier message est accepté, le second dépasse la limite
+	assert.NoError(t, conn.WriteJSON(HostMessage{GameState: json.RawMessage(`{"score":1}`)}))
+	assert.NoError(t, conn.WriteJSON(HostMessage{GameState: json.RawMessage(`{"score":2}`)}))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var response ErrorMessage
+	assert.NoError(t, conn.ReadJSON(&response))
+	assert.Equal(t, "error", response.Type)
+	assert.Equal(t, ErrCodeRateLimited, response.Code)
+	assert.Greater(t, response.RetryAfterMs, int64(0))
+
+	gameInstance, _ := suite.GameManager.GetGame(suite.GameID)
+	gameInstance.Mutex.Lock()
+	assert.JSONEq(t, `{"score":1}`, string(gameInstance.GameState))
+	gameInstance.Mutex.Unlock()
+}
+
+// TestHostSchemaViolation vérifie qu'un état invalide est rejeté avec la liste des violations
+func (suite *WebSocketTestSuite) TestHostSchemaViolation() {
+	t := suite.T()
+
+	schema, _ := suite.GameManager.Schemas().Get(game.YamsScorecardSchema)
+	gameID, err := suite.GameManager.CreateGameWithOptions(suite.HostID,
+		[]byte(`{"players":[{"id":"p1","scores":{}}]}`),
+		game.GameOptions{Schema: schema, SchemaName: game.YamsScorecardSchema})
+	assert.NoError(t, err)
+	suite.GameID = gameID
+
+	suite.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.WSHandler.HostGame(w, r)
+	}))
+
+	conn, _, err := suite.ConnectHost()
+	if err != nil {
+		t.Fatalf("Could not connect to WebSocket: %v", err)
+	}
+	defer conn.Close()
+	suite.ReadSession(conn)
+
+	assert.NoError(t, conn.WriteJSON(HostMessage{GameState: json.RawMessage(`{"players":[{"id":"p1","scores":{"yams":49}}]}`)}))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var response ErrorMessage
+	assert.NoError(t, conn.ReadJSON(&response))
+	assert.Equal(t, ErrCodeSchemaViolation, response.Code)
+	if assert.Len(t, response.Violations, 1) {
+		assert.Equal(t, "/players/0/scores/yams", response.Violations[0].Path)
+	}
+
+	// L'état invalide n'a pas été appliqué
+	gameInstance, _ := suite.GameManager.GetGame(gameID)
+	gameInstance.Mutex.Lock()
+	assert.JSONEq(t, `{"players":[{"id":"p1","scores":{}}]}`, string(gameInstance.GameState))
+	gameInstance.Mutex.Unlock()
+}
+
+// TestHostMessageTooBig vérifie qu'un message trop volumineux ferme la connexion
+func (suite *WebSocketTestSuite) TestHostMessageTooBig() {
+	t := suite.T()
+
+	config := DefaultConfig()
+	config.MaxMessageSize = 64
+	suite.WSHandler = NewGameWSHandlerWithConfig(suite.GameManager, config)
+
+	suite.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.WSHandler.HostGame(w, r)
+	}))
+
+	conn, _, err := suite.ConnectHost()
+	if err != nil {
+		t.Fatalf("Could not connect to WebSocket: %v", err)
+	}
+	defer conn.Close()
+	suite.ReadSession(conn)
+
+	padding := strings.Repeat("x", 128)
+	assert.NoError(t, conn.WriteJSON(HostMessage{GameState: json.RawMessage(`{"padding":"` + padding + `"}`)}))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), "unexpected error: %v", err)
+
+	gameInstance, _ := suite.GameManager.GetGame(suite.GameID)
+	gameInstance.Mutex.Lock()
+	assert.Equal(t, suite.InitialState, gameInstance.GameState)
+	gameInstance.Mutex.Unlock()
+}
+
+// TestViewerReceivesUpdates vérifie qu'un spectateur reçoit l'état initial puis les mises à jour
+func (suite *WebSocketTestSuite) TestViewerReceivesUpdates() {
+	t := suite.T()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hostGame", suite.WSHandler.HostGame)
+	mux.HandleFunc("/viewGame", suite.WSHandler.ViewGame)
+	suite.Server = httptest.NewServer(mux)
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+
+	host, _, err := websocket.DefaultDialer.Dial(baseURL+"/hostGame?gameId="+suite.GameID+"&hostId="+suite.HostID, nil)
+	if err != nil {
+		t.Fatalf("Could not connect host: %v", err)
+	}
+	defer host.Close()
+	suite.ReadSession(host)
+
+	viewer, _, err := websocket.DefaultDialer.Dial(baseURL+"/viewGame?gameId="+suite.GameID, nil)
+	if err != nil {
+		t.Fatalf("Could not connect viewer: %v", err)
+	}
+	defer viewer.Close()
+
+	viewer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var initial game.StateMessage
+	assert.NoError(t, viewer.ReadJSON(&initial))
+	assert.JSONEq(t, string(suite.InitialState), string(initial.GameState))
+
+	host.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var joined map[string]string
+	assert.NoError(t, host.ReadJSON(&joined))
+	assert.Equal(t, "viewerJoined", joined["type"])
+
+	assert.NoError(t, host.WriteJSON(HostMessage{GameState: json.RawMessage(`{"score":42}`)}))
+	var update game.StateMessage
+	assert.NoError(t, viewer.ReadJSON(&update))
+	assert.Equal(t, "gameState", update.Type)
+	assert.JSONEq(t, `{"score":42}`, string(update.GameState))
+
+	// La suppression de la partie ferme la connexion des spectateurs
+	suite.GameManager.RemoveGame(suite.GameID)
+	var removed map[string]string
+	assert.NoError(t, viewer.ReadJSON(&removed))
+	assert.Equal(t, "gameRemoved", removed["type"])
+	_, _, err = viewer.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "unexpected error: %v", err)
+}
+
+// TestViewGameUnknownGame vérifie qu'une partie inconnue est refusée avant la mise à niveau
+func (suite *WebSocketTestSuite) TestViewGameUnknownGame() {
+	t := suite.T()
+
+	suite.Server = httptest.NewServer(http.HandlerFunc(suite.WSHandler.ViewGame))
+	wsURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http") + "?gameId=unknown"
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+// TestLifecycleEvents vérifie les événements émis au fil de la vie d'une partie
+func (suite *WebSocketTestSuite) TestLifecycleEvents() {
+	t := suite.T()
+
+	events := make(chan game.Event, 16)
+	unsubscribe := suite.GameManager.Events().Subscribe(func(event game.Event) {
+		events <- event
+	})
+	defer unsubscribe()
+	nextEvent := func() game.Event {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(2 * time.Second):
+			t.Fatal("no event emitted")
+			return game.Event{}
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hostGame", suite.WSHandler.HostGame)
+	mux.HandleFunc("/viewGame", suite.WSHandler.ViewGame)
+	suite.Server = httptest.NewServer(mux)
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+
+	host, _, err := websocket.DefaultDialer.Dial(baseURL+"/hostGame?gameId="+suite.GameID+"&hostId="+suite.HostID, nil)
+	require.NoError(t, err)
+	event := nextEvent()
+	assert.Equal(t, game.EventHostConnected, event.Type)
+	assert.Equal(t, suite.GameID, event.GameID)
+	assert.Equal(t, false, event.Data["reconnected"])
+
+	viewer, _, err := websocket.DefaultDialer.Dial(baseURL+"/viewGame?gameId="+suite.GameID, nil)
+	require.NoError(t, err)
+	defer viewer.Close()
+	event = nextEvent()
+	assert.Equal(t, game.EventViewerJoined, event.Type)
+	assert.Equal(t, 1, event.Data["localViewers"])
+
+	require.NoError(t, host.WriteJSON(HostMessage{GameState: json.RawMessage(`{"score":7}`)}))
+	event = nextEvent()
+	assert.Equal(t, game.EventStateUpdated, event.Type)
+	assert.JSONEq(t, `{"score":7}`, string(event.Data["gameState"].(json.RawMessage)))
+
+	host.Close()
+	event = nextEvent()
+	assert.Equal(t, game.EventHostDisconnected, event.Type)
+	assert.Equal(t, suite.HostID, event.Data["hostPlayerId"])
+}
+
+// TestEndGame vérifie la fin de partie : classement envoyé aux spectateurs et état figé
+func (suite *WebSocketTestSuite) TestEndGame() {
+	t := suite.T()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hostGame", suite.WSHandler.HostGame)
+	mux.HandleFunc("/viewGame", suite.WSHandler.ViewGame)
+	suite.Server = httptest.NewServer(mux)
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+
+	host, _, err := websocket.DefaultDialer.Dial(baseURL+"/hostGame?gameId="+suite.GameID+"&hostId="+suite.HostID, nil)
+	require.NoError(t, err)
+	defer host.Close()
+	suite.ReadSession(host)
+	viewer, _, err := websocket.DefaultDialer.Dial(baseURL+"/viewGame?gameId="+suite.GameID, nil)
+	require.NoError(t, err)
+	defer viewer.Close()
+
+	viewer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var initial game.StateMessage
+	require.NoError(t, viewer.ReadJSON(&initial))
+	host.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var joined map[string]string
+	require.NoError(t, host.ReadJSON(&joined))
+
+	// Des scores invalides sont refusés sans terminer la partie
+	require.NoError(t, host.WriteJSON(HostMessage{Type: MessageEndGame}))
+	var rejected ErrorMessage
+	require.NoError(t, host.ReadJSON(&rejected))
+	assert.Equal(t, ErrCodeInvalidResults, rejected.Code)
+
+	require.NoError(t, host.WriteJSON(HostMessage{
+		Type:        MessageEndGame,
+		GameState:   json.RawMessage(`{"state":"final","score":245}`),
+		FinalScores: []game.FinalScore{{PlayerID: "alice", Score: 198}, {PlayerID: suite.HostID, Score: 245}},
+	}))
+
+	var ended game.GameEndedMessage
+	require.NoError(t, viewer.ReadJSON(&ended))
+	assert.Equal(t, "gameEnded", ended.Type)
+	assert.Equal(t, []game.Standing{{Rank: 1, PlayerID: suite.HostID, Score: 245}, {Rank: 2, PlayerID: "alice", Score: 198}}, ended.Standings)
+	assert.JSONEq(t, `{"state":"final","score":245}`, string(ended.GameState))
+
+	var acknowledged game.GameEndedMessage
+	require.NoError(t, host.ReadJSON(&acknowledged))
+	assert.Equal(t, ended.Standings, acknowledged.Standings)
+
+	// L'état d'une partie terminée est figé
+	require.NoError(t, host.WriteJSON(HostMessage{GameState: json.RawMessage(`{"score":999}`)}))
+	var frozen ErrorMessage
+	require.NoError(t, host.ReadJSON(&frozen))
+	assert.Equal(t, ErrCodeGameFinished, frozen.Code)
+
+	// Un nouveau spectateur reçoit directement le classement final
+	late, _, err := websocket.DefaultDialer.Dial(baseURL+"/viewGame?gameId="+suite.GameID, nil)
+	require.NoError(t, err)
+	defer late.Close()
+	late.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var lateEnded game.GameEndedMessage
+	require.NoError(t, late.ReadJSON(&lateEnded))
+	assert.Equal(t, "gameEnded", lateEnded.Type)
+
+	gameInstance, _ := suite.GameManager.GetGame(suite.GameID)
+	gameInstance.Mutex.Lock()
+	assert.Equal(t, game.StatusFinished, gameInstance.Status)
+	assert.JSONEq(t, `{"state":"final","score":245}`, string(gameInstance.GameState))
+	gameInstance.Mutex.Unlock()
+}
+
+// TestUnknownHostMessage vérifie qu'un type de message inconnu est signalé à l'hôte
+func (suite *WebSocketTestSuite) TestUnknownHostMessage() {
+	t := suite.T()
+
+	suite.Server = httptest.NewServer(http.HandlerFunc(suite.WSHandler.HostGame))
+	host, _, err := suite.ConnectHost()
+	require.NoError(t, err)
+	defer host.Close()
+	suite.ReadSession(host)
+
+	require.NoError(t, host.WriteJSON(HostMessage{Type: "rollDice"}))
+	host.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var rejected ErrorMessage
+	require.NoError(t, host.ReadJSON(&rejected))
+	assert.Equal(t, ErrCodeUnknownMessage, rejected.Code)
+	assert.Contains(t, rejected.Message, "rollDice")
+}
+
+// TestPauseAndResume vérifie la pause et la reprise d'une partie par l'hôte
+func (suite *WebSocketTestSuite) TestPauseAndResume() {
+	t := suite.T()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hostGame", suite.WSHandler.HostGame)
+	mux.HandleFunc("/viewGame", suite.WSHandler.ViewGame)
+	suite.Server = httptest.NewServer(mux)
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+
+	host, _, err := websocket.DefaultDialer.Dial(baseURL+"/hostGame?gameId="+suite.GameID+"&hostId="+suite.HostID, nil)
+	require.NoError(t, err)
+	defer host.Close()
+	suite.ReadSession(host)
+	viewer, _, err := websocket.DefaultDialer.Dial(baseURL+"/viewGame?gameId="+suite.GameID, nil)
+	require.NoError(t, err)
+	defer viewer.Close()
+
+	viewer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var initial game.StateMessage
+	require.NoError(t, viewer.ReadJSON(&initial))
+	host.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var joined map[string]string
+	require.NoError(t, host.ReadJSON(&joined))
+
+	require.NoError(t, host.WriteJSON(HostMessage{Type: MessagePause, Reason: "Back in 5", ExpectedDurationMs: 300000}))
+	var paused game.GamePausedMessage
+	require.NoError(t, viewer.ReadJSON(&paused))
+	assert.Equal(t, "gamePaused", paused.Type)
+	assert.Equal(t, "Back in 5", paused.Reason)
+	assert.Equal(t, int64(300000), paused.ExpectedDurationMs)
+	assert.JSONEq(t, string(suite.InitialState), string(paused.GameState))
+	var acknowledged game.GamePausedMessage
+	require.NoError(t, host.ReadJSON(&acknowledged))
+	assert.Equal(t, "gamePaused", acknowledged.Type)
+
+	// Les mises à jour sont refusées pendant la pause
+	require.NoError(t, host.WriteJSON(HostMessage{GameState: json.RawMessage(`{"score":5}`)}))
+	var rejected ErrorMessage
+	require.NoError(t, host.ReadJSON(&rejected))
+	assert.Equal(t, ErrCodeGamePaused, rejected.Code)
+
+	require.NoError(t, host.WriteJSON(HostMessage{Type: MessageResume}))
+	var resumed game.GameResumedMessage
+	require.NoError(t, viewer.ReadJSON(&resumed))
+	assert.Equal(t, "gameResumed", resumed.Type)
+	require.NoError(t, host.ReadJSON(&resumed))
+
+	require.NoError(t, host.WriteJSON(HostMessage{Type: MessageResume}))
+	require.NoError(t, host.ReadJSON(&rejected))
+	assert.Equal(t, ErrCodeGameNotPaused, rejected.Code)
+
+	require.NoError(t, host.WriteJSON(HostMessage{GameState: json.RawMessage(`{"score":5}`)}))
+	var update game.StateMessage
+	require.NoError(t, viewer.ReadJSON(&update))
+	assert.JSONEq(t, `{"score":5}`, string(update.GameState))
+}
+
+// TestHostReconnectionGracePeriod vérifie la réservation du siège de l'hôte pendant le délai de reconnexion
+func (suite *WebSocketTestSuite) TestHostReconnectionGracePeriod() {
+	t := suite.T()
+
+	config := game.DefaultConfig()
+	config.HostGracePeriod = 300 * time.Millisecond
+	suite.GameManager = game.NewGameManagerWithConfig(config)
+	suite.WSHandler = NewGameWSHandler(suite.GameManager)
+	gameID, err := suite.GameManager.CreateGame(suite.HostID, suite.InitialState)
+	require.NoError(t, err)
+	suite.GameID = gameID
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hostGame", suite.WSHandler.HostGame)
+	mux.HandleFunc("/viewGame", suite.WSHandler.ViewGame)
+	suite.Server = httptest.NewServer(mux)
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+	hostURL := baseURL + "/hostGame?gameId=" + suite.GameID + "&hostId=" + suite.HostID
+
+	host, _, err := websocket.DefaultDialer.Dial(hostURL, nil)
+	require.NoError(t, err)
+	session := suite.ReadSession(host)
+	assert.NotEmpty(t, session.ResumeToken)
+	assert.Equal(t, int64(300), session.GracePeriodMs)
+
+	viewer, _, err := websocket.DefaultDialer.Dial(baseURL+"/viewGame?gameId="+suite.GameID, nil)
+	require.NoError(t, err)
+	defer viewer.Close()
+	viewer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var initial game.StateMessage
+	require.NoError(t, viewer.ReadJSON(&initial))
+
+	// Les spectateurs reçoivent le compte à rebours de la reconnexion
+	host.Close()
+	var disconnected HostDisconnectedMessage
+	require.NoError(t, viewer.ReadJSON(&disconnected))
+	assert.Equal(t, "hostDisconnected", disconnected.Type)
+	assert.Equal(t, int64(300), disconnected.GracePeriodMs)
+	require.NotNil(t, disconnected.ReconnectDeadline)
+	assert.True(t, disconnected.ReconnectDeadline.After(time.Now()))
+
+	// Sans le jeton de reprise, le siège de l'hôte reste réservé
+	_, resp, err := websocket.DefaultDialer.Dial(hostURL, nil)
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	host, _, err = websocket.DefaultDialer.Dial(hostURL+"&resumeToken="+session.ResumeToken, nil)
+	require.NoError(t, err)
+	assert.Equal(t, session.ResumeToken, suite.ReadSession(host).ResumeToken)
+	var reconnected map[string]string
+	require.NoError(t, viewer.ReadJSON(&reconnected))
+	assert.Equal(t, "hostReconnected", reconnected["type"])
+
+	// Passé le délai, la partie est abandonnée
+	host.Close()
+	require.NoError(t, viewer.ReadJSON(&disconnected))
+	var abandoned game.GameAbandonedMessage
+	require.NoError(t, viewer.ReadJSON(&abandoned))
+	assert.Equal(t, "gameAbandoned", abandoned.Type)
+	assert.JSONEq(t, string(suite.InitialState), string(abandoned.GameState))
+
+	_, resp, err = websocket.DefaultDialer.Dial(hostURL+"&resumeToken="+session.ResumeToken, nil)
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusGone, resp.StatusCode)
+	}
+}
+
+// TestDuplicateHostTakeover vérifie qu'une seconde connexion de l'hôte remplace la première
+func (suite *WebSocketTestSuite) TestDuplicateHostTakeover() {
+	t := suite.T()
+
+	events := make(chan game.Event, 4)
+	unsubscribe := suite.GameManager.Events().Subscribe(func(event game.Event) {
+		events <- event
+	}, game.EventHostDisconnected)
+	defer unsubscribe()
+
+	suite.Server = httptest.NewServer(http.HandlerFunc(suite.WSHandler.HostGame))
+	first, _, err := suite.ConnectHost()
+	require.NoError(t, err)
+	defer first.Close()
+	session := suite.ReadSession(first)
+
+	wsURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http") +
+		"?gameId=" + suite.GameID + "&hostId=" + suite.HostID + "&resumeToken=" + session.ResumeToken
+	second, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer second.Close()
+	suite.ReadSession(second)
+
+	// L'ancienne connexion est prévenue puis fermée
+	first.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var replaced map[string]string
+	require.NoError(t, first.ReadJSON(&replaced))
+	assert.Equal(t, "replacedByNewSession", replaced["type"])
+	_, _, err = first.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "unexpected error: %v", err)
+
+	// La boucle de l'ancienne connexion ne marque pas l'hôte déconnecté
+	time.Sleep(100 * time.Millisecond)
+	gameInstance, _ := suite.GameManager.GetGame(suite.GameID)
+	gameInstance.Mutex.Lock()
+	assert.Equal(t, game.HostConnected, gameInstance.HostConnectionState)
+	gameInstance.Mutex.Unlock()
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected %s event", event.Type)
+	default:
+	}
+
+	require.NoError(t, second.WriteJSON(HostMessage{GameState: json.RawMessage(`{"score":12}`)}))
+	time.Sleep(100 * time.Millisecond)
+	gameInstance.Mutex.Lock()
+	assert.JSONEq(t, `{"score":12}`, string(gameInstance.GameState))
+	gameInstance.Mutex.Unlock()
+}
+
+// TestDuplicateHostReject vérifie qu'une seconde connexion de l'hôte est refusée avec la politique reject
+func (suite *WebSocketTestSuite) TestDuplicateHostReject() {
+	t := suite.T()
+
+	config := game.DefaultConfig()
+	config.DuplicateHostPolicy = game.DuplicateHostReject
+	suite.GameManager = game.NewGameManagerWithConfig(config)
+	suite.WSHandler = NewGameWSHandler(suite.GameManager)
+	gameID, err := suite.GameManager.CreateGame(suite.HostID, suite.InitialState)
+	require.NoError(t, err)
+	suite.GameID = gameID
+
+	suite.Server = httptest.NewServer(http.HandlerFunc(suite.WSHandler.HostGame))
+	first, _, err := suite.ConnectHost()
+	require.NoError(t, err)
+	defer first.Close()
+	session := suite.ReadSession(first)
+
+	wsURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http") +
+		"?gameId=" + suite.GameID + "&hostId=" + suite.HostID + "&resumeToken=" + session.ResumeToken
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	}
+
+	// La première connexion reste l'hôte
+	require.NoError(t, first.WriteJSON(HostMessage{GameState: json.RawMessage(`{"score":3}`)}))
+	time.Sleep(100 * time.Millisecond)
+	gameInstance, _ := suite.GameManager.GetGame(suite.GameID)
+	gameInstance.Mutex.Lock()
+	assert.JSONEq(t, `{"score":3}`, string(gameInstance.GameState))
+	gameInstance.Mutex.Unlock()
+}
+
+// TestAdminDisconnect vérifie la fermeture des connexions d'une partie par un opérateur
+func (suite *WebSocketTestSuite) TestAdminDisconnect() {
+	t := suite.T()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hostGame", suite.WSHandler.HostGame)
+	mux.HandleFunc("/viewGame", suite.WSHandler.ViewGame)
+	suite.Server = httptest.NewServer(mux)
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+
+	host, _, err := websocket.DefaultDialer.Dial(baseURL+"/hostGame?gameId="+suite.GameID+"&hostId="+suite.HostID, nil)
+	require.NoError(t, err)
+	defer host.Close()
+	suite.ReadSession(host)
+	viewer, _, err := websocket.DefaultDialer.Dial(baseURL+"/viewGame?gameId="+suite.GameID, nil)
+	require.NoError(t, err)
+	defer viewer.Close()
+	viewer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var initial game.StateMessage
+	require.NoError(t, viewer.ReadJSON(&initial))
+	time.Sleep(50 * time.Millisecond)
+
+	details, err := suite.GameManager.Details(suite.GameID)
+	require.NoError(t, err)
+	assert.NotNil(t, details.Host)
+	assert.Len(t, details.ViewerConnections, 1)
+
+	count, err := suite.GameManager.DisconnectViewers(suite.GameID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	_, _, err = viewer.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "unexpected error: %v", err)
+
+	disconnected, err := suite.GameManager.DisconnectHostConnection(suite.GameID)
+	require.NoError(t, err)
+	assert.True(t, disconnected)
+	host.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err = host.ReadMessage(); err != nil {
+			break
+		}
+	}
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "unexpected error: %v", err)
+}
+
+// TestLeaderboardFeed vérifie que le flux du classement envoie le classement puis ses
+// changements à la fin d'une partie Yams
+func (suite *WebSocketTestSuite) TestLeaderboardFeed() {
+	t := suite.T()
+
+	board := leaderboard.New()
+	defer board.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, board.Listen(ctx, suite.GameManager.Broadcaster()))
+	suite.Server = httptest.NewServer(suite.WSHandler.LeaderboardFeed(board))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(suite.Server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var snapshot leaderboard.Snapshot
+	require.NoError(t, conn.ReadJSON(&snapshot))
+	assert.Equal(t, "leaderboard", snapshot.Type)
+	assert.Len(t, snapshot.Boards, 3)
+
+	schema, _ := suite.GameManager.Schemas().Get(game.YamsScorecardSchema)
+	gameID, err := suite.GameManager.CreateGameWithOptions("alice", []byte(`{"players":[{"id":"alice","scores":{"yams":50}}]}`),
+		game.GameOptions{Schema: schema, SchemaName: game.YamsScorecardSchema})
+	require.NoError(t, err)
+	_, err = suite.GameManager.EndGame(gameID, []game.FinalScore{{PlayerID: "alice", Score: 50}}, nil)
+	require.NoError(t, err)
+
+	var update leaderboard.Update
+	require.NoError(t, conn.ReadJSON(&update))
+	assert.Equal(t, "leaderboardUpdate", update.Type)
+	assert.Equal(t, gameID, update.GameID)
+	assert.Len(t, update.Changes, 3)
+	assert.Equal(t, 1, update.Records.MostYams.Value)
+}
+
+// TestViewTournament vérifie qu'un spectateur de tournoi reçoit le tournoi, les messages
+// de ses parties marqués par leur identifiant, puis les parties de la manche suivante
+func (suite *WebSocketTestSuite) TestViewTournament() {
+	t := suite.T()
+
+	tournaments := tournament.NewManager(suite.GameManager)
+	defer tournaments.Close()
+	created, err := tournaments.Create(tournament.Options{
+		Format:  tournament.FormatAggregate,
+		Players: []string{"alice", "bob"},
+		Rounds:  2,
+	})
+	require.NoError(t, err)
+	require.Len(t, created.Matches, 1)
+	firstGameID := created.Matches[0].GameID
+
+	suite.Server = httptest.NewServer(suite.WSHandler.ViewTournament(tournaments))
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+
+	// Un tournoi inconnu est refusé
+	_, resp, err := websocket.DefaultDialer.Dial(baseURL+"?tournamentId=unknown", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial(baseURL+"?tournamentId="+created.TournamentID, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var current tournament.Message
+	require.NoError(t, conn.ReadJSON(&current))
+	assert.Equal(t, "tournament", current.Type)
+	assert.Equal(t, 1, current.Tournament.CurrentRound)
+
+	var initial GameMessage
+	require.NoError(t, conn.ReadJSON(&initial))
+	assert.Equal(t, "gameMessage", initial.Type)
+	assert.Equal(t, firstGameID, initial.GameID)
+	assert.Contains(t, string(initial.Message), `"type":"gameState"`)
+
+	_, err = suite.GameManager.EndGame(firstGameID, []game.FinalScore{{PlayerID: "alice", Score: 28}, {PlayerID: "bob", Score: 15}},
+		[]byte(`{"players":[{"id":"alice","scores":{"chance":28}},{"id":"bob","scores":{"chance":15}}]}`))
+	require.NoError(t, err)
+
+	// Les messages du tournoi et des parties arrivent par des abonnements distincts :
+	// leur ordre relatif n'est pas garanti
+	var gameEnded, secondRound bool
+	var secondGameID string
+	for !gameEnded || !secondRound || secondGameID == "" {
+		var message struct {
+			Type       string                `json:"type"`
+			GameID     string                `json:"gameId"`
+			Message    json.RawMessage       `json:"message"`
+			Tournament tournament.Tournament `json:"tournament"`
+		}
+		require.NoError(t, conn.ReadJSON(&message))
+		switch {
+		case message.Type == "tournament" && message.Tournament.CurrentRound == 2:
+			secondRound = true
+			assert.Equal(t, tournament.MatchFinished, message.Tournament.Matches[0].Status)
+			assert.Equal(t, "alice", message.Tournament.Standings[0].PlayerID)
+		case message.Type == "gameMessage" && message.GameID == firstGameID:
+			gameEnded = gameEnded || strings.Contains(string(message.Message), `"type":"gameEnded"`)
+		case message.Type == "gameMessage":
+			secondGameID = message.GameID
+		}
+	}
+	assert.NotEqual(t, firstGameID, secondGameID)
+}
+
+// TestLobby vérifie la mise en relation de joueurs par le lobby, puis leur connexion à la
+// partie créée avec leur jeton de place
+func (suite *WebSocketTestSuite) TestLobby() {
+	t := suite.T()
+
+	config := lobby.DefaultConfig()
+	config.QueueTimeout = 200 * time.Millisecond
+	config.MatchInterval = 20 * time.Millisecond
+	matchmaking := lobby.NewWithConfig(suite.GameManager, config)
+	defer matchmaking.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lobby", suite.WSHandler.Lobby(matchmaking))
+	mux.HandleFunc("/hostGame", suite.WSHandler.HostGame)
+	mux.HandleFunc("/viewGame", suite.WSHandler.ViewGame)
+	suite.Server = httptest.NewServer(mux)
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+
+	// Le joueur est obligatoire
+	_, resp, err := websocket.DefaultDialer.Dial(baseURL+"/lobby", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	connect := func(playerID string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(baseURL+"/lobby?playerId="+playerID, nil)
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		return conn
+	}
+	alice, bob := connect("alice"), connect("bob")
+	defer alice.Close()
+	defer bob.Close()
+
+	// Une taille invalide est refusée
+	require.NoError(t, alice.WriteJSON(LobbyMessage{Type: MessageQueue, Size: 9}))
+	var invalid ErrorMessage
+	require.NoError(t, alice.ReadJSON(&invalid))
+	assert.Equal(t, ErrCodeInvalidQueue, invalid.Code)
+
+	// Annuler sans attendre est une erreur, annuler en attente quitte la file
+	require.NoError(t, alice.WriteJSON(LobbyMessage{Type: MessageCancel}))
+	var notQueued ErrorMessage
+	require.NoError(t, alice.ReadJSON(&notQueued))
+	assert.Equal(t, ErrCodeNotQueued, notQueued.Code)
+	require.NoError(t, alice.WriteJSON(LobbyMessage{Type: MessageQueue, Size: 2}))
+	var queued QueuedMessage
+	require.NoError(t, alice.ReadJSON(&queued))
+	assert.Equal(t, "queued", queued.Type)
+	assert.Equal(t, int64(200), queued.TimeoutMs)
+	require.NoError(t, alice.WriteJSON(LobbyMessage{Type: MessageQueue, Size: 2}))
+	var already ErrorMessage
+	require.NoError(t, alice.ReadJSON(&already))
+	assert.Equal(t, ErrCodeAlreadyQueued, already.Code)
+	require.NoError(t, alice.WriteJSON(LobbyMessage{Type: MessageCancel}))
+	var cancelled map[string]string
+	require.NoError(t, alice.ReadJSON(&cancelled))
+	assert.Equal(t, "queueCancelled", cancelled["type"])
+
+	// Sans adversaire, l'attente prend fin après le délai
+	require.NoError(t, bob.WriteJSON(LobbyMessage{Type: MessageQueue, Size: 2}))
+	require.NoError(t, bob.ReadJSON(&queued))
+	var timeout map[string]string
+	require.NoError(t, bob.ReadJSON(&timeout))
+	assert.Equal(t, "queueTimeout", timeout["type"])
+
+	// Deux joueurs en attente forment une partie, hébergée par le premier arrivé
+	require.NoError(t, alice.WriteJSON(LobbyMessage{Type: MessageQueue, Size: 2}))
+	require.NoError(t, alice.ReadJSON(&queued))
+	require.NoError(t, bob.WriteJSON(LobbyMessage{Type: MessageQueue, Size: 2}))
+	require.NoError(t, bob.ReadJSON(&queued))
+	var aliceMatch, bobMatch MatchFoundMessage
+	require.NoError(t, alice.ReadJSON(&aliceMatch))
+	require.NoError(t, bob.ReadJSON(&bobMatch))
+	assert.Equal(t, "matchFound", aliceMatch.Type)
+	assert.Equal(t, aliceMatch.GameID, bobMatch.GameID)
+	assert.Equal(t, []string{"alice", "bob"}, bobMatch.Players)
+	assert.True(t, aliceMatch.Host)
+	assert.False(t, bobMatch.Host)
+	assert.NotEqual(t, aliceMatch.PlayerToken, bobMatch.PlayerToken)
+
+	// L'hôte ouvre la partie avec son jeton, l'autre joueur la rejoint avec le sien
+	gameURL := "?gameId=" + aliceMatch.GameID
+	_, resp, err = websocket.DefaultDialer.Dial(baseURL+"/hostGame"+gameURL+"&hostId=alice", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	host, _, err := websocket.DefaultDialer.Dial(baseURL+"/hostGame"+gameURL+"&hostId=alice&resumeToken="+aliceMatch.PlayerToken, nil)
+	require.NoError(t, err)
+	defer host.Close()
+	suite.ReadSession(host)
+
+	_, resp, err = websocket.DefaultDialer.Dial(baseURL+"/viewGame"+gameURL+"&playerId=bob&playerToken="+aliceMatch.PlayerToken, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	player, _, err := websocket.DefaultDialer.Dial(baseURL+"/viewGame"+gameURL+"&playerId=bob&playerToken="+bobMatch.PlayerToken, nil)
+	require.NoError(t, err)
+	defer player.Close()
+
+	host.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var joined map[string]interface{}
+	require.NoError(t, host.ReadJSON(&joined))
+	assert.Equal(t, "viewerJoined", joined["type"])
+	assert.Equal(t, "bob", joined["playerId"])
+}
+
+// muxReply est un message reçu sur une connexion multiplexée
+type muxReply struct {
+	Type    string          `json:"type"`
+	GameID  string          `json:"gameId"`
+	Code    string          `json:"code"`
+	Reason  string          `json:"reason"`
+	Window  int             `json:"window"`
+	Message json.RawMessage `json:"message"`
+}
+
+// ReadMux lit le prochain message d'une connexion multiplexée
+func (suite *WebSocketTestSuite) ReadMux(conn *websocket.Conn) muxReply {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var reply muxReply
+	require.NoError(suite.T(), conn.ReadJSON(&reply))
+	return reply
+}
+
+// TestMultiplex vérifie le suivi de plusieurs parties et l'hébergement d'une partie sur
+// une seule connexion
+func (suite *WebSocketTestSuite) TestMultiplex() {
+	t := suite.T()
+	ctx := context.Background()
+
+	otherGameID, err := suite.GameManager.CreateGame("other-host", json.RawMessage(`{"round":1}`))
+	require.NoError(t, err)
+	tokens, err := suite.GameManager.ReserveSeats(otherGameID, []string{"friend"})
+	require.NoError(t, err)
+
+	suite.Server = httptest.NewServer(http.HandlerFunc(suite.WSHandler.Multiplex))
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+	host, _, err := websocket.DefaultDialer.Dial(baseURL+"?playerId="+suite.HostID, nil)
+	require.NoError(t, err)
+	defer host.Close()
+	viewer, _, err := websocket.DefaultDialer.Dial(baseURL+"?playerId=friend", nil)
+	require.NoError(t, err)
+	defer viewer.Close()
+
+	// L'hôte ouvre sa partie sur la connexion multiplexée
+	require.NoError(t, host.WriteJSON(MuxMessage{Type: MessageHost, GameID: suite.GameID}))
+	session := suite.ReadMux(host)
+	assert.Equal(t, "gameMessage", session.Type)
+	assert.Equal(t, suite.GameID, session.GameID)
+	assert.Contains(t, string(session.Message), `"type":"hostSession"`)
+	require.NoError(t, host.WriteJSON(MuxMessage{Type: MessageHost, GameID: otherGameID}))
+	assert.Equal(t, ErrCodeAlreadyHosting, suite.ReadMux(host).Code)
+
+	// Les erreurs portent l'identifiant de la partie
+	require.NoError(t, viewer.WriteJSON(MuxMessage{Type: MessageSubscribe, GameID: "unknown"}))
+	refused := suite.ReadMux(viewer)
+	assert.Equal(t, ErrCodeGameNotFound, refused.Code)
+	assert.Equal(t, "unknown", refused.GameID)
+	require.NoError(t, viewer.WriteJSON(MuxMessage{Type: MessageSubscribe, GameID: otherGameID, PlayerToken: "guess"}))
+	assert.Equal(t, ErrCodeInvalidPlayerToken, suite.ReadMux(viewer).Code)
+
+	// Le spectateur suit les deux parties, la première avec une fenêtre d'un message
+	require.NoError(t, viewer.WriteJSON(MuxMessage{Type: MessageSubscribe, GameID: suite.GameID, Window: 1}))
+	subscribed := suite.ReadMux(viewer)
+	assert.Equal(t, "subscribed", subscribed.Type)
+	assert.Equal(t, 1, subscribed.Window)
+	initial := suite.ReadMux(viewer)
+	assert.Equal(t, suite.GameID, initial.GameID)
+	assert.Contains(t, string(initial.Message), `"score":0`)
+	joined := suite.ReadMux(host)
+	assert.Equal(t, suite.GameID, joined.GameID)
+	assert.Contains(t, string(joined.Message), `"type":"viewerJoined"`)
+
+	require.NoError(t, viewer.WriteJSON(MuxMessage{Type: MessageSubscribe, GameID: otherGameID, PlayerToken: tokens["friend"]}))
+	assert.Equal(t, "subscribed", suite.ReadMux(viewer).Type)
+	assert.Equal(t, otherGameID, suite.ReadMux(viewer).GameID)
+	require.NoError(t, viewer.WriteJSON(MuxMessage{Type: MessageSubscribe, GameID: otherGameID}))
+	assert.Equal(t, ErrCodeAlreadySubscribed, suite.ReadMux(viewer).Code)
+
+	// Au-delà de la fenêtre, seul le dernier état est conservé, sans retenir l'autre partie
+	require.NoError(t, host.WriteJSON(MuxMessage{Type: MessageGameState, GameID: suite.GameID, HostMessage: HostMessage{GameState: json.RawMessage(`{"score":1}`)}}))
+	first := suite.ReadMux(viewer)
+	assert.Equal(t, suite.GameID, first.GameID)
+	assert.Contains(t, string(first.Message), `"score":1`)
+	require.NoError(t, host.WriteJSON(MuxMessage{Type: MessageGameState, GameID: suite.GameID, HostMessage: HostMessage{GameState: json.RawMessage(`{"score":2}`)}}))
+	require.NoError(t, host.WriteJSON(MuxMessage{Type: MessageGameState, GameID: suite.GameID, HostMessage: HostMessage{GameState: json.RawMessage(`{"score":3}`)}}))
+	require.NoError(t, host.WriteJSON(MuxMessage{Type: MessageGameState, GameID: otherGameID, HostMessage: HostMessage{GameState: json.RawMessage(`{}`)}}))
+	assert.Equal(t, ErrCodeNotHosting, suite.ReadMux(host).Code)
+	require.NoError(t, suite.GameManager.PublishState(ctx, otherGameID, json.RawMessage(`{"round":2}`)))
+	other := suite.ReadMux(viewer)
+	assert.Equal(t, otherGameID, other.GameID)
+	assert.Contains(t, string(other.Message), `"round":2`)
+
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, viewer.WriteJSON(MuxMessage{Type: MessageAck, GameID: suite.GameID}))
+	latest := suite.ReadMux(viewer)
+	assert.Equal(t, suite.GameID, latest.GameID)
+	assert.Contains(t, string(latest.Message), `"score":3`)
+
+	// Aucun message d'une partie ne suit son désabonnement
+	require.NoError(t, viewer.WriteJSON(MuxMessage{Type: MessageUnsubscribe, GameID: otherGameID}))
+	unsubscribed := suite.ReadMux(viewer)
+	assert.Equal(t, "unsubscribed", unsubscribed.Type)
+	assert.Equal(t, otherGameID, unsubscribed.GameID)
+	require.NoError(t, suite.GameManager.PublishState(ctx, otherGameID, json.RawMessage(`{"round":3}`)))
+	require.NoError(t, viewer.WriteJSON(MuxMessage{Type: MessageAck, GameID: suite.GameID}))
+	require.NoError(t, host.WriteJSON(MuxMessage{Type: MessageGameState, GameID: suite.GameID, HostMessage: HostMessage{GameState: json.RawMessage(`{"score":4}`)}}))
+	next := suite.ReadMux(viewer)
+	assert.Equal(t, suite.GameID, next.GameID)
+	assert.Contains(t, string(next.Message), `"score":4`)
+
+	// La suppression d'une partie met fin à son abonnement
+	require.NoError(t, viewer.WriteJSON(MuxMessage{Type: MessageSubscribe, GameID: otherGameID}))
+	assert.Equal(t, "subscribed", suite.ReadMux(viewer).Type)
+	suite.ReadMux(viewer)
+	suite.GameManager.RemoveGame(otherGameID)
+	removed := suite.ReadMux(viewer)
+	assert.Contains(t, string(removed.Message), `"type":"gameRemoved"`)
+	ended := suite.ReadMux(viewer)
+	assert.Equal(t, "subscriptionEnded", ended.Type)
+	assert.Equal(t, otherGameID, ended.GameID)
+	assert.Equal(t, "gameRemoved", ended.Reason)
+
+	// La fermeture de la connexion de l'hôte est annoncée aux spectateurs
+	host.Close()
+	require.NoError(t, viewer.WriteJSON(MuxMessage{Type: MessageAck, GameID: suite.GameID}))
+	disconnected := suite.ReadMux(viewer)
+	assert.Equal(t, suite.GameID, disconnected.GameID)
+	assert.Contains(t, string(disconnected.Message), `"type":"hostDisconnected"`)
+}
+
+// TestMultiplexRateLimit vérifie qu'un client multiplexé dépassant la limite de messages
+// de façon répétée est déconnecté
+func (suite *WebSocketTestSuite) TestMultiplexRateLimit() {
+	t := suite.T()
+
+	config := DefaultConfig()
+	config.MessageLimit = api.RateLimit{Rate: 0.01, Burst: 1}
+	suite.WSHandler = NewGameWSHandlerWithConfig(suite.GameManager, config)
+	suite.Server = httptest.NewServer(http.HandlerFunc(suite.WSHandler.Multiplex))
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(baseURL+"?playerId=flooder", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Le premier message est traité, les suivants sont refusés
+	require.NoError(t, conn.WriteJSON(MuxMessage{Type: MessageUnsubscribe, GameID: suite.GameID}))
+	assert.Equal(t, ErrCodeNotSubscribed, suite.ReadMux(conn).Code)
+	for i := 1; i < maxRateLimited; i++ {
+		require.NoError(t, conn.WriteJSON(MuxMessage{Type: MessageUnsubscribe, GameID: suite.GameID}))
+		assert.Equal(t, ErrCodeRateLimited, suite.ReadMux(conn).Code)
+	}
+
+	// Le refus suivant ferme la connexion
+	require.NoError(t, conn.WriteJSON(MuxMessage{Type: MessageUnsubscribe, GameID: suite.GameID}))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+}
+
+// TestMultiplexHostWrites vérifie que les écritures d'une connexion multiplexée hébergeant
+// une partie ne prennent pas le verrou de la partie
+func (suite *WebSocketTestSuite) TestMultiplexHostWrites() {
+	t := suite.T()
+
+	otherGameID, err := suite.GameManager.CreateGame("other-host", json.RawMessage(`{"round":1}`))
+	require.NoError(t, err)
+	gameObj, err := suite.GameManager.GetGame(suite.GameID)
+	require.NoError(t, err)
+
+	suite.Server = httptest.NewServer(http.HandlerFunc(suite.WSHandler.Multiplex))
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+	host, _, err := websocket.DefaultDialer.Dial(baseURL+"?playerId="+suite.HostID, nil)
+	require.NoError(t, err)
+	defer host.Close()
+	require.NoError(t, host.WriteJSON(MuxMessage{Type: MessageHost, GameID: suite.GameID}))
+	assert.Contains(t, string(suite.ReadMux(host).Message), `"type":"hostSession"`)
+	require.NoError(t, host.WriteJSON(MuxMessage{Type: MessageSubscribe, GameID: otherGameID}))
+	assert.Equal(t, "subscribed", suite.ReadMux(host).Type)
+	assert.Equal(t, otherGameID, suite.ReadMux(host).GameID)
+
+	// L'autre partie reste suivie pendant que le verrou de la partie hébergée est tenu
+	gameObj.Mutex.Lock()
+	defer gameObj.Mutex.Unlock()
+	require.NoError(t, suite.GameManager.PublishState(context.Background(), otherGameID, json.RawMessage(`{"round":2}`)))
+	other := suite.ReadMux(host)
+	assert.Equal(t, otherGameID, other.GameID)
+	assert.Contains(t, string(other.Message), `"round":2`)
+}
+
+// TestWriteTimeout vérifie qu'une écriture dépassant le délai rompt la connexion
+func (suite *WebSocketTestSuite) TestWriteTimeout() {
+	t := suite.T()
+
+	config := DefaultConfig()
+	config.WriteTimeout = time.Nanosecond
+	suite.WSHandler = NewGameWSHandlerWithConfig(suite.GameManager, config)
+	suite.Server = httptest.NewServer(http.HandlerFunc(suite.WSHandler.ViewGame))
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+
+	viewer, _, err := websocket.DefaultDialer.Dial(baseURL+"?gameId="+suite.GameID, nil)
+	require.NoError(t, err)
+	defer viewer.Close()
+	viewer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = viewer.ReadMessage()
+	assert.Error(t, err)
+	var netErr net.Error
+	assert.False(t, errors.As(err, &netErr) && netErr.Timeout(), "la connexion doit être rompue par le serveur")
+}
+
+// TestEncodings vérifie la négociation de l'encodage de chaque connexion
+func (suite *WebSocketTestSuite) TestEncodings() {
+	t := suite.T()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hostGame", suite.WSHandler.HostGame)
+	mux.HandleFunc("/viewGame", suite.WSHandler.ViewGame)
+	mux.HandleFunc("/ws", suite.WSHandler.Multiplex)
+	suite.Server = httptest.NewServer(mux)
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+	dial := func(path string, subprotocols ...string) *websocket.Conn {
+		dialer := websocket.Dialer{Subprotocols: subprotocols}
+		conn, _, err := dialer.Dial(baseURL+path, nil)
+		require.NoError(t, err)
+		return conn
+	}
+	read := func(conn *websocket.Conn, encoding Encoding) map[string]interface{} {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		messageType, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		var message map[string]interface{}
+		switch encoding {
+		case EncodingMessagePack:
+			assert.Equal(t, websocket.BinaryMessage, messageType)
+			require.NoError(t, msgpack.Unmarshal(data, &message))
+		case EncodingCBOR:
+			assert.Equal(t, websocket.BinaryMessage, messageType)
+			require.NoError(t, cborDecoding.Unmarshal(data, &message))
+		default:
+			assert.Equal(t, websocket.TextMessage, messageType)
+			require.NoError(t, json.Unmarshal(data, &message))
+		}
+		return message
+	}
+
+	// Le premier encodage proposé dans l'ordre du serveur est retenu
+	host := dial("/hostGame?gameId="+suite.GameID+"&hostId="+suite.HostID, "json", "msgpack")
+	defer host.Close()
+	assert.Equal(t, "msgpack", host.Subprotocol())
+	assert.Equal(t, "hostSession", read(host, EncodingMessagePack)["type"])
+
+	cborViewer := dial("/viewGame?gameId="+suite.GameID, "cbor")
+	defer cborViewer.Close()
+	assert.Equal(t, "cbor", cborViewer.Subprotocol())
+	initial := read(cborViewer, EncodingCBOR)
+	assert.Equal(t, map[string]interface{}{"state": "initial", "score": uint64(0)}, initial["gameState"])
+	assert.Equal(t, "viewerJoined", read(host, EncodingMessagePack)["type"])
+
+	// Les clients ne proposant aucun encodage reçoivent du JSON
+	jsonViewer := dial("/viewGame?gameId=" + suite.GameID)
+	defer jsonViewer.Close()
+	assert.Equal(t, "", jsonViewer.Subprotocol())
+	read(jsonViewer, EncodingJSON)
+	read(host, EncodingMessagePack)
+
+	// L'hôte envoie ses messages en MessagePack, ou en JSON dans une trame texte
+	update, err := msgpack.Marshal(map[string]interface{}{
+		"gameState": map[string]interface{}{"score": 42, "ratio": 0.5},
+	})
+	require.NoError(t, err)
+	require.NoError(t, host.WriteMessage(websocket.BinaryMessage, update))
+	assert.Equal(t, map[string]interface{}{"score": uint64(42), "ratio": 0.5}, read(cborViewer, EncodingCBOR)["gameState"])
+	assert.Equal(t, map[string]interface{}{"score": float64(42), "ratio": 0.5}, read(jsonViewer, EncodingJSON)["gameState"])
+	require.NoError(t, host.WriteJSON(HostMessage{GameState: json.RawMessage(`{"score":43}`)}))
+	assert.Equal(t, map[string]interface{}{"score": uint64(43)}, read(cborViewer, EncodingCBOR)["gameState"])
+	read(jsonViewer, EncodingJSON)
+
+	// Les messages de la connexion multiplexée sont encodés de même
+	multiplexed := dial("/ws?playerId=friend", "cbor")
+	defer multiplexed.Close()
+	subscribe, err := cbor.Marshal(MuxMessage{Type: MessageSubscribe, GameID: suite.GameID})
+	require.NoError(t, err)
+	require.NoError(t, multiplexed.WriteMessage(websocket.BinaryMessage, subscribe))
+	assert.Equal(t, "subscribed", read(multiplexed, EncodingCBOR)["type"])
+	state := read(multiplexed, EncodingCBOR)
+	assert.Equal(t, "gameMessage", state["type"])
+	assert.Equal(t, suite.GameID, state["gameId"])
+	assert.Equal(t, map[string]interface{}{"score": uint64(43)}, state["message"].(map[string]interface{})["gameState"])
+}
+
+// TestCompression vérifie la compression des messages dépassant le seuil
+func (suite *WebSocketTestSuite) TestCompression() {
+	t := suite.T()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hostGame", suite.WSHandler.HostGame)
+	mux.HandleFunc("/viewGame", suite.WSHandler.ViewGame)
+	suite.Server = httptest.NewServer(mux)
+	baseURL := "ws" + strings.TrimPrefix(suite.Server.URL, "http")
+
+	host, _, err := websocket.DefaultDialer.Dial(baseURL+"/hostGame?gameId="+suite.GameID+"&hostId="+suite.HostID, nil)
+	require.NoError(t, err)
+	defer host.Close()
+	suite.ReadSession(host)
+
+	// Seul le spectateur proposant permessage-deflate reçoit des messages compressés
+	compressing := websocket.Dialer{EnableCompression: true}
+	viewer, _, err := compressing.Dial(baseURL+"/viewGame?gameId="+suite.GameID, nil)
+	require.NoError(t, err)
+	defer viewer.Close()
+	plain, _, err := websocket.DefaultDialer.Dial(baseURL+"/viewGame?gameId="+suite.GameID, nil)
+	require.NoError(t, err)
+	defer plain.Close()
+	for _, conn := range []*websocket.Conn{viewer, plain} {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err := conn.ReadMessage()
+		require.NoError(t, err)
+	}
+
+	board := strings.Repeat("yams ", 400)
+	require.NoError(t, host.WriteJSON(HostMessage{GameState: json.RawMessage(`{"board":"` + board + `"}`)}))
+	for _, conn := range []*websocket.Conn{viewer, plain} {
+		var update game.StateMessage
+		require.NoError(t, conn.ReadJSON(&update))
+		assert.JSONEq(t, `{"board":"`+board+`"}`, string(update.GameState))
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int64(1), suite.WSHandler.CompressedCount())
+	size := len(`{"type":"gameState","gameState":{"board":"` + board + `"}}`)
+	assert.Equal(t, int64(frameSize(size)), suite.WSHandler.UncompressedBytes())
+	assert.Greater(t, suite.WSHandler.BytesSaved(), int64(size/2))
+
+	// Les messages sous le seuil ne sont pas compressés
+	require.NoError(t, host.WriteJSON(HostMessage{GameState: json.RawMessage(`{"score":1}`)}))
+	var update game.StateMessage
+	require.NoError(t, viewer.ReadJSON(&update))
+	assert.JSONEq(t, `{"score":1}`, string(update.GameState))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int64(1), suite.WSHandler.CompressedCount())
+}
+
 // TestWebSocketSuite lance la suite de tests
 func TestWebSocketSuite(t *testing.T) {
 	suite.Run(t, new(WebSocketTestSuite))
 }
+
+// TestViewerOnAnotherInstance vérifie qu'un spectateur connecté à une autre instance que
+// l'hôte suit la partie à travers le broadcaster Redis
+func TestViewerOnAnotherInstance(t *testing.T) {
+	redisServer := broadcasttest.NewRedisServer(t, "")
+	newInstance := func() (*game.GameManager, string) {
+		redisConfig, err := broadcast.ParseRedisURL(redisServer.URL())
+		require.NoError(t, err)
+		broadcaster, err := broadcast.NewRedis(context.Background(), redisConfig)
+		require.NoError(t, err)
+		t.Cleanup(func() { broadcaster.Close() })
+
+		config := game.DefaultConfig()
+		config.Broadcaster = broadcaster
+		manager := game.NewGameManagerWithConfig(config)
+		handler := NewGameWSHandler(manager)
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/hostGame", handler.HostGame)
+		mux.HandleFunc("/viewGame", handler.ViewGame)
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return manager, "ws" + strings.TrimPrefix(server.URL, "http")
+	}
+
+	hostManager, hostURL := newInstance()
+	viewerManager, viewerURL := newInstance()
+
+	gameID, err := hostManager.CreateGame("host", json.RawMessage(`{"score":0}`))
+	require.NoError(t, err)
+	_, err = viewerManager.GetGame(gameID)
+	assert.Error(t, err, "the game is only held by the host instance")
+
+	host, _, err := websocket.DefaultDialer.Dial(hostURL+"/hostGame?gameId="+gameID+"&hostId=host", nil)
+	require.NoError(t, err)
+	defer host.Close()
+	host.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var session SessionMessage
+	require.NoError(t, host.ReadJSON(&session))
+	assert.Equal(t, "hostSession", session.Type)
+
+	viewer, _, err := websocket.DefaultDialer.Dial(viewerURL+"/viewGame?gameId="+gameID, nil)
+	require.NoError(t, err)
+	defer viewer.Close()
+
+	viewer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var initial game.StateMessage
+	require.NoError(t, viewer.ReadJSON(&initial))
+	assert.JSONEq(t, `{"score":0}`, string(initial.GameState))
+
+	host.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var joined map[string]string
+	require.NoError(t, host.ReadJSON(&joined))
+	assert.Equal(t, "viewerJoined", joined["type"])
+
+	require.NoError(t, host.WriteJSON(HostMessage{GameState: json.RawMessage(`{"score":50}`)}))
+	var update game.StateMessage
+	require.NoError(t, viewer.ReadJSON(&update))
+	assert.JSONEq(t, `{"score":50}`, string(update.GameState))
+
+	host.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	var disconnected HostDisconnectedMessage
+	require.NoError(t, viewer.ReadJSON(&disconnected))
+	assert.Equal(t, "hostDisconnected", disconnected.Type)
+
+	// A viewer joining later on the viewer instance receives the last state
+	late, _, err := websocket.DefaultDialer.Dial(viewerURL+"/viewGame?gameId="+gameID, nil)
+	require.NoError(t, err)
+	defer late.Close()
+	late.SetReadDeadline(time.Now().Add(2 * time.Second))
+	require.NoError(t, late.ReadJSON(&initial))
+	assert.JSONEq(t, `{"score":50}`, string(initial.GameState))
+}
+
+// TestTracing vérifie les spans de connexion, de mise à jour et de diffusion, rattachés
+// à la trace de la requête de mise à niveau
+func TestTracing(t *testing.T) {
+	_, err := tracing.Init(context.Background(), tracing.Config{Exporter: tracing.ExporterNone})
+	require.NoError(t, err)
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	manager := game.NewGameManager()
+	handler := NewGameWSHandler(manager)
+	gameID, err := manager.CreateGame("host", json.RawMessage(`{"score":0}`))
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hostGame", handler.HostGame)
+	mux.HandleFunc("/viewGame", handler.ViewGame)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	baseURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	dial := func(path, parentID string) *websocket.Conn {
+		header := http.Header{"Traceparent": []string{"00-" + traceID + "-" + parentID + "-01"}}
+		conn, _, err := websocket.DefaultDialer.Dial(baseURL+path, header)
+		require.NoError(t, err)
+		return conn
+	}
+	host := dial("/hostGame?gameId="+gameID+"&hostId=host", "00f067aa0ba902b7")
+	defer host.Close()
+	host.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var session SessionMessage
+	require.NoError(t, host.ReadJSON(&session))
+	viewer := dial("/viewGame?gameId="+gameID, "00f067aa0ba902b8")
+	defer viewer.Close()
+	viewer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var state game.StateMessage
+	require.NoError(t, viewer.ReadJSON(&state))
+
+	require.NoError(t, host.WriteJSON(HostMessage{GameState: json.RawMessage(`{"score":42}`)}))
+	require.NoError(t, viewer.ReadJSON(&state))
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	require.Eventually(t, func() bool {
+		for _, span := range recorder.Ended() {
+			spans[span.Name()] = span
+		}
+		return len(spans) == 4
+	}, 2*time.Second, 10*time.Millisecond)
+	attributes := func(span sdktrace.ReadOnlySpan) map[string]string {
+		values := map[string]string{}
+		for _, attr := range span.Attributes() {
+			values[string(attr.Key)] = attr.Value.Emit()
+		}
+		return values
+	}
+
+	// Les connexions continuent la trace de leur requête de mise à niveau
+	hostConnect := spans["HostGame.connect"]
+	require.NotNil(t, hostConnect)
+	assert.Equal(t, traceID, hostConnect.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", hostConnect.Parent().SpanID().String())
+	assert.Equal(t, map[string]string{
+		string(tracing.AttrGameID):     gameID,
+		string(tracing.AttrHostID):     "host",
+		string(tracing.AttrConnection): "connected for the first time",
+	}, attributes(hostConnect))
+
+	viewerConnect := spans["ViewGame.connect"]
+	require.NotNil(t, viewerConnect)
+	assert.Equal(t, traceID, viewerConnect.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b8", viewerConnect.Parent().SpanID().String())
+	assert.Equal(t, gameID, attributes(viewerConnect)[string(tracing.AttrGameID)])
+	assert.Equal(t, "1", attributes(viewerConnect)[string(tracing.AttrViewerCount)])
+
+	// Chaque mise à jour est la racine de sa trace, liée à la connexion de l'hôte
+	update := spans["HostGame.update"]
+	require.NotNil(t, update)
+	assert.False(t, update.Parent().IsValid())
+	require.Len(t, update.Links(), 1)
+	assert.Equal(t, hostConnect.SpanContext().SpanID(), update.Links()[0].SpanContext.SpanID())
+	assert.Equal(t, map[string]string{
+		string(tracing.AttrGameID):      gameID,
+		string(tracing.AttrPayloadSize): "12",
+		string(tracing.AttrViewerCount): "1",
+	}, attributes(update))
+
+	publish := spans["HostGame.publish"]
+	require.NotNil(t, publish)
+	assert.Equal(t, update.SpanContext().SpanID(), publish.Parent().SpanID())
+	assert.Equal(t, "1", attributes(publish)[string(tracing.AttrViewerCount)])
+}
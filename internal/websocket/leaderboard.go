@@ -0,0 +1,88 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/api"
+	"github.com/vincentvignali/yamsAttackSocket/internal/leaderboard"
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+Leaderboard Feed
+
+This file implements the live leaderboard feed. A client connecting to it first receives
+a leaderboard message with the top of every board, then a leaderboardUpdate message each
+time a finished game changes a board or breaks a record. Like viewers, feed clients are
+not expected to talk: a flooding client is disconnected.
+*/
+
+// LeaderboardFeed returns the handler of the live leaderboard feed.
+func (h *GameWSHandler) LeaderboardFeed(board *leaderboard.Leaderboard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Subscribe before taking the snapshot, so that no update is missed in between
+		updates, err := board.Subscribe(r.Context())
+		if err != nil {
+			api.HandleError(w, &api.AppError{
+				Code:    http.StatusServiceUnavailable,
+				Message: api.ErrBroadcastUnavailable,
+				Err:     err,
+			})
+			return
+		}
+		defer updates.Close()
+
+		conn, err := h.upgrade(w, r)
+		if err != nil {
+			api.HandleError(w, &api.AppError{
+				Code:    http.StatusInternalServerError,
+				Message: api.ErrWebSocketUpgrade,
+				Err:     err,
+			})
+			return
+		}
+		defer conn.Close()
+		h.gameManager.UpdateOpenConnections(1)
+		defer h.gameManager.UpdateOpenConnections(-1)
+		if h.config.MaxMessageSize > 0 {
+			conn.SetReadLimit(h.config.MaxMessageSize)
+		}
+
+		snapshot, err := json.Marshal(board.Snapshot(api.DefaultLeaderboardLimit))
+		if err != nil {
+			logger.Error.Printf("Cannot encode the leaderboard: %v", err)
+			return
+		}
+		if err := writeData(conn, snapshot); err != nil {
+			logger.Debug.Printf("Error sending the leaderboard: %v", err)
+			return
+		}
+
+		forwardDone := make(chan struct{})
+		go func() {
+			defer close(forwardDone)
+			forwardToViewer(conn, updates, "leaderboard")
+		}()
+
+		messageBucket := api.NewTokenBucket(h.config.MessageLimit)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				break
+			}
+			if allowed, _ := messageBucket.Allow(); !allowed {
+				logger.Warn.Printf("Leaderboard client disconnected, rate limit reached")
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, api.ErrRateLimited),
+					time.Now().Add(time.Second))
+				break
+			}
+		}
+
+		updates.Close()
+		<-forwardDone
+	}
+}
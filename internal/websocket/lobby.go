@@ -0,0 +1,204 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/api"
+	"github.com/vincentvignali/yamsAttackSocket/internal/lobby"
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+)
+
+/*
+Matchmaking Lobby
+
+This file implements the lobby socket, on which players look for online opponents. A
+player sends a queue message with the number of players of the game wanted and an
+optional rating, and receives a queued message. The wait ends with:
+- a matchFound message with the game created for the match and the seat token of the
+  player: the host connects to /hostGame with it as resume token, the other players
+  join with /viewGame, presenting their player ID and token
+- a queueTimeout message when no match was found in time
+- a queueCancelled message after a cancel message
+The player may then queue again on the same connection. Closing the connection leaves
+the queue.
+*/
+
+// Lobby returns the handler of the lobby socket.
+func (h *GameWSHandler) Lobby(matchmaking *lobby.Lobby) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		playerID := r.URL.Query().Get("playerId")
+		if playerID == "" {
+			api.HandleError(w, &api.AppError{
+				Code:    http.StatusBadRequest,
+				Message: api.ErrMissingParam + ": playerId",
+			})
+			return
+		}
+
+		conn, err := h.upgrade(w, r)
+		if err != nil {
+			api.HandleError(w, &api.AppError{
+				Code:    http.StatusInternalServerError,
+				Message: api.ErrWebSocketUpgrade,
+				Err:     err,
+			})
+			return
+		}
+		defer conn.Close()
+		h.gameManager.UpdateOpenConnections(1)
+		defer h.gameManager.UpdateOpenConnections(-1)
+		if h.config.MaxMessageSize > 0 {
+			conn.SetReadLimit(h.config.MaxMessageSize)
+		}
+
+		session := &lobbySession{conn: conn, lobby: matchmaking, playerID: playerID}
+		defer session.leave()
+		logger.Debug.Printf("Lobby player connected: PlayerID=%s", playerID)
+
+		messageBucket := api.NewTokenBucket(h.config.MessageLimit)
+		for {
+			var message LobbyMessage
+			if err := readMessage(conn, &message); err != nil {
+				logger.Debug.Printf("Lobby player disconnected (PlayerID=%s): %v", playerID, err)
+				break
+			}
+			if allowed, wait := messageBucket.Allow(); !allowed {
+				session.send(ErrorMessage{
+					Type:         "error",
+					Code:         ErrCodeRateLimited,
+					Message:      api.ErrRateLimited,
+					RetryAfterMs: wait.Milliseconds(),
+				})
+				continue
+			}
+
+			switch message.Type {
+			case MessageQueue:
+				session.queue(message)
+			case MessageCancel:
+				session.cancel()
+			default:
+				session.send(ErrorMessage{
+					Type:    "error",
+					Code:    ErrCodeUnknownMessage,
+					Message: api.ErrUnknownMessageType + ": " + message.Type,
+				})
+			}
+		}
+	}
+}
+
+// queue puts the player in the queue and waits for the outcome in the background.
+func (s *lobbySession) queue(message LobbyMessage) {
+	ticket, err := s.lobby.Join(s.playerID, message.Size, message.Rating)
+	switch {
+	case errors.Is(err, lobby.ErrAlreadyQueued):
+		s.send(ErrorMessage{Type: "error", Code: ErrCodeAlreadyQueued, Message: api.ErrAlreadyQueued})
+		return
+	case errors.Is(err, lobby.ErrInvalidTicket):
+		s.send(ErrorMessage{
+			Type:    "error",
+			Code:    ErrCodeInvalidQueue,
+			Message: api.ErrInvalidQueueRequest + ": " + strings.TrimPrefix(err.Error(), lobby.ErrInvalidTicket.Error()+": "),
+		})
+		return
+	case err != nil:
+		s.send(ErrorMessage{Type: "error", Code: ErrCodeInvalidQueue, Message: api.ErrInvalidQueueRequest})
+		return
+	}
+
+	stop := make(chan struct{})
+	s.mutex.Lock()
+	s.ticket = ticket
+	s.stopWaiting = stop
+	s.mutex.Unlock()
+
+	// The queued message is sent before the outcome, which may already be there
+	s.send(QueuedMessage{
+		Type:      "queued",
+		Size:      ticket.Size,
+		QueuedAt:  ticket.QueuedAt.UTC(),
+		TimeoutMs: s.lobby.QueueTimeout().Milliseconds(),
+	})
+	s.waiting.Add(1)
+	go func() {
+		defer s.waiting.Done()
+		s.wait(ticket, stop)
+	}()
+}
+
+// wait sends the outcome of a ticket, unless stop is closed first.
+func (s *lobbySession) wait(ticket *lobby.Ticket, stop chan struct{}) {
+	var outcome lobby.Outcome
+	select {
+	case <-stop:
+		return
+	case outcome = <-ticket.Outcome():
+	}
+
+	s.mutex.Lock()
+	if s.ticket == ticket {
+		s.ticket = nil
+	}
+	s.mutex.Unlock()
+
+	if outcome.TimedOut {
+		s.send(map[string]string{"type": "queueTimeout"})
+		return
+	}
+	match := outcome.Match
+	s.send(MatchFoundMessage{
+		Type:         "matchFound",
+		GameID:       match.GameID,
+		HostPlayerID: match.HostPlayerID,
+		Players:      match.Players,
+		Host:         match.HostPlayerID == s.playerID,
+		PlayerToken:  match.Tokens[s.playerID],
+	})
+}
+
+// cancel takes the player out of the queue. A player already matched receives its match.
+func (s *lobbySession) cancel() {
+	s.mutex.Lock()
+	ticket, stop := s.ticket, s.stopWaiting
+	s.mutex.Unlock()
+	if ticket == nil {
+		s.send(ErrorMessage{Type: "error", Code: ErrCodeNotQueued, Message: api.ErrNotQueued})
+		return
+	}
+	if !s.lobby.Cancel(ticket) {
+		return
+	}
+
+	s.mutex.Lock()
+	if s.ticket == ticket {
+		s.ticket = nil
+	}
+	s.mutex.Unlock()
+	close(stop)
+	s.send(map[string]string{"type": "queueCancelled"})
+}
+
+// leave takes the player out of the queue when the connection ends.
+func (s *lobbySession) leave() {
+	s.mutex.Lock()
+	ticket, stop := s.ticket, s.stopWaiting
+	s.ticket = nil
+	s.mutex.Unlock()
+	if ticket != nil {
+		s.lobby.Cancel(ticket)
+		close(stop)
+	}
+	s.waiting.Wait()
+}
+
+// send writes a message to the player.
+func (s *lobbySession) send(message interface{}) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	if err := writeMessage(s.conn, message); err != nil {
+		logger.Debug.Printf("Error sending to lobby player (PlayerID=%s): %v", s.playerID, err)
+	}
+}
@@ -0,0 +1,569 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/api"
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+	"github.com/vincentvignali/yamsAttackSocket/internal/tracing"
+)
+
+/*
+Multiplexed Socket
+
+This file implements the multiplexed socket, on which a client follows several games
+over one connection, and may host one of them. The client identifies itself once, with
+the optional playerId query parameter, then sends commands naming a game:
+- subscribe follows a game: the client receives a subscribed message, then each message
+  a viewer of the game would receive, starting with its current state, in a gameMessage
+  message carrying the game ID. A player holding a seat of the game presents its
+  playerToken, and is announced to the host like on /viewGame
+- unsubscribe stops following a game: no message of the game follows the unsubscribed
+  message
+- host opens the host session of a game of this instance hosted by the player,
+  presenting its resumeToken once the session is open. The host messages of /hostGame
+  (gameState, endGame, pause and resume) are then accepted for that game, and the
+  messages for the host are sent in gameMessage messages
+An error refusing a command carries the game ID of the command. A client going on
+sending commands refused by the rate limit is disconnected.
+
+Each subscription is forwarded on its own, with flow control: a subscription with a
+window sends at most window messages ahead of the acknowledgements of the client (ack
+messages). The messages held back meanwhile are conflated, only the last game state
+being kept, so that a client reading slowly receives the latest state rather than every
+state. A subscription holding back too many messages, or whose broadcast subscription
+falls behind, ends with a subscriptionEnded message while the other subscriptions go
+on; the client may subscribe again to start over from the current state.
+
+The connection is a viewer of each game followed that is held by this instance, and the
+host connection of the game hosted: disconnecting the viewers or the host of one of
+them from the admin API, or taking the host session over from another connection,
+closes the whole connection.
+*/
+
+const (
+	// maxSubscriptions bounds the games followed by a multiplexed connection
+	maxSubscriptions = 32
+	// maxPending bounds the messages held back by the window of a subscription
+	maxPending = broadcast.DefaultBufferSize
+	// maxRateLimited bounds the messages in a row refused by the rate limit before the
+	// connection is closed
+	maxRateLimited = 10
+)
+
+const (
+	reasonGameRemoved          = "gameRemoved"
+	reasonSlowSubscriber       = "slowSubscriber"
+	reasonBroadcastUnavailable = "broadcastUnavailable"
+)
+
+// Multiplex handles the multiplexed socket.
+func (h *GameWSHandler) Multiplex(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrade(w, r)
+	if err != nil {
+		api.HandleError(w, &api.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: api.ErrWebSocketUpgrade,
+			Err:     err,
+		})
+		return
+	}
+	defer conn.Close()
+	h.gameManager.UpdateOpenConnections(1)
+	defer h.gameManager.UpdateOpenConnections(-1)
+	if h.config.MaxMessageSize > 0 {
+		conn.SetReadLimit(h.config.MaxMessageSize)
+	}
+
+	session := &muxSession{
+		handler:       h,
+		conn:          conn,
+		writeMutex:    h.registerWriteLock(conn),
+		ctx:           r.Context(),
+		playerID:      r.URL.Query().Get("playerId"),
+		subscriptions: make(map[string]*muxSubscription),
+	}
+	defer session.close()
+	logger.Debug.Printf("Multiplexed connection opened: PlayerID=%s", session.playerID)
+
+	messageBucket := api.NewTokenBucket(h.config.MessageLimit)
+	rateLimited := 0
+	for {
+		var message MuxMessage
+		if err := readMessage(conn, &message); err != nil {
+			logger.Debug.Printf("Multiplexed connection closed (PlayerID=%s): %v", session.playerID, err)
+			break
+		}
+		if allowed, wait := messageBucket.Allow(); !allowed {
+			if rateLimited++; rateLimited >= maxRateLimited {
+				logger.Warn.Printf("Multiplexed connection closed, rate limit reached: PlayerID=%s", session.playerID)
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, api.ErrRateLimited),
+					time.Now().Add(time.Second))
+				break
+			}
+			session.sendJSON(ErrorMessage{
+				Type:         "error",
+				GameID:       message.GameID,
+				Code:         ErrCodeRateLimited,
+				Message:      api.ErrRateLimited,
+				RetryAfterMs: wait.Milliseconds(),
+			})
+			continue
+		}
+		rateLimited = 0
+
+		switch message.Type {
+		case MessageSubscribe:
+			session.subscribe(message)
+		case MessageUnsubscribe:
+			session.unsubscribe(message.GameID)
+		case MessageAck:
+			session.ack(message)
+		case MessageHost:
+			session.host(message)
+		case MessageGameState, MessageEndGame, MessagePause, MessageResume:
+			session.applyHost(message)
+		default:
+			session.sendError(message.GameID, ErrCodeUnknownMessage, api.ErrUnknownMessageType+": "+message.Type)
+		}
+	}
+}
+
+// subscribe starts following a game.
+func (s *muxSession) subscribe(message MuxMessage) {
+	gameID := message.GameID
+	if gameID == "" || message.Window < 0 {
+		s.sendError(gameID, ErrCodeInvalidSubscription, api.ErrInvalidSubscription)
+		return
+	}
+	s.mutex.Lock()
+	_, subscribed := s.subscriptions[gameID]
+	count := len(s.subscriptions)
+	s.mutex.Unlock()
+	if subscribed {
+		s.sendError(gameID, ErrCodeAlreadySubscribed, api.ErrAlreadySubscribed)
+		return
+	}
+	if count >= maxSubscriptions {
+		s.sendError(gameID, ErrCodeTooManySubscriptions, api.ErrTooManySubscriptions)
+		return
+	}
+
+	h := s.handler
+	// Subscribe before reading the current state, so that no update is missed in between
+	messages, err := h.gameManager.Broadcaster().Subscribe(s.ctx, game.GameTopic(gameID))
+	if err != nil {
+		s.sendError(gameID, ErrCodeBroadcastUnavailable, api.ErrBroadcastUnavailable)
+		return
+	}
+	initialState, err := h.gameManager.CurrentState(s.ctx, gameID)
+	if err != nil {
+		messages.Close()
+		if errors.Is(err, broadcast.ErrNoSnapshot) {
+			s.sendError(gameID, ErrCodeGameNotFound, api.ErrGameNotFound)
+		} else {
+			s.sendError(gameID, ErrCodeBroadcastUnavailable, api.ErrBroadcastUnavailable)
+		}
+		return
+	}
+	// gameObj is nil when the game is owned by another instance
+	gameObj, _ := h.gameManager.GetGame(gameID)
+
+	// Seats are checked by the instance holding the game, like on /viewGame
+	viewerJoined := map[string]string{
+		"type": "viewerJoined",
+	}
+	if message.PlayerToken != "" && gameObj != nil {
+		if err := h.gameManager.CheckPlayerSeat(gameObj, s.playerID, message.PlayerToken); err != nil {
+			messages.Close()
+			s.sendError(gameID, ErrCodeInvalidPlayerToken, api.ErrInvalidPlayerToken)
+			return
+		}
+		viewerJoined["playerId"] = s.playerID
+	}
+
+	subscription := &muxSubscription{
+		gameID:   gameID,
+		messages: messages,
+		gameObj:  gameObj,
+		window:   message.Window,
+		credits:  message.Window,
+		done:     make(chan struct{}),
+	}
+	s.mutex.Lock()
+	s.subscriptions[gameID] = subscription
+	s.mutex.Unlock()
+
+	s.sendJSON(SubscriptionMessage{Type: "subscribed", GameID: gameID, Window: message.Window})
+	s.sendGame(gameID, initialState)
+	if err := h.gameManager.PublishToHost(s.ctx, gameID, viewerJoined); err != nil {
+		logger.Warn.Printf("Unable to notify host of new viewer: %v", err)
+	}
+
+	viewerCount := 0
+	if gameObj != nil {
+		gameObj.Mutex.Lock()
+		gameObj.LastActivity = time.Now()
+		gameObj.Viewers = append(gameObj.Viewers, s.conn)
+		viewerCount = len(gameObj.Viewers)
+		gameObj.Mutex.Unlock()
+	}
+	h.gameManager.Emit(game.EventViewerJoined, gameID, map[string]interface{}{
+		"localViewers": viewerCount,
+	})
+	logger.Info.Printf("Game followed on a multiplexed connection: GameID=%s (local viewers: %d)", gameID, viewerCount)
+
+	s.forwarding.Add(1)
+	go func() {
+		defer s.forwarding.Done()
+		s.forward(subscription)
+	}()
+}
+
+// unsubscribe stops following a game. No message of the game is sent after the
+// unsubscribed message.
+func (s *muxSession) unsubscribe(gameID string) {
+	s.mutex.Lock()
+	subscription, exists := s.subscriptions[gameID]
+	delete(s.subscriptions, gameID)
+	s.mutex.Unlock()
+	if !exists {
+		s.sendError(gameID, ErrCodeNotSubscribed, api.ErrNotSubscribed)
+		return
+	}
+
+	subscription.messages.Close()
+	<-subscription.done
+	s.detach(subscription)
+	s.sendJSON(SubscriptionMessage{Type: "unsubscribed", GameID: gameID})
+}
+
+// ack acknowledges messages of a subscription, sending the messages held back within
+// the window.
+func (s *muxSession) ack(message MuxMessage) {
+	s.mutex.Lock()
+	subscription, exists := s.subscriptions[message.GameID]
+	s.mutex.Unlock()
+	if !exists {
+		s.sendError(message.GameID, ErrCodeNotSubscribed, api.ErrNotSubscribed)
+		return
+	}
+	count := message.Count
+	if count <= 0 {
+		count = 1
+	}
+
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	if subscription.window == 0 {
+		return
+	}
+	subscription.credits += count
+	if subscription.credits > subscription.window {
+		subscription.credits = subscription.window
+	}
+	for subscription.credits > 0 && len(subscription.pending) > 0 {
+		s.sendGame(subscription.gameID, subscription.pending[0].data)
+		subscription.pending = subscription.pending[1:]
+		subscription.credits--
+	}
+}
+
+// forward writes the messages of a subscription until the game is removed or the
+// subscription ends.
+func (s *muxSession) forward(subscription *muxSubscription) {
+	defer close(subscription.done)
+	for data := range subscription.messages.Messages() {
+		if game.IsGameRemoved(data) {
+			s.flush(subscription, data)
+			s.end(subscription, reasonGameRemoved)
+			return
+		}
+		if !s.deliver(subscription, data) {
+			logger.Warn.Printf("Subscription ended, too many messages held back: GameID=%s", subscription.gameID)
+			s.end(subscription, reasonSlowSubscriber)
+			return
+		}
+	}
+
+	if err := subscription.messages.Err(); err != nil {
+		logger.Warn.Printf("Subscription ended (GameID=%s): %v", subscription.gameID, err)
+		reason := reasonBroadcastUnavailable
+		if errors.Is(err, broadcast.ErrSlowSubscriber) {
+			reason = reasonSlowSubscriber
+		}
+		s.end(subscription, reason)
+	}
+}
+
+// deliver sends a message of a subscription, or holds it back when the window is used
+// up. It returns false when the subscription holds back too many messages.
+func (s *muxSession) deliver(subscription *muxSubscription, data []byte) bool {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	if subscription.window == 0 || subscription.credits > 0 {
+		if subscription.window > 0 {
+			subscription.credits--
+		}
+		s.sendGame(subscription.gameID, data)
+		return true
+	}
+
+	// A new game state replaces the states held back
+	held := pendingMessage{data: data, state: isGameState(data)}
+	if held.state {
+		kept := subscription.pending[:0]
+		for _, pending := range subscription.pending {
+			if !pending.state {
+				kept = append(kept, pending)
+			}
+		}
+		subscription.pending = kept
+	}
+	subscription.pending = append(subscription.pending, held)
+	return len(subscription.pending) <= maxPending
+}
+
+// flush sends the messages held back by a subscription and a last message, whatever
+// the window.
+func (s *muxSession) flush(subscription *muxSubscription, data []byte) {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	for _, pending := range subscription.pending {
+		s.sendGame(subscription.gameID, pending.data)
+	}
+	subscription.pending = nil
+	s.sendGame(subscription.gameID, data)
+}
+
+// end drops a subscription that ended on its own, and tells the client why, unless the
+// client unsubscribed meanwhile.
+func (s *muxSession) end(subscription *muxSubscription, reason string) {
+	s.mutex.Lock()
+	current := s.subscriptions[subscription.gameID] == subscription
+	if current {
+		delete(s.subscriptions, subscription.gameID)
+	}
+	s.mutex.Unlock()
+	if !current {
+		return
+	}
+
+	subscription.messages.Close()
+	s.detach(subscription)
+	s.sendJSON(SubscriptionMessage{Type: "subscriptionEnded", GameID: subscription.gameID, Reason: reason})
+}
+
+// detach removes the connection from the viewers of the game of a subscription.
+func (s *muxSession) detach(subscription *muxSubscription) {
+	gameObj := subscription.gameObj
+	if gameObj == nil {
+		return
+	}
+	gameObj.Mutex.Lock()
+	for i, v := range gameObj.Viewers {
+		if v == s.conn {
+			gameObj.Viewers = append(gameObj.Viewers[:i], gameObj.Viewers[i+1:]...)
+			break
+		}
+	}
+	gameObj.LastActivity = time.Now()
+	gameObj.Mutex.Unlock()
+}
+
+// host opens the host session of a game on the connection.
+func (s *muxSession) host(message MuxMessage) {
+	h := s.handler
+	gameID := message.GameID
+	s.mutex.Lock()
+	hosting := s.hosted != nil
+	s.mutex.Unlock()
+	if hosting {
+		s.sendError(gameID, ErrCodeAlreadyHosting, api.ErrAlreadyHosting)
+		return
+	}
+	gameObj, err := h.gameManager.GetGame(gameID)
+	if err != nil {
+		s.sendError(gameID, ErrCodeGameNotFound, api.ErrGameNotFound)
+		return
+	}
+	if s.playerID == "" || gameObj.HostPlayerID != s.playerID {
+		s.sendError(gameID, ErrCodeInvalidHostID, api.ErrInvalidHostID)
+		return
+	}
+
+	connectCtx, connectSpan := tracing.Tracer().Start(s.ctx, "Multiplex.host",
+		trace.WithAttributes(tracing.AttrGameID.String(gameID), tracing.AttrHostID.String(s.playerID)))
+
+	session, err := h.gameManager.ConnectHost(gameObj, s.conn, message.ResumeToken)
+	if err == nil {
+		s.mutex.Lock()
+		s.hosted = gameObj
+		s.hostGeneration = session.Generation
+		s.connectLink = trace.LinkFromContext(connectCtx)
+		s.mutex.Unlock()
+	}
+	if err != nil {
+		appErr := hostSeatError(err)
+		endSpanWithError(connectSpan, appErr.Message)
+		s.sendError(gameID, hostSeatCode(err), appErr.Message)
+		return
+	}
+	if session.Replaced != nil {
+		h.closeReplacedHost(gameObj, session.Replaced)
+	}
+
+	s.sendGameJSON(gameID, SessionMessage{
+		Type:          "hostSession",
+		ResumeToken:   session.ResumeToken,
+		GracePeriodMs: h.gameManager.HostGracePeriod().Milliseconds(),
+	})
+
+	// Messages for the host (viewerJoined) may come from viewers of any instance
+	hostMessages, err := h.gameManager.Broadcaster().Subscribe(connectCtx, game.HostTopic(gameID))
+	if err != nil {
+		logger.Warn.Printf("Host will not be notified of viewers (GameID=%s): %v", gameID, err)
+	} else {
+		s.mutex.Lock()
+		s.hostMessages = hostMessages
+		s.mutex.Unlock()
+		s.forwarding.Add(1)
+		go func() {
+			defer s.forwarding.Done()
+			for data := range hostMessages.Messages() {
+				s.sendGame(gameID, data)
+			}
+		}()
+	}
+
+	h.announceHost(connectCtx, gameObj, session)
+	logger.Info.Printf("Host connected on a multiplexed connection: GameID=%s, HostID=%s", gameID, s.playerID)
+	connectSpan.End()
+}
+
+// applyHost applies a host message to the hosted game.
+func (s *muxSession) applyHost(message MuxMessage) {
+	s.mutex.Lock()
+	gameObj, generation, connectLink := s.hosted, s.hostGeneration, s.connectLink
+	s.mutex.Unlock()
+	if gameObj == nil || gameObj.GameID != message.GameID {
+		s.sendError(message.GameID, ErrCodeNotHosting, api.ErrNotHosting)
+		return
+	}
+	if !s.handler.gameManager.IsCurrentHost(gameObj, generation) {
+		logger.Info.Printf("Message of a replaced host connection dropped: GameID=%s", gameObj.GameID)
+		return
+	}
+
+	hostMessage := message.HostMessage
+	hostMessage.Type = message.Type
+	reply, current := s.handler.applyHostMessage(s.ctx, connectLink, gameObj, generation, hostMessage)
+	if current && reply != nil {
+		s.sendGameJSON(gameObj.GameID, reply)
+	}
+}
+
+// close ends the subscriptions and the host session of the connection.
+func (s *muxSession) close() {
+	// Writes fail from now on, so that no forwarding stays blocked on the connection
+	s.conn.Close()
+
+	s.mutex.Lock()
+	subscriptions := s.subscriptions
+	s.subscriptions = nil
+	hosted, generation, hostMessages := s.hosted, s.hostGeneration, s.hostMessages
+	s.mutex.Unlock()
+
+	for _, subscription := range subscriptions {
+		subscription.messages.Close()
+		s.detach(subscription)
+	}
+	if hostMessages != nil {
+		hostMessages.Close()
+	}
+	s.forwarding.Wait()
+	s.handler.writeLocks.Delete(s.conn)
+	if hosted != nil {
+		s.handler.disconnectHost(hosted, generation)
+	}
+	logger.Debug.Printf("Multiplexed connection ended: PlayerID=%s, %d games followed", s.playerID, len(subscriptions))
+}
+
+// sendGame writes a message of the broadcaster for a game, tagged with its game ID.
+func (s *muxSession) sendGame(gameID string, data []byte) {
+	s.send(func() error {
+		return writeGameMessage(s.conn, gameID, data)
+	})
+}
+
+// sendGameJSON writes a message for the host of a game, tagged with its game ID.
+func (s *muxSession) sendGameJSON(gameID string, message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		logger.Warn.Printf("Cannot encode a message of game %s: %v", gameID, err)
+		return
+	}
+	s.sendJSON(GameMessage{
+		Type:    "gameMessage",
+		GameID:  gameID,
+		Message: data,
+	})
+}
+
+// sendError writes the error refusing a command about a game.
+func (s *muxSession) sendError(gameID, code, message string) {
+	s.sendJSON(ErrorMessage{
+		Type:    "error",
+		GameID:  gameID,
+		Code:    code,
+		Message: message,
+	})
+}
+
+// sendJSON writes a message.
+func (s *muxSession) sendJSON(message interface{}) {
+	s.send(func() error {
+		return writeMessage(s.conn, message)
+	})
+}
+
+// send makes a write. Writes are serialized with the other writes of the connection,
+// including those of the connection taking the host session over.
+func (s *muxSession) send(write func() error) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	if err := write(); err != nil {
+		logger.Debug.Printf("Error sending on multiplexed connection (PlayerID=%s): %v", s.playerID, err)
+		s.conn.Close()
+	}
+}
+
+// hostSeatCode returns the error code refusing a host session on a multiplexed connection.
+func hostSeatCode(err error) string {
+	switch {
+	case errors.Is(err, game.ErrGameAbandoned):
+		return ErrCodeGameAbandoned
+	case errors.Is(err, game.ErrInvalidResumeToken):
+		return ErrCodeInvalidResumeToken
+	case errors.Is(err, game.ErrHostAlreadyConnected):
+		return ErrCodeHostAlreadyConnected
+	}
+	return ErrCodeInternal
+}
+
+// isGameState reports whether a message of a game topic carries a game state.
+func isGameState(data []byte) bool {
+	var message struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(data, &message) == nil && message.Type == "gameState"
+}
@@ -0,0 +1,245 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/api"
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
+	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/logger"
+	"github.com/vincentvignali/yamsAttackSocket/internal/tournament"
+)
+
+/*
+Tournament Viewers
+
+This file implements the tournament viewer socket. A tournament viewer first receives a
+tournament message with the state of the tournament, then a new one at each change (a
+game over, a round started, the tournament finished). It also follows every game of the
+tournament on the same connection: each message a viewer of the game would receive,
+starting with its current state, is sent in a gameMessage message carrying the game ID.
+The games of a new round are followed once the tournament message announcing them is
+sent. Like viewers, tournament viewers are not expected to talk: a flooding client is
+disconnected.
+*/
+
+// ViewTournament returns the handler of the tournament viewer socket.
+func (h *GameWSHandler) ViewTournament(tournaments *tournament.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tournamentID := r.URL.Query().Get("tournamentId")
+		if tournamentID == "" {
+			api.HandleError(w, &api.AppError{
+				Code:    http.StatusBadRequest,
+				Message: api.ErrMissingParam + ": tournamentId",
+			})
+			return
+		}
+
+		// Subscribe before reading the current state, so that no change is missed in between
+		updates, err := h.gameManager.Broadcaster().Subscribe(r.Context(), tournament.Topic(tournamentID))
+		if err != nil {
+			api.HandleError(w, &api.AppError{
+				Code:    http.StatusServiceUnavailable,
+				Message: api.ErrBroadcastUnavailable,
+				Err:     err,
+			})
+			return
+		}
+		defer updates.Close()
+
+		current, err := tournaments.Current(r.Context(), tournamentID)
+		if errors.Is(err, tournament.ErrNotFound) {
+			api.HandleError(w, &api.AppError{
+				Code:    http.StatusNotFound,
+				Message: api.ErrTournamentNotFound,
+			})
+			return
+		}
+		if err != nil {
+			api.HandleError(w, &api.AppError{
+				Code:    http.StatusServiceUnavailable,
+				Message: api.ErrBroadcastUnavailable,
+				Err:     err,
+			})
+			return
+		}
+
+		conn, err := h.upgrade(w, r)
+		if err != nil {
+			api.HandleError(w, &api.AppError{
+				Code:    http.StatusInternalServerError,
+				Message: api.ErrWebSocketUpgrade,
+				Err:     err,
+			})
+			return
+		}
+		defer conn.Close()
+		h.gameManager.UpdateOpenConnections(1)
+		defer h.gameManager.UpdateOpenConnections(-1)
+		if h.config.MaxMessageSize > 0 {
+			conn.SetReadLimit(h.config.MaxMessageSize)
+		}
+
+		viewer := &tournamentViewer{
+			conn:        conn,
+			gameManager: h.gameManager,
+			games:       make(map[string]*broadcast.Subscription),
+		}
+		defer viewer.close()
+		if !viewer.send(current) {
+			return
+		}
+		logger.Info.Printf("New tournament viewer connected: TournamentID=%s", tournamentID)
+		viewer.follow(r.Context(), current)
+
+		forwardDone := make(chan struct{})
+		go func() {
+			defer close(forwardDone)
+			viewer.forwardTournament(r.Context(), updates, tournamentID)
+		}()
+
+		messageBucket := api.NewTokenBucket(h.config.MessageLimit)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				logger.Debug.Printf("Tournament viewer disconnected: TournamentID=%s, Error: %v", tournamentID, err)
+				break
+			}
+			if allowed, _ := messageBucket.Allow(); !allowed {
+				logger.Warn.Printf("Tournament viewer disconnected, rate limit reached: TournamentID=%s", tournamentID)
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, api.ErrRateLimited),
+					time.Now().Add(time.Second))
+				break
+			}
+		}
+
+		updates.Close()
+		<-forwardDone
+	}
+}
+
+// forwardTournament writes the changes of the tournament until the subscription ends,
+// following the games of the new rounds.
+func (v *tournamentViewer) forwardTournament(ctx context.Context, updates *broadcast.Subscription, tournamentID string) {
+	for data := range updates.Messages() {
+		if !v.send(data) {
+			return
+		}
+		if tournament.IsTournamentRemoved(data) {
+			v.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "tournament removed"),
+				time.Now().Add(time.Second))
+			v.conn.Close()
+			return
+		}
+		v.follow(ctx, data)
+	}
+
+	if err := updates.Err(); err != nil {
+		logger.Warn.Printf("Tournament viewer disconnected (TournamentID=%s): %v", tournamentID, err)
+		v.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, err.Error()),
+			time.Now().Add(time.Second))
+		v.conn.Close()
+	}
+}
+
+// follow starts forwarding the games of a tournament message not followed yet. It is
+// called by one goroutine at a time.
+func (v *tournamentViewer) follow(ctx context.Context, data []byte) {
+	var message tournament.Message
+	if err := json.Unmarshal(data, &message); err != nil {
+		logger.Warn.Printf("Invalid tournament message received: %v", err)
+		return
+	}
+
+	for _, match := range message.Tournament.Matches {
+		gameID := match.GameID
+		if _, followed := v.games[gameID]; followed || gameID == "" {
+			continue
+		}
+		messages, err := v.gameManager.Broadcaster().Subscribe(ctx, game.GameTopic(gameID))
+		if err != nil {
+			logger.Warn.Printf("Tournament viewer cannot follow game %s: %v", gameID, err)
+			continue
+		}
+		v.games[gameID] = messages
+		// A game already removed has nothing left to show
+		state, err := v.gameManager.CurrentState(ctx, gameID)
+		if err != nil {
+			messages.Close()
+			continue
+		}
+		if !v.sendGame(gameID, state) {
+			return
+		}
+
+		v.forwarding.Add(1)
+		go func() {
+			defer v.forwarding.Done()
+			v.forwardGame(gameID, messages)
+		}()
+	}
+}
+
+// forwardGame writes the messages of a game until the game is removed or the
+// subscription ends.
+func (v *tournamentViewer) forwardGame(gameID string, messages *broadcast.Subscription) {
+	for data := range messages.Messages() {
+		if !v.sendGame(gameID, data) {
+			return
+		}
+		if game.IsGameRemoved(data) {
+			messages.Close()
+			return
+		}
+	}
+
+	if err := messages.Err(); err != nil {
+		logger.Warn.Printf("Tournament viewer disconnected (GameID=%s): %v", gameID, err)
+		v.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, err.Error()),
+			time.Now().Add(time.Second))
+		v.conn.Close()
+	}
+}
+
+// sendGame writes a message of a game, tagged with its game ID.
+func (v *tournamentViewer) sendGame(gameID string, data []byte) bool {
+	return v.write(func() error {
+		return writeGameMessage(v.conn, gameID, data)
+	})
+}
+
+// send writes a message of the tournament.
+func (v *tournamentViewer) send(data []byte) bool {
+	return v.write(func() error {
+		return writeBroadcast(v.conn, data)
+	})
+}
+
+// write makes a write, closing the connection when it fails.
+func (v *tournamentViewer) write(write func() error) bool {
+	v.writeMutex.Lock()
+	defer v.writeMutex.Unlock()
+	if err := write(); err != nil {
+		logger.Debug.Printf("Error sending to tournament viewer: %v", err)
+		v.conn.Close()
+		return false
+	}
+	return true
+}
+
+// close ends the subscriptions of the games and waits for their forwarding to stop.
+func (v *tournamentViewer) close() {
+	for _, messages := range v.games {
+		messages.Close()
+	}
+	v.forwarding.Wait()
+}
@@ -1,17 +1,370 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/vincentvignali/yamsAttackSocket/internal/api"
+	"github.com/vincentvignali/yamsAttackSocket/internal/broadcast"
 	"github.com/vincentvignali/yamsAttackSocket/internal/game"
+	"github.com/vincentvignali/yamsAttackSocket/internal/lobby"
+)
+
+const (
+	// ErrCodeRateLimited is sent to a host whose message was dropped by the rate limiter
+	ErrCodeRateLimited = "rateLimited"
+	// ErrCodeSchemaViolation is sent to a host whose game state does not match the game schema
+	ErrCodeSchemaViolation = "schemaViolation"
+	// ErrCodeGameFinished is sent to a host updating or ending a game already finished
+	ErrCodeGameFinished = "gameFinished"
+	// ErrCodeInvalidResults is sent to a host ending its game with final scores that cannot be ranked
+	ErrCodeInvalidResults = "invalidResults"
+	// ErrCodeGamePaused is sent to a host updating or pausing a paused game
+	ErrCodeGamePaused = "gamePaused"
+	// ErrCodeGameNotPaused is sent to a host resuming a game that is not paused
+	ErrCodeGameNotPaused = "gameNotPaused"
+	// ErrCodeInvalidPause is sent to a host pausing with an invalid reason or duration
+	ErrCodeInvalidPause = "invalidPause"
+	// ErrCodeUnknownMessage is sent to a host sending a message of an unknown type
+	ErrCodeUnknownMessage = "unknownMessageType"
+	// ErrCodeGameAbandoned is sent to a host acting on a game abandoned after the grace period
+	ErrCodeGameAbandoned = "gameAbandoned"
+	// ErrCodeInvalidQueue is sent to a lobby player queueing for an invalid number of players
+	ErrCodeInvalidQueue = "invalidQueueRequest"
+	// ErrCodeAlreadyQueued is sent to a lobby player queueing while already waiting for a match
+	ErrCodeAlreadyQueued = "alreadyQueued"
+	// ErrCodeNotQueued is sent to a lobby player cancelling without waiting for a match
+	ErrCodeNotQueued = "notQueued"
+	// ErrCodeGameNotFound is sent to a client following or hosting an unknown game
+	ErrCodeGameNotFound = "gameNotFound"
+	// ErrCodeBroadcastUnavailable is sent to a client following a game while the broadcast
+	// backbone is unavailable
+	ErrCodeBroadcastUnavailable = "broadcastUnavailable"
+	// ErrCodeInvalidPlayerToken is sent to a client following a game with a wrong seat token
+	ErrCodeInvalidPlayerToken = "invalidPlayerToken"
+	// ErrCodeInvalidSubscription is sent to a client following a game without its ID or
+	// with a negative window
+	ErrCodeInvalidSubscription = "invalidSubscription"
+	// ErrCodeAlreadySubscribed is sent to a client following a game twice
+	ErrCodeAlreadySubscribed = "alreadySubscribed"
+	// ErrCodeNotSubscribed is sent to a client unsubscribing from or acknowledging a game
+	// it does not follow
+	ErrCodeNotSubscribed = "notSubscribed"
+	// ErrCodeTooManySubscriptions is sent to a client following too many games
+	ErrCodeTooManySubscriptions = "tooManySubscriptions"
+	// ErrCodeInvalidHostID is sent to a client hosting a game of another player
+	ErrCodeInvalidHostID = "invalidHostId"
+	// ErrCodeInvalidResumeToken is sent to a client hosting a game without its resume token
+	ErrCodeInvalidResumeToken = "invalidResumeToken"
+	// ErrCodeHostAlreadyConnected is sent to a client hosting a game whose host is connected
+	ErrCodeHostAlreadyConnected = "hostAlreadyConnected"
+	// ErrCodeAlreadyHosting is sent to a client hosting a second game
+	ErrCodeAlreadyHosting = "alreadyHosting"
+	// ErrCodeNotHosting is sent to a client sending a host message for a game it does not host
+	ErrCodeNotHosting = "notHosting"
+	// ErrCodeInternal is sent to a client whose command failed on the server side
+	ErrCodeInternal = "internalError"
+)
+
+const (
+	// MessageGameState updates the game state; it is the default message type
+	MessageGameState = "gameState"
+	// MessageEndGame ends the game with the final scores
+	MessageEndGame = "endGame"
+	// MessagePause pauses the game, with an optional reason and expected duration
+	MessagePause = "pause"
+	// MessageResume resumes a paused game
+	MessageResume = "resume"
+)
+
+const (
+	// MessageQueue queues a lobby player for a game of Size players, with an optional Rating
+	MessageQueue = "queue"
+	// MessageCancel leaves the lobby queue
+	MessageCancel = "cancel"
 )
 
+const (
+	// MessageSubscribe follows a game on a multiplexed connection
+	MessageSubscribe = "subscribe"
+	// MessageUnsubscribe stops following a game
+	MessageUnsubscribe = "unsubscribe"
+	// MessageAck acknowledges messages of a subscription with a window
+	MessageAck = "ack"
+	// MessageHost opens the host session of a game on a multiplexed connection
+	MessageHost = "host"
+)
+
+// Config holds the GameWSHandler settings
+type Config struct {
+	ReadBufferSize  int
+	WriteBufferSize int
+	// CheckOrigin validates the Origin of upgrade requests; nil accepts every origin
+	CheckOrigin func(r *http.Request) bool
+	// MessageLimit bounds the messages accepted on each connection; a zero rate disables it
+	MessageLimit api.RateLimit
+	// MaxMessageSize is the maximum size in bytes of an inbound message; 0 means unlimited.
+	// A connection sending a larger message is closed with a "message too big" status.
+	MaxMessageSize int64
+	// Compression negotiates permessage-deflate with the clients offering it
+	Compression bool
+	// CompressionLevel is the deflate level, from -2 (Huffman only) to 9 (best compression)
+	CompressionLevel int
+	// CompressionThreshold is the size in bytes below which messages are not compressed
+	CompressionThreshold int
+	// WriteTimeout bounds each write of a message; 0 means unlimited. A write that times
+	// out breaks the connection, which a client not reading its messages no longer blocks.
+	WriteTimeout time.Duration
+}
+
 type GameWSHandler struct {
 	gameManager *game.GameManager
+	config      Config
 	upgrader    websocket.Upgrader
+	// compressedMessages, uncompressedBytes and bytesSaved measure the compression
+	compressedMessages atomic.Int64
+	uncompressedBytes  atomic.Int64
+	bytesSaved         atomic.Int64
+	// writeLocks holds the write lock of each connection that may host a game, by
+	// connection, so that the connection taking the host session over writes to the
+	// replaced one without racing with its writes
+	writeLocks sync.Map
 }
 
 type HostMessage struct {
+	// Type is MessageGameState (or empty), MessageEndGame, MessagePause or MessageResume
+	Type      string          `json:"type,omitempty"`
 	GameState json.RawMessage `json:"gameState"`
-}
\ No newline at end of file
+	// FinalScores are the scores of the players, for MessageEndGame
+	FinalScores []game.FinalScore `json:"finalScores,omitempty"`
+	// Reason and ExpectedDurationMs optionally describe a pause, for MessagePause
+	Reason             string `json:"reason,omitempty"`
+	ExpectedDurationMs int64  `json:"expectedDurationMs,omitempty"`
+}
+
+// SessionMessage is the first message sent to a host connection. The host must present
+// ResumeToken to reconnect, within GracePeriodMs of a disconnection.
+type SessionMessage struct {
+	Type          string `json:"type"`
+	ResumeToken   string `json:"resumeToken"`
+	GracePeriodMs int64  `json:"gracePeriodMs"`
+}
+
+// HostDisconnectedMessage tells the viewers that the host left. GracePeriodMs and
+// ReconnectDeadline are set when the game is abandoned if the host misses the deadline.
+type HostDisconnectedMessage struct {
+	Type              string     `json:"type"`
+	Message           string     `json:"message"`
+	GracePeriodMs     int64      `json:"gracePeriodMs,omitempty"`
+	ReconnectDeadline *time.Time `json:"reconnectDeadline,omitempty"`
+}
+
+// ErrorMessage reports a rejected message to the client
+type ErrorMessage struct {
+	Type string `json:"type"`
+	// GameID is the game of the command refused, on a multiplexed connection
+	GameID       string                 `json:"gameId,omitempty"`
+	Code         string                 `json:"code"`
+	Message      string                 `json:"message"`
+	RetryAfterMs int64                  `json:"retryAfterMs,omitempty"`
+	Violations   []game.SchemaViolation `json:"violations,omitempty"`
+}
+
+// LobbyMessage is a message of a lobby player
+type LobbyMessage struct {
+	// Type is MessageQueue or MessageCancel
+	Type string `json:"type"`
+	// Size is the number of players of the game wanted, for MessageQueue
+	Size int `json:"size,omitempty"`
+	// Rating is the optional skill rating of the player, for MessageQueue
+	Rating *int `json:"rating,omitempty"`
+}
+
+// QueuedMessage confirms that a lobby player waits for a match
+type QueuedMessage struct {
+	Type      string    `json:"type"`
+	Size      int       `json:"size"`
+	QueuedAt  time.Time `json:"queuedAt"`
+	TimeoutMs int64     `json:"timeoutMs"`
+}
+
+// MatchFoundMessage tells a lobby player the game created for its match. The host
+// connects to it with PlayerToken as resume token, the other players join it as viewers
+// with their PlayerToken.
+type MatchFoundMessage struct {
+	Type         string   `json:"type"`
+	GameID       string   `json:"gameId"`
+	HostPlayerID string   `json:"hostPlayerId"`
+	Players      []string `json:"players"`
+	Host         bool     `json:"host"`
+	PlayerToken  string   `json:"playerToken"`
+}
+
+// lobbySession is the connection of a lobby player
+type lobbySession struct {
+	conn     *websocket.Conn
+	lobby    *lobby.Lobby
+	playerID string
+	// ticket is the place of the player in the queue, nil when not queued
+	ticket *lobby.Ticket
+	// stopWaiting ends the wait for the outcome of the ticket
+	stopWaiting chan struct{}
+	waiting     sync.WaitGroup
+	// writeMutex serializes the writes of the replies and the outcomes
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+}
+
+// GameMessage carries a message of a game on a connection following several games, tagged
+// with its game ID
+type GameMessage struct {
+	Type    string          `json:"type"`
+	GameID  string          `json:"gameId"`
+	Message json.RawMessage `json:"message"`
+}
+
+// tournamentViewer is a connection following a tournament and the games of its rounds
+type tournamentViewer struct {
+	conn        *websocket.Conn
+	gameManager *game.GameManager
+	// games holds the subscription of each game followed
+	games map[string]*broadcast.Subscription
+	// forwarding counts the goroutines forwarding the game messages
+	forwarding sync.WaitGroup
+	// writeMutex serializes the writes of the tournament and game messages
+	writeMutex sync.Mutex
+}
+
+// MuxMessage is a message of a client of the multiplexed socket
+type MuxMessage struct {
+	// Type is MessageSubscribe, MessageUnsubscribe, MessageAck, MessageHost, or a host
+	// message type other than the default one for the hosted game
+	Type   string `json:"type"`
+	GameID string `json:"gameId"`
+	// PlayerToken is the seat token of the player, for MessageSubscribe
+	PlayerToken string `json:"playerToken,omitempty"`
+	// Window is the number of messages sent ahead of the acknowledgements, for
+	// MessageSubscribe; 0 means no limit
+	Window int `json:"window,omitempty"`
+	// Count is the number of messages acknowledged, for MessageAck; 0 means 1
+	Count int `json:"count,omitempty"`
+	// ResumeToken is the resume token of the host session, for MessageHost
+	ResumeToken string `json:"resumeToken,omitempty"`
+	// HostMessage holds the fields of the host messages; its Type is ignored
+	HostMessage
+}
+
+// SubscriptionMessage reports a change of a subscription of a multiplexed connection
+type SubscriptionMessage struct {
+	// Type is subscribed, unsubscribed or subscriptionEnded
+	Type   string `json:"type"`
+	GameID string `json:"gameId"`
+	Window int    `json:"window,omitempty"`
+	// Reason tells why a subscription ended: gameRemoved, slowSubscriber or
+	// broadcastUnavailable
+	Reason string `json:"reason,omitempty"`
+}
+
+// muxSession is a connection of the multiplexed socket
+type muxSession struct {
+	handler  *GameWSHandler
+	conn     *websocket.Conn
+	ctx      context.Context
+	playerID string
+	// subscriptions holds the games followed, by game ID
+	subscriptions map[string]*muxSubscription
+	// hosted is the game hosted on the connection, nil when none
+	hosted         *game.Game
+	hostGeneration uint64
+	hostMessages   *broadcast.Subscription
+	// connectLink links the updates of the hosted game to the span of its connection
+	connectLink trace.Link
+	// forwarding counts the goroutines forwarding the messages of the games
+	forwarding sync.WaitGroup
+	// writeMutex serializes the writes of the connection; it is its write lock
+	writeMutex *sync.Mutex
+	mutex      sync.Mutex
+}
+
+// muxSubscription is a game followed on a multiplexed connection
+type muxSubscription struct {
+	gameID   string
+	messages *broadcast.Subscription
+	// gameObj is the game when held by this instance, the connection being one of its viewers
+	gameObj *game.Game
+	// window is the number of messages sent ahead of the acknowledgements, 0 for no limit
+	window int
+	// credits is the number of messages that can be sent before the next acknowledgement
+	credits int
+	// pending holds the messages held back for lack of credits, oldest first
+	pending []pendingMessage
+	// done is closed once the forwarding of the messages stopped
+	done  chan struct{}
+	mutex sync.Mutex
+}
+
+// pendingMessage is a message of a game held back by the window of its subscription
+type pendingMessage struct {
+	data []byte
+	// state is set for the gameState messages, replaced by the next one
+	state bool
+}
+
+// meteredWriter is the response of an upgrade request, counting the bytes written to
+// its hijacked connection
+type meteredWriter struct {
+	http.ResponseWriter
+	handler *GameWSHandler
+	// compression is set when compression is enabled and the client offers permessage-deflate
+	compression bool
+}
+
+// meteredConn is the network connection of a WebSocket, counting the bytes written
+type meteredConn struct {
+	net.Conn
+	handler *GameWSHandler
+	// compression is set when permessage-deflate was negotiated
+	compression bool
+	written     atomic.Int64
+}
+
+// encodedCache holds the prepared conversions of the latest messages of the broadcaster,
+// by the address of their JSON slice
+type encodedCache struct {
+	entries map[*byte]*encodedMessage
+	// order holds the keys of the entries in a ring, the next one evicted at next
+	order []*byte
+	next  int
+	mutex sync.Mutex
+}
+
+// encodedMessage is a message of the broadcaster with its prepared conversions
+type encodedMessage struct {
+	// data is the JSON message, kept so that its address is not reused while cached
+	data     []byte
+	prepared map[encodedVariant]preparedMessage
+	mutex    sync.Mutex
+}
+
+// preparedMessage is a conversion of a message of the broadcaster, prepared for every
+// connection using its encoding
+type preparedMessage struct {
+	message *websocket.PreparedMessage
+	// size is the size of the message in its encoding, before compression
+	size int
+}
+
+// encodedVariant is a conversion of a message: an encoding, and the game ID of the
+// gameMessage message wrapping it, empty when not wrapped
+type encodedVariant struct {
+	gameID   string
+	encoding Encoding
+}